@@ -0,0 +1,58 @@
+// Package email delivers domain.Email messages over SMTP, to a file or to
+// the log.
+package email
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go-back/internal/domain"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidMessage = errors.New("email: invalid message")
+
+// Format renders msg as an RFC 5322 message with a quoted-printable UTF-8
+// body. Addresses are parsed and headers are encoded, so user provided
+// values cannot inject headers.
+func Format(from string, msg domain.Email, date time.Time) ([]byte, error) {
+	fromAddr, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("%w: from: %w", ErrInvalidMessage, err)
+	}
+	toAddr, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return nil, fmt.Errorf("%w: to: %w", ErrInvalidMessage, err)
+	}
+	if strings.ContainsAny(msg.Subject, "\r\n") {
+		return nil, fmt.Errorf("%w: subject has a line break", ErrInvalidMessage)
+	}
+
+	domainPart := fromAddr.Address[strings.LastIndex(fromAddr.Address, "@")+1:]
+
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+	header("From", fromAddr.String())
+	header("To", toAddr.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("Message-ID", "<"+uuid.NewString()+"@"+domainPart+">")
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+
+	body := quotedprintable.NewWriter(&buf)
+	body.Write([]byte(strings.ReplaceAll(msg.Body, "\n", "\r\n")))
+	body.Close()
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,135 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"go-back/internal/domain"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testMessage = domain.Email{To: "john@example.com", Subject: "Confirme seu email", Body: "Olá John,\nsee https://example.com/verify?token=abc\n"}
+
+func TestFormat(t *testing.T) {
+	raw, err := Format("Go Project <no-reply@example.com>", testMessage, time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	message := string(raw)
+	for _, expected := range []string{
+		"From: \"Go Project\" <no-reply@example.com>\r\n",
+		"To: <john@example.com>\r\n",
+		"Subject: Confirme seu email\r\n",
+		"Date: Mon, 06 May 2024 07:08:09 +0000\r\n",
+		"Content-Type: text/plain; charset=utf-8\r\n",
+		"\r\n\r\nOl=C3=A1 John,\r\n",
+		"token=3Dabc",
+	} {
+		if !strings.Contains(message, expected) {
+			t.Errorf("expected message to contain %q, got:\n%s", expected, message)
+		}
+	}
+
+	for name, msg := range map[string]domain.Email{
+		"header injection in subject": {To: "john@example.com", Subject: "Hi\r\nBcc: all@example.com"},
+		"invalid recipient":           {To: "john@example.com\r\nBcc: all@example.com", Subject: "Hi"},
+	} {
+		if _, err := Format("no-reply@example.com", msg, time.Now()); !errors.Is(err, ErrInvalidMessage) {
+			t.Errorf("%s: expected ErrInvalidMessage, got %v", name, err)
+		}
+	}
+}
+
+func TestFileSender(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "emails.mbox")
+	sender := NewFileSender(path, "no-reply@example.com")
+
+	for i := 0; i < 2; i++ {
+		if err := sender.Send(context.Background(), testMessage); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	raw, _ := os.ReadFile(path)
+	if count := strings.Count(string(raw), "From john@example.com "); count != 2 {
+		t.Errorf("expected 2 messages in the file, got %d:\n%s", count, raw)
+	}
+}
+
+// serveSMTP accepts one connection and answers just enough of RFC 5321 for
+// net/smtp, returning what the client sent through the channels.
+func serveSMTP(t *testing.T, listener net.Listener, recipients chan<- string, data chan<- string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(command) {
+		case "EHLO", "HELO":
+			text.PrintfLine("250 localhost")
+		case "RCPT":
+			recipients <- arg
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			body, err := text.ReadDotBytes()
+			if err != nil {
+				t.Errorf("expected a message, got %v", err)
+				return
+			}
+			data <- string(body)
+			text.PrintfLine("250 OK")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("250 OK")
+		}
+	}
+}
+
+func TestSMTPSender(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer listener.Close()
+
+	recipients, data := make(chan string, 1), make(chan string, 1)
+	go serveSMTP(t, listener, recipients, data)
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	sender := NewSMTPSender(SMTPConfig{Host: host, Port: portNumber, From: "no-reply@example.com"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := sender.Send(ctx, testMessage); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if recipient := <-recipients; recipient != "TO:<john@example.com>" {
+		t.Errorf("expected the recipient to be john@example.com, got %q", recipient)
+	}
+	message, _ := textproto.NewReader(bufio.NewReader(strings.NewReader(<-data))).ReadMIMEHeader()
+	if message.Get("Subject") != testMessage.Subject {
+		t.Errorf("expected the subject to be delivered, got %v", message)
+	}
+}
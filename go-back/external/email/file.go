@@ -0,0 +1,47 @@
+package email
+
+import (
+	"context"
+	"go-back/internal/domain"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileSender appends every message to a file instead of delivering it,
+// separated by a "From " line as in mbox files. It is meant for
+// development and tests.
+type FileSender struct {
+	path string
+	from string
+	mu   sync.Mutex
+}
+
+func NewFileSender(path, from string) *FileSender {
+	return &FileSender{path: path, from: from}
+}
+
+func (s *FileSender) Send(ctx context.Context, msg domain.Email) error {
+	date := time.Now()
+	raw, err := Format(s.from, msg, date)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString("From " + msg.To + " " + date.UTC().Format(time.ANSIC) + "\n"); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Write(append(raw, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
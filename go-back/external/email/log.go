@@ -0,0 +1,23 @@
+package email
+
+import (
+	"context"
+	"go-back/internal/domain"
+	"log/slog"
+)
+
+// LogSender logs messages instead of delivering them. Bodies are logged at
+// debug level only, since they carry tokens.
+type LogSender struct {
+	logger *slog.Logger
+}
+
+func NewLogSender(logger *slog.Logger) *LogSender {
+	return &LogSender{logger: logger}
+}
+
+func (s *LogSender) Send(ctx context.Context, msg domain.Email) error {
+	s.logger.InfoContext(ctx, "email not delivered", "sender", "log", "to", msg.To, "subject", msg.Subject)
+	s.logger.DebugContext(ctx, "email body", "to", msg.To, "body", msg.Body)
+	return nil
+}
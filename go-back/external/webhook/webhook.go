@@ -0,0 +1,67 @@
+// Package webhook POSTs domain.WebhookEvent payloads to subscriber URLs,
+// signed as described by the Standard Webhooks specification.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"go-back/internal/domain"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Sender delivers each event with a single request. Subscribers verify it
+// came from us by recomputing Webhook-Signature with the shared secret.
+type Sender struct {
+	secret []byte
+	client *http.Client
+}
+
+func NewSender(secret string, timeout time.Duration) *Sender {
+	return &Sender{secret: []byte(secret), client: &http.Client{Timeout: timeout}}
+}
+
+// Send POSTs event to url as JSON. Any response but a 2xx is an error.
+func (s *Sender) Send(ctx context.Context, url string, event domain.WebhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Webhook-Id", event.ID)
+	req.Header.Set("Webhook-Timestamp", strconv.FormatInt(timestamp.Unix(), 10))
+	req.Header.Set("Webhook-Signature", "v1,"+Sign(s.secret, event.ID, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook: %s answered %s", url, resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the base64 HMAC-SHA256 of "id.timestamp.body" under secret.
+func Sign(secret []byte, id string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s.%d.", id, timestamp.Unix())
+	mac.Write(body)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,53 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"go-back/internal/domain"
+)
+
+func TestSender(t *testing.T) {
+	event := domain.WebhookEvent{
+		ID:         "msg_1",
+		Type:       domain.AuditUserCreated,
+		OccurredAt: time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC),
+		Data:       domain.User{UUID: "u1", Name: "John", Email: "john@example.com"},
+	}
+
+	status := http.StatusNoContent
+	var received domain.WebhookEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		unix, _ := strconv.ParseInt(r.Header.Get("Webhook-Timestamp"), 10, 64)
+		signature := "v1," + Sign([]byte("whsec"), r.Header.Get("Webhook-Id"), time.Unix(unix, 0), body)
+		if r.Method != http.MethodPost || r.Header.Get("Webhook-Id") != event.ID || r.Header.Get("Webhook-Signature") != signature {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		json.Unmarshal(body, &received)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	if err := NewSender("whsec", time.Second).Send(context.Background(), server.URL, event); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if received.ID != event.ID || received.Type != event.Type || received.Data.Email != event.Data.Email {
+		t.Errorf("expected the event to be received, got %+v", received)
+	}
+
+	if err := NewSender("other", time.Second).Send(context.Background(), server.URL, event); err == nil {
+		t.Errorf("expected an error for a rejected signature")
+	}
+	status = http.StatusInternalServerError
+	if err := NewSender("whsec", time.Second).Send(context.Background(), server.URL, event); err == nil {
+		t.Errorf("expected an error for a 5xx response")
+	}
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"crypto/rand"
+	"strings"
+)
+
+// apiKeyPrefix starts every API key, so leaked keys are easy to spot in
+// logs and by secret scanners.
+const apiKeyPrefix = "gbk"
+
+// NewAPIKey returns a random API key of the form gbk_<prefix>_<secret>,
+// its prefix, which is stored to look the key up, and the hash of its
+// secret, stored in place of the secret. The prefix carries 40 bits and
+// the secret 256.
+func NewAPIKey() (key, prefix, hash string, err error) {
+	raw := make([]byte, 5)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", "", err
+	}
+	prefix = strings.ToLower(recoveryEncoding.EncodeToString(raw))
+
+	secret, hash, err := NewOpaqueToken()
+	if err != nil {
+		return "", "", "", err
+	}
+	return apiKeyPrefix + "_" + prefix + "_" + secret, prefix, hash, nil
+}
+
+// ParseAPIKey splits key into its prefix and the hash of its secret. ok is
+// false for strings that are not API keys.
+func ParseAPIKey(key string) (prefix, hash string, ok bool) {
+	rest, found := strings.CutPrefix(strings.TrimSpace(key), apiKeyPrefix+"_")
+	if !found {
+		return "", "", false
+	}
+	prefix, secret, found := strings.Cut(rest, "_")
+	if !found || prefix == "" || secret == "" {
+		return "", "", false
+	}
+	return prefix, HashOpaqueToken(secret), true
+}
@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAPIKey(t *testing.T) {
+	key, prefix, hash, err := NewAPIKey()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !strings.HasPrefix(key, "gbk_"+prefix+"_") || len(prefix) != 8 {
+		t.Fatalf("expected gbk_<prefix>_<secret>, got %q with prefix %q", key, prefix)
+	}
+
+	parsedPrefix, parsedHash, ok := ParseAPIKey(" " + key + " ")
+	if !ok || parsedPrefix != prefix || parsedHash != hash {
+		t.Errorf("expected the key to parse back, got %q, %q, %t", parsedPrefix, parsedHash, ok)
+	}
+	if _, other, _ := ParseAPIKey(key + "x"); other == hash {
+		t.Error("expected another secret to hash differently")
+	}
+
+	for _, invalid := range []string{"", "gbk_", "gbk_abc", "gbk__secret", "gbk_abc_", "xyz_abc_secret"} {
+		if _, _, ok := ParseAPIKey(invalid); ok {
+			t.Errorf("expected %q to be refused", invalid)
+		}
+	}
+}
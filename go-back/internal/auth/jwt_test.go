@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writeJWKS(t *testing.T, path string, keys ...map[string]string) {
+	t.Helper()
+	raw, _ := json.Marshal(map[string]interface{}{"keys": keys})
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatalf("expected no error writing JWKS, got %v", err)
+	}
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ed25519JWK(kid string, key ed25519.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "OKP",
+		"crv": "Ed25519",
+		"kid": kid,
+		"x":   base64.RawURLEncoding.EncodeToString(key),
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.RegisteredClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("expected no error signing, got %v", err)
+	}
+	return signed
+}
+
+func validClaims() jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		Subject:   "user-1",
+		Issuer:    "https://issuer.test",
+		Audience:  jwt.ClaimStrings{"go-back"},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	edPublic, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, rsaJWK("rsa-1", &rsaKey.PublicKey), ed25519JWK("ed-1", edPublic))
+
+	keys, err := NewKeySet("shared-secret", path, 0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	verifier := NewVerifier(keys, VerifierConfig{
+		Issuer:    "https://issuer.test",
+		Audience:  "go-back",
+		ClockSkew: 30 * time.Second,
+	})
+
+	t.Run("accepts every supported algorithm", func(t *testing.T) {
+		tokens := map[string]string{
+			"HS256": sign(t, jwt.SigningMethodHS256, "", []byte("shared-secret"), validClaims()),
+			"RS256": sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, validClaims()),
+			"EdDSA": sign(t, jwt.SigningMethodEdDSA, "ed-1", edPrivate, validClaims()),
+		}
+		for alg, token := range tokens {
+			claims, err := verifier.Verify(token)
+			if err != nil {
+				t.Errorf("%s: expected no error, got %v", alg, err)
+				continue
+			}
+			if claims.Subject != "user-1" {
+				t.Errorf("%s: expected subject user-1, got %q", alg, claims.Subject)
+			}
+		}
+	})
+
+	t.Run("rejects invalid tokens", func(t *testing.T) {
+		expired := validClaims()
+		expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+		wrongIssuer := validClaims()
+		wrongIssuer.Issuer = "https://evil.test"
+		wrongAudience := validClaims()
+		wrongAudience.Audience = jwt.ClaimStrings{"other"}
+		noSubject := validClaims()
+		noSubject.Subject = ""
+		noExpiry := validClaims()
+		noExpiry.ExpiresAt = nil
+
+		publicKeyBytes := rsaKey.PublicKey.N.Bytes()
+
+		tokens := map[string]string{
+			"expired":         sign(t, jwt.SigningMethodHS256, "", []byte("shared-secret"), expired),
+			"wrong issuer":    sign(t, jwt.SigningMethodHS256, "", []byte("shared-secret"), wrongIssuer),
+			"wrong audience":  sign(t, jwt.SigningMethodHS256, "", []byte("shared-secret"), wrongAudience),
+			"no subject":      sign(t, jwt.SigningMethodHS256, "", []byte("shared-secret"), noSubject),
+			"no expiry":       sign(t, jwt.SigningMethodHS256, "", []byte("shared-secret"), noExpiry),
+			"wrong secret":    sign(t, jwt.SigningMethodHS256, "", []byte("other-secret"), validClaims()),
+			"unknown kid":     sign(t, jwt.SigningMethodRS256, "rsa-2", rsaKey, validClaims()),
+			"alg confusion":   sign(t, jwt.SigningMethodHS256, "rsa-1", publicKeyBytes, validClaims()),
+			"unsupported alg": sign(t, jwt.SigningMethodHS512, "", []byte("shared-secret"), validClaims()),
+		}
+		for name, token := range tokens {
+			if _, err := verifier.Verify(token); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("%s: expected ErrInvalidToken, got %v", name, err)
+			}
+		}
+	})
+
+	t.Run("tolerates clock skew", func(t *testing.T) {
+		claims := validClaims()
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-10 * time.Second))
+		claims.NotBefore = jwt.NewNumericDate(time.Now().Add(10 * time.Second))
+		if _, err := verifier.Verify(sign(t, jwt.SigningMethodHS256, "", []byte("shared-secret"), claims)); err != nil {
+			t.Errorf("expected token within skew to be accepted, got %v", err)
+		}
+	})
+
+	t.Run("picks up rotated keys from the JWKS file", func(t *testing.T) {
+		newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+		writeJWKS(t, path, rsaJWK("rsa-2", &newKey.PublicKey))
+		// Make sure the modification time changes even on coarse filesystems.
+		later := time.Now().Add(time.Minute)
+		os.Chtimes(path, later, later)
+
+		if _, err := verifier.Verify(sign(t, jwt.SigningMethodRS256, "rsa-2", newKey, validClaims())); err != nil {
+			t.Errorf("expected rotated key to be accepted, got %v", err)
+		}
+		if _, err := verifier.Verify(sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, validClaims())); err == nil {
+			t.Error("expected retired key to be rejected")
+		}
+	})
+}
+
+func TestParseJWKS(t *testing.T) {
+	t.Run("skips encryption keys", func(t *testing.T) {
+		keys, err := ParseJWKS([]byte(`{"keys":[{"kty":"oct","k":"c2VjcmV0","use":"enc"},{"kty":"oct","kid":"a","k":"c2VjcmV0"}]}`))
+		if err != nil || len(keys) != 1 || keys[0].ID != "a" || keys[0].Algorithm != AlgHS256 {
+			t.Errorf("expected one HS256 key, got %v (err %v)", keys, err)
+		}
+	})
+
+	t.Run("rejects unsupported or inconsistent keys", func(t *testing.T) {
+		for _, raw := range []string{
+			`{"keys":[{"kty":"EC","crv":"P-256"}]}`,
+			`{"keys":[{"kty":"oct","k":"c2VjcmV0","alg":"RS256"}]}`,
+			`{"keys":[{"kty":"OKP","crv":"X25519","x":"AA"}]}`,
+			`not json`,
+		} {
+			if _, err := ParseJWKS([]byte(raw)); err == nil {
+				t.Errorf("expected error for %s", raw)
+			}
+		}
+	})
+
+	t.Run("requires at least one key", func(t *testing.T) {
+		if _, err := NewKeySet("", "", 0); err == nil {
+			t.Error("expected error without keys")
+		}
+	})
+}
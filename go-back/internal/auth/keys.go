@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var ErrUnknownKey = errors.New("no key matches the token")
+
+// Key is a verification key. Material is a []byte for HS256, an
+// *rsa.PublicKey for RS256 and an ed25519.PublicKey for EdDSA.
+type Key struct {
+	ID        string
+	Algorithm string
+	Material  interface{}
+}
+
+// KeySet holds the keys tokens may be signed with: an optional static
+// HS256 secret plus the keys of a JWKS file. The file is reloaded when it
+// changes, checked at most once per refresh interval, so keys can be rotated
+// by rewriting it without restarting the server.
+type KeySet struct {
+	static  []Key
+	path    string
+	refresh time.Duration
+
+	mu        sync.RWMutex
+	fileKeys  []Key
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// NewKeySet loads the JWKS file at path, if any. secret, when not empty, is
+// accepted as an HS256 key with no key ID.
+func NewKeySet(secret string, path string, refresh time.Duration) (*KeySet, error) {
+	ks := &KeySet{path: path, refresh: refresh}
+	if secret != "" {
+		ks.static = append(ks.static, Key{Algorithm: AlgHS256, Material: []byte(secret)})
+	}
+
+	if path != "" {
+		if err := ks.reload(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(ks.static) == 0 && len(ks.fileKeys) == 0 {
+		return nil, errors.New("auth: no keys configured")
+	}
+	return ks, nil
+}
+
+// Lookup returns the key with keyID whose algorithm is alg. Tokens without
+// a key ID match any key of that algorithm that has no ID either.
+func (ks *KeySet) Lookup(keyID, alg string) (Key, error) {
+	ks.maybeReload()
+
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	for _, keys := range [][]Key{ks.fileKeys, ks.static} {
+		if key, ok := findKey(keys, keyID, alg); ok {
+			return key, nil
+		}
+	}
+	return Key{}, fmt.Errorf("%w: kid %q alg %s", ErrUnknownKey, keyID, alg)
+}
+
+func findKey(keys []Key, keyID, alg string) (Key, bool) {
+	for _, key := range keys {
+		if key.ID == keyID && key.Algorithm == alg {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+func (ks *KeySet) maybeReload() {
+	if ks.path == "" {
+		return
+	}
+
+	ks.mu.RLock()
+	due := time.Since(ks.checkedAt) >= ks.refresh
+	ks.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	// A broken file keeps the previous keys in place; the error is surfaced
+	// when the server starts.
+	_ = ks.reload()
+}
+
+func (ks *KeySet) reload() error {
+	info, err := os.Stat(ks.path)
+	if err != nil {
+		return fmt.Errorf("auth: reading JWKS file: %w", err)
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	ks.checkedAt = time.Now()
+	if info.ModTime().Equal(ks.modTime) && ks.fileKeys != nil {
+		return nil
+	}
+
+	raw, err := os.ReadFile(ks.path)
+	if err != nil {
+		return fmt.Errorf("auth: reading JWKS file: %w", err)
+	}
+	keys, err := ParseJWKS(raw)
+	if err != nil {
+		return err
+	}
+
+	ks.fileKeys = keys
+	ks.modTime = info.ModTime()
+	return nil
+}
+
+type jwk struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	Curve     string `json:"crv"`
+	K         string `json:"k"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+	X         string `json:"x"`
+}
+
+// ParseJWKS decodes a JSON Web Key Set (RFC 7517) holding oct, RSA or
+// Ed25519 keys. Encryption keys are skipped.
+func ParseJWKS(raw []byte) ([]Key, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("auth: decoding JWKS: %w", err)
+	}
+
+	keys := make([]Key, 0, len(set.Keys))
+	for i, k := range set.Keys {
+		if k.Use == "enc" {
+			continue
+		}
+		key, err := k.parse()
+		if err != nil {
+			return nil, fmt.Errorf("auth: JWKS key %d (kid %q): %w", i, k.KeyID, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (k jwk) parse() (Key, error) {
+	key := Key{ID: k.KeyID}
+
+	switch k.KeyType {
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil || len(secret) == 0 {
+			return Key{}, errors.New("invalid k")
+		}
+		key.Algorithm, key.Material = AlgHS256, secret
+
+	case "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return Key{}, errors.New("invalid n or e")
+		}
+		key.Algorithm = AlgRS256
+		key.Material = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if k.Curve != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return Key{}, errors.New("only Ed25519 OKP keys are supported")
+		}
+		key.Algorithm, key.Material = AlgEdDSA, ed25519.PublicKey(x)
+
+	default:
+		return Key{}, fmt.Errorf("unsupported kty %q", k.KeyType)
+	}
+
+	if k.Algorithm != "" && k.Algorithm != key.Algorithm {
+		return Key{}, fmt.Errorf("alg %q does not match kty %q", k.Algorithm, k.KeyType)
+	}
+	return key, nil
+}
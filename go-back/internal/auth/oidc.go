@@ -0,0 +1,351 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	// ErrOIDCRejected is returned when the provider refuses to exchange an
+	// authorization code, because it is wrong, expired or was already used.
+	ErrOIDCRejected = errors.New("identity provider rejected the code")
+	// ErrOIDCUnavailable covers providers that cannot be reached or answer
+	// with something other than what OpenID Connect prescribes.
+	ErrOIDCUnavailable = errors.New("identity provider unavailable")
+)
+
+// jwksRefreshInterval spaces out refetches of the provider keys triggered by
+// ID tokens signed with a key we do not know, so bogus tokens cannot make
+// us hammer the provider.
+const jwksRefreshInterval = time.Minute
+
+// fetchTimeout bounds the fetches of the discovery document and the keys,
+// which are shared by every login waiting on them rather than bound to the
+// request that started them.
+const fetchTimeout = 10 * time.Second
+
+type OIDCConfig struct {
+	// IssuerURL is the issuer of the ID tokens, which serves its discovery
+	// document under /.well-known/openid-configuration.
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback the provider sends users back to.
+	RedirectURL string
+	Scopes      []string
+	// ClockSkew is tolerated on exp and iat.
+	ClockSkew time.Duration
+	// Client makes the requests to the provider; nil uses a client with a
+	// 10s timeout.
+	Client *http.Client
+}
+
+// OIDCProvider runs the OpenID Connect authorization code flow with PKCE
+// against one provider. The discovery document is fetched on first use and
+// the signing keys whenever an ID token names one we do not have.
+type OIDCProvider struct {
+	config OIDCConfig
+	client *http.Client
+
+	// mu guards the discovery document and the keys; fetches shares the
+	// requests that fill them, which run without holding mu.
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      []Key
+	keysAt    time.Time
+	fetches   singleflight.Group
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// IDTokenClaims are the claims of an ID token used to find or create the
+// user it names.
+type IDTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce           string `json:"nonce"`
+	AuthorizedParty string `json:"azp"`
+	Email           string `json:"email"`
+	EmailVerified   bool   `json:"email_verified"`
+	Name            string `json:"name"`
+}
+
+func NewOIDCProvider(config OIDCConfig) *OIDCProvider {
+	client := config.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &OIDCProvider{config: config, client: client}
+}
+
+// PKCEChallenge derives the S256 code challenge of verifier, RFC 7636.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the page of the provider to send the user to. state
+// and nonce come back in the callback and the ID token; verifier is kept
+// until the code is exchanged and only its challenge is sent now.
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	endpoint, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("%w: authorization endpoint: %w", ErrOIDCUnavailable, err)
+	}
+	query := endpoint.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(p.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", PKCEChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+	endpoint.RawQuery = query.Encode()
+	return endpoint.String(), nil
+}
+
+// Exchange trades code for an ID token, proving with verifier that we
+// started the flow, and returns its claims once the token is verified and
+// carries nonce.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier, nonce string) (*IDTokenClaims, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	if p.config.ClientSecret == "" {
+		form.Set("client_id", p.config.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrOIDCUnavailable, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		// client_secret_basic form-encodes both parts, RFC 6749 section 2.3.1.
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	var response struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.do(req, &response)
+	if status >= 400 && status < 500 && response.Error != "" {
+		return nil, fmt.Errorf("%w: %s: %s", ErrOIDCRejected, response.Error, response.ErrorDescription)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if response.IDToken == "" {
+		return nil, fmt.Errorf("%w: token response has no id_token", ErrOIDCUnavailable)
+	}
+
+	return p.verify(ctx, discovery, response.IDToken, nonce)
+}
+
+// verify checks the signature of the ID token against the keys of the
+// provider, its issuer, audience, expiry and nonce. Every failure wraps
+// ErrInvalidToken.
+func (p *OIDCProvider) verify(ctx context.Context, discovery *oidcDiscovery, raw, nonce string) (*IDTokenClaims, error) {
+	claims := &IDTokenClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		keyID, _ := token.Header["kid"].(string)
+		key, err := p.lookup(ctx, discovery, keyID, token.Method.Alg())
+		if err != nil {
+			return nil, err
+		}
+		return key.Material, nil
+	},
+		// HS256 is left out: its key would be the client secret, which the
+		// JWKS of the provider does not hold.
+		jwt.WithValidMethods([]string{AlgRS256, AlgEdDSA}),
+		jwt.WithLeeway(p.config.ClockSkew),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub claim", ErrInvalidToken)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID {
+		return nil, fmt.Errorf("%w: azp %q is not the client", ErrInvalidToken, claims.AuthorizedParty)
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// lookup returns the provider key with keyID and alg, refetching the JWKS
+// once when it is missing, as providers rotate keys without notice. The
+// fetch runs without holding mu, so a slow provider does not hold up logins
+// with keys we have, and concurrent refetches share one request.
+func (p *OIDCProvider) lookup(ctx context.Context, discovery *oidcDiscovery, keyID, alg string) (Key, error) {
+	p.mu.Lock()
+	key, found := findKey(p.keys, keyID, alg)
+	throttled := p.keys != nil && time.Since(p.keysAt) < jwksRefreshInterval
+	p.mu.Unlock()
+
+	if found {
+		return key, nil
+	}
+	if throttled {
+		return Key{}, fmt.Errorf("%w: kid %q alg %s", ErrUnknownKey, keyID, alg)
+	}
+
+	fetched, err, _ := p.fetches.Do("jwks", func() (interface{}, error) {
+		ctx, cancel := sharedFetchContext(ctx)
+		defer cancel()
+		keys, err := p.fetchKeys(ctx, discovery.JWKSURI)
+		if err != nil {
+			return nil, err
+		}
+		p.mu.Lock()
+		p.keys, p.keysAt = keys, time.Now()
+		p.mu.Unlock()
+		return keys, nil
+	})
+	if err != nil {
+		return Key{}, err
+	}
+	if key, ok := findKey(fetched.([]Key), keyID, alg); ok {
+		return key, nil
+	}
+	return Key{}, fmt.Errorf("%w: kid %q alg %s", ErrUnknownKey, keyID, alg)
+}
+
+// sharedFetchContext derives the context of a fetch shared by several
+// logins from the one that started it, so the fetch does not fail for all
+// of them when that login gives up.
+func sharedFetchContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), fetchTimeout)
+}
+
+func (p *OIDCProvider) fetchKeys(ctx context.Context, jwksURI string) ([]Key, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURI, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrOIDCUnavailable, err)
+	}
+	var set json.RawMessage
+	if _, err := p.do(req, &set); err != nil {
+		return nil, err
+	}
+	keys, err := ParseJWKS(set)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrOIDCUnavailable, err)
+	}
+	return keys, nil
+}
+
+// discover fetches the discovery document once. A failed fetch is retried
+// on the next login rather than keeping the server from starting. As with
+// the keys, the fetch runs without holding mu.
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	discovery := p.discovery
+	p.mu.Unlock()
+	if discovery != nil {
+		return discovery, nil
+	}
+
+	fetched, err, _ := p.fetches.Do("discovery", func() (interface{}, error) {
+		ctx, cancel := sharedFetchContext(ctx)
+		defer cancel()
+		discovery, err := p.fetchDiscovery(ctx)
+		if err != nil {
+			return nil, err
+		}
+		p.mu.Lock()
+		p.discovery = discovery
+		p.mu.Unlock()
+		return discovery, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fetched.(*oidcDiscovery), nil
+}
+
+func (p *OIDCProvider) fetchDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	wellKnown := strings.TrimSuffix(p.config.IssuerURL, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrOIDCUnavailable, err)
+	}
+	discovery := &oidcDiscovery{}
+	if _, err := p.do(req, discovery); err != nil {
+		return nil, err
+	}
+	// OpenID Connect Discovery section 4.3: the document must name the
+	// issuer it was fetched from.
+	if discovery.Issuer != p.config.IssuerURL {
+		return nil, fmt.Errorf("%w: discovery issuer %q does not match %q", ErrOIDCUnavailable, discovery.Issuer, p.config.IssuerURL)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: discovery document misses endpoints", ErrOIDCUnavailable)
+	}
+	return discovery, nil
+}
+
+// do sends req and decodes its JSON body into v, returning the status.
+// Bodies of error responses are decoded too, for the error fields of OAuth.
+func (p *OIDCProvider) do(req *http.Request, v interface{}) (int, error) {
+	res, err := p.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrOIDCUnavailable, err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return res.StatusCode, fmt.Errorf("%w: %w", ErrOIDCUnavailable, err)
+	}
+	decodeErr := json.Unmarshal(body, v)
+	if res.StatusCode != http.StatusOK {
+		return res.StatusCode, fmt.Errorf("%w: %s answered %s", ErrOIDCUnavailable, req.URL.Path, res.Status)
+	}
+	if decodeErr != nil {
+		return res.StatusCode, fmt.Errorf("%w: decoding %s: %w", ErrOIDCUnavailable, req.URL.Path, decodeErr)
+	}
+	return res.StatusCode, nil
+}
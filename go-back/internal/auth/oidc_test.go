@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"go-back/internal/auth/oidctest"
+)
+
+func TestOIDCProvider(t *testing.T) {
+	idp := oidctest.NewServer("go-back", "client-secret")
+	defer idp.Close()
+	idp.SetIdentity(oidctest.Identity{Subject: "idp-user-1", Email: "john@example.com", EmailVerified: true, Name: "John"})
+
+	provider := NewOIDCProvider(OIDCConfig{
+		IssuerURL:    idp.Issuer(),
+		ClientID:     idp.ClientID,
+		ClientSecret: idp.ClientSecret,
+		RedirectURL:  "http://localhost/api/auth/oidc/callback",
+	})
+	ctx := context.Background()
+
+	// authorize runs the flow up to the callback and returns the code.
+	authorize := func(t *testing.T, state, nonce, verifier string) string {
+		t.Helper()
+		authURL, err := provider.AuthCodeURL(ctx, state, nonce, verifier)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		callback, err := idp.Authorize(authURL)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if callback.Query().Get("state") != state || callback.Query().Get("code") == "" {
+			t.Fatalf("expected a code and the state back, got %s", callback)
+		}
+		return callback.Query().Get("code")
+	}
+
+	t.Run("sends the PKCE challenge", func(t *testing.T) {
+		authURL, _ := provider.AuthCodeURL(ctx, "state", "nonce", "verifier")
+		parsed, _ := url.Parse(authURL)
+		query := parsed.Query()
+		if query.Get("code_challenge") != PKCEChallenge("verifier") || query.Get("code_challenge_method") != "S256" ||
+			query.Get("scope") != "openid email profile" || query.Get("code_verifier") != "" {
+			t.Errorf("expected an S256 challenge without the verifier, got %s", authURL)
+		}
+	})
+
+	t.Run("exchanges the code for verified claims", func(t *testing.T) {
+		code := authorize(t, "state", "nonce", "verifier")
+		claims, err := provider.Exchange(ctx, code, "verifier", "nonce")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if claims.Subject != "idp-user-1" || claims.Email != "john@example.com" || !claims.EmailVerified || claims.Name != "John" {
+			t.Errorf("expected the identity of the provider, got %+v", claims)
+		}
+
+		if _, err := provider.Exchange(ctx, code, "verifier", "nonce"); !errors.Is(err, ErrOIDCRejected) {
+			t.Errorf("expected a used code to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("requires the verifier", func(t *testing.T) {
+		code := authorize(t, "state", "nonce", "verifier")
+		if _, err := provider.Exchange(ctx, code, "another verifier", "nonce"); !errors.Is(err, ErrOIDCRejected) {
+			t.Errorf("expected a wrong verifier to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("requires the nonce", func(t *testing.T) {
+		code := authorize(t, "state", "nonce", "verifier")
+		if _, err := provider.Exchange(ctx, code, "verifier", "another nonce"); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("expected a token with another nonce to be refused, got %v", err)
+		}
+	})
+
+	t.Run("fetches rotated keys", func(t *testing.T) {
+		idp.RotateKey()
+		code := authorize(t, "state", "nonce", "verifier")
+		if _, err := provider.Exchange(ctx, code, "verifier", "nonce"); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("expected keys to be refetched at most once per interval, got %v", err)
+		}
+
+		provider.keysAt = time.Now().Add(-jwksRefreshInterval)
+		code = authorize(t, "state", "nonce", "verifier")
+		if _, err := provider.Exchange(ctx, code, "verifier", "nonce"); err != nil {
+			t.Errorf("expected the new key to be fetched, got %v", err)
+		}
+	})
+
+	t.Run("checks the issuer of the discovery document", func(t *testing.T) {
+		other := NewOIDCProvider(OIDCConfig{IssuerURL: idp.Issuer() + "/", ClientID: idp.ClientID})
+		if _, err := other.AuthCodeURL(ctx, "state", "nonce", "verifier"); !errors.Is(err, ErrOIDCUnavailable) {
+			t.Errorf("expected a mismatched issuer to be refused, got %v", err)
+		}
+	})
+
+	t.Run("fetches keys without holding up other logins", func(t *testing.T) {
+		// The login that starts the fetch gives up while it runs, which
+		// must not fail the fetch for the others.
+		first, cancel := context.WithCancel(ctx)
+		fetching, release := make(chan struct{}), make(chan struct{})
+		blocked := NewOIDCProvider(OIDCConfig{
+			IssuerURL:    idp.Issuer(),
+			ClientID:     idp.ClientID,
+			ClientSecret: idp.ClientSecret,
+			RedirectURL:  "http://localhost/api/auth/oidc/callback",
+			Client: &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				if req.URL.Path == "/jwks" {
+					close(fetching)
+					<-release
+				}
+				return http.DefaultTransport.RoundTrip(req)
+			})},
+		})
+		authURL, _ := blocked.AuthCodeURL(ctx, "state", "nonce", "verifier")
+		callback, err := idp.Authorize(authURL)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		exchanged := make(chan error)
+		go func() {
+			_, err := blocked.Exchange(first, callback.Query().Get("code"), "verifier", "nonce")
+			exchanged <- err
+		}()
+		<-fetching
+		cancel()
+
+		started := make(chan error)
+		go func() {
+			_, err := blocked.AuthCodeURL(ctx, "state", "nonce", "verifier")
+			started <- err
+		}()
+		select {
+		case err := <-started:
+			if err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Error("expected a login to start while the keys are fetched")
+		}
+
+		close(release)
+		if err := <-exchanged; err != nil {
+			t.Errorf("expected the exchange to finish once the keys arrive, got %v", err)
+		}
+	})
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"errors"
+	"go-back/internal/domain"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testArgon2Params keeps the tests fast; they are far too weak for real use.
+var testArgon2Params = Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestPasswordHasher(t *testing.T) {
+	hasher := NewPasswordHasher(testArgon2Params)
+
+	hash, err := hasher.Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("expected a PHC encoded argon2id hash, got %q", hash)
+	}
+
+	other, _ := hasher.Hash("correct horse battery staple")
+	if other == hash {
+		t.Error("expected hashes of the same password to use different salts")
+	}
+
+	match, needsRehash, err := hasher.Verify("correct horse battery staple", hash)
+	if err != nil || !match || needsRehash {
+		t.Errorf("expected the password to match without rehash, got match=%v rehash=%v err=%v", match, needsRehash, err)
+	}
+
+	match, _, err = hasher.Verify("Correct horse battery staple", hash)
+	if err != nil || match {
+		t.Errorf("expected a different password not to match, got match=%v err=%v", match, err)
+	}
+
+	t.Run("flags hashes made with other parameters", func(t *testing.T) {
+		stronger := testArgon2Params
+		stronger.Iterations = 2
+
+		match, needsRehash, err := NewPasswordHasher(stronger).Verify("correct horse battery staple", hash)
+		if err != nil || !match || !needsRehash {
+			t.Errorf("expected a match needing rehash, got match=%v rehash=%v err=%v", match, needsRehash, err)
+		}
+	})
+
+	t.Run("rejects malformed hashes", func(t *testing.T) {
+		for _, encoded := range []string{
+			"",
+			"plaintext",
+			"$argon2i$v=19$m=64,t=1,p=1$c2FsdA$a2V5",
+			"$argon2id$v=16$m=64,t=1,p=1$c2FsdA$a2V5",
+			"$argon2id$v=19$m=64$c2FsdA$a2V5",
+			"$argon2id$v=19$m=64,t=1,p=1$!!$a2V5",
+		} {
+			if _, _, err := hasher.Verify("password", encoded); !errors.Is(err, ErrMalformedHash) {
+				t.Errorf("expected ErrMalformedHash for %q, got %v", encoded, err)
+			}
+		}
+	})
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "banned.txt")
+	os.WriteFile(path, []byte("# common passwords\npassword1234\n\nQwertyuiop123\n"), 0o600)
+
+	banned, err := LoadBannedPasswords(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(banned) != 2 {
+		t.Fatalf("expected 2 banned passwords, got %v", banned)
+	}
+
+	policy := NewPasswordPolicy(12, 20, banned)
+	cases := []struct {
+		password string
+		reason   string
+	}{
+		{"long enough password", ""},
+		{"çãéíóúàõâêô!", ""},
+		{"short", "password must be at least 12 characters long"},
+		{"a password that is far too long", "password must be at most 20 characters long"},
+		{"PASSWORD1234", "password is too common"},
+		{"qwertyuiop123", "password is too common"},
+	}
+	for _, c := range cases {
+		err := policy.Check(c.password)
+		if c.reason == "" {
+			if err != nil {
+				t.Errorf("expected %q to be accepted, got %v", c.password, err)
+			}
+			continue
+		}
+
+		var policyErr domain.PasswordPolicyError
+		if !errors.As(err, &policyErr) || policyErr.Reason != c.reason || !errors.Is(err, domain.ErrWeakPassword) {
+			t.Errorf("expected %q to be rejected with %q, got %v", c.password, c.reason, err)
+		}
+	}
+
+	if _, err := LoadBannedPasswords(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
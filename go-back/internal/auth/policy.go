@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"go-back/internal/domain"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// PasswordPolicy rejects passwords that are too short, too long or on the
+// banned list. Lengths count characters, not bytes.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	banned    map[string]bool
+}
+
+func NewPasswordPolicy(minLength, maxLength int, banned []string) *PasswordPolicy {
+	policy := &PasswordPolicy{MinLength: minLength, MaxLength: maxLength, banned: map[string]bool{}}
+	for _, password := range banned {
+		policy.banned[strings.ToLower(password)] = true
+	}
+	return policy
+}
+
+// LoadBannedPasswords reads one password per line from path, skipping
+// blank lines and lines starting with #.
+func LoadBannedPasswords(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("auth: banned passwords: %w", err)
+	}
+	defer file.Close()
+
+	var passwords []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords = append(passwords, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("auth: banned passwords: %w", err)
+	}
+	return passwords, nil
+}
+
+// Check returns a domain.PasswordPolicyError explaining the first rule
+// password breaks. The banned list is matched case-insensitively.
+func (p *PasswordPolicy) Check(password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return domain.PasswordPolicyError{Reason: fmt.Sprintf("password must be at least %d characters long", p.MinLength)}
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return domain.PasswordPolicyError{Reason: fmt.Sprintf("password must be at most %d characters long", p.MaxLength)}
+	}
+	if p.banned[strings.ToLower(password)] {
+		return domain.PasswordPolicyError{Reason: "password is too common"}
+	}
+	return nil
+}
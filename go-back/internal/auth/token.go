@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"unicode"
+)
+
+// NewOpaqueToken returns a random URL-safe token to hand to a user and the
+// hash to store in its place. Tokens carry 256 bits of entropy, so a plain
+// SHA-256 is enough to keep a leaked table useless.
+func NewOpaqueToken() (token string, hash string, err error) {
+	token, err = RandomToken()
+	if err != nil {
+		return "", "", err
+	}
+	return token, HashOpaqueToken(token), nil
+}
+
+// RandomToken returns 256 random bits encoded as URL-safe base64.
+func RandomToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewRecoveryCode returns a random MFA recovery code, 80 bits written as
+// four groups of base32, and the hash to store in its place.
+func NewRecoveryCode() (code string, hash string, err error) {
+	raw := make([]byte, 10)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	encoded := strings.ToLower(recoveryEncoding.EncodeToString(raw))
+	code = encoded[0:4] + "-" + encoded[4:8] + "-" + encoded[8:12] + "-" + encoded[12:16]
+	return code, HashRecoveryCode(code), nil
+}
+
+// HashRecoveryCode hashes code ignoring case, spaces and dashes, so codes
+// typed back in any of those forms match.
+func HashRecoveryCode(code string) string {
+	normalized := strings.Map(func(r rune) rune {
+		if r == '-' || unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, code)
+	return HashOpaqueToken(normalized)
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"rsc.io/qr"
+)
+
+var ErrMalformedSecret = errors.New("auth: malformed totp secret")
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTP generates and validates RFC 6238 codes with HMAC-SHA1, the only
+// algorithm authenticator apps reliably support.
+type TOTP struct {
+	Digits int
+	Period time.Duration
+	// Skew is how many periods before and after the current one are still
+	// accepted, to absorb clock drift between the server and the device.
+	Skew int
+}
+
+var DefaultTOTP = TOTP{Digits: 6, Period: 30 * time.Second, Skew: 1}
+
+// NewTOTPSecret returns a random 160 bit secret in unpadded base32, the
+// form authenticator apps expect.
+func NewTOTPSecret() (string, error) {
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return secretEncoding.EncodeToString(raw), nil
+}
+
+// URI returns the otpauth:// URI that enrolls secret in an authenticator
+// app under issuer and account.
+func (t TOTP) URI(issuer, account, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", strconv.Itoa(t.Digits))
+	query.Set("period", strconv.Itoa(int(t.Period.Seconds())))
+
+	link := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: query.Encode(),
+	}
+	return link.String()
+}
+
+// Step returns the time step at falls in.
+func (t TOTP) Step(at time.Time) int64 {
+	return at.Unix() / int64(t.Period.Seconds())
+}
+
+// Code returns the code of secret for step.
+func (t TOTP) Code(secret string, step int64) (string, error) {
+	key, err := secretEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil || len(key) == 0 {
+		return "", ErrMalformedSecret
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation, RFC 4226 section 5.3.
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < t.Digits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", t.Digits, value%modulo), nil
+}
+
+// Validate reports whether code is valid for secret within Skew steps of
+// at, and the step it matched. Callers must refuse steps at or before the
+// last one used, or a code could be replayed while it is still valid.
+func (t TOTP) Validate(secret, code string, at time.Time) (int64, bool) {
+	if len(code) != t.Digits {
+		return 0, false
+	}
+
+	current := t.Step(at)
+	for offset := -t.Skew; offset <= t.Skew; offset++ {
+		expected, err := t.Code(secret, current+int64(offset))
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return current + int64(offset), true
+		}
+	}
+	return 0, false
+}
+
+// QRCodePNG renders text, usually an otpauth:// URI, as a PNG QR code.
+func QRCodePNG(text string) ([]byte, error) {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return nil, err
+	}
+	return code.PNG(), nil
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTP(t *testing.T) {
+	// Test vectors of RFC 6238 appendix B, for the SHA1 key.
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	rfc := TOTP{Digits: 8, Period: 30 * time.Second}
+	for unix, expected := range map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	} {
+		code, err := rfc.Code(secret, rfc.Step(time.Unix(unix, 0)))
+		if err != nil || code != expected {
+			t.Errorf("expected %s at %d, got %s, %v", expected, unix, code, err)
+		}
+	}
+
+	t.Run("accepts codes within the skew", func(t *testing.T) {
+		at := time.Unix(1111111111, 0)
+		step := DefaultTOTP.Step(at)
+		for offset, valid := range map[int64]bool{-2: false, -1: true, 0: true, 1: true, 2: false} {
+			code, _ := DefaultTOTP.Code(secret, step+offset)
+			matched, ok := DefaultTOTP.Validate(secret, code, at)
+			if ok != valid || (ok && matched != step+offset) {
+				t.Errorf("offset %d: expected valid=%v, got step %d, %v", offset, valid, matched, ok)
+			}
+		}
+		if _, ok := DefaultTOTP.Validate(secret, "12345", at); ok {
+			t.Error("expected a code of the wrong length to be invalid")
+		}
+	})
+
+	t.Run("rejects malformed secrets", func(t *testing.T) {
+		if _, err := DefaultTOTP.Code("not base32!", 1); err != ErrMalformedSecret {
+			t.Errorf("expected ErrMalformedSecret, got %v", err)
+		}
+	})
+
+	t.Run("builds enrollment URIs and QR codes", func(t *testing.T) {
+		generated, err := NewTOTPSecret()
+		if err != nil || len(generated) != 32 {
+			t.Fatalf("expected a 32 character secret, got %q, %v", generated, err)
+		}
+
+		uri := DefaultTOTP.URI("Go Project", "john@example.com", generated)
+		parsed, err := url.Parse(uri)
+		if err != nil || parsed.Scheme != "otpauth" || parsed.Host != "totp" || parsed.Path != "/Go Project:john@example.com" {
+			t.Fatalf("unexpected URI %q, %v", uri, err)
+		}
+		if query := parsed.Query(); query.Get("secret") != generated || query.Get("digits") != "6" || query.Get("period") != "30" {
+			t.Errorf("unexpected parameters in %q", uri)
+		}
+
+		png, err := QRCodePNG(uri)
+		if err != nil || !bytes.HasPrefix(png, []byte("\x89PNG\r\n\x1a\n")) {
+			t.Errorf("expected a PNG, got %d bytes, %v", len(png), err)
+		}
+	})
+}
+
+func TestRecoveryCode(t *testing.T) {
+	code, hash, err := NewRecoveryCode()
+	if err != nil || len(code) != 19 {
+		t.Fatalf("expected a code like xxxx-xxxx-xxxx-xxxx, got %q, %v", code, err)
+	}
+
+	for _, typed := range []string{code, " " + code + " ", strings.ToUpper(code), code[0:4] + code[5:9] + code[10:14] + code[15:19]} {
+		if HashRecoveryCode(typed) != hash {
+			t.Errorf("expected %q to match %q", typed, code)
+		}
+	}
+	if other, _, _ := NewRecoveryCode(); HashRecoveryCode(other) == hash {
+		t.Error("expected codes to differ")
+	}
+}
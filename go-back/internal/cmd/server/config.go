@@ -1,5 +1,244 @@
 package config
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
 
 var DATABASE_URL = os.Getenv("DATABASE_URL")
+
+// STORAGE selects the user repository backend: "postgres", "sqlite" or "memory".
+var STORAGE = getEnv("STORAGE", "postgres")
+
+var SQLITE_PATH = getEnv("SQLITE_PATH", "go-back.db")
+
+var (
+	DB_MAX_CONNS          = getEnvInt("DB_MAX_CONNS", 10)
+	DB_MIN_CONNS          = getEnvInt("DB_MIN_CONNS", 2)
+	DB_MAX_CONN_IDLE_TIME = getEnvDuration("DB_MAX_CONN_IDLE_TIME", 5*time.Minute)
+	DB_MAX_CONN_LIFETIME  = getEnvDuration("DB_MAX_CONN_LIFETIME", time.Hour)
+
+	DB_READ_TIMEOUT  = getEnvDuration("DB_READ_TIMEOUT", 3*time.Second)
+	DB_WRITE_TIMEOUT = getEnvDuration("DB_WRITE_TIMEOUT", 5*time.Second)
+)
+
+var (
+	// USER_RETENTION is how long soft deleted users are kept before being
+	// purged; zero disables the purger. It runs every USER_PURGE_INTERVAL,
+	// which must be positive.
+	USER_RETENTION      = getEnvDuration("USER_RETENTION", 30*24*time.Hour)
+	USER_PURGE_INTERVAL = getEnvDuration("USER_PURGE_INTERVAL", time.Hour)
+)
+
+// REQUIRE_IF_MATCH makes user updates fail with 428 unless they send the
+// ETag they read in an If-Match header.
+var REQUIRE_IF_MATCH = getEnvBool("REQUIRE_IF_MATCH", false)
+
+// Bearer tokens are verified with JWT_SECRET (HS256) and/or the keys of the
+// JWKS file at JWT_JWKS_FILE, reread every JWT_JWKS_REFRESH when it changes.
+// JWT_ISSUER and JWT_AUDIENCE are enforced when set.
+var (
+	JWT_SECRET       = os.Getenv("JWT_SECRET")
+	JWT_JWKS_FILE    = os.Getenv("JWT_JWKS_FILE")
+	JWT_JWKS_REFRESH = getEnvDuration("JWT_JWKS_REFRESH", time.Minute)
+	JWT_ISSUER       = os.Getenv("JWT_ISSUER")
+	JWT_AUDIENCE     = os.Getenv("JWT_AUDIENCE")
+	JWT_CLOCK_SKEW   = getEnvDuration("JWT_CLOCK_SKEW", 30*time.Second)
+)
+
+// JWT_TTL is the lifetime of the access tokens issued by /api/auth/login,
+// which is only served when JWT_SECRET is set.
+var JWT_TTL = getEnvDuration("JWT_TTL", 15*time.Minute)
+
+// Logins through an OpenID Connect provider are served when
+// OIDC_ISSUER_URL is set, for the client OIDC_CLIENT_ID registered with the
+// callback OIDC_REDIRECT_URL. Users have OIDC_LOGIN_TTL to come back from
+// the provider.
+var (
+	OIDC_ISSUER_URL    = os.Getenv("OIDC_ISSUER_URL")
+	OIDC_CLIENT_ID     = os.Getenv("OIDC_CLIENT_ID")
+	OIDC_CLIENT_SECRET = os.Getenv("OIDC_CLIENT_SECRET")
+	OIDC_REDIRECT_URL  = getEnv("OIDC_REDIRECT_URL", "http://localhost:1111/api/auth/oidc/callback")
+	OIDC_SCOPES        = getEnvList("OIDC_SCOPES")
+	OIDC_LOGIN_TTL     = getEnvDuration("OIDC_LOGIN_TTL", 10*time.Minute)
+)
+
+// Requests are rate limited per client IP (RATE_LIMIT_IP), per IP on the
+// login routes (RATE_LIMIT_LOGIN), per user (RATE_LIMIT_USER) and per user
+// when creating and looking up users, written as "requests/period". Limits
+// are counted in memory, or in REDIS_URL with RATE_LIMIT_STORE=redis.
+// TRUSTED_PROXIES lists the proxies whose X-Forwarded-For is believed.
+var (
+	RATE_LIMIT_STORE       = getEnv("RATE_LIMIT_STORE", "memory")
+	RATE_LIMIT_IP          = getEnv("RATE_LIMIT_IP", "600/1m")
+	RATE_LIMIT_LOGIN       = getEnv("RATE_LIMIT_LOGIN", "10/1m")
+	RATE_LIMIT_USER        = getEnv("RATE_LIMIT_USER", "300/1m")
+	RATE_LIMIT_CREATE_USER = getEnv("RATE_LIMIT_CREATE_USER", "20/1m")
+	RATE_LIMIT_LOOKUP_USER = getEnv("RATE_LIMIT_LOOKUP_USER", "120/1m")
+	REDIS_URL              = getEnv("REDIS_URL", "redis://localhost:6379/0")
+	TRUSTED_PROXIES        = getEnvList("TRUSTED_PROXIES")
+)
+
+// USER_CACHE caches the users read by UUID and email for USER_CACHE_TTL:
+// "redis" shares them through REDIS_URL, "memory" keeps up to
+// USER_CACHE_SIZE of them in each instance and an empty value disables it.
+var (
+	USER_CACHE      = os.Getenv("USER_CACHE")
+	USER_CACHE_TTL  = getEnvDuration("USER_CACHE_TTL", time.Minute)
+	USER_CACHE_SIZE = getEnvInt("USER_CACHE_SIZE", 10000)
+)
+
+// API keys are limited to API_KEY_RATE_LIMIT requests per minute unless
+// they have their own limit. Their last use is written at most once per
+// API_KEY_TOUCH_INTERVAL.
+var (
+	API_KEY_RATE_LIMIT     = getEnvInt("API_KEY_RATE_LIMIT", 600)
+	API_KEY_TOUCH_INTERVAL = getEnvDuration("API_KEY_TOUCH_INTERVAL", time.Minute)
+)
+
+// Each login opens a session lasting at most SESSION_TTL, kept alive by
+// refresh tokens that expire after REFRESH_TOKEN_TTL unused.
+var (
+	SESSION_TTL       = getEnvDuration("SESSION_TTL", 30*24*time.Hour)
+	REFRESH_TOKEN_TTL = getEnvDuration("REFRESH_TOKEN_TTL", 7*24*time.Hour)
+)
+
+// Passwords are hashed with Argon2id using ARGON2_MEMORY KiB,
+// ARGON2_ITERATIONS passes and ARGON2_PARALLELISM lanes. Changing them
+// rehashes each password on its next successful login.
+var (
+	ARGON2_MEMORY      = getEnvInt("ARGON2_MEMORY", 64*1024)
+	ARGON2_ITERATIONS  = getEnvInt("ARGON2_ITERATIONS", 3)
+	ARGON2_PARALLELISM = getEnvInt("ARGON2_PARALLELISM", 2)
+)
+
+// New passwords must have between PASSWORD_MIN_LENGTH and
+// PASSWORD_MAX_LENGTH characters and must not appear in
+// PASSWORD_BANNED_FILE, a list with one password per line.
+var (
+	PASSWORD_MIN_LENGTH  = getEnvInt("PASSWORD_MIN_LENGTH", 12)
+	PASSWORD_MAX_LENGTH  = getEnvInt("PASSWORD_MAX_LENGTH", 128)
+	PASSWORD_BANNED_FILE = os.Getenv("PASSWORD_BANNED_FILE")
+)
+
+// REQUIRE_VERIFIED_EMAIL refuses logins from users that have not verified
+// their email yet.
+var REQUIRE_VERIFIED_EMAIL = getEnvBool("REQUIRE_VERIFIED_EMAIL", true)
+
+// Verification emails link to EMAIL_VERIFICATION_URL with the token in the
+// token query parameter. Tokens expire after EMAIL_VERIFICATION_TTL and a
+// user can ask for a new one every EMAIL_VERIFICATION_RESEND_INTERVAL.
+var (
+	EMAIL_VERIFICATION_URL             = getEnv("EMAIL_VERIFICATION_URL", "http://localhost:3000/verify-email")
+	EMAIL_VERIFICATION_TTL             = getEnvDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour)
+	EMAIL_VERIFICATION_RESEND_INTERVAL = getEnvDuration("EMAIL_VERIFICATION_RESEND_INTERVAL", time.Minute)
+)
+
+// Password reset emails link to PASSWORD_RESET_URL with the token in the
+// token query parameter. Tokens expire after PASSWORD_RESET_TTL and at most
+// one email is sent to a user every PASSWORD_RESET_INTERVAL.
+var (
+	PASSWORD_RESET_URL      = getEnv("PASSWORD_RESET_URL", "http://localhost:3000/reset-password")
+	PASSWORD_RESET_TTL      = getEnvDuration("PASSWORD_RESET_TTL", time.Hour)
+	PASSWORD_RESET_INTERVAL = getEnvDuration("PASSWORD_RESET_INTERVAL", time.Minute)
+)
+
+// EMAIL_SENDER selects how emails are delivered: "log" only logs them,
+// "file" appends them to EMAIL_FILE and "smtp" sends them through
+// SMTP_HOST:SMTP_PORT, authenticating when SMTP_USERNAME is set.
+var (
+	EMAIL_SENDER  = getEnv("EMAIL_SENDER", "log")
+	EMAIL_FROM    = getEnv("EMAIL_FROM", "Go Project <no-reply@localhost>")
+	EMAIL_FILE    = getEnv("EMAIL_FILE", "emails.mbox")
+	SMTP_HOST     = getEnv("SMTP_HOST", "localhost")
+	SMTP_PORT     = getEnvInt("SMTP_PORT", 587)
+	SMTP_USERNAME = os.Getenv("SMTP_USERNAME")
+	SMTP_PASSWORD = os.Getenv("SMTP_PASSWORD")
+)
+
+// Background jobs, such as emails and webhooks, run on QUEUE_CONCURRENCY
+// workers that poll for due jobs every QUEUE_POLL_INTERVAL. A job may run
+// for QUEUE_LEASE before it is canceled and, once the lease passed, claimed
+// again. Failed jobs are retried after QUEUE_RETRY_DELAY, doubled on each
+// retry up to QUEUE_MAX_RETRY_DELAY, and left dead after QUEUE_MAX_ATTEMPTS
+// tries. On shutdown running jobs get QUEUE_DRAIN_TIMEOUT to finish.
+var (
+	QUEUE_CONCURRENCY     = getEnvInt("QUEUE_CONCURRENCY", 4)
+	QUEUE_POLL_INTERVAL   = getEnvDuration("QUEUE_POLL_INTERVAL", time.Second)
+	QUEUE_LEASE           = getEnvDuration("QUEUE_LEASE", time.Minute)
+	QUEUE_MAX_ATTEMPTS    = getEnvInt("QUEUE_MAX_ATTEMPTS", 10)
+	QUEUE_RETRY_DELAY     = getEnvDuration("QUEUE_RETRY_DELAY", 10*time.Second)
+	QUEUE_MAX_RETRY_DELAY = getEnvDuration("QUEUE_MAX_RETRY_DELAY", time.Hour)
+	QUEUE_DRAIN_TIMEOUT   = getEnvDuration("QUEUE_DRAIN_TIMEOUT", 30*time.Second)
+)
+
+// Changes to users are POSTed to each of WEBHOOK_URLS, signed with
+// WEBHOOK_SECRET. Deliveries taking longer than WEBHOOK_TIMEOUT fail and
+// are retried.
+var (
+	WEBHOOK_URLS    = getEnvList("WEBHOOK_URLS")
+	WEBHOOK_SECRET  = os.Getenv("WEBHOOK_SECRET")
+	WEBHOOK_TIMEOUT = getEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second)
+)
+
+// MFA_REQUIRED_ROLES lists roles that only apply to tokens of a login with
+// MFA, such as "admin". Codes are TOTP as in RFC 6238, accepted up to
+// MFA_TOTP_SKEW periods early or late; authenticator apps show the account
+// under MFA_ISSUER. A login with MFA has MFA_CHALLENGE_TTL to send the code
+// after the password.
+var (
+	MFA_REQUIRED_ROLES = getEnvList("MFA_REQUIRED_ROLES")
+	MFA_ISSUER         = getEnv("MFA_ISSUER", "Go Project")
+	MFA_TOTP_SKEW      = getEnvInt("MFA_TOTP_SKEW", 1)
+	MFA_CHALLENGE_TTL  = getEnvDuration("MFA_CHALLENGE_TTL", 5*time.Minute)
+)
+
+// ADMIN_SUBJECTS lists JWT subjects that always hold the admin role, used
+// to grant the first roles.
+var ADMIN_SUBJECTS = getEnvList("ADMIN_SUBJECTS")
+
+// LOG_LEVEL is the minimum level of the JSON logs: debug, info, warn or error.
+var LOG_LEVEL = getEnv("LOG_LEVEL", "info")
+
+func getEnv(key string, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
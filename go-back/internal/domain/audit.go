@@ -0,0 +1,91 @@
+package domain
+
+import "time"
+
+const (
+	AuditUserCreated     = "user.created"
+	AuditUserUpdated     = "user.updated"
+	AuditUserActivated   = "user.activated"
+	AuditUserDeactivated = "user.deactivated"
+	AuditUserDeleted     = "user.deleted"
+	AuditUserRestored    = "user.restored"
+	AuditUserPurged      = "user.purged"
+	AuditEmailVerified   = "user.email_verified"
+	AuditRoleGranted     = "role.granted"
+	AuditRoleRevoked     = "role.revoked"
+)
+
+type AuditEvent struct {
+	UUID       string                 `json:"uuid" ksql:"uuid"`
+	Actor      string                 `json:"actor" ksql:"actor"`
+	Action     string                 `json:"action" ksql:"action"`
+	TargetUUID string                 `json:"target_uuid" ksql:"target_uuid"`
+	Changes    map[string]FieldChange `json:"changes" ksql:"changes,json"`
+	RequestID  string                 `json:"request_id" ksql:"request_id"`
+	IP         string                 `json:"ip" ksql:"ip"`
+	CreatedAt  time.Time              `json:"created_at" ksql:"created_at"`
+	// Seq numbers events in the order they were written, which created_at
+	// cannot: events of one transaction may share it.
+	Seq int64 `json:"-" ksql:"seq"`
+}
+
+// FieldChange is the value of a field before and after a mutation. From is
+// nil for created users and To is nil for purged ones.
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+type AuditFilter struct {
+	Limit  int        `form:"limit" binding:"omitempty,min=1,max=200"`
+	Cursor string     `form:"cursor"`
+	Target string     `form:"target"`
+	Actor  string     `form:"actor"`
+	Since  *time.Time `form:"since"`
+
+	// After is the decoded Cursor: the last event of the previous page.
+	// Events are listed newest first.
+	After *AuditCursor `form:"-"`
+}
+
+type AuditCursor struct {
+	Seq int64 `json:"s"`
+}
+
+type AuditPage struct {
+	Events     []AuditEvent
+	NextCursor string
+}
+
+// DiffUsers lists the user fields that differ between before and after.
+// Bookkeeping fields (updated_at, version) are left out.
+func DiffUsers(before, after *User) map[string]FieldChange {
+	changes := map[string]FieldChange{}
+	field := func(name string, value func(User) interface{}) {
+		var from, to interface{}
+		if before != nil {
+			from = value(*before)
+		}
+		if after != nil {
+			to = value(*after)
+		}
+		if from != to {
+			changes[name] = FieldChange{From: from, To: to}
+		}
+	}
+
+	field("name", func(u User) interface{} { return u.Name })
+	field("email", func(u User) interface{} { return u.Email })
+	field("is_active", func(u User) interface{} { return u.IsActive })
+	field("deleted_at", func(u User) interface{} { return formatTime(u.DeletedAt) })
+	field("email_verified_at", func(u User) interface{} { return formatTime(u.EmailVerifiedAt) })
+
+	return changes
+}
+
+func formatTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	AuditPasswordChanged = "user.password_changed"
+	AuditPasswordReset   = "user.password_reset"
+)
+
+var (
+	// ErrPasswordNotSet is returned by credential repositories for users
+	// that never had a password.
+	ErrPasswordNotSet   = errors.New("password not set")
+	ErrEmailNotVerified = errors.New("email not verified")
+)
+
+// Credential is the password of a user. It lives apart from User so the
+// hash is never loaded, serialized or cached along with the profile.
+type Credential struct {
+	UserUUID          string    `ksql:"user_uuid"`
+	PasswordHash      string    `ksql:"password_hash"`
+	PasswordChangedAt time.Time `ksql:"password_changed_at"`
+	UpdatedAt         time.Time `ksql:"updated_at"`
+}
+
+type PasswordInput struct {
+	// CurrentPassword is required when users change their own password.
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type ForgotPasswordInput struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordInput struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+type LoginInput struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+type AccessToken struct {
+	AccessToken string    `json:"access_token"`
+	TokenType   string    `json:"token_type"`
+	ExpiresIn   int       `json:"expires_in"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	// RefreshToken trades for a new AccessToken at /auth/refresh until
+	// RefreshExpiresAt, and is rotated every time.
+	RefreshToken     string    `json:"refresh_token,omitempty"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at,omitzero"`
+	SessionID        string    `json:"session_id,omitempty"`
+}
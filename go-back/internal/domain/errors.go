@@ -0,0 +1,36 @@
+package domain
+
+import "errors"
+
+// Storage and service errors are translated into this set, so callers can
+// match them with errors.Is whatever backend produced them.
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrEmailTaken   = errors.New("email already in use")
+	ErrInvalidInput = errors.New("invalid input")
+	ErrConflict     = errors.New("conflict")
+	ErrForbidden    = errors.New("forbidden")
+
+	// ErrInvalidCredentials covers unknown emails, wrong passwords and
+	// accounts that cannot log in, so callers cannot tell them apart.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrWeakPassword       = errors.New("password does not meet the policy")
+
+	// ErrVersionMismatch reports a conditional write that lost the race
+	// against another update of the same user.
+	ErrVersionMismatch = errors.New("user was modified by another request")
+)
+
+// PasswordPolicyError is an ErrWeakPassword whose Reason is safe to show to
+// clients.
+type PasswordPolicyError struct {
+	Reason string
+}
+
+func (e PasswordPolicyError) Error() string {
+	return ErrWeakPassword.Error() + ": " + e.Reason
+}
+
+func (e PasswordPolicyError) Unwrap() error {
+	return ErrWeakPassword
+}
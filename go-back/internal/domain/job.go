@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+type JobStatus string
+
+const (
+	// JobQueued jobs wait for RunAt to be claimed by a worker.
+	JobQueued JobStatus = "queued"
+	// JobRunning jobs were claimed by a worker until LockedUntil. Once that
+	// passes they are claimed again, as their worker is presumed gone.
+	JobRunning JobStatus = "running"
+	// JobDead jobs failed MaxAttempts times, or failed for good, and are
+	// kept for inspection.
+	JobDead JobStatus = "dead"
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+// Job is a unit of background work of Kind, described by its JSON Payload.
+// Jobs that succeed are deleted.
+type Job struct {
+	ID          string     `json:"id" ksql:"id"`
+	Kind        string     `json:"kind" ksql:"kind"`
+	Payload     string     `json:"payload" ksql:"payload"`
+	Status      JobStatus  `json:"status" ksql:"status"`
+	Attempts    int        `json:"attempts" ksql:"attempts"`
+	MaxAttempts int        `json:"max_attempts" ksql:"max_attempts"`
+	RunAt       time.Time  `json:"run_at" ksql:"run_at"`
+	LockedUntil *time.Time `json:"locked_until,omitempty" ksql:"locked_until"`
+	LastError   string     `json:"last_error,omitempty" ksql:"last_error"`
+	CreatedAt   time.Time  `json:"created_at" ksql:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" ksql:"updated_at"`
+}
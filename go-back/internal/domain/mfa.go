@@ -0,0 +1,91 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	AuditMFAEnabled               = "user.mfa_enabled"
+	AuditMFADisabled              = "user.mfa_disabled"
+	AuditRecoveryCodesRegenerated = "user.recovery_codes_regenerated"
+	AuditRecoveryCodeUsed         = "user.recovery_code_used"
+)
+
+// RecoveryCodeCount is how many recovery codes a user gets at a time.
+const RecoveryCodeCount = 10
+
+var (
+	// ErrMFANotEnabled is returned by MFA repositories for users without a
+	// TOTP secret, and by services for users that did not confirm theirs.
+	ErrMFANotEnabled  = errors.New("mfa not enabled")
+	ErrInvalidMFACode = errors.New("invalid mfa code")
+	// ErrMFARequired is a forbidden action that a role withheld for lack
+	// of MFA would allow.
+	ErrMFARequired = errors.New("mfa required")
+)
+
+// MFA is the TOTP enrollment of a user. It is pending until ConfirmedAt is
+// set by a first valid code. LastUsedStep is the newest time step a code
+// was accepted for; codes of that step or older are refused as replays.
+type MFA struct {
+	UserUUID     string     `ksql:"user_uuid"`
+	Secret       string     `ksql:"secret"`
+	ConfirmedAt  *time.Time `ksql:"confirmed_at"`
+	LastUsedStep int64      `ksql:"last_used_step"`
+	CreatedAt    time.Time  `ksql:"created_at"`
+	UpdatedAt    time.Time  `ksql:"updated_at"`
+}
+
+// MFAStatus is what is shown about the MFA of a user; never the secret.
+type MFAStatus struct {
+	Enabled           bool       `json:"enabled"`
+	EnabledAt         *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesLeft int        `json:"recovery_codes_left"`
+}
+
+// TOTPEnrollment is handed to the user once, to add the secret to an
+// authenticator app. QRCode is a data: URI of a PNG encoding URI.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+	QRCode string `json:"qr_code"`
+}
+
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
+
+// MFACodeInput carries a TOTP code or a recovery code.
+type MFACodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type MFALoginInput struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// MFAChallenge is returned by a login whose password matched for a user
+// with MFA; the login completes by sending MFAToken with a code.
+type MFAChallenge struct {
+	MFARequired bool      `json:"mfa_required"`
+	MFAToken    string    `json:"mfa_token"`
+	ExpiresIn   int       `json:"expires_in"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// LoginResult holds either an access token or an MFA challenge, and
+// serializes as the one that is set.
+type LoginResult struct {
+	AccessToken  *AccessToken
+	MFAChallenge *MFAChallenge
+}
+
+func (r LoginResult) MarshalJSON() ([]byte, error) {
+	if r.MFAChallenge != nil {
+		return json.Marshal(r.MFAChallenge)
+	}
+	return json.Marshal(r.AccessToken)
+}
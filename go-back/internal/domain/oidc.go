@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrOIDCLoginFailed covers callbacks that do not complete the login
+	// they claim to: a missing or mismatched state, an authorization denied
+	// or expired at the provider, or an ID token that fails verification.
+	ErrOIDCLoginFailed             = errors.New("oidc login failed")
+	ErrIdentityProviderUnavailable = errors.New("identity provider unavailable")
+)
+
+// OIDCLogin is a login started at the identity provider, which the user is
+// sent to at URL. State, Nonce and Verifier stay with the browser of the
+// user until the callback, which must bring them back before ExpiresAt.
+type OIDCLogin struct {
+	URL       string
+	State     string
+	Nonce     string
+	Verifier  string
+	ExpiresAt time.Time
+}
+
+// OIDCCallback is the query the identity provider redirects back with.
+type OIDCCallback struct {
+	Code             string `form:"code"`
+	State            string `form:"state"`
+	Error            string `form:"error"`
+	ErrorDescription string `form:"error_description"`
+}
@@ -0,0 +1,150 @@
+package domain
+
+import (
+	"slices"
+	"time"
+)
+
+type Role string
+
+const (
+	RoleAdmin   Role = "admin"
+	RoleSupport Role = "support"
+	RoleViewer  Role = "viewer"
+	// RoleSelf is held implicitly by every active user and only grants
+	// access to their own account.
+	RoleSelf Role = "self"
+)
+
+type Permission string
+
+const (
+	PermUsersRead         Permission = "users:read"
+	PermUsersWrite        Permission = "users:write"
+	PermUsersToggleActive Permission = "users:toggle_active"
+	PermUsersDelete       Permission = "users:delete"
+	PermAuditRead         Permission = "audit:read"
+	PermRolesRead         Permission = "roles:read"
+	PermRolesWrite        Permission = "roles:write"
+	PermAPIKeysRead       Permission = "api_keys:read"
+	PermAPIKeysWrite      Permission = "api_keys:write"
+	PermMetricsRead       Permission = "metrics:read"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin: {
+		PermUsersRead, PermUsersWrite, PermUsersToggleActive, PermUsersDelete,
+		PermAuditRead, PermRolesRead, PermRolesWrite, PermAPIKeysRead, PermAPIKeysWrite,
+		PermMetricsRead,
+	},
+	RoleSupport: {PermUsersRead, PermUsersWrite, PermUsersToggleActive, PermAuditRead},
+	RoleViewer:  {PermUsersRead},
+	RoleSelf:    {PermUsersRead, PermUsersWrite},
+}
+
+// AssignableRole reports whether role can be stored for a user; RoleSelf
+// cannot, as every user holds it already.
+func AssignableRole(role Role) bool {
+	return role == RoleAdmin || role == RoleSupport || role == RoleViewer
+}
+
+type RoleGrant struct {
+	UserUUID  string    `json:"user_uuid" ksql:"user_uuid"`
+	Role      Role      `json:"role" ksql:"role"`
+	GrantedBy string    `json:"granted_by" ksql:"granted_by"`
+	GrantedAt time.Time `json:"granted_at" ksql:"granted_at"`
+}
+
+type RoleInput struct {
+	Role Role `json:"role" binding:"required,oneof=admin support viewer"`
+}
+
+// Principal is an authenticated caller and the roles it holds.
+type Principal struct {
+	Subject string
+	Roles   []Role
+	// Withheld are roles the subject holds but that require MFA, which
+	// the caller did not pass. They grant nothing.
+	Withheld []Role
+	// Scopes are permissions held over every user without a role, as
+	// granted to API keys. They only reach the accounts of users whose
+	// roles grant no permission outside of them.
+	Scopes []Permission
+}
+
+// NeedsMFA reports whether perm would be granted by a withheld role, that
+// is, whether logging in with MFA would give it.
+func (p Principal) NeedsMFA(perm Permission) bool {
+	for _, role := range p.Withheld {
+		if roleHas(role, perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// Has reports whether the principal holds perm at all, possibly only over
+// its own account. It is enough to reach a route; Can decides per object.
+func (p Principal) Has(perm Permission) bool {
+	if p.scoped(perm) {
+		return true
+	}
+	for _, role := range p.Roles {
+		if roleHas(role, perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// Can reports whether the principal may use perm on the user targetUUID.
+// An empty targetUUID stands for operations not bound to one user, such as
+// listing or creating users, which RoleSelf never allows.
+func (p Principal) Can(perm Permission, targetUUID string) bool {
+	if p.scoped(perm) {
+		return true
+	}
+	for _, role := range p.Roles {
+		if !roleHas(role, perm) {
+			continue
+		}
+		if role != RoleSelf || (targetUUID != "" && targetUUID == p.Subject) {
+			return true
+		}
+	}
+	return false
+}
+
+// Outranks reports whether the principal holds every permission granted
+// by roles, over every user. Writing to the account of another user takes
+// outranking the roles that user holds.
+func (p Principal) Outranks(roles []Role) bool {
+	for _, role := range roles {
+		for _, perm := range rolePermissions[role] {
+			if !p.scoped(perm) && !slices.ContainsFunc(p.Roles, func(held Role) bool {
+				return held != RoleSelf && roleHas(held, perm)
+			}) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (p Principal) scoped(perm Permission) bool {
+	for _, scope := range p.Scopes {
+		if scope == perm {
+			return true
+		}
+	}
+	return false
+}
+
+func roleHas(role Role, perm Permission) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == perm {
+			return true
+		}
+	}
+	return false
+}
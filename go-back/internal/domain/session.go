@@ -0,0 +1,64 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	AuditSessionRevoked     = "user.session_revoked"
+	AuditRefreshTokenReused = "user.refresh_token_reused"
+)
+
+// Reasons a session was revoked.
+const (
+	SessionLogout             = "logout"
+	SessionUserDeactivated    = "user_deactivated"
+	SessionUserDeleted        = "user_deleted"
+	SessionPasswordChanged    = "password_changed"
+	SessionRefreshTokenReused = "refresh_token_reused"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrRefreshTokenReused is a refresh token presented again after it was
+	// rotated, a sign that it leaked.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// Session is a login of a user on one device. Its refresh tokens form a
+// family: each refresh rotates the token, and reusing a rotated one
+// revokes the whole session. AMR holds the authentication methods of the
+// login, space separated, so refreshed access tokens keep them.
+type Session struct {
+	ID            string     `json:"id" ksql:"id"`
+	UserUUID      string     `json:"user_uuid" ksql:"user_uuid"`
+	UserAgent     string     `json:"user_agent" ksql:"user_agent"`
+	IP            string     `json:"ip" ksql:"ip"`
+	AMR           string     `json:"-" ksql:"amr"`
+	CreatedAt     time.Time  `json:"created_at" ksql:"created_at"`
+	LastUsedAt    time.Time  `json:"last_used_at" ksql:"last_used_at"`
+	ExpiresAt     time.Time  `json:"expires_at" ksql:"expires_at"`
+	RevokedAt     *time.Time `json:"-" ksql:"revoked_at"`
+	RevokedReason string     `json:"-" ksql:"revoked_reason"`
+	// Current marks the session of the caller in listings.
+	Current bool `json:"current"`
+}
+
+// Active reports whether the session can still be used at now.
+func (s Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// RefreshToken is one token of a session. Only its SHA-256 is stored.
+type RefreshToken struct {
+	TokenHash string     `ksql:"token_hash"`
+	SessionID string     `ksql:"session_id"`
+	CreatedAt time.Time  `ksql:"created_at"`
+	ExpiresAt time.Time  `ksql:"expires_at"`
+	UsedAt    *time.Time `ksql:"used_at"`
+}
+
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type TokenPurpose string
+
+const (
+	TokenEmailVerification TokenPurpose = "email_verification"
+	TokenPasswordReset     TokenPurpose = "password_reset"
+	// TokenMFAChallenge links the two steps of a login with MFA. It is
+	// handed out after the password matched, never mailed.
+	TokenMFAChallenge TokenPurpose = "mfa_challenge"
+)
+
+var (
+	// ErrInvalidToken covers unknown, expired and already used tokens.
+	ErrInvalidToken    = errors.New("token is invalid or expired")
+	ErrTooManyRequests = errors.New("too many requests")
+	// ErrTokenRevoked is a bearer token with a valid signature that was
+	// revoked before it expired.
+	ErrTokenRevoked = errors.New("token revoked")
+)
+
+// UserToken is a single-use token mailed to a user. The token itself is
+// only known to the recipient; TokenHash is its SHA-256.
+type UserToken struct {
+	TokenHash string       `ksql:"token_hash"`
+	UserUUID  string       `ksql:"user_uuid"`
+	Purpose   TokenPurpose `ksql:"purpose"`
+	Email     string       `ksql:"email"`
+	CreatedAt time.Time    `ksql:"created_at"`
+	ExpiresAt time.Time    `ksql:"expires_at"`
+	UsedAt    *time.Time   `ksql:"used_at"`
+}
+
+type TokenInput struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// RetryAfterError is an ErrTooManyRequests telling when to try again.
+type RetryAfterError struct {
+	After time.Duration
+}
+
+func (e RetryAfterError) Error() string {
+	return fmt.Sprintf("%s: retry after %s", ErrTooManyRequests, e.After)
+}
+
+func (e RetryAfterError) Unwrap() error {
+	return ErrTooManyRequests
+}
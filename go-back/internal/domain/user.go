@@ -3,15 +3,82 @@ package domain
 import "time"
 
 type User struct {
-	UUID      string    `json:"uuid" ksql:"uuid"`
-	Name      string    `json:"name" ksql:"name"`
-	Email     string    `json:"email" ksql:"email"`
-	CreatedAt time.Time `json:"created_at" ksql:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" ksql:"updated_at"`
-	IsActive  bool      `json:"is_active" ksql:"is_active"`
+	UUID      string     `json:"uuid" ksql:"uuid"`
+	Name      string     `json:"name" ksql:"name"`
+	Email     string     `json:"email" ksql:"email"`
+	CreatedAt time.Time  `json:"created_at" ksql:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" ksql:"updated_at"`
+	IsActive  bool       `json:"is_active" ksql:"is_active"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty" ksql:"deleted_at"`
+	Version   int        `json:"version" ksql:"version"`
+
+	// EmailVerifiedAt is nil until the user proves they own Email, and is
+	// reset whenever Email changes.
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty" ksql:"email_verified_at"`
 }
 
 type UserInput struct {
 	Name  string `json:"name" binding:"required"`
 	Email string `json:"email" binding:"required,email"`
 }
+
+type UserFilter struct {
+	Limit          int        `form:"limit" binding:"omitempty,min=1,max=200"`
+	Cursor         string     `form:"cursor"`
+	IsActive       *bool      `form:"is_active"`
+	EmailDomain    string     `form:"email_domain"`
+	CreatedAfter   *time.Time `form:"created_after"`
+	CreatedBefore  *time.Time `form:"created_before"`
+	Query          string     `form:"q"`
+	IncludeDeleted bool       `form:"include_deleted"`
+	Sort           string     `form:"sort" binding:"omitempty,oneof=created_at -created_at updated_at -updated_at name -name email -email"`
+
+	// After is the decoded Cursor: the sort value and uuid of the last user
+	// of the previous page.
+	After *UserCursor `form:"-"`
+}
+
+type UserCursor struct {
+	Value string `json:"v"`
+	UUID  string `json:"u"`
+}
+
+type UserPage struct {
+	Users      []User
+	NextCursor string
+}
+
+// SortColumn splits Sort into the column name and whether it is descending.
+func (f UserFilter) SortColumn() (column string, desc bool) {
+	if f.Sort == "" {
+		return "created_at", false
+	}
+	if f.Sort[0] == '-' {
+		return f.Sort[1:], true
+	}
+	return f.Sort, false
+}
+
+// AfterValue returns the cursor value typed for the sort column, ready to
+// be compared against it.
+func (f UserFilter) AfterValue() (interface{}, error) {
+	column, _ := f.SortColumn()
+	if column == "created_at" || column == "updated_at" {
+		return time.Parse(time.RFC3339Nano, f.After.Value)
+	}
+	return f.After.Value, nil
+}
+
+// SortValue returns the value of the sort column used to build cursors.
+func (u User) SortValue(column string) string {
+	switch column {
+	case "name":
+		return u.Name
+	case "email":
+		return u.Email
+	case "updated_at":
+		return u.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	default:
+		return u.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+}
@@ -0,0 +1,13 @@
+package domain
+
+import "time"
+
+// WebhookEvent is what webhook subscribers receive when a user changes.
+// Type is the audit action of the change, such as "user.created", and ID
+// stays the same across retries so subscribers can drop duplicates.
+type WebhookEvent struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Data       User      `json:"data"`
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"go-back/internal/domain"
+	"go-back/internal/http/middleware"
+	"go-back/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyController struct {
+	APIKeyService service.APIKeyService
+}
+
+func NewAPIKeyController(s service.APIKeyService) *APIKeyController {
+	return &APIKeyController{APIKeyService: s}
+}
+
+func (kc *APIKeyController) ListAPIKeys(c *gin.Context) {
+	keys, err := kc.APIKeyService.ListAPIKeys(requestContext(c))
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Error("request failed", "controller", "APIKeyController", "func", "ListAPIKeys", "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    keys,
+	})
+}
+
+func (kc *APIKeyController) GetAPIKey(c *gin.Context) {
+	id := c.Param("id")
+
+	key, err := kc.APIKeyService.GetAPIKey(requestContext(c), id)
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Error("request failed", "controller", "APIKeyController", "func", "GetAPIKey", "keyID", id, "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    key,
+	})
+}
+
+func (kc *APIKeyController) CreateAPIKey(c *gin.Context) {
+	var input domain.APIKeyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		abortWithError(c, invalidInput("invalid request body", err))
+		return
+	}
+
+	key, err := kc.APIKeyService.CreateAPIKey(requestContext(c), input)
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Error("request failed", "controller", "APIKeyController", "func", "CreateAPIKey", "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Store the key now, it will not be shown again.",
+		"data":    key,
+	})
+}
+
+func (kc *APIKeyController) UpdateAPIKey(c *gin.Context) {
+	id := c.Param("id")
+
+	var input domain.APIKeyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		abortWithError(c, invalidInput("invalid request body", err))
+		return
+	}
+
+	key, err := kc.APIKeyService.UpdateAPIKey(requestContext(c), id, input)
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Error("request failed", "controller", "APIKeyController", "func", "UpdateAPIKey", "keyID", id, "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    key,
+	})
+}
+
+func (kc *APIKeyController) RevokeAPIKey(c *gin.Context) {
+	id := c.Param("id")
+
+	err := kc.APIKeyService.RevokeAPIKey(requestContext(c), id)
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Error("request failed", "controller", "APIKeyController", "func", "RevokeAPIKey", "keyID", id, "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "API key revoked.",
+	})
+}
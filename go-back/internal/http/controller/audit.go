@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"context"
+	"go-back/internal/domain"
+	"go-back/internal/http/middleware"
+	"go-back/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditController struct {
+	AuditService service.AuditService
+}
+
+func NewAuditController(s service.AuditService) *AuditController {
+	return &AuditController{AuditService: s}
+}
+
+func (ac *AuditController) ListAuditEvents(c *gin.Context) {
+	var filter domain.AuditFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		abortWithError(c, invalidInput("invalid query parameters", err))
+		return
+	}
+
+	page, err := ac.AuditService.ListAuditEvents(requestContext(c), filter)
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Error("request failed", "controller", "AuditController", "func", "ListAuditEvents", "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"data":        page.Events,
+		"next_cursor": page.NextCursor,
+	})
+}
+
+// requestContext returns the request context carrying the audit actor: the
+// authenticated subject, the request ID, the client IP, its user agent and
+// session.
+func requestContext(c *gin.Context) context.Context {
+	return service.WithActor(c.Request.Context(), service.Actor{
+		ID:        middleware.GetSubject(c),
+		RequestID: requestID(c),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		SessionID: middleware.GetSessionID(c),
+	})
+}
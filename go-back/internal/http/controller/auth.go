@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"go-back/internal/domain"
+	"go-back/internal/http/middleware"
+	"go-back/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuthController struct {
+	AuthService service.AuthService
+}
+
+func NewAuthController(s service.AuthService) *AuthController {
+	return &AuthController{AuthService: s}
+}
+
+func (ac *AuthController) Login(c *gin.Context) {
+	var input domain.LoginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		abortWithError(c, invalidInput("invalid request body", err))
+		return
+	}
+
+	result, err := ac.AuthService.Login(requestContext(c), input)
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Warn("login failed", "controller", "AuthController", "func", "Login", "email", input.Email, "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+func (ac *AuthController) LoginMFA(c *gin.Context) {
+	var input domain.MFALoginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		abortWithError(c, invalidInput("invalid request body", err))
+		return
+	}
+
+	token, err := ac.AuthService.LoginMFA(requestContext(c), input)
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Warn("login failed", "controller", "AuthController", "func", "LoginMFA", "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    token,
+	})
+}
+
+func (ac *AuthController) Refresh(c *gin.Context) {
+	var input domain.RefreshInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		abortWithError(c, invalidInput("invalid request body", err))
+		return
+	}
+
+	token, err := ac.AuthService.Refresh(requestContext(c), input.RefreshToken)
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Warn("refresh failed", "controller", "AuthController", "func", "Refresh", "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    token,
+	})
+}
+
+func (ac *AuthController) SetPassword(c *gin.Context) {
+	userUUID := c.Param("userUUID")
+
+	var input domain.PasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		abortWithError(c, invalidInput("invalid request body", err))
+		return
+	}
+
+	err := ac.AuthService.SetPassword(requestContext(c), userUUID, input)
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Error("request failed", "controller", "AuthController", "func", "SetPassword", "userUUID", userUUID, "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Password updated.",
+	})
+}
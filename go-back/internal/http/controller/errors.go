@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-back/internal/domain"
+	"go-back/internal/http/middleware"
+	"go-back/internal/service"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errIfMatchRequired is returned when REQUIRE_IF_MATCH is set and an update
+// comes without If-Match.
+var errIfMatchRequired = errors.New("If-Match header is required")
+
+type errorResponse struct {
+	err    error
+	status int
+	slug   string
+	title  string
+	detail string
+}
+
+// errorResponses maps domain errors to problem details. Errors are matched
+// with errors.Is in order, so wrapped errors resolve to their domain cause.
+var errorResponses = []errorResponse{
+	{domain.ErrUserNotFound, http.StatusNotFound, "user-not-found", "User not found", "no user found for this userUUID"},
+	{domain.ErrAPIKeyNotFound, http.StatusNotFound, "api-key-not-found", "API key not found", "no API key found for this id"},
+	{domain.ErrSessionNotFound, http.StatusNotFound, "session-not-found", "Session not found", "no active session found for this id"},
+	{domain.ErrEmailTaken, http.StatusConflict, "email-taken", "Email already in use", "another user already has this email"},
+	{domain.ErrInvalidCredentials, http.StatusUnauthorized, "invalid-credentials", "Invalid credentials", "the credentials provided are incorrect"},
+	{domain.ErrOIDCLoginFailed, http.StatusUnauthorized, "oidc-login-failed", "Login failed", "the login at the identity provider failed or expired, start it again"},
+	{domain.ErrIdentityProviderUnavailable, http.StatusBadGateway, "identity-provider-unavailable", "Identity provider unavailable", "the identity provider could not be reached, try again later"},
+	{domain.ErrWeakPassword, http.StatusBadRequest, "weak-password", "Weak password", "the password does not meet the password policy"},
+	{domain.ErrEmailNotVerified, http.StatusForbidden, "email-not-verified", "Email not verified", "verify your email before logging in"},
+	{domain.ErrInvalidToken, http.StatusBadRequest, "invalid-token", "Invalid token", "the token is invalid, expired or was already used"},
+	{domain.ErrInvalidMFACode, http.StatusBadRequest, "invalid-mfa-code", "Invalid MFA code", "the code is wrong, expired or was already used"},
+	{domain.ErrMFANotEnabled, http.StatusConflict, "mfa-not-enabled", "MFA not enabled", "the user has not enabled multi-factor authentication"},
+	{domain.ErrTooManyRequests, http.StatusTooManyRequests, "too-many-requests", "Too many requests", "slow down and try again later"},
+	{domain.ErrMFARequired, http.StatusForbidden, "mfa-required", "MFA required", "log in with multi-factor authentication to perform this action"},
+	{domain.ErrForbidden, http.StatusForbidden, "forbidden", "Forbidden", "you are not allowed to perform this action"},
+	{domain.ErrVersionMismatch, http.StatusPreconditionFailed, "version-mismatch", "Precondition failed", "user was modified by another request, reload it and try again"},
+	{domain.ErrConflict, http.StatusConflict, "conflict", "Conflict", "conflicting request, try again"},
+	{service.ErrInvalidCursor, http.StatusBadRequest, "invalid-cursor", "Invalid cursor", "the cursor is malformed or was built for another sort order"},
+	{domain.ErrInvalidInput, http.StatusBadRequest, "invalid-input", "Invalid input", "the request could not be processed"},
+	{errIfMatchRequired, http.StatusPreconditionRequired, "if-match-required", "Precondition required", "send the ETag of the user in an If-Match header"},
+	{context.DeadlineExceeded, http.StatusGatewayTimeout, "timeout", "Request timed out", "the request took too long to complete"},
+	{context.Canceled, middleware.StatusClientClosedRequest, "client-closed-request", "Client closed request", "the request was canceled before it completed"},
+}
+
+var internalErrorResponse = errorResponse{
+	status: http.StatusInternalServerError,
+	slug:   "internal-error",
+	title:  "Internal server error",
+	detail: "an unexpected error occurred",
+}
+
+// abortWithError writes err as an application/problem+json response and
+// aborts the request. It is the only place handlers turn errors into
+// status codes.
+func abortWithError(c *gin.Context, err error) {
+	response := internalErrorResponse
+	for _, candidate := range errorResponses {
+		if errors.Is(err, candidate.err) {
+			response = candidate
+			break
+		}
+	}
+
+	problem := Problem{
+		Type:      problemTypeBase + response.slug,
+		Title:     response.title,
+		Status:    response.status,
+		Detail:    response.detail,
+		Instance:  c.Request.URL.Path,
+		RequestID: requestID(c),
+	}
+
+	var input inputError
+	if errors.As(err, &input) {
+		problem.Detail = input.message
+		problem.Errors = fieldErrors(input.cause)
+	}
+	var policy domain.PasswordPolicyError
+	if errors.As(err, &policy) {
+		problem.Detail = policy.Reason
+	}
+	var retry domain.RetryAfterError
+	if errors.As(err, &retry) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retry.After.Seconds()))))
+	}
+
+	c.Header("Content-Type", problemContentType)
+	c.AbortWithStatusJSON(problem.Status, problem)
+}
+
+// inputError is a domain.ErrInvalidInput raised by the HTTP layer itself,
+// whose message is safe to show to the client. Invalid input reported by
+// the storage only gets a generic message, since it carries driver details.
+type inputError struct {
+	message string
+	cause   error
+}
+
+func invalidInput(message string, cause error) error {
+	return inputError{message: message, cause: cause}
+}
+
+func (e inputError) Error() string {
+	if e.cause == nil {
+		return e.message
+	}
+	return fmt.Sprintf("%s: %v", e.message, e.cause)
+}
+
+func (e inputError) Unwrap() []error {
+	if e.cause == nil {
+		return []error{domain.ErrInvalidInput}
+	}
+	return []error{domain.ErrInvalidInput, e.cause}
+}
@@ -0,0 +1,39 @@
+package controller
+
+import (
+	config "go-back/internal/cmd/server"
+	"go-back/internal/domain"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func userETag(user domain.User) string {
+	return `"` + strconv.Itoa(user.Version) + `"`
+}
+
+// ifMatchVersion reads the user version sent in If-Match. It returns 0 when
+// the header is absent or "*", meaning the write is not conditional, and
+// errIfMatchRequired when it is absent while REQUIRE_IF_MATCH is set.
+func ifMatchVersion(c *gin.Context) (int, error) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		if config.REQUIRE_IF_MATCH {
+			return 0, errIfMatchRequired
+		}
+		return 0, nil
+	}
+
+	if header == "*" {
+		return 0, nil
+	}
+
+	tag := strings.TrimPrefix(header, "W/")
+	version, err := strconv.Atoi(strings.Trim(tag, `"`))
+	if err != nil || version < 1 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+		return 0, invalidInput("invalid If-Match header", nil)
+	}
+
+	return version, nil
+}
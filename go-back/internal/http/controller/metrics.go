@@ -0,0 +1,13 @@
+package controller
+
+import (
+	"expvar"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics serves the variables published through expvar, such as the
+// memory stats of the Go runtime and the read stats of the users.
+func Metrics(c *gin.Context) {
+	expvar.Handler().ServeHTTP(c.Writer, c.Request)
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"go-back/internal/domain"
+	"go-back/internal/http/middleware"
+	"go-back/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MFAController struct {
+	MFAService service.MFAService
+}
+
+func NewMFAController(s service.MFAService) *MFAController {
+	return &MFAController{MFAService: s}
+}
+
+func (mc *MFAController) GetMFA(c *gin.Context) {
+	userUUID := c.Param("userUUID")
+
+	status, err := mc.MFAService.GetMFA(requestContext(c), userUUID)
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Error("request failed", "controller", "MFAController", "func", "GetMFA", "userUUID", userUUID, "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    status,
+	})
+}
+
+func (mc *MFAController) EnrollTOTP(c *gin.Context) {
+	userUUID := c.Param("userUUID")
+
+	enrollment, err := mc.MFAService.EnrollTOTP(requestContext(c), userUUID)
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Error("request failed", "controller", "MFAController", "func", "EnrollTOTP", "userUUID", userUUID, "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Scan the QR code and confirm with a code from the app.",
+		"data":    enrollment,
+	})
+}
+
+func (mc *MFAController) ConfirmTOTP(c *gin.Context) {
+	userUUID := c.Param("userUUID")
+
+	var input domain.MFACodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		abortWithError(c, invalidInput("invalid request body", err))
+		return
+	}
+
+	codes, err := mc.MFAService.ConfirmTOTP(requestContext(c), userUUID, input.Code)
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Warn("request failed", "controller", "MFAController", "func", "ConfirmTOTP", "userUUID", userUUID, "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "MFA enabled. Store the recovery codes somewhere safe; they are not shown again.",
+		"data":    codes,
+	})
+}
+
+func (mc *MFAController) RegenerateRecoveryCodes(c *gin.Context) {
+	userUUID := c.Param("userUUID")
+
+	var input domain.MFACodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		abortWithError(c, invalidInput("invalid request body", err))
+		return
+	}
+
+	codes, err := mc.MFAService.RegenerateRecoveryCodes(requestContext(c), userUUID, input.Code)
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Warn("request failed", "controller", "MFAController", "func", "RegenerateRecoveryCodes", "userUUID", userUUID, "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Recovery codes replaced.",
+		"data":    codes,
+	})
+}
+
+// DisableMFA takes a code in the body when users disable their own MFA;
+// callers disabling it for someone else send no body.
+func (mc *MFAController) DisableMFA(c *gin.Context) {
+	userUUID := c.Param("userUUID")
+
+	var input struct {
+		Code string `json:"code"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			abortWithError(c, invalidInput("invalid request body", err))
+			return
+		}
+	}
+
+	if err := mc.MFAService.DisableMFA(requestContext(c), userUUID, input.Code); err != nil {
+		middleware.Logger(c.Request.Context()).Warn("request failed", "controller", "MFAController", "func", "DisableMFA", "userUUID", userUUID, "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "MFA disabled.",
+	})
+}
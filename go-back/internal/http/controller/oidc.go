@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"go-back/internal/domain"
+	"go-back/internal/http/middleware"
+	"go-back/internal/service"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oidcCookie keeps the state, nonce and PKCE verifier of a login between
+// the redirect to the identity provider and its callback, so they never
+// leave the browser that started it.
+const (
+	oidcCookie     = "oidc_login"
+	oidcCookiePath = "/api/auth/oidc"
+)
+
+type OIDCController struct {
+	OIDCService service.OIDCService
+}
+
+func (oc *OIDCController) Login(c *gin.Context) {
+	login, err := oc.OIDCService.StartLogin(requestContext(c))
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Error("request failed", "controller", "OIDCController", "func", "Login", "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	value := strings.Join([]string{login.State, login.Nonce, login.Verifier}, ".")
+	setOIDCCookie(c, value, int(time.Until(login.ExpiresAt).Seconds()))
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, login.URL)
+}
+
+func (oc *OIDCController) Callback(c *gin.Context) {
+	var callback domain.OIDCCallback
+	if err := c.ShouldBindQuery(&callback); err != nil {
+		abortWithError(c, invalidInput("invalid query parameters", err))
+		return
+	}
+
+	// Each login is good for one callback, whatever its outcome.
+	var started domain.OIDCLogin
+	if value, err := c.Cookie(oidcCookie); err == nil {
+		if parts := strings.Split(value, "."); len(parts) == 3 {
+			started = domain.OIDCLogin{State: parts[0], Nonce: parts[1], Verifier: parts[2]}
+		}
+	}
+	setOIDCCookie(c, "", -1)
+
+	result, err := oc.OIDCService.FinishLogin(requestContext(c), callback, started)
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Warn("login failed", "controller", "OIDCController", "func", "Callback", "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// setOIDCCookie sends the cookie Lax, as the callback is a top-level
+// redirect from the provider, and Secure whenever the request came over
+// HTTPS, directly or through a proxy.
+func setOIDCCookie(c *gin.Context, value string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcCookie, value, maxAge, oidcCookiePath, "", secure, true)
+}
@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"go-back/internal/domain"
+	"go-back/internal/http/middleware"
+	"go-back/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PasswordResetController struct {
+	PasswordResetService service.PasswordResetService
+}
+
+func NewPasswordResetController(s service.PasswordResetService) *PasswordResetController {
+	return &PasswordResetController{PasswordResetService: s}
+}
+
+// ForgotPassword answers 202 for any valid email, whether or not it
+// belongs to a user, so it cannot be used to find accounts. Failures are
+// only logged for the same reason.
+func (pc *PasswordResetController) ForgotPassword(c *gin.Context) {
+	var input domain.ForgotPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		abortWithError(c, invalidInput("invalid request body", err))
+		return
+	}
+
+	if err := pc.PasswordResetService.ForgotPassword(requestContext(c), input.Email); err != nil {
+		middleware.Logger(c.Request.Context()).Error("request failed", "controller", "PasswordResetController", "func", "ForgotPassword", "err", err)
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"message": "If the email belongs to an account, a reset link was sent to it.",
+	})
+}
+
+func (pc *PasswordResetController) ResetPassword(c *gin.Context) {
+	var input domain.ResetPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		abortWithError(c, invalidInput("invalid request body", err))
+		return
+	}
+
+	if err := pc.PasswordResetService.ResetPassword(requestContext(c), input); err != nil {
+		middleware.Logger(c.Request.Context()).Warn("request failed", "controller", "PasswordResetController", "func", "ResetPassword", "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Password updated.",
+	})
+}
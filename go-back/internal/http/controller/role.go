@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"go-back/internal/domain"
+	"go-back/internal/http/middleware"
+	"go-back/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoleController struct {
+	RoleService service.RoleService
+}
+
+func NewRoleController(s service.RoleService) *RoleController {
+	return &RoleController{RoleService: s}
+}
+
+func (rc *RoleController) ListRoles(c *gin.Context) {
+	userUUID := c.Param("userUUID")
+
+	grants, err := rc.RoleService.ListRoles(requestContext(c), userUUID)
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Error("request failed", "controller", "RoleController", "func", "ListRoles", "userUUID", userUUID, "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    grants,
+	})
+}
+
+func (rc *RoleController) GrantRole(c *gin.Context) {
+	userUUID := c.Param("userUUID")
+
+	var input domain.RoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		abortWithError(c, invalidInput("invalid request body", err))
+		return
+	}
+
+	grants, err := rc.RoleService.GrantRole(requestContext(c), userUUID, input.Role)
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Error("request failed", "controller", "RoleController", "func", "GrantRole", "userUUID", userUUID, "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Role granted.",
+		"data":    grants,
+	})
+}
+
+func (rc *RoleController) RevokeRole(c *gin.Context) {
+	userUUID := c.Param("userUUID")
+	role := domain.Role(c.Param("role"))
+
+	grants, err := rc.RoleService.RevokeRole(requestContext(c), userUUID, role)
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Error("request failed", "controller", "RoleController", "func", "RevokeRole", "userUUID", userUUID, "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Role revoked.",
+		"data":    grants,
+	})
+}
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"go-back/internal/http/middleware"
+	"go-back/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SessionController struct {
+	SessionService service.SessionService
+}
+
+func NewSessionController(s service.SessionService) *SessionController {
+	return &SessionController{SessionService: s}
+}
+
+// ListSessions lists the sessions of the caller.
+func (sc *SessionController) ListSessions(c *gin.Context) {
+	userUUID := middleware.GetSubject(c)
+
+	sessions, err := sc.SessionService.ListSessions(requestContext(c), userUUID)
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Error("request failed", "controller", "SessionController", "func", "ListSessions", "userUUID", userUUID, "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    sessions,
+	})
+}
+
+func (sc *SessionController) RevokeSession(c *gin.Context) {
+	id := c.Param("id")
+
+	err := sc.SessionService.RevokeSession(requestContext(c), id)
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Error("request failed", "controller", "SessionController", "func", "RevokeSession", "sessionID", id, "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Session revoked.",
+	})
+}
@@ -1,18 +1,14 @@
 package controller
 
 import (
-	"database/sql"
-	"errors"
 	"go-back/internal/domain"
+	"go-back/internal/http/middleware"
 	"go-back/internal/service"
-	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
-var ErrNoRows = errors.New("sql: no rows in result set")
-
 type UserController struct {
 	UserService service.UserService
 }
@@ -22,53 +18,43 @@ func NewUserController(s service.UserService) *UserController {
 }
 
 func (uc *UserController) ListAllUsers(c *gin.Context) {
-	users, err := uc.UserService.ListAllUsers()
-	if err != nil {
-		log.Printf("controller=UserController func=ListUser err=%v", err)
-
-		status := http.StatusInternalServerError
-		message := "internal error"
-
-		if errors.Is(err, ErrNoRows) {
-			status = http.StatusNotFound
-			message = "no user found for this userUUID"
-		}
+	var filter domain.UserFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		abortWithError(c, invalidInput("invalid query parameters", err))
+		return
+	}
 
-		c.AbortWithStatusJSON(status, gin.H{
-			"success": false,
-			"message": message,
-		})
+	page, err := uc.UserService.ListAllUsers(requestContext(c), filter)
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Error("request failed", "controller", "UserController", "func", "ListAllUsers", "err", err)
+		abortWithError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data":    users,
+		"success":     true,
+		"data":        page.Users,
+		"next_cursor": page.NextCursor,
 	})
 }
 
 func (uc *UserController) ListUser(c *gin.Context) {
 	userUUID := c.Param("userUUID")
 
-	user, err := uc.UserService.ListUserByUUID(userUUID)
+	var user domain.User
+	var err error
+	if c.Query("include_deleted") == "true" {
+		user, err = uc.UserService.ListUserByUUIDWithDeleted(requestContext(c), userUUID)
+	} else {
+		user, err = uc.UserService.ListUserByUUID(requestContext(c), userUUID)
+	}
 	if err != nil {
-		log.Printf("controller=UserController func=ListUser userUUID=%s err=%v", userUUID, err)
-
-		status := http.StatusInternalServerError
-		message := "internal error"
-
-		if errors.Is(err, ErrNoRows) {
-			status = http.StatusNotFound
-			message = "no user found for this userUUID"
-		}
-
-		c.AbortWithStatusJSON(status, gin.H{
-			"success": false,
-			"message": message,
-		})
+		middleware.Logger(c.Request.Context()).Error("request failed", "controller", "UserController", "func", "ListUser", "userUUID", userUUID, "err", err)
+		abortWithError(c, err)
 		return
 	}
 
+	c.Header("ETag", userETag(user))
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data":    user,
@@ -78,36 +64,32 @@ func (uc *UserController) ListUser(c *gin.Context) {
 func (uc *UserController) UpdateUser(c *gin.Context) {
 	userUUID := c.Param("userUUID")
 	if userUUID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"message": "userUUID is required",
-		})
+		abortWithError(c, invalidInput("userUUID is required", nil))
 		return
 	}
 
 	var previewUser domain.User
 	if err := c.ShouldBindJSON(&previewUser); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"message": "invalid request body",
-		})
+		abortWithError(c, invalidInput("invalid request body", err))
 		return
 	}
 	previewUser.UUID = userUUID
 
-	currentUser, err := uc.UserService.ListUserByUUID(previewUser.UUID)
+	expectedVersion, err := ifMatchVersion(c)
 	if err != nil {
-		log.Printf("controller=UserController func=UpdateUser userUUID=%s err=%v", previewUser.UUID, err)
-		status := http.StatusInternalServerError
-		message := "internal error"
-		if errors.Is(err, ErrNoRows) {
-			status = http.StatusNotFound
-			message = "no user found for this userUUID"
-		}
-		c.AbortWithStatusJSON(status, gin.H{
-			"success": false,
-			"message": message,
-		})
+		abortWithError(c, err)
+		return
+	}
+
+	currentUser, err := uc.UserService.ListUserByUUID(requestContext(c), previewUser.UUID)
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Error("request failed", "controller", "UserController", "func", "UpdateUser", "userUUID", previewUser.UUID, "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	if expectedVersion != 0 && expectedVersion != currentUser.Version {
+		abortWithError(c, domain.ErrVersionMismatch)
 		return
 	}
 
@@ -124,6 +106,7 @@ func (uc *UserController) UpdateUser(c *gin.Context) {
 	}
 
 	if !changed {
+		c.Header("ETag", userETag(currentUser))
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
 			"message": "No changes detected.",
@@ -132,16 +115,14 @@ func (uc *UserController) UpdateUser(c *gin.Context) {
 		return
 	}
 
-	updatedUser, err := uc.UserService.UpdateUser(currentUser)
+	updatedUser, err := uc.UserService.UpdateUser(requestContext(c), currentUser)
 	if err != nil {
-		log.Printf("controller=UserController func=UpdateUser userUUID=%s err=%v", previewUser.UUID, err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"message": "failed to update user",
-		})
+		middleware.Logger(c.Request.Context()).Error("request failed", "controller", "UserController", "func", "UpdateUser", "userUUID", previewUser.UUID, "err", err)
+		abortWithError(c, err)
 		return
 	}
 
+	c.Header("ETag", userETag(updatedUser))
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "User updated.",
@@ -152,23 +133,24 @@ func (uc *UserController) UpdateUser(c *gin.Context) {
 func (uc *UserController) ManageActivateUser(c *gin.Context) {
 	userUUID := c.Param("userUUID")
 	if userUUID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"message": "userUUID is required",
-		})
+		abortWithError(c, invalidInput("userUUID is required", nil))
 		return
 	}
 
-	user, err := uc.UserService.ManageActivateUser(userUUID)
+	expectedVersion, err := ifMatchVersion(c)
 	if err != nil {
-		log.Printf("controller=UserController func=UpdateUser userUUID=%s err=%v", userUUID, err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"message": "failed to update user",
-		})
+		abortWithError(c, err)
 		return
 	}
 
+	user, err := uc.UserService.ManageActivateUser(requestContext(c), userUUID, expectedVersion)
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Error("request failed", "controller", "UserController", "func", "ManageActivateUser", "userUUID", userUUID, "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	c.Header("ETag", userETag(user))
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "User updated.",
@@ -179,42 +161,16 @@ func (uc *UserController) ManageActivateUser(c *gin.Context) {
 func (uc *UserController) CreateUser(c *gin.Context) {
 	var input domain.UserInput
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"message": "invalid request body",
-		})
+		abortWithError(c, invalidInput("invalid request body", err))
 		return
 	}
 
-	user, err := uc.UserService.ListUserByEmail(input.Email)
+	// Duplicated emails are rejected by the storage with
+	// domain.ErrEmailTaken, which also covers concurrent creations.
+	newUser, err := uc.UserService.CreateUser(requestContext(c), input)
 	if err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
-			log.Printf("controller=UserController func=CreateUser email=%s err=%v", input.Email, err)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"success": false,
-				"message": "failed to check user",
-			})
-			return
-		}
-		user = domain.User{}
-	}
-
-	if user.UUID != "" {
-		c.JSON(http.StatusConflict, gin.H{
-			"success": false,
-			"message": "user already exists",
-			"data":    user,
-		})
-		return
-	}
-
-	newUser, err := uc.UserService.CreateUser(input)
-	if err != nil {
-		log.Printf("controller=UserController func=CreateUser email=%s err=%v", input.Email, err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"message": "failed to create user",
-		})
+		middleware.Logger(c.Request.Context()).Error("request failed", "controller", "UserController", "func", "CreateUser", "email", input.Email, "err", err)
+		abortWithError(c, err)
 		return
 	}
 
@@ -228,16 +184,10 @@ func (uc *UserController) CreateUser(c *gin.Context) {
 func (uc *UserController) DeleteUser(c *gin.Context) {
 	userUUID := c.Param("userUUID")
 
-	err := uc.UserService.DeleteUser(userUUID)
+	err := uc.UserService.DeleteUser(requestContext(c), userUUID)
 	if err != nil {
-		log.Printf("controller=UserController func=DeleteUser userUUID=%s err=%v", userUUID, err)
-		status := http.StatusInternalServerError
-		message := "internal error"
-
-		c.AbortWithStatusJSON(status, gin.H{
-			"success": false,
-			"message": message,
-		})
+		middleware.Logger(c.Request.Context()).Error("request failed", "controller", "UserController", "func", "DeleteUser", "userUUID", userUUID, "err", err)
+		abortWithError(c, err)
 		return
 	}
 
@@ -246,3 +196,20 @@ func (uc *UserController) DeleteUser(c *gin.Context) {
 		"message": "User deleted successfully",
 	})
 }
+
+func (uc *UserController) RestoreUser(c *gin.Context) {
+	userUUID := c.Param("userUUID")
+
+	user, err := uc.UserService.RestoreUser(requestContext(c), userUUID)
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Error("request failed", "controller", "UserController", "func", "RestoreUser", "userUUID", userUUID, "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "User restored.",
+		"data":    user,
+	})
+}
@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"go-back/internal/domain"
+	"go-back/internal/http/middleware"
+	"go-back/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type VerificationController struct {
+	VerificationService service.VerificationService
+}
+
+func NewVerificationController(s service.VerificationService) *VerificationController {
+	return &VerificationController{VerificationService: s}
+}
+
+func (vc *VerificationController) VerifyEmail(c *gin.Context) {
+	var input domain.TokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		abortWithError(c, invalidInput("invalid request body", err))
+		return
+	}
+
+	user, err := vc.VerificationService.VerifyEmail(requestContext(c), input.Token)
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Warn("request failed", "controller", "VerificationController", "func", "VerifyEmail", "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Email verified.",
+		"data":    user,
+	})
+}
+
+func (vc *VerificationController) ResendVerification(c *gin.Context) {
+	userUUID := c.Param("userUUID")
+
+	err := vc.VerificationService.ResendVerification(requestContext(c), userUUID)
+	if err != nil {
+		middleware.Logger(c.Request.Context()).Error("request failed", "controller", "VerificationController", "func", "ResendVerification", "userUUID", userUUID, "err", err)
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"message": "Verification email sent.",
+	})
+}
@@ -1,29 +1,141 @@
 package handler
 
 import (
+	"go-back/internal/auth"
+	"go-back/internal/domain"
 	"go-back/internal/http/controller"
+	"go-back/internal/http/middleware"
 	"go-back/internal/service"
-	"go-back/internal/storage/repository"
 
 	"github.com/gin-gonic/gin"
 )
 
-func HandleRequests(router *gin.Engine) {
-	api := router.Group("/api")
+type Dependencies struct {
+	UserService         service.UserService
+	AuditService        service.AuditService
+	RoleService         service.RoleService
+	AuthService         service.AuthService
+	MFAService          service.MFAService
+	SessionService      service.SessionService
+	APIKeyService       service.APIKeyService
+	OIDCService         service.OIDCService
+	VerificationService service.VerificationService
+	ResetService        service.PasswordResetService
+	Verifier            *auth.Verifier
+	RateLimits          RateLimits
+}
+
+// RateLimits configures the rate limiting of the routes. Policies with a
+// zero limit are off, and so are all of them without a Store.
+type RateLimits struct {
+	Store middleware.RateLimitStore
+	// IP applies to every request, by client IP.
+	IP middleware.Limit
+	// Login applies to the routes taking passwords, codes and reset tokens,
+	// by client IP, against guessing them.
+	Login middleware.Limit
+	// Subject applies to each authenticated user, and APIKey to each API
+	// key without a limit of its own.
+	Subject middleware.Limit
+	APIKey  middleware.Limit
+	// CreateUser and LookupUser apply per subject to creating users and to
+	// reading them by UUID, against spam and enumeration.
+	CreateUser middleware.Limit
+	LookupUser middleware.Limit
+}
+
+func (l RateLimits) policy(name string, limit middleware.Limit, key middleware.RateKeyFunc) gin.HandlerFunc {
+	return middleware.RateLimit(l.Store, middleware.RatePolicy{Name: name, Limit: limit, Key: key})
+}
+
+func HandleRequests(router *gin.Engine, deps Dependencies) {
+	limits := deps.RateLimits
+	loginLimit := limits.policy("login", limits.Login, middleware.ByIP)
+
+	api := router.Group("/api", limits.policy("ip", limits.IP, middleware.ByIP))
 	api.GET("/check", controller.HealthCheckStatus)
 
-	repo := &repository.UserRepository{}
-	userService := service.NewUserService(repo)
-	userController := &controller.UserController{UserService: userService}
+	authController := &controller.AuthController{AuthService: deps.AuthService}
+	if deps.AuthService.IssuesTokens() {
+		api.POST("/auth/login", loginLimit, authController.Login)
+		api.POST("/auth/login/mfa", loginLimit, authController.LoginMFA)
+		api.POST("/auth/refresh", authController.Refresh)
+	}
+
+	if deps.OIDCService.Enabled() {
+		oidcController := &controller.OIDCController{OIDCService: deps.OIDCService}
+		api.GET("/auth/oidc/login", oidcController.Login)
+		api.GET("/auth/oidc/callback", oidcController.Callback)
+	}
+
+	resetController := &controller.PasswordResetController{PasswordResetService: deps.ResetService}
+	api.POST("/auth/password/forgot", loginLimit, resetController.ForgotPassword)
+	api.POST("/auth/password/reset", loginLimit, resetController.ResetPassword)
+
+	// Verification links are opened before the user can log in.
+	verificationController := &controller.VerificationController{VerificationService: deps.VerificationService}
+	api.POST("/user/verify", verificationController.VerifyEmail)
+
+	authenticated := api.Group("",
+		middleware.Authenticate(deps.Verifier, deps.APIKeyService),
+		middleware.RejectRevoked(deps.AuthService),
+		middleware.RateLimit(limits.Store, middleware.RatePolicy{
+			Name:     "subject",
+			Limit:    limits.Subject,
+			Key:      middleware.BySubject,
+			Override: middleware.APIKeyLimit(limits.APIKey),
+		}),
+		middleware.LoadPrincipal(deps.RoleService),
+	)
+	require := middleware.Require
+
+	userController := &controller.UserController{UserService: deps.UserService}
+
+	user := authenticated.Group("/user")
+	user.GET("/list", require(domain.PermUsersRead), userController.ListAllUsers)
+	user.GET("/list/:userUUID", limits.policy("lookup_user", limits.LookupUser, middleware.BySubject),
+		require(domain.PermUsersRead), userController.ListUser)
+
+	user.POST("/create", limits.policy("create_user", limits.CreateUser, middleware.BySubject),
+		require(domain.PermUsersWrite), userController.CreateUser)
+	user.POST("/restore/:userUUID", require(domain.PermUsersDelete), userController.RestoreUser)
+	user.POST("/verify/resend/:userUUID", require(domain.PermUsersWrite), verificationController.ResendVerification)
+
+	user.PUT("/edit/:userUUID", require(domain.PermUsersWrite), userController.UpdateUser)
+	user.PUT("/manage/:userUUID", require(domain.PermUsersToggleActive), userController.ManageActivateUser)
+	user.PUT("/password/:userUUID", require(domain.PermUsersWrite), authController.SetPassword)
+
+	user.DELETE("/delete/:userUUID", require(domain.PermUsersDelete), userController.DeleteUser)
+
+	mfaController := &controller.MFAController{MFAService: deps.MFAService}
+	user.GET("/mfa/:userUUID", require(domain.PermUsersRead), mfaController.GetMFA)
+	user.POST("/mfa/totp/:userUUID", require(domain.PermUsersWrite), mfaController.EnrollTOTP)
+	user.POST("/mfa/totp/confirm/:userUUID", require(domain.PermUsersWrite), mfaController.ConfirmTOTP)
+	user.POST("/mfa/recovery-codes/:userUUID", require(domain.PermUsersWrite), mfaController.RegenerateRecoveryCodes)
+	user.POST("/mfa/disable/:userUUID", require(domain.PermUsersWrite), mfaController.DisableMFA)
+
+	sessionController := &controller.SessionController{SessionService: deps.SessionService}
+	user.GET("/sessions", require(domain.PermUsersRead), sessionController.ListSessions)
+	user.DELETE("/sessions/:id", require(domain.PermUsersWrite), sessionController.RevokeSession)
+
+	auditController := &controller.AuditController{AuditService: deps.AuditService}
+	authenticated.GET("/audit", require(domain.PermAuditRead), auditController.ListAuditEvents)
+
+	authenticated.GET("/metrics", require(domain.PermMetricsRead), controller.Metrics)
 
-	user := api.Group("/user")
-	user.GET("/list", userController.ListAllUsers)
-	user.GET("/list/:userUUID", userController.ListUser)
+	apiKeyController := &controller.APIKeyController{APIKeyService: deps.APIKeyService}
 
-	user.POST("/create", userController.CreateUser)
+	keys := authenticated.Group("/keys")
+	keys.GET("", require(domain.PermAPIKeysRead), apiKeyController.ListAPIKeys)
+	keys.GET("/:id", require(domain.PermAPIKeysRead), apiKeyController.GetAPIKey)
+	keys.POST("", require(domain.PermAPIKeysWrite), apiKeyController.CreateAPIKey)
+	keys.PUT("/:id", require(domain.PermAPIKeysWrite), apiKeyController.UpdateAPIKey)
+	keys.DELETE("/:id", require(domain.PermAPIKeysWrite), apiKeyController.RevokeAPIKey)
 
-	user.PUT("/edit/:userUUID", userController.UpdateUser)
-	user.PUT("/manage/:userUUID", userController.ManageActivateUser)
+	roleController := &controller.RoleController{RoleService: deps.RoleService}
 
-	user.DELETE("/delete/:userUUID", userController.DeleteUser)
+	role := authenticated.Group("/role")
+	role.GET("/list/:userUUID", require(domain.PermRolesRead), roleController.ListRoles)
+	role.POST("/grant/:userUUID", require(domain.PermRolesWrite), roleController.GrantRole)
+	role.DELETE("/revoke/:userUUID/:role", require(domain.PermRolesWrite), roleController.RevokeRole)
 }
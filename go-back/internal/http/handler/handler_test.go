@@ -0,0 +1,1498 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-back/internal/auth"
+	"go-back/internal/auth/oidctest"
+	"go-back/internal/domain"
+	"go-back/internal/http/controller"
+	"go-back/internal/http/middleware"
+	"go-back/internal/queue"
+	"go-back/internal/service"
+	"go-back/internal/storage/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type userResponse struct {
+	Success bool        `json:"success"`
+	Data    domain.User `json:"data"`
+}
+
+const (
+	testSecret  = "test-secret"
+	testSubject = "tester"
+)
+
+// testMailbox is an EmailSender that keeps the emails it is given. Emails
+// queued as jobs are sent when the mailbox is read.
+type testMailbox struct {
+	mu     sync.Mutex
+	emails []domain.Email
+	worker *queue.Worker
+}
+
+func (m *testMailbox) Send(ctx context.Context, email domain.Email) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.emails = append(m.emails, email)
+	return nil
+}
+
+// deliver runs the queued jobs, sending the emails they hold.
+func (m *testMailbox) deliver() {
+	if _, err := m.worker.RunPending(context.Background()); err != nil {
+		panic(err)
+	}
+}
+
+// lastToken returns the token of the newest email sent to address.
+func (m *testMailbox) lastToken(address string) string {
+	m.deliver()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.emails) - 1; i >= 0; i-- {
+		if m.emails[i].To == address {
+			_, token, _ := strings.Cut(m.emails[i].Body, "token=")
+			token, _, _ = strings.Cut(token, "\n")
+			return token
+		}
+	}
+	return ""
+}
+
+func (m *testMailbox) count(address string) int {
+	m.deliver()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count := 0
+	for _, email := range m.emails {
+		if email.To == address {
+			count++
+		}
+	}
+	return count
+}
+
+// testIdP is the OpenID Connect provider of the test routers.
+var testIdP *oidctest.Server
+
+func TestMain(m *testing.M) {
+	testIdP = oidctest.NewServer("go-back", "client-secret")
+	code := m.Run()
+	testIdP.Close()
+	os.Exit(code)
+}
+
+func newTestRouter() *gin.Engine {
+	r, _ := newTestRouterWithMailbox()
+	return r
+}
+
+func newTestRouterWithMailbox() (*gin.Engine, *testMailbox) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.RequestID(slog.New(slog.DiscardHandler)))
+
+	keys, err := auth.NewKeySet(testSecret, "", 0)
+	if err != nil {
+		panic(err)
+	}
+
+	users := repository.NewMemoryUserRepository()
+	audit := repository.NewMemoryAuditRepository()
+	roles := repository.NewMemoryRoleRepository()
+	tokens := repository.NewMemoryTokenRepository()
+	mfa := repository.NewMemoryMFARepository()
+	sessions := repository.NewMemorySessionRepository()
+	tx := repository.NewMemoryTransactor()
+
+	issuer, _ := auth.NewIssuer(testSecret, auth.IssuerConfig{TTL: time.Minute})
+	authService, err := service.NewAuthService(users, repository.NewMemoryCredentialRepository(), mfa, tokens, sessions, audit, tx, service.AuthConfig{
+		Hasher:               auth.NewPasswordHasher(auth.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}),
+		Policy:               auth.NewPasswordPolicy(12, 64, []string{"password1234"}),
+		Issuer:               issuer,
+		RequireVerifiedEmail: true,
+		TOTP:                 auth.DefaultTOTP,
+		MFAChallengeTTL:      time.Minute,
+		SessionTTL:           time.Hour,
+		RefreshTokenTTL:      time.Hour,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	jobs := repository.NewMemoryJobRepository()
+	mailbox := &testMailbox{worker: queue.NewWorker(jobs, queue.WorkerConfig{})}
+	jobQueue := queue.NewQueue(jobs, 1)
+	verificationService := service.NewVerificationService(users, tokens, audit, tx, jobQueue,
+		service.VerificationConfig{TTL: time.Hour, ResendInterval: time.Minute, URL: "https://app.example.com/verify"})
+	queue.Handle(mailbox.worker, service.JobSendEmail, mailbox.Send)
+	userService := service.NewUserService(users, audit, tx, service.UserConfig{Verifier: verificationService, Sessions: sessions, Roles: roles})
+
+	resetService := service.NewPasswordResetService(userService, authService, tokens, tx, jobQueue,
+		service.PasswordResetConfig{TTL: time.Hour, Interval: time.Minute, URL: "https://app.example.com/reset"})
+	queue.Handle(mailbox.worker, service.JobPasswordReset, resetService.SendPasswordReset)
+
+	oidcProvider := auth.NewOIDCProvider(auth.OIDCConfig{
+		IssuerURL:    testIdP.Issuer(),
+		ClientID:     testIdP.ClientID,
+		ClientSecret: testIdP.ClientSecret,
+		RedirectURL:  "http://localhost/api/auth/oidc/callback",
+	})
+
+	HandleRequests(r, Dependencies{
+		UserService:  userService,
+		AuditService: service.NewAuditService(audit),
+		RoleService:  service.NewRoleService(roles, users, audit, tx, []string{testSubject}, []domain.Role{domain.RoleAdmin}),
+		AuthService:  authService,
+		MFAService: service.NewMFAService(users, mfa, audit, tx,
+			service.MFAConfig{TOTP: auth.DefaultTOTP, Issuer: "Go Project"}),
+		SessionService: service.NewSessionService(sessions, audit, tx),
+		APIKeyService: service.NewAPIKeyService(repository.NewMemoryAPIKeyRepository(), audit, tx,
+			service.APIKeyConfig{TouchInterval: time.Minute}),
+		OIDCService: service.NewOIDCService(userService, authService, oidcProvider,
+			service.OIDCConfig{LoginTTL: time.Minute}),
+		VerificationService: verificationService,
+		ResetService:        resetService,
+		Verifier:            auth.NewVerifier(keys, auth.VerifierConfig{}),
+		RateLimits: RateLimits{
+			Store:      middleware.NewMemoryRateLimitStore(),
+			APIKey:     middleware.Limit{Requests: 3, Period: time.Minute},
+			CreateUser: middleware.Limit{Requests: 50, Period: time.Minute},
+		},
+	})
+	return r, mailbox
+}
+
+// signToken signs a token for subject as issued after MFA, unless amr
+// says otherwise.
+func signToken(subject string, expiresAt time.Time, amr ...string) string {
+	if len(amr) == 0 {
+		amr = []string{auth.AMRPassword, auth.AMROTP, auth.AMRMFA}
+	}
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		AMR: amr,
+	}).SignedString([]byte(testSecret))
+	return token
+}
+
+func doRequest(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	return doConditionalRequest(r, method, path, body, "")
+}
+
+func doConditionalRequest(r *gin.Engine, method, path, body, ifMatch string) *httptest.ResponseRecorder {
+	return doRequestAs(r, testSubject, method, path, body, ifMatch)
+}
+
+func doRequestAs(r *gin.Engine, subject, method, path, body, ifMatch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+signToken(subject, time.Now().Add(time.Hour)))
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthentication(t *testing.T) {
+	r := newTestRouter()
+
+	cases := map[string]string{
+		"missing token":   "",
+		"wrong scheme":    "Basic dXNlcjpwYXNz",
+		"expired token":   "Bearer " + signToken(testSubject, time.Now().Add(-time.Hour)),
+		"malformed token": "Bearer not-a-jwt",
+	}
+	for name, header := range cases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/user/list", nil)
+			if header != "" {
+				req.Header.Set("Authorization", header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("expected status %d, got %d", http.StatusUnauthorized, w.Code)
+			}
+			if w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected WWW-Authenticate header")
+			}
+		})
+	}
+
+	t.Run("leaves the health check open", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/check", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+	})
+}
+
+func TestUserRoutes(t *testing.T) {
+	r := newTestRouter()
+
+	w := doRequest(r, http.MethodPost, "/api/user/create", `{"name":"John","email":"john@example.com"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body)
+	}
+	var created userResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("expected valid json, got %v", err)
+	}
+
+	t.Run("rejects duplicated email", func(t *testing.T) {
+		w := doRequest(r, http.MethodPost, "/api/user/create", `{"name":"John","email":"john@example.com"}`)
+		if w.Code != http.StatusConflict {
+			t.Errorf("expected status %d, got %d", http.StatusConflict, w.Code)
+		}
+	})
+
+	t.Run("describes invalid fields as problem details", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/user/create", strings.NewReader(`{"email":"not-an-email"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+signToken(testSubject, time.Now().Add(time.Hour)))
+		req.Header.Set("X-Request-ID", "req-42")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+		}
+		if contentType := w.Header().Get("Content-Type"); contentType != "application/problem+json" {
+			t.Errorf("expected application/problem+json, got %q", contentType)
+		}
+
+		var problem controller.Problem
+		if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+			t.Fatalf("expected valid json, got %v", err)
+		}
+		if problem.Status != http.StatusBadRequest || problem.Instance != "/api/user/create" || problem.RequestID != "req-42" || problem.Type == "" {
+			t.Errorf("unexpected problem %+v", problem)
+		}
+		expected := []controller.FieldError{
+			{Field: "name", Rule: "required", Message: "name is required"},
+			{Field: "email", Rule: "email", Message: "email must be a valid email address"},
+		}
+		if fmt.Sprint(problem.Errors) != fmt.Sprint(expected) {
+			t.Errorf("expected errors %v, got %v", expected, problem.Errors)
+		}
+
+		w = doRequest(r, http.MethodPost, "/api/user/create", `{"name":42,"email":"john@example.com"}`)
+		json.Unmarshal(w.Body.Bytes(), &problem)
+		if len(problem.Errors) != 1 || problem.Errors[0].Field != "name" || problem.Errors[0].Rule != "type" {
+			t.Errorf("expected a type error on name, got %v", problem.Errors)
+		}
+
+		w = doRequest(r, http.MethodGet, "/api/user/list?sort=password", "")
+		json.Unmarshal(w.Body.Bytes(), &problem)
+		if len(problem.Errors) != 1 || problem.Errors[0].Field != "sort" || problem.Errors[0].Rule != "oneof" {
+			t.Errorf("expected a oneof error on sort, got %v", problem.Errors)
+		}
+	})
+
+	t.Run("paginates user list", func(t *testing.T) {
+		doRequest(r, http.MethodPost, "/api/user/create", `{"name":"Jane","email":"jane@example.com"}`)
+
+		w := doRequest(r, http.MethodGet, "/api/user/list?limit=1&sort=-created_at", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		var page struct {
+			Data       []domain.User `json:"data"`
+			NextCursor string        `json:"next_cursor"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &page)
+		if len(page.Data) != 1 || page.NextCursor == "" {
+			t.Fatalf("expected one user and a next cursor, got %s", w.Body)
+		}
+
+		w = doRequest(r, http.MethodGet, "/api/user/list?limit=1&sort=-created_at&cursor="+page.NextCursor, "")
+		json.Unmarshal(w.Body.Bytes(), &page)
+		if len(page.Data) != 1 || page.NextCursor != "" {
+			t.Errorf("expected last page with one user, got %s", w.Body)
+		}
+	})
+
+	t.Run("rejects invalid list parameters", func(t *testing.T) {
+		for _, query := range []string{"sort=password", "limit=-1", "limit=1000", "cursor=bogus"} {
+			w := doRequest(r, http.MethodGet, "/api/user/list?"+query, "")
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected status %d for %q, got %d", http.StatusBadRequest, query, w.Code)
+			}
+		}
+	})
+
+	t.Run("lists created user", func(t *testing.T) {
+		w := doRequest(r, http.MethodGet, "/api/user/list/"+created.Data.UUID, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+	})
+
+	t.Run("updates user", func(t *testing.T) {
+		w := doRequest(r, http.MethodPut, "/api/user/edit/"+created.Data.UUID, `{"name":"Johnny"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		var updated userResponse
+		json.Unmarshal(w.Body.Bytes(), &updated)
+		if updated.Data.Name != "Johnny" {
+			t.Errorf("expected name Johnny, got %q", updated.Data.Name)
+		}
+	})
+
+	t.Run("rejects email taken by another user", func(t *testing.T) {
+		w := doRequest(r, http.MethodPut, "/api/user/edit/"+created.Data.UUID, `{"email":"jane@example.com"}`)
+		if w.Code != http.StatusConflict {
+			t.Errorf("expected status %d, got %d: %s", http.StatusConflict, w.Code, w.Body)
+		}
+	})
+
+	t.Run("honours If-Match on updates", func(t *testing.T) {
+		w := doRequest(r, http.MethodGet, "/api/user/list/"+created.Data.UUID, "")
+		etag := w.Header().Get("ETag")
+		if etag == "" {
+			t.Fatal("expected ETag header")
+		}
+
+		w = doConditionalRequest(r, http.MethodPut, "/api/user/edit/"+created.Data.UUID, `{"name":"Johnny B"}`, `"1"`)
+		if w.Code != http.StatusPreconditionFailed {
+			t.Errorf("expected status %d, got %d", http.StatusPreconditionFailed, w.Code)
+		}
+
+		w = doConditionalRequest(r, http.MethodPut, "/api/user/edit/"+created.Data.UUID, `{"name":"Johnny B"}`, "W/"+etag)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		if w.Header().Get("ETag") == etag {
+			t.Errorf("expected ETag to change after update, got %s", etag)
+		}
+
+		w = doConditionalRequest(r, http.MethodPut, "/api/user/manage/"+created.Data.UUID, "", etag)
+		if w.Code != http.StatusPreconditionFailed {
+			t.Errorf("expected status %d, got %d", http.StatusPreconditionFailed, w.Code)
+		}
+
+		w = doConditionalRequest(r, http.MethodPut, "/api/user/edit/"+created.Data.UUID, `{"name":"Johnny"}`, `"1", "2"`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+
+	t.Run("deactivates user", func(t *testing.T) {
+		w := doRequest(r, http.MethodPut, "/api/user/manage/"+created.Data.UUID, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		var toggled userResponse
+		json.Unmarshal(w.Body.Bytes(), &toggled)
+		if toggled.Data.IsActive {
+			t.Error("expected user to be inactive")
+		}
+	})
+
+	t.Run("soft deletes and restores user", func(t *testing.T) {
+		w := doRequest(r, http.MethodDelete, "/api/user/delete/"+created.Data.UUID, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+
+		w = doRequest(r, http.MethodGet, "/api/user/list/"+created.Data.UUID, "")
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected deleted user to be hidden, got %d", w.Code)
+		}
+		w = doRequest(r, http.MethodGet, "/api/user/list/"+created.Data.UUID+"?include_deleted=true", "")
+		if w.Code != http.StatusOK {
+			t.Errorf("expected deleted user with include_deleted, got %d", w.Code)
+		}
+
+		w = doRequest(r, http.MethodPost, "/api/user/restore/"+created.Data.UUID, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		w = doRequest(r, http.MethodGet, "/api/user/list/"+created.Data.UUID, "")
+		if w.Code != http.StatusOK {
+			t.Errorf("expected restored user to be visible, got %d", w.Code)
+		}
+	})
+
+	t.Run("lists audit events of the user", func(t *testing.T) {
+		w := doRequest(r, http.MethodGet, "/api/audit?limit=2&target="+created.Data.UUID, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		var page struct {
+			Data       []domain.AuditEvent `json:"data"`
+			NextCursor string              `json:"next_cursor"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &page)
+		if len(page.Data) != 2 || page.Data[0].Action != domain.AuditUserRestored || page.NextCursor == "" {
+			t.Fatalf("expected the latest 2 events and a cursor, got %s", w.Body)
+		}
+		if page.Data[0].Actor != testSubject || page.Data[0].IP == "" {
+			t.Errorf("expected the token subject as actor and the client ip, got %+v", page.Data[0])
+		}
+
+		w = doRequest(r, http.MethodGet, "/api/audit?actor=nobody", "")
+		json.Unmarshal(w.Body.Bytes(), &page)
+		if len(page.Data) != 0 {
+			t.Errorf("expected no events for unknown actor, got %s", w.Body)
+		}
+
+		for _, query := range []string{"since=yesterday", "cursor=bogus", "limit=1000"} {
+			w := doRequest(r, http.MethodGet, "/api/audit?"+query, "")
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected status %d for %q, got %d", http.StatusBadRequest, query, w.Code)
+			}
+		}
+	})
+
+	t.Run("returns not found for unknown user", func(t *testing.T) {
+		w := doRequest(r, http.MethodDelete, "/api/user/delete/missing", "")
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+		}
+		w = doRequest(r, http.MethodPost, "/api/user/restore/missing", "")
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+}
+
+func TestAuthorization(t *testing.T) {
+	r := newTestRouter()
+
+	createUser := func(name, email string) string {
+		w := doRequest(r, http.MethodPost, "/api/user/create", `{"name":"`+name+`","email":"`+email+`"}`)
+		var created userResponse
+		json.Unmarshal(w.Body.Bytes(), &created)
+		return created.Data.UUID
+	}
+	support := createUser("Support", "support@example.com")
+	viewer := createUser("Viewer", "viewer@example.com")
+	member := createUser("Member", "member@example.com")
+	other := createUser("Other", "other@example.com")
+	admin := createUser("Admin", "admin@example.com")
+
+	for subject, role := range map[string]string{support: "support", viewer: "viewer", admin: "admin"} {
+		w := doRequest(r, http.MethodPost, "/api/role/grant/"+subject, `{"role":"`+role+`"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d granting %s, got %d: %s", http.StatusOK, role, w.Code, w.Body)
+		}
+	}
+
+	cases := []struct {
+		name    string
+		subject string
+		method  string
+		path    string
+		body    string
+		status  int
+	}{
+		{"support edits any user", support, http.MethodPut, "/api/user/edit/" + other, `{"name":"Edited"}`, http.StatusOK},
+		{"support toggles any user", support, http.MethodPut, "/api/user/manage/" + other, "", http.StatusOK},
+		{"support reads the audit log", support, http.MethodGet, "/api/audit", "", http.StatusOK},
+		{"support edits viewers", support, http.MethodPut, "/api/user/edit/" + viewer, `{"name":"Viewer"}`, http.StatusOK},
+		{"support cannot edit admins", support, http.MethodPut, "/api/user/edit/" + admin, `{"email":"taken@example.com","name":"Admin"}`, http.StatusForbidden},
+		{"support cannot deactivate admins", support, http.MethodPut, "/api/user/manage/" + admin, "", http.StatusForbidden},
+		{"support cannot list deleted users", support, http.MethodGet, "/api/user/list?include_deleted=true", "", http.StatusForbidden},
+		{"admin lists deleted users", testSubject, http.MethodGet, "/api/user/list?include_deleted=true", "", http.StatusOK},
+		{"support cannot set the password of admins", support, http.MethodPut, "/api/user/password/" + admin, `{"new_password":"a long secret phrase"}`, http.StatusForbidden},
+		{"support cannot delete", support, http.MethodDelete, "/api/user/delete/" + other, "", http.StatusForbidden},
+		{"support cannot grant roles", support, http.MethodPost, "/api/role/grant/" + member, `{"role":"admin"}`, http.StatusForbidden},
+		{"support cannot read metrics", support, http.MethodGet, "/api/metrics", "", http.StatusForbidden},
+		{"admin reads metrics", testSubject, http.MethodGet, "/api/metrics", "", http.StatusOK},
+		{"viewer lists users", viewer, http.MethodGet, "/api/user/list", "", http.StatusOK},
+		{"viewer cannot read deleted users", viewer, http.MethodGet, "/api/user/list/" + other + "?include_deleted=true", "", http.StatusForbidden},
+		{"viewer cannot edit others", viewer, http.MethodPut, "/api/user/edit/" + other, `{"name":"Nope"}`, http.StatusForbidden},
+		{"self reads own account", member, http.MethodGet, "/api/user/list/" + member, "", http.StatusOK},
+		{"self edits own account", member, http.MethodPut, "/api/user/edit/" + member, `{"name":"Me"}`, http.StatusOK},
+		{"self cannot read others", member, http.MethodGet, "/api/user/list/" + other, "", http.StatusForbidden},
+		{"self cannot edit others", member, http.MethodPut, "/api/user/edit/" + other, `{"name":"Nope"}`, http.StatusForbidden},
+		{"self cannot list users", member, http.MethodGet, "/api/user/list", "", http.StatusForbidden},
+		{"self cannot deactivate itself", member, http.MethodPut, "/api/user/manage/" + member, "", http.StatusForbidden},
+		{"unknown subject has no access", "stranger", http.MethodGet, "/api/user/list/" + member, "", http.StatusForbidden},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := doRequestAs(r, c.subject, c.method, c.path, c.body, "")
+			if w.Code != c.status {
+				t.Errorf("expected status %d, got %d: %s", c.status, w.Code, w.Body)
+			}
+		})
+	}
+
+	t.Run("inactive users lose their roles", func(t *testing.T) {
+		doRequest(r, http.MethodPut, "/api/user/manage/"+viewer, "")
+		w := doRequestAs(r, viewer, http.MethodGet, "/api/user/list", "", "")
+		if w.Code != http.StatusForbidden {
+			t.Errorf("expected status %d, got %d", http.StatusForbidden, w.Code)
+		}
+	})
+
+	t.Run("manages roles", func(t *testing.T) {
+		w := doRequest(r, http.MethodPost, "/api/role/grant/"+member, `{"role":"self"}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status %d granting self, got %d", http.StatusBadRequest, w.Code)
+		}
+		w = doRequest(r, http.MethodPost, "/api/role/grant/missing", `{"role":"viewer"}`)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status %d for unknown user, got %d", http.StatusNotFound, w.Code)
+		}
+
+		w = doRequest(r, http.MethodDelete, "/api/role/revoke/"+support+"/support", "")
+		var roles struct {
+			Data []domain.RoleGrant `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &roles)
+		if w.Code != http.StatusOK || len(roles.Data) != 0 {
+			t.Errorf("expected no roles left, got %d: %s", w.Code, w.Body)
+		}
+
+		w = doRequestAs(r, support, http.MethodPut, "/api/user/edit/"+other, `{"name":"Again"}`, "")
+		if w.Code != http.StatusForbidden {
+			t.Errorf("expected revoked support to be forbidden, got %d", w.Code)
+		}
+
+		w = doRequest(r, http.MethodGet, "/api/audit?target="+support, "")
+		var page struct {
+			Data []domain.AuditEvent `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &page)
+		if len(page.Data) == 0 || page.Data[0].Action != domain.AuditRoleRevoked {
+			t.Errorf("expected role revocation to be audited, got %s", w.Body)
+		}
+	})
+}
+
+func TestPasswordLogin(t *testing.T) {
+	r, mailbox := newTestRouterWithMailbox()
+
+	w := doRequest(r, http.MethodPost, "/api/user/create", `{"name":"John","email":"john@example.com"}`)
+	var created userResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	userUUID := created.Data.UUID
+
+	login := func(email, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/login",
+			strings.NewReader(`{"email":"`+email+`","password":"`+password+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	expectProblem := func(t *testing.T, w *httptest.ResponseRecorder, status int, problemType string) controller.Problem {
+		t.Helper()
+		var problem controller.Problem
+		json.Unmarshal(w.Body.Bytes(), &problem)
+		if w.Code != status || problem.Type != problemType {
+			t.Fatalf("expected %d %s, got %d: %s", status, problemType, w.Code, w.Body)
+		}
+		return problem
+	}
+
+	t.Run("users without a password cannot log in", func(t *testing.T) {
+		expectProblem(t, login("john@example.com", "anything at all"), http.StatusUnauthorized, "/problems/invalid-credentials")
+	})
+
+	t.Run("enforces the password policy", func(t *testing.T) {
+		w := doRequest(r, http.MethodPut, "/api/user/password/"+userUUID, `{"new_password":"short"}`)
+		problem := expectProblem(t, w, http.StatusBadRequest, "/problems/weak-password")
+		if problem.Detail != "password must be at least 12 characters long" {
+			t.Errorf("expected the policy reason as detail, got %q", problem.Detail)
+		}
+
+		w = doRequest(r, http.MethodPut, "/api/user/password/"+userUUID, `{"new_password":"Password1234"}`)
+		expectProblem(t, w, http.StatusBadRequest, "/problems/weak-password")
+	})
+
+	w = doRequest(r, http.MethodPut, "/api/user/password/"+userUUID, `{"new_password":"first secret phrase"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d setting the password, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+
+	t.Run("rejects wrong passwords and unknown emails alike", func(t *testing.T) {
+		wrong := expectProblem(t, login("john@example.com", "second secret phrase"), http.StatusUnauthorized, "/problems/invalid-credentials")
+		unknown := expectProblem(t, login("nobody@example.com", "first secret phrase"), http.StatusUnauthorized, "/problems/invalid-credentials")
+		if wrong.Detail != unknown.Detail {
+			t.Errorf("expected the same detail, got %q and %q", wrong.Detail, unknown.Detail)
+		}
+	})
+
+	t.Run("requires a verified email", func(t *testing.T) {
+		expectProblem(t, login("john@example.com", "first secret phrase"), http.StatusForbidden, "/problems/email-not-verified")
+
+		w := doRequest(r, http.MethodPost, "/api/user/verify", `{"token":"`+mailbox.lastToken("john@example.com")+`"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d verifying, got %d: %s", http.StatusOK, w.Code, w.Body)
+		}
+	})
+
+	t.Run("issues tokens accepted by the API", func(t *testing.T) {
+		w := login("john@example.com", "first secret phrase")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+		}
+		var response struct {
+			Data domain.AccessToken `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if response.Data.TokenType != "Bearer" || response.Data.ExpiresIn != 60 || response.Data.AccessToken == "" {
+			t.Fatalf("unexpected token %+v", response.Data)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/api/user/list/"+userUUID, nil)
+		req.Header.Set("Authorization", "Bearer "+response.Data.AccessToken)
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("expected status %d reading itself, got %d", http.StatusOK, w.Code)
+		}
+	})
+
+	t.Run("users confirm their current password", func(t *testing.T) {
+		w := doRequestAs(r, userUUID, http.MethodPut, "/api/user/password/"+userUUID, `{"new_password":"second secret phrase"}`, "")
+		expectProblem(t, w, http.StatusUnauthorized, "/problems/invalid-credentials")
+
+		w = doRequestAs(r, userUUID, http.MethodPut, "/api/user/password/"+userUUID,
+			`{"current_password":"first secret phrase","new_password":"second secret phrase"}`, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+		}
+
+		expectProblem(t, login("john@example.com", "first secret phrase"), http.StatusUnauthorized, "/problems/invalid-credentials")
+		if w := login("john@example.com", "second secret phrase"); w.Code != http.StatusOK {
+			t.Errorf("expected the new password to work, got %d", w.Code)
+		}
+	})
+
+	t.Run("audits password changes without their value", func(t *testing.T) {
+		w := doRequest(r, http.MethodGet, "/api/audit?target="+userUUID, "")
+		if strings.Contains(w.Body.String(), "secret phrase") {
+			t.Fatalf("expected no password in the audit log, got %s", w.Body)
+		}
+		var page struct {
+			Data []domain.AuditEvent `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &page)
+		if len(page.Data) == 0 || page.Data[0].Action != domain.AuditPasswordChanged || page.Data[0].Actor != userUUID {
+			t.Errorf("expected the last change to be audited, got %s", w.Body)
+		}
+	})
+
+	t.Run("inactive users cannot log in", func(t *testing.T) {
+		doRequest(r, http.MethodPut, "/api/user/manage/"+userUUID, "")
+		expectProblem(t, login("john@example.com", "second secret phrase"), http.StatusUnauthorized, "/problems/invalid-credentials")
+	})
+}
+
+func TestEmailVerification(t *testing.T) {
+	r, mailbox := newTestRouterWithMailbox()
+
+	w := doRequest(r, http.MethodPost, "/api/user/create", `{"name":"John","email":"john@example.com"}`)
+	var created userResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	userUUID := created.Data.UUID
+
+	if created.Data.EmailVerifiedAt != nil {
+		t.Fatalf("expected new users to be unverified, got %v", created.Data.EmailVerifiedAt)
+	}
+	if mailbox.count("john@example.com") != 1 || !strings.Contains(mailbox.emails[0].Body, "https://app.example.com/verify?token=") {
+		t.Fatalf("expected a verification link to be mailed, got %+v", mailbox.emails)
+	}
+	firstToken := mailbox.lastToken("john@example.com")
+
+	verify := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/user/verify", strings.NewReader(`{"token":"`+token+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("throttles resends", func(t *testing.T) {
+		w := doRequestAs(r, userUUID, http.MethodPost, "/api/user/verify/resend/"+userUUID, "", "")
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+			t.Errorf("expected status %d with Retry-After, got %d %v", http.StatusTooManyRequests, w.Code, w.Header())
+		}
+		if mailbox.count("john@example.com") != 1 {
+			t.Errorf("expected no new email, got %d", mailbox.count("john@example.com"))
+		}
+	})
+
+	t.Run("throttles resends before the email is sent", func(t *testing.T) {
+		w := doRequest(r, http.MethodPost, "/api/user/create", `{"name":"Jane","email":"jane@example.com"}`)
+		var jane userResponse
+		json.Unmarshal(w.Body.Bytes(), &jane)
+
+		// The worker does not run until the mailbox is read.
+		for i := 0; i < 2; i++ {
+			w := doRequestAs(r, jane.Data.UUID, http.MethodPost, "/api/user/verify/resend/"+jane.Data.UUID, "", "")
+			if w.Code != http.StatusTooManyRequests {
+				t.Errorf("expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+			}
+		}
+		if count := mailbox.count("jane@example.com"); count != 1 {
+			t.Errorf("expected only the first email, got %d", count)
+		}
+	})
+
+	t.Run("rejects unknown tokens", func(t *testing.T) {
+		if w := verify("not-a-token"); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "/problems/invalid-token") {
+			t.Errorf("expected an invalid-token problem, got %d: %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("reports requests the client canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		req := httptest.NewRequest(http.MethodPost, "/api/user/verify", strings.NewReader(`{"token":"`+firstToken+`"}`)).WithContext(ctx)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != middleware.StatusClientClosedRequest || !strings.Contains(w.Body.String(), "/problems/client-closed-request") {
+			t.Errorf("expected a client-closed-request problem, got %d: %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("verifies once per token", func(t *testing.T) {
+		w := verify(firstToken)
+		var verified userResponse
+		json.Unmarshal(w.Body.Bytes(), &verified)
+		if w.Code != http.StatusOK || verified.Data.EmailVerifiedAt == nil {
+			t.Fatalf("expected the email to be verified, got %d: %s", w.Code, w.Body)
+		}
+
+		if w := verify(firstToken); w.Code != http.StatusBadRequest {
+			t.Errorf("expected a used token to be rejected, got %d", w.Code)
+		}
+		if w := doRequest(r, http.MethodPost, "/api/user/verify/resend/"+userUUID, ""); w.Code != http.StatusConflict {
+			t.Errorf("expected status %d resending to a verified email, got %d", http.StatusConflict, w.Code)
+		}
+
+		w = doRequest(r, http.MethodGet, "/api/audit?target="+userUUID+"&limit=1", "")
+		var page struct {
+			Data []domain.AuditEvent `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &page)
+		if len(page.Data) != 1 || page.Data[0].Action != domain.AuditEmailVerified || page.Data[0].Actor != userUUID {
+			t.Errorf("expected the verification to be audited as the user, got %s", w.Body)
+		}
+	})
+
+	t.Run("changing the email requires verifying it again", func(t *testing.T) {
+		w := doRequest(r, http.MethodPut, "/api/user/edit/"+userUUID, `{"email":"johnny@example.com"}`)
+		var updated userResponse
+		json.Unmarshal(w.Body.Bytes(), &updated)
+		if w.Code != http.StatusOK || updated.Data.EmailVerifiedAt != nil {
+			t.Fatalf("expected the new email to be unverified, got %d: %s", w.Code, w.Body)
+		}
+		if mailbox.count("johnny@example.com") != 1 {
+			t.Fatalf("expected a verification email to the new address, got %d", mailbox.count("johnny@example.com"))
+		}
+
+		doRequest(r, http.MethodPut, "/api/user/edit/"+userUUID, `{"name":"Johnny"}`)
+		if mailbox.count("johnny@example.com") != 1 {
+			t.Errorf("expected no email when the address does not change, got %d", mailbox.count("johnny@example.com"))
+		}
+
+		if w := verify(mailbox.lastToken("johnny@example.com")); w.Code != http.StatusOK {
+			t.Errorf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+		}
+	})
+}
+
+func TestPasswordReset(t *testing.T) {
+	r, mailbox := newTestRouterWithMailbox()
+
+	w := doRequest(r, http.MethodPost, "/api/user/create", `{"name":"John","email":"john@example.com"}`)
+	var created userResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	userUUID := created.Data.UUID
+	doRequest(r, http.MethodPost, "/api/user/verify", `{"token":"`+mailbox.lastToken("john@example.com")+`"}`)
+	doRequest(r, http.MethodPut, "/api/user/password/"+userUUID, `{"new_password":"first secret phrase"}`)
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	forgot := func(email string) *httptest.ResponseRecorder {
+		return post("/api/auth/password/forgot", `{"email":"`+email+`"}`)
+	}
+	reset := func(token, password string) *httptest.ResponseRecorder {
+		return post("/api/auth/password/reset", `{"token":"`+token+`","new_password":"`+password+`"}`)
+	}
+	login := func(password string) int {
+		return post("/api/auth/login", `{"email":"john@example.com","password":"`+password+`"}`).Code
+	}
+
+	// Signed before the reset, as a token issued by an earlier login.
+	earlier, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   userUUID,
+		IssuedAt:  jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}).SignedString([]byte(testSecret))
+	readSelf := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/list/"+userUUID, nil)
+		req.Header.Set("Authorization", "Bearer "+earlier)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	sent := mailbox.count("john@example.com")
+
+	t.Run("answers the same for unknown emails", func(t *testing.T) {
+		if w := forgot("nobody@example.com"); w.Code != http.StatusAccepted {
+			t.Errorf("expected status %d, got %d: %s", http.StatusAccepted, w.Code, w.Body)
+		}
+		if mailbox.count("nobody@example.com") != 0 {
+			t.Errorf("expected no email to unknown addresses")
+		}
+	})
+
+	t.Run("mails a reset link at most once per interval", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			if w := forgot("john@example.com"); w.Code != http.StatusAccepted {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusAccepted, w.Code, w.Body)
+			}
+		}
+		if mailbox.count("john@example.com") != sent+1 {
+			t.Fatalf("expected one reset email, got %d", mailbox.count("john@example.com")-sent)
+		}
+		if last := mailbox.emails[len(mailbox.emails)-1]; !strings.Contains(last.Body, "https://app.example.com/reset?token=") {
+			t.Errorf("expected a reset link, got %q", last.Body)
+		}
+	})
+	token := mailbox.lastToken("john@example.com")
+
+	t.Run("rejects weak passwords and unknown tokens", func(t *testing.T) {
+		if w := reset(token, "short"); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "/problems/weak-password") {
+			t.Errorf("expected a weak-password problem, got %d: %s", w.Code, w.Body)
+		}
+		if w := reset("not-a-token", "second secret phrase"); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "/problems/invalid-token") {
+			t.Errorf("expected an invalid-token problem, got %d: %s", w.Code, w.Body)
+		}
+		if w := reset(mailbox.emails[0].Body, "second secret phrase"); w.Code != http.StatusBadRequest {
+			t.Errorf("expected a verification token to be rejected, got %d", w.Code)
+		}
+	})
+
+	t.Run("sets the new password once per token", func(t *testing.T) {
+		if w := reset(token, "second secret phrase"); w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+		}
+		if w := reset(token, "third secret phrase"); w.Code != http.StatusBadRequest {
+			t.Errorf("expected a used token to be rejected, got %d", w.Code)
+		}
+
+		if code := login("first secret phrase"); code != http.StatusUnauthorized {
+			t.Errorf("expected the old password to fail, got %d", code)
+		}
+		if code := login("second secret phrase"); code != http.StatusOK {
+			t.Errorf("expected the new password to work, got %d", code)
+		}
+	})
+
+	t.Run("revokes tokens issued before the reset", func(t *testing.T) {
+		if code := readSelf(); code != http.StatusUnauthorized {
+			t.Errorf("expected status %d, got %d", http.StatusUnauthorized, code)
+		}
+	})
+
+	t.Run("audits the reset as the user", func(t *testing.T) {
+		w := doRequest(r, http.MethodGet, "/api/audit?target="+userUUID+"&limit=1", "")
+		var page struct {
+			Data []domain.AuditEvent `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &page)
+		if len(page.Data) != 1 || page.Data[0].Action != domain.AuditPasswordReset || page.Data[0].Actor != userUUID {
+			t.Errorf("expected the reset to be audited, got %s", w.Body)
+		}
+	})
+}
+
+func TestMFA(t *testing.T) {
+	r, mailbox := newTestRouterWithMailbox()
+
+	w := doRequest(r, http.MethodPost, "/api/user/create", `{"name":"John","email":"john@example.com"}`)
+	var created userResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	userUUID := created.Data.UUID
+	doRequest(r, http.MethodPost, "/api/user/verify", `{"token":"`+mailbox.lastToken("john@example.com")+`"}`)
+	doRequest(r, http.MethodPut, "/api/user/password/"+userUUID, `{"new_password":"first secret phrase"}`)
+	doRequest(r, http.MethodPost, "/api/role/grant/"+userUUID, `{"role":"admin"}`)
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	type loginData struct {
+		AccessToken string `json:"access_token"`
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+	login := func(t *testing.T) loginData {
+		t.Helper()
+		w := post("/api/auth/login", `{"email":"john@example.com","password":"first secret phrase"}`)
+		var response struct {
+			Data loginData `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+		}
+		return response.Data
+	}
+	listUsers := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/list", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("withholds enforced roles without MFA", func(t *testing.T) {
+		w := listUsers(login(t).AccessToken)
+		if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "/problems/mfa-required") {
+			t.Errorf("expected an mfa-required problem, got %d: %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("withholds admin from admin subjects without MFA", func(t *testing.T) {
+		w := listUsers(signToken(testSubject, time.Now().Add(time.Hour), auth.AMRPassword))
+		if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "/problems/mfa-required") {
+			t.Errorf("expected an mfa-required problem, got %d: %s", w.Code, w.Body)
+		}
+		if w := listUsers(signToken(testSubject, time.Now().Add(time.Hour))); w.Code != http.StatusOK {
+			t.Errorf("expected status %d with MFA, got %d: %s", http.StatusOK, w.Code, w.Body)
+		}
+	})
+
+	w = doRequestAs(r, userUUID, http.MethodPost, "/api/user/mfa/totp/"+userUUID, "", "")
+	var enrollment struct {
+		Data domain.TOTPEnrollment `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &enrollment)
+	if w.Code != http.StatusOK || enrollment.Data.Secret == "" || !strings.HasPrefix(enrollment.Data.URI, "otpauth://totp/") {
+		t.Fatalf("expected an enrollment, got %d: %s", w.Code, w.Body)
+	}
+	secret := enrollment.Data.Secret
+	code := func(offset int64) string {
+		code, _ := auth.DefaultTOTP.Code(secret, auth.DefaultTOTP.Step(time.Now())+offset)
+		return code
+	}
+
+	w = doRequestAs(r, userUUID, http.MethodPost, "/api/user/mfa/totp/confirm/"+userUUID, `{"code":"`+code(-1)+`"}`, "")
+	var recovery struct {
+		Data domain.RecoveryCodes `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &recovery)
+	if w.Code != http.StatusOK || len(recovery.Data.Codes) != domain.RecoveryCodeCount {
+		t.Fatalf("expected MFA to be enabled, got %d: %s", w.Code, w.Body)
+	}
+
+	t.Run("allows one attempt per challenge", func(t *testing.T) {
+		challenge := login(t)
+		if !challenge.MFARequired || challenge.MFAToken == "" || challenge.AccessToken != "" {
+			t.Fatalf("expected an MFA challenge, got %+v", challenge)
+		}
+
+		w := post("/api/auth/login/mfa", `{"mfa_token":"`+challenge.MFAToken+`","code":"not-a-code"}`)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "/problems/invalid-mfa-code") {
+			t.Errorf("expected an invalid-mfa-code problem, got %d: %s", w.Code, w.Body)
+		}
+		w = post("/api/auth/login/mfa", `{"mfa_token":"`+challenge.MFAToken+`","code":"`+code(1)+`"}`)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "/problems/invalid-token") {
+			t.Errorf("expected the challenge to be spent, got %d: %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("grants enforced roles after MFA", func(t *testing.T) {
+		next := code(1)
+		w := post("/api/auth/login/mfa", `{"mfa_token":"`+login(t).MFAToken+`","code":"`+next+`"}`)
+		var response struct {
+			Data domain.AccessToken `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if w.Code != http.StatusOK || response.Data.AccessToken == "" {
+			t.Fatalf("expected a token, got %d: %s", w.Code, w.Body)
+		}
+		if w := listUsers(response.Data.AccessToken); w.Code != http.StatusOK {
+			t.Errorf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+		}
+
+		w = post("/api/auth/login/mfa", `{"mfa_token":"`+login(t).MFAToken+`","code":"`+next+`"}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected a replayed code to be refused, got %d: %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("accepts each recovery code once", func(t *testing.T) {
+		body := `{"mfa_token":"` + login(t).MFAToken + `","code":"` + recovery.Data.Codes[0] + `"}`
+		if w := post("/api/auth/login/mfa", body); w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+		}
+		body = `{"mfa_token":"` + login(t).MFAToken + `","code":"` + recovery.Data.Codes[0] + `"}`
+		if w := post("/api/auth/login/mfa", body); w.Code != http.StatusBadRequest {
+			t.Errorf("expected a used recovery code to be refused, got %d", w.Code)
+		}
+
+		w := doRequest(r, http.MethodGet, "/api/user/mfa/"+userUUID, "")
+		var status struct {
+			Data domain.MFAStatus `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &status)
+		if !status.Data.Enabled || status.Data.RecoveryCodesLeft != domain.RecoveryCodeCount-1 {
+			t.Errorf("expected %d recovery codes left, got %s", domain.RecoveryCodeCount-1, w.Body)
+		}
+	})
+
+	t.Run("admins disable it for lost devices", func(t *testing.T) {
+		if w := doRequest(r, http.MethodPost, "/api/user/mfa/disable/"+userUUID, ""); w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+		}
+		if data := login(t); data.AccessToken == "" || data.MFARequired {
+			t.Errorf("expected a token without MFA, got %+v", data)
+		}
+
+		w := doRequest(r, http.MethodGet, "/api/audit?target="+userUUID+"&limit=1", "")
+		var page struct {
+			Data []domain.AuditEvent `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &page)
+		if len(page.Data) != 1 || page.Data[0].Action != domain.AuditMFADisabled || page.Data[0].Actor != testSubject {
+			t.Errorf("expected the admin to be audited, got %s", w.Body)
+		}
+	})
+}
+
+func TestSessions(t *testing.T) {
+	r, mailbox := newTestRouterWithMailbox()
+
+	w := doRequest(r, http.MethodPost, "/api/user/create", `{"name":"John","email":"john@example.com"}`)
+	var created userResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	userUUID := created.Data.UUID
+	doRequest(r, http.MethodPut, "/api/user/password/"+userUUID, `{"new_password":"first secret phrase"}`)
+	doRequest(r, http.MethodPost, "/api/user/verify", `{"token":"`+mailbox.lastToken("john@example.com")+`"}`)
+
+	send := func(method, path, body, bearer, userAgent string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", userAgent)
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	tokens := func(t *testing.T, w *httptest.ResponseRecorder) domain.AccessToken {
+		t.Helper()
+		var response struct {
+			Data domain.AccessToken `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if w.Code != http.StatusOK || response.Data.RefreshToken == "" || response.Data.SessionID == "" {
+			t.Fatalf("expected tokens of a session, got %d: %s", w.Code, w.Body)
+		}
+		return response.Data
+	}
+	login := func(t *testing.T, userAgent string) domain.AccessToken {
+		t.Helper()
+		return tokens(t, send(http.MethodPost, "/api/auth/login", `{"email":"john@example.com","password":"first secret phrase"}`, "", userAgent))
+	}
+	refresh := func(token domain.AccessToken) *httptest.ResponseRecorder {
+		return send(http.MethodPost, "/api/auth/refresh", `{"refresh_token":"`+token.RefreshToken+`"}`, "", "laptop")
+	}
+	listSessions := func(t *testing.T, token domain.AccessToken) []domain.Session {
+		t.Helper()
+		w := send(http.MethodGet, "/api/user/sessions", "", token.AccessToken, "")
+		var response struct {
+			Data []domain.Session `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+		}
+		return response.Data
+	}
+
+	laptop := login(t, "laptop")
+	phone := login(t, "phone")
+
+	t.Run("lists the sessions of the caller", func(t *testing.T) {
+		sessions := listSessions(t, laptop)
+		if len(sessions) != 2 {
+			t.Fatalf("expected 2 sessions, got %+v", sessions)
+		}
+		for _, session := range sessions {
+			if current := session.ID == laptop.SessionID; session.Current != current {
+				t.Errorf("expected current to be %t for %+v", current, session)
+			}
+			if session.ID == phone.SessionID && (session.UserAgent != "phone" || session.IP == "") {
+				t.Errorf("expected the device of the session, got %+v", session)
+			}
+		}
+	})
+
+	t.Run("rotates refresh tokens and revokes the family on reuse", func(t *testing.T) {
+		rotated := tokens(t, refresh(laptop))
+		if rotated.SessionID != laptop.SessionID || rotated.RefreshToken == laptop.RefreshToken {
+			t.Fatalf("expected a new refresh token for the same session, got %+v", rotated)
+		}
+		if w := send(http.MethodGet, "/api/user/list/"+userUUID, "", rotated.AccessToken, ""); w.Code != http.StatusOK {
+			t.Fatalf("expected the refreshed token to work, got %d: %s", w.Code, w.Body)
+		}
+
+		if w := refresh(laptop); w.Code != http.StatusBadRequest {
+			t.Fatalf("expected the reused token to be refused, got %d: %s", w.Code, w.Body)
+		}
+		if w := refresh(rotated); w.Code != http.StatusBadRequest {
+			t.Errorf("expected the whole family to be revoked, got %d: %s", w.Code, w.Body)
+		}
+		if w := send(http.MethodGet, "/api/user/list/"+userUUID, "", rotated.AccessToken, ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("expected the access token of the session to be revoked, got %d", w.Code)
+		}
+
+		w := doRequest(r, http.MethodGet, "/api/audit?target="+userUUID+"&limit=1", "")
+		var page struct {
+			Data []domain.AuditEvent `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &page)
+		if len(page.Data) != 1 || page.Data[0].Action != domain.AuditRefreshTokenReused {
+			t.Errorf("expected the reuse to be audited, got %s", w.Body)
+		}
+		if sessions := listSessions(t, phone); len(sessions) != 1 || sessions[0].ID != phone.SessionID {
+			t.Errorf("expected only the phone to be left, got %+v", sessions)
+		}
+	})
+
+	t.Run("revokes a session", func(t *testing.T) {
+		tablet := login(t, "tablet")
+
+		w := doRequest(r, http.MethodPost, "/api/user/create", `{"name":"Jane","email":"jane@example.com"}`)
+		var jane userResponse
+		json.Unmarshal(w.Body.Bytes(), &jane)
+		w = doRequestAs(r, jane.Data.UUID, http.MethodDelete, "/api/user/sessions/"+tablet.SessionID, "", "")
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected the session of another user to be hidden, got %d: %s", w.Code, w.Body)
+		}
+
+		if w := send(http.MethodDelete, "/api/user/sessions/"+tablet.SessionID, "", phone.AccessToken, ""); w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+		}
+		if w := send(http.MethodDelete, "/api/user/sessions/"+tablet.SessionID, "", phone.AccessToken, ""); w.Code != http.StatusNotFound {
+			t.Errorf("expected a revoked session to be gone, got %d", w.Code)
+		}
+		if w := refresh(tablet); w.Code != http.StatusBadRequest {
+			t.Errorf("expected the refresh token to be revoked, got %d", w.Code)
+		}
+	})
+
+	t.Run("deactivation revokes every session", func(t *testing.T) {
+		if w := doRequest(r, http.MethodPut, "/api/user/manage/"+userUUID, ""); w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+		}
+		if w := send(http.MethodGet, "/api/user/list/"+userUUID, "", phone.AccessToken, ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("expected the access token to be revoked, got %d", w.Code)
+		}
+		if w := refresh(phone); w.Code != http.StatusBadRequest {
+			t.Errorf("expected the refresh token to be revoked, got %d", w.Code)
+		}
+
+		doRequest(r, http.MethodPut, "/api/user/manage/"+userUUID, "")
+		if w := refresh(phone); w.Code != http.StatusBadRequest {
+			t.Errorf("expected reactivation to leave sessions revoked, got %d", w.Code)
+		}
+	})
+}
+
+func TestAPIKeys(t *testing.T) {
+	r := newTestRouter()
+
+	type createdKey struct {
+		Data domain.CreatedAPIKey `json:"data"`
+	}
+	create := func(t *testing.T, body string) domain.CreatedAPIKey {
+		t.Helper()
+		w := doRequest(r, http.MethodPost, "/api/keys", body)
+		var response createdKey
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if w.Code != http.StatusCreated || response.Data.Key == "" || !strings.Contains(response.Data.Key, response.Data.Prefix) {
+			t.Fatalf("expected a key, got %d: %s", w.Code, w.Body)
+		}
+		if strings.Contains(w.Body.String(), "secret_hash") {
+			t.Errorf("expected the hash to stay hidden, got %s", w.Body)
+		}
+		return response.Data
+	}
+	withKey := func(method, path, body string, header func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		header(req)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	xAPIKey := func(key string) func(*http.Request) {
+		return func(req *http.Request) { req.Header.Set("X-API-Key", key) }
+	}
+	authorization := func(key string) func(*http.Request) {
+		return func(req *http.Request) { req.Header.Set("Authorization", "ApiKey "+key) }
+	}
+
+	t.Run("validates scopes", func(t *testing.T) {
+		w := doRequest(r, http.MethodPost, "/api/keys", `{"name":"batch","scopes":["roles:write"]}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body)
+		}
+		w = doRequestAs(r, "someone", http.MethodGet, "/api/keys", "", "")
+		if w.Code != http.StatusForbidden {
+			t.Errorf("expected only admins to manage keys, got %d", w.Code)
+		}
+	})
+
+	key := create(t, `{"name":"batch","scopes":["users:read","users:write"],"rate_limit":100}`)
+
+	t.Run("authenticates with the key", func(t *testing.T) {
+		for name, header := range map[string]func(*http.Request){"X-API-Key": xAPIKey(key.Key), "Authorization": authorization(key.Key)} {
+			if w := withKey(http.MethodGet, "/api/user/list", "", header); w.Code != http.StatusOK {
+				t.Errorf("%s: expected status %d, got %d: %s", name, http.StatusOK, w.Code, w.Body)
+			}
+		}
+
+		w := withKey(http.MethodPost, "/api/user/create", `{"name":"John","email":"john@example.com"}`, xAPIKey(key.Key))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body)
+		}
+		var created userResponse
+		json.Unmarshal(w.Body.Bytes(), &created)
+
+		w = doRequest(r, http.MethodGet, "/api/audit?target="+created.Data.UUID, "")
+		var page struct {
+			Data []domain.AuditEvent `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &page)
+		if len(page.Data) == 0 || page.Data[len(page.Data)-1].Actor != domain.APIKeySubjectPrefix+key.ID {
+			t.Errorf("expected the key to be the actor, got %s", w.Body)
+		}
+
+		if w := withKey(http.MethodDelete, "/api/user/delete/"+created.Data.UUID, "", xAPIKey(key.Key)); w.Code != http.StatusForbidden {
+			t.Errorf("expected a scope the key lacks to be refused, got %d", w.Code)
+		}
+		if w := withKey(http.MethodGet, "/api/keys", "", xAPIKey(key.Key)); w.Code != http.StatusForbidden {
+			t.Errorf("expected keys not to manage keys, got %d", w.Code)
+		}
+	})
+
+	t.Run("tracks the last use", func(t *testing.T) {
+		w := doRequest(r, http.MethodGet, "/api/keys/"+key.ID, "")
+		var response struct {
+			Data domain.APIKey `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if w.Code != http.StatusOK || response.Data.LastUsedAt == nil || strings.Contains(w.Body.String(), `"key"`) {
+			t.Errorf("expected the key without its secret and with a last use, got %d: %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("rejects invalid keys", func(t *testing.T) {
+		for _, invalid := range []string{"gbk_" + key.Prefix + "_wrong", "not a key"} {
+			w := withKey(http.MethodGet, "/api/user/list", "", xAPIKey(invalid))
+			if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "/problems/invalid-api-key") {
+				t.Errorf("expected %q to be refused, got %d: %s", invalid, w.Code, w.Body)
+			}
+		}
+
+		expired := create(t, `{"name":"old","scopes":["users:read"],"expires_at":"2020-01-01T00:00:00Z"}`)
+		if w := withKey(http.MethodGet, "/api/user/list", "", xAPIKey(expired.Key)); w.Code != http.StatusUnauthorized {
+			t.Errorf("expected an expired key to be refused, got %d", w.Code)
+		}
+	})
+
+	t.Run("applies the rate limit of the key", func(t *testing.T) {
+		limited := create(t, `{"name":"limited","scopes":["users:read"],"rate_limit":2}`)
+		for i := 0; i < 2; i++ {
+			if w := withKey(http.MethodGet, "/api/user/list", "", xAPIKey(limited.Key)); w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+			}
+		}
+		w := withKey(http.MethodGet, "/api/user/list", "", xAPIKey(limited.Key))
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+			t.Errorf("expected status %d with Retry-After, got %d: %v", http.StatusTooManyRequests, w.Code, w.Header())
+		}
+	})
+
+	t.Run("updates and revokes keys", func(t *testing.T) {
+		w := doRequest(r, http.MethodPut, "/api/keys/"+key.ID, `{"name":"batch","scopes":["users:read"],"rate_limit":100}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+		}
+		w = withKey(http.MethodPost, "/api/user/create", `{"name":"Jane","email":"jane@example.com"}`, xAPIKey(key.Key))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("expected the removed scope to be refused, got %d", w.Code)
+		}
+
+		if w := doRequest(r, http.MethodDelete, "/api/keys/"+key.ID, ""); w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+		}
+		if w := withKey(http.MethodGet, "/api/user/list", "", xAPIKey(key.Key)); w.Code != http.StatusUnauthorized {
+			t.Errorf("expected a revoked key to be refused, got %d", w.Code)
+		}
+		if w := doRequest(r, http.MethodGet, "/api/keys/"+key.ID, ""); w.Code != http.StatusNotFound {
+			t.Errorf("expected a revoked key to be gone, got %d", w.Code)
+		}
+	})
+}
+
+func TestOIDCLogin(t *testing.T) {
+	r, mailbox := newTestRouterWithMailbox()
+
+	get := func(path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// login runs the flow through the provider as identity and returns the
+	// response of the callback.
+	login := func(t *testing.T, identity oidctest.Identity) *httptest.ResponseRecorder {
+		t.Helper()
+		testIdP.SetIdentity(identity)
+
+		w := get("/api/auth/oidc/login")
+		if w.Code != http.StatusFound {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusFound, w.Code, w.Body)
+		}
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 || !cookies[0].HttpOnly || strings.Contains(w.Header().Get("Location"), cookies[0].Value) {
+			t.Fatalf("expected an HttpOnly cookie kept from the provider, got %+v", cookies)
+		}
+
+		callback, err := testIdP.Authorize(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		return get(callback.RequestURI(), cookies[0])
+	}
+	accessToken := func(t *testing.T, w *httptest.ResponseRecorder) domain.AccessToken {
+		t.Helper()
+		var response struct {
+			Data domain.AccessToken `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if w.Code != http.StatusOK || response.Data.AccessToken == "" || response.Data.RefreshToken == "" {
+			t.Fatalf("expected tokens, got %d: %s", w.Code, w.Body)
+		}
+		return response.Data
+	}
+	subject := func(token domain.AccessToken) string {
+		claims := &auth.Claims{}
+		jwt.ParseWithClaims(token.AccessToken, claims, func(*jwt.Token) (interface{}, error) { return []byte(testSecret), nil })
+		return claims.Subject
+	}
+
+	t.Run("creates the user on the first login", func(t *testing.T) {
+		identity := oidctest.Identity{Subject: "idp-1", Email: "olivia@example.com", EmailVerified: true, Name: "Olivia"}
+		token := accessToken(t, login(t, identity))
+
+		w := doRequestAs(r, subject(token), http.MethodGet, "/api/user/list/"+subject(token), "", "")
+		var created userResponse
+		json.Unmarshal(w.Body.Bytes(), &created)
+		if w.Code != http.StatusOK || created.Data.Email != "olivia@example.com" || created.Data.Name != "Olivia" {
+			t.Fatalf("expected the user to be created, got %d: %s", w.Code, w.Body)
+		}
+		if created.Data.EmailVerifiedAt == nil || mailbox.count("olivia@example.com") != 0 {
+			t.Errorf("expected the email verified by the provider without mailing a token, got %s", w.Body)
+		}
+
+		if again := accessToken(t, login(t, identity)); subject(again) != subject(token) {
+			t.Errorf("expected the next login to find the same user, got %s", subject(again))
+		}
+	})
+
+	t.Run("links existing users by email", func(t *testing.T) {
+		w := doRequest(r, http.MethodPost, "/api/user/create", `{"name":"Paul","email":"paul@example.com"}`)
+		var existing userResponse
+		json.Unmarshal(w.Body.Bytes(), &existing)
+
+		token := accessToken(t, login(t, oidctest.Identity{Subject: "idp-2", Email: "paul@example.com", EmailVerified: true}))
+		if subject(token) != existing.Data.UUID {
+			t.Errorf("expected the login to link %s, got %s", existing.Data.UUID, subject(token))
+		}
+
+		w = doRequest(r, http.MethodGet, "/api/user/list/"+existing.Data.UUID, "")
+		var linked userResponse
+		json.Unmarshal(w.Body.Bytes(), &linked)
+		if linked.Data.EmailVerifiedAt == nil {
+			t.Errorf("expected the linked email to be verified, got %s", w.Body)
+		}
+
+		w = doRequest(r, http.MethodGet, "/api/audit?target="+existing.Data.UUID+"&limit=1", "")
+		var page struct {
+			Data []domain.AuditEvent `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &page)
+		if len(page.Data) != 1 || page.Data[0].Action != domain.AuditEmailVerified {
+			t.Errorf("expected the verification to be audited, got %s", w.Body)
+		}
+	})
+
+	t.Run("requires an email verified by the provider", func(t *testing.T) {
+		w := login(t, oidctest.Identity{Subject: "idp-3", Email: "paul@example.com"})
+		if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "/problems/email-not-verified") {
+			t.Errorf("expected status %d, got %d: %s", http.StatusForbidden, w.Code, w.Body)
+		}
+	})
+
+	t.Run("rejects failed logins", func(t *testing.T) {
+		w := login(t, oidctest.Identity{})
+		if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "/problems/oidc-login-failed") {
+			t.Errorf("expected a denied login to fail, got %d: %s", w.Code, w.Body)
+		}
+
+		testIdP.SetIdentity(oidctest.Identity{Subject: "idp-1", Email: "olivia@example.com", EmailVerified: true})
+		callback, _ := testIdP.Authorize(get("/api/auth/oidc/login").Header().Get("Location"))
+		other := get("/api/auth/oidc/login").Result().Cookies()
+
+		for name, cookies := range map[string][]*http.Cookie{"no cookie": nil, "another login": other} {
+			w := get(callback.RequestURI(), cookies...)
+			if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "/problems/oidc-login-failed") {
+				t.Errorf("%s: expected status %d, got %d: %s", name, http.StatusUnauthorized, w.Code, w.Body)
+			}
+		}
+	})
+}
@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"go-back/internal/auth"
+	"go-back/internal/domain"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// SubjectKey holds the sub claim of the authenticated caller.
+	SubjectKey = "subject"
+	// ClaimsKey holds the *auth.Claims of the authenticated caller.
+	ClaimsKey = "claims"
+	// APIKeyKey holds the domain.APIKey of callers authenticated with one.
+	APIKeyKey = "api_key"
+
+	// APIKeyHeader carries an API key, as an alternative to
+	// "Authorization: ApiKey <key>".
+	APIKeyHeader = "X-API-Key"
+)
+
+// GetSubject returns the subject authenticated by Authenticate, or "" on
+// routes that do not require authentication.
+func GetSubject(c *gin.Context) string {
+	return c.GetString(SubjectKey)
+}
+
+// GetSessionID returns the session of the token authenticated by
+// Authenticate, or "" for tokens issued elsewhere.
+func GetSessionID(c *gin.Context) string {
+	claims, ok := c.Get(ClaimsKey)
+	if !ok {
+		return ""
+	}
+	return claims.(*auth.Claims).SessionID
+}
+
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(ctx context.Context, key string) (domain.APIKey, error)
+}
+
+// Authenticate requires a valid JWT in the Authorization header, as in
+// "Authorization: Bearer <token>", and puts its subject and claims on the
+// gin context. Requests carrying an API key are authenticated by keys
+// instead, and get the key on the gin context in place of claims.
+func Authenticate(verifier *auth.Verifier, keys APIKeyAuthenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key, ok := apiKey(c); ok {
+			authenticateAPIKey(c, keys, key)
+			return
+		}
+
+		scheme, token, found := strings.Cut(c.GetHeader("Authorization"), " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			c.Header("WWW-Authenticate", `Bearer`)
+			abortWithProblem(c, http.StatusUnauthorized, "unauthorized",
+				"Unauthorized", "a bearer token is required")
+			return
+		}
+
+		claims, err := verifier.Verify(strings.TrimSpace(token))
+		if err != nil {
+			Logger(c.Request.Context()).Info("rejected token", "err", err)
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			abortWithProblem(c, http.StatusUnauthorized, "invalid-token",
+				"Unauthorized", "the bearer token is invalid or expired")
+			return
+		}
+
+		c.Set(SubjectKey, claims.Subject)
+		c.Set(ClaimsKey, claims)
+
+		ctx := WithLogger(c.Request.Context(), Logger(c.Request.Context()).With("subject", claims.Subject))
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+	}
+}
+
+// apiKey returns the API key of the request, from X-API-Key or an
+// Authorization header with the ApiKey scheme.
+func apiKey(c *gin.Context) (string, bool) {
+	if key := c.GetHeader(APIKeyHeader); key != "" {
+		return key, true
+	}
+	scheme, key, found := strings.Cut(c.GetHeader("Authorization"), " ")
+	if found && strings.EqualFold(scheme, "ApiKey") {
+		return strings.TrimSpace(key), true
+	}
+	return "", false
+}
+
+func authenticateAPIKey(c *gin.Context, keys APIKeyAuthenticator, secret string) {
+	key, err := keys.AuthenticateAPIKey(c.Request.Context(), secret)
+	switch {
+	case errors.Is(err, domain.ErrInvalidAPIKey):
+		Logger(c.Request.Context()).Info("rejected api key", "err", err)
+		c.Header("WWW-Authenticate", `ApiKey`)
+		abortWithProblem(c, http.StatusUnauthorized, "invalid-api-key",
+			"Unauthorized", "the API key is invalid, expired or revoked")
+		return
+	case err != nil:
+		Logger(c.Request.Context()).Error("failed to authenticate api key", "err", err)
+		abortWithProblem(c, http.StatusInternalServerError, "internal-error",
+			"Internal server error", "an unexpected error occurred")
+		return
+	}
+
+	c.Set(SubjectKey, key.Subject())
+	c.Set(APIKeyKey, key)
+
+	ctx := WithLogger(c.Request.Context(), Logger(c.Request.Context()).With("subject", key.Subject()))
+	c.Request = c.Request.WithContext(ctx)
+
+	c.Next()
+}
+
+type TokenChecker interface {
+	CheckToken(ctx context.Context, claims *auth.Claims) error
+}
+
+// RejectRevoked turns away tokens that Authenticate accepted but that were
+// revoked since they were issued, such as those older than a password
+// reset. It must run after Authenticate. API keys are checked when they
+// are authenticated.
+func RejectRevoked(checker TokenChecker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := c.Get(ClaimsKey)
+		if !ok {
+			c.Next()
+			return
+		}
+		err := checker.CheckToken(c.Request.Context(), claims.(*auth.Claims))
+		if errors.Is(err, domain.ErrTokenRevoked) {
+			Logger(c.Request.Context()).Info("rejected token", "err", err)
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			abortWithProblem(c, http.StatusUnauthorized, "invalid-token",
+				"Unauthorized", "the bearer token was revoked")
+			return
+		}
+		if err != nil {
+			Logger(c.Request.Context()).Error("failed to check token", "err", err)
+			abortWithProblem(c, http.StatusInternalServerError, "internal-error",
+				"Internal server error", "an unexpected error occurred")
+			return
+		}
+
+		c.Next()
+	}
+}
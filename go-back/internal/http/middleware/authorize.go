@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"go-back/internal/auth"
+	"go-back/internal/domain"
+	"go-back/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PrincipalKey holds the domain.Principal of the authenticated caller.
+const PrincipalKey = "principal"
+
+type PrincipalLoader interface {
+	LoadPrincipal(ctx context.Context, subject string, mfa bool) (domain.Principal, error)
+}
+
+// LoadPrincipal resolves the roles of the subject set by Authenticate and
+// puts the principal on the gin context and in the request context, where
+// the services enforce per-object checks. API keys hold their scopes
+// instead of roles.
+func LoadPrincipal(loader PrincipalLoader) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var principal domain.Principal
+		if key, ok := c.Get(APIKeyKey); ok {
+			principal = key.(domain.APIKey).Principal()
+		} else {
+			claims, _ := c.Get(ClaimsKey)
+			mfa := claims != nil && claims.(*auth.Claims).MFA()
+
+			var err error
+			principal, err = loader.LoadPrincipal(c.Request.Context(), GetSubject(c), mfa)
+			if err != nil {
+				Logger(c.Request.Context()).Error("failed to load principal", "err", err)
+				abortWithProblem(c, http.StatusInternalServerError, "internal-error",
+					"Internal server error", "an unexpected error occurred")
+				return
+			}
+		}
+
+		c.Set(PrincipalKey, principal)
+		c.Request = c.Request.WithContext(service.WithPrincipal(c.Request.Context(), principal))
+
+		c.Next()
+	}
+}
+
+// Require rejects callers whose roles do not include perm, even over their
+// own account only, with 403. Callers who would get perm by logging in
+// with MFA are told so.
+func Require(perm domain.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, _ := c.Get(PrincipalKey)
+		p, ok := principal.(domain.Principal)
+		if ok && !p.Has(perm) && p.NeedsMFA(perm) {
+			abortWithProblem(c, http.StatusForbidden, "mfa-required",
+				"MFA required", "permission "+string(perm)+" requires logging in with multi-factor authentication")
+			return
+		}
+		if !ok || !p.Has(perm) {
+			abortWithProblem(c, http.StatusForbidden, "forbidden",
+				"Forbidden", "missing permission "+string(perm))
+			return
+		}
+
+		c.Next()
+	}
+}
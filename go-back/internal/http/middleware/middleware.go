@@ -1 +1,163 @@
 package middleware
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+
+	// RequestIDKey holds the request ID in the gin context.
+	RequestIDKey = "request_id"
+
+	// StatusClientClosedRequest is the nginx status for requests the client
+	// gave up on before they were served.
+	StatusClientClosedRequest = 499
+
+	maxRequestIDLength = 128
+)
+
+type loggerKey struct{}
+
+// WithLogger returns a copy of ctx carrying logger.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// Logger returns the request-scoped logger set by RequestID, or the default
+// logger outside of a request.
+func Logger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// GetRequestID returns the ID assigned to the request by RequestID.
+func GetRequestID(c *gin.Context) string {
+	return c.GetString(RequestIDKey)
+}
+
+// RequestID assigns every request an ID, reusing the inbound X-Request-ID
+// when it looks sane, and echoes it in the response. It also puts a logger
+// tagged with the ID in the request context, so every entry logged while
+// serving the request can be correlated.
+func RequestID(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+
+		c.Set(RequestIDKey, requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		ctx := WithLogger(c.Request.Context(), logger.With("request_id", requestID))
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+	}
+}
+
+// validRequestID accepts printable ASCII IDs of reasonable length, so
+// clients cannot inject newlines or huge values into the logs.
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(requestID); i++ {
+		if requestID[i] < 0x21 || requestID[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// AccessLog logs one entry per request once it is served, at error level
+// for 5xx responses and warn level for 4xx ones. Requests the client closed
+// stay at info level, since nothing went wrong on either side.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status == StatusClientClosedRequest:
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		Logger(c.Request.Context()).LogAttrs(c.Request.Context(), level, "request",
+			slog.String("method", c.Request.Method),
+			slog.String("route", route),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Int("bytes", max(c.Writer.Size(), 0)),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+		)
+	}
+}
+
+// Recovery turns a panic in a later handler into a 500 problem+json
+// response, logging the panic value and stack trace.
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// http.ErrAbortHandler is the standard way to abort a response;
+			// let net/http handle it.
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			Logger(c.Request.Context()).Error("panic recovered",
+				"panic", fmt.Sprint(recovered),
+				"stack", string(debug.Stack()),
+			)
+
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			abortWithProblem(c, http.StatusInternalServerError, "internal-error",
+				"Internal server error", "an unexpected error occurred")
+		}()
+
+		c.Next()
+	}
+}
+
+// abortWithProblem writes the problem+json document the controllers use for
+// errors raised before a handler runs.
+func abortWithProblem(c *gin.Context, status int, slug, title, detail string) {
+	c.Header("Content-Type", "application/problem+json")
+	c.AbortWithStatusJSON(status, gin.H{
+		"type":       "/problems/" + slug,
+		"title":      title,
+		"status":     status,
+		"detail":     detail,
+		"instance":   c.Request.URL.Path,
+		"request_id": GetRequestID(c),
+	})
+}
@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestRouter(logs *bytes.Buffer) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestID(slog.New(slog.NewJSONHandler(logs, nil))), AccessLog(), Recovery())
+	r.GET("/users/:id", func(c *gin.Context) {
+		Logger(c.Request.Context()).Info("handler")
+		c.String(http.StatusOK, "ok")
+	})
+	r.GET("/canceled", func(c *gin.Context) {
+		c.Status(StatusClientClosedRequest)
+	})
+	r.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+	return r
+}
+
+func decodeLogs(t *testing.T, logs *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("expected json log line, got %q", line)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestRequestID(t *testing.T) {
+	t.Run("honours inbound X-Request-ID", func(t *testing.T) {
+		var logs bytes.Buffer
+		req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+		req.Header.Set(RequestIDHeader, "abc-123")
+		w := httptest.NewRecorder()
+		newTestRouter(&logs).ServeHTTP(w, req)
+
+		if id := w.Header().Get(RequestIDHeader); id != "abc-123" {
+			t.Errorf("expected abc-123, got %q", id)
+		}
+		for _, entry := range decodeLogs(t, &logs) {
+			if entry["request_id"] != "abc-123" {
+				t.Errorf("expected every entry to carry the request id, got %v", entry)
+			}
+		}
+	})
+
+	t.Run("generates an id when missing or unsafe", func(t *testing.T) {
+		for _, inbound := range []string{"", "bad\nid", strings.Repeat("a", 200)} {
+			var logs bytes.Buffer
+			req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+			req.Header.Set(RequestIDHeader, inbound)
+			w := httptest.NewRecorder()
+			newTestRouter(&logs).ServeHTTP(w, req)
+
+			if id := w.Header().Get(RequestIDHeader); id == "" || id == inbound {
+				t.Errorf("expected a generated id for %q, got %q", inbound, id)
+			}
+		}
+	})
+}
+
+func TestAccessLog(t *testing.T) {
+	var logs bytes.Buffer
+	w := httptest.NewRecorder()
+	newTestRouter(&logs).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/42", nil))
+
+	entries := decodeLogs(t, &logs)
+	access := entries[len(entries)-1]
+	if access["msg"] != "request" || access["route"] != "/users/:id" || access["path"] != "/users/42" {
+		t.Errorf("unexpected access log %v", access)
+	}
+	if access["status"] != float64(http.StatusOK) || access["bytes"] != float64(2) || access["level"] != "INFO" {
+		t.Errorf("expected status 200, 2 bytes at info level, got %v", access)
+	}
+	if _, ok := access["latency"]; !ok {
+		t.Errorf("expected latency in %v", access)
+	}
+}
+
+func TestAccessLog_ClientClosedRequest(t *testing.T) {
+	var logs bytes.Buffer
+	w := httptest.NewRecorder()
+	newTestRouter(&logs).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/canceled", nil))
+
+	entries := decodeLogs(t, &logs)
+	if access := entries[len(entries)-1]; access["status"] != float64(StatusClientClosedRequest) || access["level"] != "INFO" {
+		t.Errorf("expected access log with status 499 at info level, got %v", access)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	var logs bytes.Buffer
+	w := httptest.NewRecorder()
+	newTestRouter(&logs).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+	var problem map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("expected json body, got %q", w.Body)
+	}
+	if problem["request_id"] != w.Header().Get(RequestIDHeader) || problem["status"] != float64(http.StatusInternalServerError) {
+		t.Errorf("unexpected problem %v", problem)
+	}
+
+	entries := decodeLogs(t, &logs)
+	if entries[0]["msg"] != "panic recovered" || entries[0]["panic"] != "boom" {
+		t.Errorf("expected panic to be logged, got %v", entries[0])
+	}
+	if access := entries[len(entries)-1]; access["status"] != float64(http.StatusInternalServerError) || access["level"] != "ERROR" {
+		t.Errorf("expected access log with status 500 at error level, got %v", access)
+	}
+}
@@ -0,0 +1,253 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-back/internal/domain"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimitKey holds the RateLimitResult of the tightest policy applied to
+// the request so far, which is the one the RateLimit headers describe.
+const rateLimitKey = "rate_limit"
+
+// Limit allows Requests per Period, all of them at once at most.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseLimit reads limits written as "requests/period", such as "10/1m".
+// An empty value or zero requests is no limit.
+func ParseLimit(value string) (Limit, error) {
+	if value == "" {
+		return Limit{}, nil
+	}
+	requests, period, found := strings.Cut(value, "/")
+	if !found {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: want requests/period", value)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: bad number of requests", value)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: bad period", value)
+	}
+	return Limit{Requests: n, Period: d}, nil
+}
+
+// Enabled reports whether the limit limits anything.
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Period > 0
+}
+
+// interval is the time one request takes to be paid back.
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Requests)
+}
+
+// RateLimitResult is the outcome of counting a request against a Limit.
+type RateLimitResult struct {
+	Limit   Limit
+	Allowed bool
+	// Remaining is how many more requests would be allowed right now.
+	Remaining int
+	// RetryAfter is how long until the next request is allowed, when this
+	// one was not.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the whole limit is available again.
+	ResetAfter time.Duration
+}
+
+// newRateLimitResult describes the bucket whose theoretical arrival time is
+// resetAfter away, as seen by a request that was allowed or not.
+func newRateLimitResult(limit Limit, allowed bool, retryAfter, resetAfter time.Duration) RateLimitResult {
+	remaining := int((limit.Period - resetAfter) / limit.interval())
+	return RateLimitResult{
+		Limit:      limit,
+		Allowed:    allowed,
+		Remaining:  max(0, min(remaining, limit.Requests)),
+		RetryAfter: retryAfter,
+		ResetAfter: resetAfter,
+	}
+}
+
+// RateLimitStore counts requests against limits with the generic cell rate
+// algorithm (GCRA), which behaves as a token bucket holding limit.Requests
+// tokens but only stores one timestamp per key.
+type RateLimitStore interface {
+	Allow(ctx context.Context, key string, limit Limit) (RateLimitResult, error)
+}
+
+// RatePolicy limits the requests of each client, as told apart by Key, to
+// Limit. Limits may be told apart by name only, so each policy needs its
+// own Name.
+type RatePolicy struct {
+	Name  string
+	Limit Limit
+	Key   RateKeyFunc
+	// Override, when set, may replace Limit for a request, as API keys with
+	// a limit of their own do.
+	Override func(*gin.Context) (Limit, bool)
+}
+
+// RateKeyFunc names the bucket of a request.
+type RateKeyFunc func(*gin.Context) string
+
+// ByIP buckets requests by client IP.
+func ByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// BySubject buckets requests by the user or API key authenticated by
+// Authenticate, falling back to the client IP on open routes.
+func BySubject(c *gin.Context) string {
+	if subject := GetSubject(c); subject != "" {
+		return "sub:" + subject
+	}
+	return ByIP(c)
+}
+
+// APIKeyLimit overrides the limit of requests made with an API key with
+// the limit of the key, or with fallback for keys without one.
+func APIKeyLimit(fallback Limit) func(*gin.Context) (Limit, bool) {
+	return func(c *gin.Context) (Limit, bool) {
+		key, ok := c.Get(APIKeyKey)
+		if !ok {
+			return Limit{}, false
+		}
+		if perMinute := key.(domain.APIKey).RateLimit; perMinute > 0 {
+			return Limit{Requests: perMinute, Period: time.Minute}, true
+		}
+		return fallback, true
+	}
+}
+
+// RateLimit counts the request against policy in store and rejects it with
+// 429 and Retry-After once the bucket is empty. Every response carries the
+// RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and
+// RateLimit-Policy headers of the tightest policy applied to it. When the
+// store fails the request is let through: an outage of the store should not
+// take the API down with it.
+func RateLimit(store RateLimitStore, policy RatePolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := policy.Limit
+		if policy.Override != nil {
+			if override, ok := policy.Override(c); ok {
+				limit = override
+			}
+		}
+		if store == nil || !limit.Enabled() {
+			c.Next()
+			return
+		}
+
+		key := "ratelimit:" + policy.Name + ":" + policy.Key(c)
+		result, err := store.Allow(c.Request.Context(), key, limit)
+		if err != nil {
+			Logger(c.Request.Context()).Error("rate limit store failed", "policy", policy.Name, "err", err)
+			c.Next()
+			return
+		}
+
+		setRateLimitHeaders(c, result)
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			abortWithProblem(c, http.StatusTooManyRequests, "too-many-requests",
+				"Too many requests", "the rate limit of "+policy.Name+" was exceeded, slow down and try again later")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// setRateLimitHeaders describes result in the RateLimit headers of the
+// IETF draft, unless an earlier policy left less room.
+func setRateLimitHeaders(c *gin.Context, result RateLimitResult) {
+	if previous, ok := c.Get(rateLimitKey); ok && previous.(RateLimitResult).Remaining < result.Remaining {
+		return
+	}
+	c.Set(rateLimitKey, result)
+
+	header := c.Writer.Header()
+	header.Set("RateLimit-Limit", strconv.Itoa(result.Limit.Requests))
+	header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+	header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", result.Limit.Requests, ceilSeconds(result.Limit.Period)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// gcra counts a request arriving at now against the bucket whose
+// theoretical arrival time is tat, returning the new one. A bucket is full
+// when tat is in the past and empty when tat is a whole period ahead.
+func gcra(tat, now time.Time, limit Limit) (time.Time, RateLimitResult) {
+	if tat.Before(now) {
+		tat = now
+	}
+	next := tat.Add(limit.interval())
+	if allowAt := next.Add(-limit.Period); allowAt.After(now) {
+		return tat, newRateLimitResult(limit, false, allowAt.Sub(now), tat.Sub(now))
+	}
+	return next, newRateLimitResult(limit, true, 0, next.Sub(now))
+}
+
+// MemoryRateLimitStore keeps the buckets in process memory, which is right
+// for a single instance only: each instance would allow the whole limit.
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	tats    map[string]time.Time
+	sweptAt time.Time
+	now     func() time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{tats: map[string]time.Time{}, now: time.Now}
+}
+
+func (s *MemoryRateLimitStore) Allow(ctx context.Context, key string, limit Limit) (RateLimitResult, error) {
+	if err := ctx.Err(); err != nil {
+		return RateLimitResult{}, err
+	}
+	if !limit.Enabled() {
+		return RateLimitResult{}, errors.New("ratelimit: limit is not enabled")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	tat, result := gcra(s.tats[key], now, limit)
+	s.tats[key] = tat
+	return result, nil
+}
+
+// sweep forgets full buckets once a minute, so the map only holds clients
+// seen recently.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.sweptAt) < time.Minute {
+		return
+	}
+	for key, tat := range s.tats {
+		if !tat.After(now) {
+			delete(s.tats, key)
+		}
+	}
+	s.sweptAt = now
+}
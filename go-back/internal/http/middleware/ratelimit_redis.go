@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// gcraScript runs gcra atomically in Redis, in microseconds and on the
+// clock of Redis, so every instance shares the same buckets and time. It
+// returns whether the request was allowed, its retry after and reset after.
+var gcraScript = redis.NewScript(`
+local period = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+local tat = tonumber(redis.call("GET", KEYS[1]) or now)
+if tat < now then
+	tat = now
+end
+
+local next = tat + interval
+local allow_at = next - period
+if allow_at > now then
+	return {0, allow_at - now, tat - now}
+end
+
+redis.call("SET", KEYS[1], string.format("%.0f", next), "PX", math.ceil((next - now) / 1000))
+return {1, 0, next - now}
+`)
+
+// RedisRateLimitStore keeps the buckets in Redis, or anything speaking its
+// protocol with Lua scripting, so the limits hold across instances.
+type RedisRateLimitStore struct {
+	client redis.Scripter
+}
+
+func NewRedisRateLimitStore(client redis.Scripter) *RedisRateLimitStore {
+	return &RedisRateLimitStore{client: client}
+}
+
+func (s *RedisRateLimitStore) Allow(ctx context.Context, key string, limit Limit) (RateLimitResult, error) {
+	if !limit.Enabled() {
+		return RateLimitResult{}, errors.New("ratelimit: limit is not enabled")
+	}
+
+	values, err := gcraScript.Run(ctx, s.client, []string{key},
+		limit.Period.Microseconds(), limit.interval().Microseconds()).Int64Slice()
+	if err != nil {
+		return RateLimitResult{}, fmt.Errorf("ratelimit: running script: %w", err)
+	}
+	if len(values) != 3 {
+		return RateLimitResult{}, fmt.Errorf("ratelimit: script returned %d values", len(values))
+	}
+
+	return newRateLimitResult(limit, values[0] == 1,
+		time.Duration(values[1])*time.Microsecond, time.Duration(values[2])*time.Microsecond), nil
+}
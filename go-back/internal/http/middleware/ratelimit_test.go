@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestParseLimit(t *testing.T) {
+	cases := map[string]Limit{
+		"10/1m": {Requests: 10, Period: time.Minute},
+		"5/30s": {Requests: 5, Period: 30 * time.Second},
+		"":      {},
+		"0/1m":  {Period: time.Minute},
+	}
+	for value, want := range cases {
+		if got, err := ParseLimit(value); err != nil || got != want {
+			t.Errorf("%q: expected %+v, got %+v, %v", value, want, got, err)
+		}
+	}
+	for _, value := range []string{"10", "ten/1m", "10/minute", "10/0s", "-1/1m"} {
+		if _, err := ParseLimit(value); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
+
+func TestRateLimitStores(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	memory := NewMemoryRateLimitStore()
+	memoryClock := start
+	memory.now = func() time.Time { return memoryClock }
+
+	mr := miniredis.RunT(t)
+	mr.SetTime(start)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	stores := map[string]struct {
+		store   RateLimitStore
+		advance func(time.Duration)
+	}{
+		"memory": {memory, func(d time.Duration) { memoryClock = memoryClock.Add(d) }},
+		"redis":  {NewRedisRateLimitStore(client), func(d time.Duration) { start = start.Add(d); mr.SetTime(start) }},
+	}
+
+	limit := Limit{Requests: 3, Period: time.Minute}
+	ctx := context.Background()
+	for name, backend := range stores {
+		t.Run(name, func(t *testing.T) {
+			for i, want := range []int{2, 1, 0} {
+				result, err := backend.store.Allow(ctx, "client", limit)
+				if err != nil || !result.Allowed || result.Remaining != want {
+					t.Fatalf("request %d: expected to be allowed with %d remaining, got %+v, %v", i, want, result, err)
+				}
+			}
+
+			result, err := backend.store.Allow(ctx, "client", limit)
+			if err != nil || result.Allowed || result.RetryAfter != 20*time.Second || result.ResetAfter != time.Minute {
+				t.Fatalf("expected to wait 20s for one more request, got %+v, %v", result, err)
+			}
+			if other, _ := backend.store.Allow(ctx, "another client", limit); !other.Allowed || other.Remaining != 2 {
+				t.Errorf("expected clients to have their own bucket, got %+v", other)
+			}
+
+			backend.advance(20 * time.Second)
+			if result, _ := backend.store.Allow(ctx, "client", limit); !result.Allowed || result.Remaining != 0 {
+				t.Errorf("expected one request to be paid back, got %+v", result)
+			}
+
+			backend.advance(time.Hour)
+			if result, _ := backend.store.Allow(ctx, "client", limit); !result.Allowed || result.Remaining != 2 {
+				t.Errorf("expected the bucket to refill, got %+v", result)
+			}
+		})
+	}
+}
+
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Allow(context.Context, string, Limit) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("connection refused")
+}
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := NewMemoryRateLimitStore()
+
+	r := gin.New()
+	r.GET("/loose", RateLimit(store, RatePolicy{Name: "loose", Limit: Limit{Requests: 5, Period: time.Minute}, Key: ByIP}),
+		func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	r.GET("/tight",
+		RateLimit(store, RatePolicy{Name: "loose", Limit: Limit{Requests: 5, Period: time.Minute}, Key: ByIP}),
+		RateLimit(store, RatePolicy{Name: "tight", Limit: Limit{Requests: 2, Period: time.Minute}, Key: ByIP}),
+		func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	r.GET("/failing", RateLimit(failingRateLimitStore{}, RatePolicy{Name: "failing", Limit: Limit{Requests: 1, Period: time.Minute}, Key: ByIP}),
+		func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/loose")
+	if w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "5" || w.Header().Get("RateLimit-Remaining") != "4" ||
+		w.Header().Get("RateLimit-Reset") != "12" || w.Header().Get("RateLimit-Policy") != "5;w=60" {
+		t.Errorf("expected the headers of the loose policy, got %d %v", w.Code, w.Header())
+	}
+
+	for i, remaining := range []string{"1", "0"} {
+		w = get("/tight")
+		if w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "2" || w.Header().Get("RateLimit-Remaining") != remaining {
+			t.Errorf("request %d: expected the headers of the tightest policy, got %d %v", i, w.Code, w.Header())
+		}
+	}
+
+	w = get("/tight")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "30" ||
+		!strings.Contains(w.Body.String(), "/problems/too-many-requests") {
+		t.Errorf("expected status %d with Retry-After, got %d %v: %s", http.StatusTooManyRequests, w.Code, w.Header(), w.Body)
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := get("/failing"); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+			t.Errorf("expected requests to go through when the store fails, got %d %v", w.Code, w.Header())
+		}
+	}
+}
@@ -1,22 +1,39 @@
 package router
 
 import (
+	"log"
+	"log/slog"
 	"net/http"
 
+	config "go-back/internal/cmd/server"
+	"go-back/internal/http/middleware"
+
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
 func NewRouter() (router *gin.Engine) {
-	return setConfigs(gin.Default())
+	return setConfigs(gin.New())
 }
 
 func setConfigs(router *gin.Engine) *gin.Engine {
+	// Client IPs key rate limits and the audit log, so X-Forwarded-For is
+	// only believed from the proxies we run.
+	if err := router.SetTrustedProxies(config.TRUSTED_PROXIES); err != nil {
+		log.Fatalf("func=setConfigs err=%v", err)
+	}
+
+	router.Use(
+		middleware.RequestID(slog.Default()),
+		middleware.AccessLog(),
+		middleware.Recovery(),
+	)
 
 	router.Use(cors.New(cors.Config{AllowOrigins: []string{"*"},
-		AllowMethods:     []string{http.MethodGet, http.MethodPatch, http.MethodPut, http.MethodPost, http.MethodHead, http.MethodDelete, http.MethodOptions},
-		AllowHeaders:     []string{"Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization", "accept", "origin", "Cache-Control", "X-Requested-With"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods: []string{http.MethodGet, http.MethodPatch, http.MethodPut, http.MethodPost, http.MethodHead, http.MethodDelete, http.MethodOptions},
+		AllowHeaders: []string{"Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization", "accept", "origin", "Cache-Control", "X-Requested-With", "If-Match", middleware.RequestIDHeader, middleware.APIKeyHeader},
+		ExposeHeaders: []string{"Content-Length", "ETag", middleware.RequestIDHeader, "Retry-After",
+			"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy"},
 		AllowCredentials: true}))
 
 	router.Use(func(c *gin.Context) {
@@ -0,0 +1,51 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go-back/internal/domain"
+)
+
+// Store keeps the jobs. Jobs are created in the transaction carried by ctx,
+// if any, so they only run once it commits.
+type Store interface {
+	CreateJob(context.Context, domain.Job) (domain.Job, error)
+	ClaimJobs(ctx context.Context, kinds []string, limit int, lease time.Duration) ([]domain.Job, error)
+	CompleteJob(context.Context, domain.Job) error
+	RetryJob(ctx context.Context, job domain.Job, runAt time.Time, lastError string) error
+	KillJob(ctx context.Context, job domain.Job, lastError string) error
+}
+
+// Queue adds jobs to a Store for a Worker to run.
+type Queue struct {
+	store       Store
+	maxAttempts int
+}
+
+// NewQueue builds a Queue whose jobs are tried up to maxAttempts times.
+func NewQueue(store Store, maxAttempts int) Queue {
+	return Queue{store: store, maxAttempts: max(maxAttempts, 1)}
+}
+
+// Enqueue adds a job of kind to run as soon as possible with payload, which
+// is stored as JSON.
+func (q Queue) Enqueue(ctx context.Context, kind string, payload any) (domain.Job, error) {
+	return q.Schedule(ctx, kind, payload, time.Time{})
+}
+
+// Schedule adds a job of kind that runs at runAt or later.
+func (q Queue) Schedule(ctx context.Context, kind string, payload any, runAt time.Time) (domain.Job, error) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return domain.Job{}, fmt.Errorf("queue: encoding %s payload: %w", kind, err)
+	}
+	return q.store.CreateJob(ctx, domain.Job{
+		Kind:        kind,
+		Payload:     string(encoded),
+		MaxAttempts: q.maxAttempts,
+		RunAt:       runAt,
+	})
+}
@@ -0,0 +1,212 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-back/internal/domain"
+)
+
+type WorkerConfig struct {
+	// Concurrency is how many jobs run at once.
+	Concurrency int
+	// PollInterval is how often the store is asked for due jobs while the
+	// worker has free slots.
+	PollInterval time.Duration
+	// Lease is how long a job may run. It is then canceled, and a job whose
+	// worker is gone is claimed again once its lease passes.
+	Lease time.Duration
+	// RetryDelay is the wait before the first retry, doubled on each of
+	// the next ones up to MaxRetryDelay.
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	// DrainTimeout is how long Run waits for running jobs on shutdown
+	// before canceling them.
+	DrainTimeout time.Duration
+}
+
+// Worker claims due jobs from a Store and runs them with the handler of
+// their kind, retrying failed jobs with exponential backoff until they run
+// out of attempts and are left dead.
+type Worker struct {
+	store    Store
+	config   WorkerConfig
+	handlers map[string]func(context.Context, string) error
+	kinds    []string
+}
+
+func NewWorker(store Store, config WorkerConfig) *Worker {
+	config.Concurrency = max(config.Concurrency, 1)
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	if config.Lease <= 0 {
+		config.Lease = time.Minute
+	}
+	if config.MaxRetryDelay <= 0 {
+		config.MaxRetryDelay = time.Hour
+	}
+	return &Worker{store: store, config: config, handlers: map[string]func(context.Context, string) error{}}
+}
+
+// Handle runs the jobs of kind with fn, decoding their payload into T.
+// Handlers must be registered before the worker runs, and must be safe to
+// run more than once for the same job: a job whose worker dies midway runs
+// again.
+func Handle[T any](w *Worker, kind string, fn func(context.Context, T) error) {
+	if _, ok := w.handlers[kind]; !ok {
+		w.kinds = append(w.kinds, kind)
+	}
+	w.handlers[kind] = func(ctx context.Context, payload string) error {
+		var value T
+		if err := json.Unmarshal([]byte(payload), &value); err != nil {
+			return Permanent(fmt.Errorf("decoding payload: %w", err))
+		}
+		return fn(ctx, value)
+	}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as a failure retrying cannot fix, so the job is left
+// dead at once.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// Run claims and runs jobs until ctx is done. It then stops claiming and
+// waits for the running jobs, canceling them after DrainTimeout; canceled
+// jobs are retried later like any failed job.
+func (w *Worker) Run(ctx context.Context) {
+	jobsCtx, cancelJobs := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelJobs()
+
+	var wg sync.WaitGroup
+	var running atomic.Int32
+	finished := make(chan struct{}, 1)
+
+	ticker := time.NewTicker(w.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if free := w.config.Concurrency - int(running.Load()); free > 0 {
+			jobs, err := w.store.ClaimJobs(ctx, w.kinds, free, w.config.Lease)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("queue=Worker func=Run err=%v", err)
+			}
+			for _, job := range jobs {
+				running.Add(1)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					w.run(jobsCtx, job)
+					running.Add(-1)
+					select {
+					case finished <- struct{}{}:
+					default:
+					}
+				}()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			stop := time.AfterFunc(w.config.DrainTimeout, cancelJobs)
+			defer stop.Stop()
+			wg.Wait()
+			return
+		case <-finished:
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunPending runs the jobs due now one batch at a time, until there are
+// none left, and returns how many ran.
+func (w *Worker) RunPending(ctx context.Context) (int, error) {
+	ran := 0
+	for {
+		jobs, err := w.store.ClaimJobs(ctx, w.kinds, w.config.Concurrency, w.config.Lease)
+		if err != nil || len(jobs) == 0 {
+			return ran, err
+		}
+
+		var wg sync.WaitGroup
+		for _, job := range jobs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				w.run(ctx, job)
+			}()
+		}
+		wg.Wait()
+		ran += len(jobs)
+	}
+}
+
+// run calls the handler of job and records the outcome. The outcome is
+// recorded even when ctx was canceled, so a drained job is retried rather
+// than waiting for its lease to pass.
+func (w *Worker) run(ctx context.Context, job domain.Job) {
+	ctx, cancel := context.WithTimeout(ctx, w.config.Lease)
+	err := w.call(ctx, job)
+	cancel()
+
+	ctx = context.WithoutCancel(ctx)
+	var permanent permanentError
+	switch {
+	case err == nil:
+		err = w.store.CompleteJob(ctx, job)
+
+	case errors.As(err, &permanent) || job.Attempts >= job.MaxAttempts:
+		log.Printf("queue=Worker func=run kind=%s jobID=%s attempts=%d dead=true err=%v", job.Kind, job.ID, job.Attempts, err)
+		err = w.store.KillJob(ctx, job, err.Error())
+
+	default:
+		log.Printf("queue=Worker func=run kind=%s jobID=%s attempts=%d err=%v", job.Kind, job.ID, job.Attempts, err)
+		err = w.store.RetryJob(ctx, job, time.Now().Add(w.backoff(job.Attempts)), err.Error())
+	}
+	if err != nil {
+		log.Printf("queue=Worker func=run kind=%s jobID=%s err=%v", job.Kind, job.ID, err)
+	}
+}
+
+// call runs the handler of job, turning a panic into an error.
+func (w *Worker) call(ctx context.Context, job domain.Job) (err error) {
+	handler, ok := w.handlers[job.Kind]
+	if !ok {
+		return Permanent(fmt.Errorf("no handler for job kind %q", job.Kind))
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return handler(ctx, job.Payload)
+}
+
+// backoff doubles RetryDelay on each attempt up to MaxRetryDelay, waiting
+// a random half to full of it so failed jobs do not come back together.
+func (w *Worker) backoff(attempts int) time.Duration {
+	delay := w.config.RetryDelay
+	for i := 1; i < attempts && delay < w.config.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, w.config.MaxRetryDelay)
+	if half := int64(delay / 2); half > 0 {
+		return time.Duration(half + rand.Int64N(half+1))
+	}
+	return delay
+}
@@ -0,0 +1,189 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-back/internal/domain"
+	"go-back/internal/storage/repository"
+)
+
+type greeting struct {
+	Name string `json:"name"`
+}
+
+func TestWorker_RunPending(t *testing.T) {
+	ctx := context.Background()
+
+	run := func(t *testing.T, handler func(context.Context, greeting) error) (domain.Job, int32) {
+		t.Helper()
+		store := repository.NewMemoryJobRepository()
+		worker := NewWorker(store, WorkerConfig{})
+		var calls atomic.Int32
+		Handle(worker, "greet", func(ctx context.Context, payload greeting) error {
+			calls.Add(1)
+			return handler(ctx, payload)
+		})
+
+		job, err := NewQueue(store, 3).Enqueue(ctx, "greet", greeting{Name: "John"})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := worker.RunPending(ctx); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		job, err = store.GetJob(ctx, job.ID)
+		if errors.Is(err, domain.ErrJobNotFound) {
+			return domain.Job{}, calls.Load()
+		}
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		return job, calls.Load()
+	}
+
+	t.Run("deletes jobs that succeed", func(t *testing.T) {
+		var got greeting
+		job, calls := run(t, func(ctx context.Context, payload greeting) error {
+			got = payload
+			return nil
+		})
+		if job.ID != "" || calls != 1 || got.Name != "John" {
+			t.Errorf("expected one run with the payload and the job deleted, got %+v after %d calls with %+v", job, calls, got)
+		}
+	})
+
+	t.Run("retries until the attempts run out", func(t *testing.T) {
+		job, calls := run(t, func(context.Context, greeting) error { return errors.New("smtp down") })
+		if calls != 3 || job.Status != domain.JobDead || job.Attempts != 3 || job.LastError != "smtp down" {
+			t.Errorf("expected a dead job after 3 calls, got %+v after %d calls", job, calls)
+		}
+	})
+
+	t.Run("retries panics", func(t *testing.T) {
+		job, calls := run(t, func(context.Context, greeting) error { panic("nil map") })
+		if calls != 3 || job.Status != domain.JobDead {
+			t.Errorf("expected a dead job after 3 calls, got %+v after %d calls", job, calls)
+		}
+	})
+
+	t.Run("does not retry permanent errors", func(t *testing.T) {
+		job, calls := run(t, func(context.Context, greeting) error { return Permanent(errors.New("no such user")) })
+		if calls != 1 || job.Status != domain.JobDead || job.LastError != "no such user" {
+			t.Errorf("expected a dead job after 1 call, got %+v after %d calls", job, calls)
+		}
+	})
+
+	t.Run("leaves undecodable payloads dead", func(t *testing.T) {
+		store := repository.NewMemoryJobRepository()
+		worker := NewWorker(store, WorkerConfig{})
+		Handle(worker, "greet", func(context.Context, greeting) error { return nil })
+
+		job, _ := NewQueue(store, 3).Enqueue(ctx, "greet", []string{"not", "a", "greeting"})
+		if ran, err := worker.RunPending(ctx); err != nil || ran != 1 {
+			t.Fatalf("expected one job to run, got %d, %v", ran, err)
+		}
+		if job, _ := store.GetJob(ctx, job.ID); job.Status != domain.JobDead {
+			t.Errorf("expected a dead job, got %+v", job)
+		}
+	})
+
+	t.Run("runs scheduled jobs once due", func(t *testing.T) {
+		store := repository.NewMemoryJobRepository()
+		worker := NewWorker(store, WorkerConfig{})
+		Handle(worker, "greet", func(context.Context, greeting) error { return nil })
+
+		queue := NewQueue(store, 3)
+		if _, err := queue.Schedule(ctx, "greet", greeting{}, time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := queue.Schedule(ctx, "greet", greeting{}, time.Now().Add(-time.Second)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if ran, err := worker.RunPending(ctx); err != nil || ran != 1 {
+			t.Errorf("expected only the due job to run, got %d, %v", ran, err)
+		}
+	})
+}
+
+func TestWorker_Run(t *testing.T) {
+	t.Run("waits for running jobs on shutdown", func(t *testing.T) {
+		store := repository.NewMemoryJobRepository()
+		worker := NewWorker(store, WorkerConfig{Concurrency: 2, PollInterval: 10 * time.Millisecond, DrainTimeout: time.Minute})
+		started := make(chan struct{}, 2)
+		release := make(chan struct{})
+		Handle(worker, "greet", func(context.Context, greeting) error {
+			started <- struct{}{}
+			<-release
+			return nil
+		})
+
+		queue := NewQueue(store, 3)
+		for i := 0; i < 2; i++ {
+			if _, err := queue.Enqueue(context.Background(), "greet", greeting{}); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			worker.Run(ctx)
+			close(done)
+		}()
+		<-started
+		<-started
+		cancel()
+
+		select {
+		case <-done:
+			t.Fatal("expected Run to wait for the running jobs")
+		case <-time.After(20 * time.Millisecond):
+		}
+		close(release)
+		<-done
+
+		if claimed, _ := store.ClaimJobs(context.Background(), []string{"greet"}, 10, time.Minute); len(claimed) != 0 {
+			t.Errorf("expected both jobs to be completed, got %+v", claimed)
+		}
+	})
+
+	t.Run("cancels jobs still running after the drain timeout", func(t *testing.T) {
+		store := repository.NewMemoryJobRepository()
+		worker := NewWorker(store, WorkerConfig{PollInterval: 10 * time.Millisecond, DrainTimeout: 10 * time.Millisecond})
+		started := make(chan struct{})
+		Handle(worker, "greet", func(ctx context.Context, _ greeting) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+		job, _ := NewQueue(store, 3).Enqueue(context.Background(), "greet", greeting{})
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-started
+			cancel()
+		}()
+		worker.Run(ctx)
+
+		job, err := store.GetJob(context.Background(), job.ID)
+		if err != nil || job.Status != domain.JobQueued || job.Attempts != 1 || job.LastError != context.Canceled.Error() {
+			t.Errorf("expected the canceled job to be queued for a retry, got %+v, %v", job, err)
+		}
+	})
+}
+
+func TestWorker_Backoff(t *testing.T) {
+	worker := NewWorker(nil, WorkerConfig{RetryDelay: 10 * time.Second, MaxRetryDelay: time.Minute})
+
+	for attempts, limit := range map[int]time.Duration{1: 10 * time.Second, 2: 20 * time.Second, 3: 40 * time.Second, 4: time.Minute, 20: time.Minute} {
+		for i := 0; i < 20; i++ {
+			if delay := worker.backoff(attempts); delay < limit/2 || delay > limit {
+				t.Fatalf("expected attempt %d to wait between %s and %s, got %s", attempts, limit/2, limit, delay)
+			}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"go-back/internal/auth"
+	"go-back/internal/domain"
+	"log"
+	"time"
+)
+
+type APIKeyRepository interface {
+	CreateAPIKey(context.Context, domain.APIKey) (domain.APIKey, error)
+	GetAPIKey(context.Context, string) (domain.APIKey, error)
+	GetAPIKeyByPrefix(context.Context, string) (domain.APIKey, error)
+	ListAPIKeys(context.Context) ([]domain.APIKey, error)
+	UpdateAPIKey(context.Context, domain.APIKey) (domain.APIKey, error)
+	RevokeAPIKey(context.Context, string) error
+	TouchAPIKey(context.Context, string, time.Time) error
+}
+
+type APIKeyConfig struct {
+	// TouchInterval spaces out the writes of the last use of a key.
+	TouchInterval time.Duration
+}
+
+type APIKeyService struct {
+	apiKeyRepository APIKeyRepository
+	auditRepository  AuditRepository
+	transactor       Transactor
+	config           APIKeyConfig
+}
+
+func NewAPIKeyService(keys APIKeyRepository, audit AuditRepository, tx Transactor, config APIKeyConfig) APIKeyService {
+	return APIKeyService{
+		apiKeyRepository: keys,
+		auditRepository:  audit,
+		transactor:       tx,
+		config:           config,
+	}
+}
+
+// CreateAPIKey creates a key and returns it with the key itself, which is
+// not stored and cannot be shown again. Callers can only hand out scopes
+// they hold over every user.
+func (ks APIKeyService) CreateAPIKey(ctx context.Context, input domain.APIKeyInput) (domain.CreatedAPIKey, error) {
+	if err := authorizeScopes(ctx, input.Scopes); err != nil {
+		return domain.CreatedAPIKey{}, err
+	}
+
+	secret, prefix, hash, err := auth.NewAPIKey()
+	if err != nil {
+		return domain.CreatedAPIKey{}, err
+	}
+
+	var key domain.APIKey
+	err = ks.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		key, err = ks.apiKeyRepository.CreateAPIKey(ctx, domain.APIKey{
+			Name:       input.Name,
+			Prefix:     prefix,
+			SecretHash: hash,
+			Scopes:     input.Scopes,
+			RateLimit:  input.RateLimit,
+			CreatedBy:  ActorFromContext(ctx).ID,
+			ExpiresAt:  input.ExpiresAt,
+		})
+		if err != nil {
+			return err
+		}
+		return recordAudit(ctx, ks.auditRepository, domain.AuditAPIKeyCreated, key.ID, domain.DiffAPIKeys(nil, &key))
+	})
+	if err != nil {
+		return domain.CreatedAPIKey{}, err
+	}
+	return domain.CreatedAPIKey{APIKey: key, Key: secret}, nil
+}
+
+func (ks APIKeyService) ListAPIKeys(ctx context.Context) ([]domain.APIKey, error) {
+	if err := authorize(ctx, domain.PermAPIKeysRead, ""); err != nil {
+		return nil, err
+	}
+	return ks.apiKeyRepository.ListAPIKeys(ctx)
+}
+
+func (ks APIKeyService) GetAPIKey(ctx context.Context, id string) (domain.APIKey, error) {
+	if err := authorize(ctx, domain.PermAPIKeysRead, ""); err != nil {
+		return domain.APIKey{}, err
+	}
+	return ks.apiKeyRepository.GetAPIKey(ctx, id)
+}
+
+// UpdateAPIKey replaces the name, scopes, rate limit and expiry of the key
+// with id. The key itself stays the same.
+func (ks APIKeyService) UpdateAPIKey(ctx context.Context, id string, input domain.APIKeyInput) (domain.APIKey, error) {
+	if err := authorizeScopes(ctx, input.Scopes); err != nil {
+		return domain.APIKey{}, err
+	}
+
+	var key domain.APIKey
+	err := ks.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		before, err := ks.apiKeyRepository.GetAPIKey(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		after := before
+		after.Name = input.Name
+		after.Scopes = input.Scopes
+		after.RateLimit = input.RateLimit
+		after.ExpiresAt = input.ExpiresAt
+		key, err = ks.apiKeyRepository.UpdateAPIKey(ctx, after)
+		if err != nil {
+			return err
+		}
+
+		changes := domain.DiffAPIKeys(&before, &key)
+		if len(changes) == 0 {
+			return nil
+		}
+		return recordAudit(ctx, ks.auditRepository, domain.AuditAPIKeyUpdated, id, changes)
+	})
+	if err != nil {
+		return domain.APIKey{}, err
+	}
+	return key, nil
+}
+
+// RevokeAPIKey stops the key with id from working, for good.
+func (ks APIKeyService) RevokeAPIKey(ctx context.Context, id string) error {
+	if err := authorize(ctx, domain.PermAPIKeysWrite, ""); err != nil {
+		return err
+	}
+
+	return ks.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		key, err := ks.apiKeyRepository.GetAPIKey(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := ks.apiKeyRepository.RevokeAPIKey(ctx, id); err != nil {
+			return err
+		}
+		return recordAudit(ctx, ks.auditRepository, domain.AuditAPIKeyRevoked, id, domain.DiffAPIKeys(&key, nil))
+	})
+}
+
+// AuthenticateAPIKey returns the key matching secret. Keys that are
+// unknown, expired or revoked get domain.ErrInvalidAPIKey. Their rate
+// limit is enforced by the HTTP layer.
+func (ks APIKeyService) AuthenticateAPIKey(ctx context.Context, secret string) (domain.APIKey, error) {
+	prefix, hash, ok := auth.ParseAPIKey(secret)
+	if !ok {
+		return domain.APIKey{}, domain.ErrInvalidAPIKey
+	}
+
+	key, err := ks.apiKeyRepository.GetAPIKeyByPrefix(ctx, prefix)
+	if errors.Is(err, domain.ErrAPIKeyNotFound) {
+		return domain.APIKey{}, domain.ErrInvalidAPIKey
+	}
+	if err != nil {
+		return domain.APIKey{}, err
+	}
+	now := time.Now()
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(key.SecretHash)) != 1 || key.Expired(now) {
+		return domain.APIKey{}, domain.ErrInvalidAPIKey
+	}
+
+	// Failing to record the use does not fail the request.
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= ks.config.TouchInterval {
+		if err := ks.apiKeyRepository.TouchAPIKey(ctx, key.ID, now); err != nil {
+			log.Printf("service=APIKeyService func=AuthenticateAPIKey keyID=%s err=%v", key.ID, err)
+		}
+	}
+	return key, nil
+}
+
+// authorizeScopes requires api_keys:write and every scope over all users,
+// so keys never hold more than whoever manages them.
+func authorizeScopes(ctx context.Context, scopes []domain.Permission) error {
+	if err := authorize(ctx, domain.PermAPIKeysWrite, ""); err != nil {
+		return err
+	}
+	for _, scope := range scopes {
+		if err := authorize(ctx, scope, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
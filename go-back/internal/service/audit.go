@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"go-back/internal/domain"
+)
+
+const (
+	// AnonymousActor is recorded for requests that carry no identity.
+	AnonymousActor = "anonymous"
+	// SystemActor is recorded for mutations made by background jobs.
+	SystemActor = "system"
+)
+
+type AuditRepository interface {
+	CreateAuditEvent(context.Context, domain.AuditEvent) (domain.AuditEvent, error)
+	ListAuditEvents(context.Context, domain.AuditFilter) ([]domain.AuditEvent, error)
+}
+
+// Actor describes who is behind a mutation. It travels in the context from
+// the HTTP layer down to the audit log.
+type Actor struct {
+	ID        string
+	RequestID string
+	IP        string
+	// UserAgent and SessionID describe the device of the actor for
+	// sessions; they are not audited.
+	UserAgent string
+	SessionID string
+}
+
+type actorKey struct{}
+
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set by WithActor, defaulting to
+// AnonymousActor.
+func ActorFromContext(ctx context.Context) Actor {
+	actor, _ := ctx.Value(actorKey{}).(Actor)
+	if actor.ID == "" {
+		actor.ID = AnonymousActor
+	}
+	return actor
+}
+
+// audit records the difference between before and after, and notifies the
+// webhooks with action as the event. It must be called inside the
+// transaction of the mutation; mutations that changed nothing are neither
+// recorded nor notified.
+func (us UserService) audit(ctx context.Context, action string, before, after *domain.User) error {
+	changes := domain.DiffUsers(before, after)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	target := after
+	if target == nil {
+		target = before
+	}
+	if err := recordAudit(ctx, us.auditRepository, action, target.UUID, changes); err != nil {
+		return err
+	}
+	if us.webhooks == nil {
+		return nil
+	}
+	return us.webhooks.NotifyUser(ctx, action, *target)
+}
+
+// recordAudit writes an event by the actor of ctx.
+func recordAudit(ctx context.Context, repo AuditRepository, action, targetUUID string, changes map[string]domain.FieldChange) error {
+	actor := ActorFromContext(ctx)
+	_, err := repo.CreateAuditEvent(ctx, domain.AuditEvent{
+		Actor:      actor.ID,
+		Action:     action,
+		TargetUUID: targetUUID,
+		Changes:    changes,
+		RequestID:  actor.RequestID,
+		IP:         actor.IP,
+	})
+	return err
+}
+
+type AuditService struct {
+	auditRepository AuditRepository
+}
+
+func NewAuditService(repo AuditRepository) AuditService {
+	return AuditService{auditRepository: repo}
+}
+
+func (as AuditService) ListAuditEvents(ctx context.Context, filter domain.AuditFilter) (domain.AuditPage, error) {
+	if err := authorize(ctx, domain.PermAuditRead, ""); err != nil {
+		return domain.AuditPage{Events: []domain.AuditEvent{}}, err
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultPageSize
+	}
+
+	if filter.Cursor != "" {
+		after, err := decodeAuditCursor(filter.Cursor)
+		if err != nil {
+			return domain.AuditPage{Events: []domain.AuditEvent{}}, err
+		}
+		filter.After = &after
+	}
+
+	limit := filter.Limit
+	filter.Limit++
+
+	events, err := as.auditRepository.ListAuditEvents(ctx, filter)
+	if err != nil {
+		return domain.AuditPage{Events: []domain.AuditEvent{}}, err
+	}
+	if events == nil {
+		events = []domain.AuditEvent{}
+	}
+
+	page := domain.AuditPage{Events: events}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		last := page.Events[limit-1]
+		payload, _ := json.Marshal(domain.AuditCursor{Seq: last.Seq})
+		page.NextCursor = base64.RawURLEncoding.EncodeToString(payload)
+	}
+	return page, nil
+}
+
+func decodeAuditCursor(cursor string) (domain.AuditCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return domain.AuditCursor{}, ErrInvalidCursor
+	}
+
+	var after domain.AuditCursor
+	if err := json.Unmarshal(raw, &after); err != nil || after.Seq <= 0 {
+		return domain.AuditCursor{}, ErrInvalidCursor
+	}
+	return after, nil
+}
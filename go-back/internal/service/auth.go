@@ -0,0 +1,520 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"go-back/internal/auth"
+	"go-back/internal/domain"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type CredentialRepository interface {
+	GetCredential(context.Context, string) (domain.Credential, error)
+	SaveCredential(context.Context, domain.Credential) error
+}
+
+// ErrLoginDisabled is returned by Login when no token issuer is configured.
+var ErrLoginDisabled = errors.New("login is disabled")
+
+type AuthConfig struct {
+	Hasher *auth.PasswordHasher
+	Policy *auth.PasswordPolicy
+	// Issuer may be nil when tokens come from elsewhere, which disables
+	// Login.
+	Issuer *auth.Issuer
+	// RequireVerifiedEmail refuses logins until the user verified their
+	// email.
+	RequireVerifiedEmail bool
+	// TOTP checks the codes of users with MFA, who get an MFA challenge
+	// valid for MFAChallengeTTL instead of a token when their password
+	// matches.
+	TOTP            auth.TOTP
+	MFAChallengeTTL time.Duration
+	// SessionTTL bounds a session from its login; RefreshTokenTTL is how
+	// long it may sit unused before its refresh token expires.
+	SessionTTL      time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+type AuthService struct {
+	userRepository       UserRepository
+	credentialRepository CredentialRepository
+	mfaRepository        MFARepository
+	tokenRepository      TokenRepository
+	sessionRepository    SessionRepository
+	auditRepository      AuditRepository
+	transactor           Transactor
+	hasher               *auth.PasswordHasher
+	policy               *auth.PasswordPolicy
+	issuer               *auth.Issuer
+	requireVerifiedEmail bool
+	totp                 auth.TOTP
+	mfaChallengeTTL      time.Duration
+	sessionTTL           time.Duration
+	refreshTokenTTL      time.Duration
+
+	// dummyHash is verified when the user has no password, so unknown
+	// emails take as long to reject as wrong passwords.
+	dummyHash string
+}
+
+func NewAuthService(users UserRepository, credentials CredentialRepository, mfa MFARepository, tokens TokenRepository,
+	sessions SessionRepository, audit AuditRepository, tx Transactor, config AuthConfig) (AuthService, error) {
+	dummyHash, err := config.Hasher.Hash("not the password of anyone")
+	if err != nil {
+		return AuthService{}, err
+	}
+
+	return AuthService{
+		userRepository:       users,
+		credentialRepository: credentials,
+		mfaRepository:        mfa,
+		tokenRepository:      tokens,
+		sessionRepository:    sessions,
+		auditRepository:      audit,
+		transactor:           tx,
+		hasher:               config.Hasher,
+		policy:               config.Policy,
+		issuer:               config.Issuer,
+		requireVerifiedEmail: config.RequireVerifiedEmail,
+		totp:                 config.TOTP,
+		mfaChallengeTTL:      config.MFAChallengeTTL,
+		sessionTTL:           config.SessionTTL,
+		refreshTokenTTL:      config.RefreshTokenTTL,
+		dummyHash:            dummyHash,
+	}, nil
+}
+
+// IssuesTokens reports whether Login is available.
+func (as AuthService) IssuesTokens() bool {
+	return as.issuer != nil
+}
+
+// Login checks the password of the active user with input.Email and starts
+// a session for them, or returns an MFA challenge to pass to LoginMFA when
+// they enabled MFA. Hashes made with outdated Argon2 parameters are
+// replaced on the way.
+func (as AuthService) Login(ctx context.Context, input domain.LoginInput) (domain.LoginResult, error) {
+	if as.issuer == nil {
+		return domain.LoginResult{}, ErrLoginDisabled
+	}
+
+	user, credential, err := as.findCredential(ctx, input.Email)
+	if err != nil {
+		return domain.LoginResult{}, err
+	}
+
+	encoded := credential.PasswordHash
+	if encoded == "" {
+		encoded = as.dummyHash
+	}
+	match, needsRehash, err := as.hasher.Verify(input.Password, encoded)
+	if err != nil {
+		return domain.LoginResult{}, err
+	}
+	if !match || credential.PasswordHash == "" || !user.IsActive {
+		return domain.LoginResult{}, domain.ErrInvalidCredentials
+	}
+	// Only checked once the password matched, so it reveals nothing about
+	// accounts the caller cannot log into anyway.
+	if as.requireVerifiedEmail && user.EmailVerifiedAt == nil {
+		return domain.LoginResult{}, domain.ErrEmailNotVerified
+	}
+
+	if needsRehash {
+		as.rehash(ctx, credential, input.Password)
+	}
+
+	return as.loginUser(ctx, user, auth.AMRPassword)
+}
+
+// loginUser starts a session for user, who authenticated with method, or
+// returns an MFA challenge when they enabled MFA.
+func (as AuthService) loginUser(ctx context.Context, user domain.User, method string) (domain.LoginResult, error) {
+	mfa, err := as.mfaRepository.GetMFA(ctx, user.UUID)
+	if err != nil && !errors.Is(err, domain.ErrMFANotEnabled) {
+		return domain.LoginResult{}, err
+	}
+	if mfa.ConfirmedAt != nil {
+		challenge, err := as.challenge(ctx, user)
+		if err != nil {
+			return domain.LoginResult{}, err
+		}
+		return domain.LoginResult{MFAChallenge: &challenge}, nil
+	}
+
+	token, err := as.startSession(ctx, user.UUID, method)
+	if err != nil {
+		return domain.LoginResult{}, err
+	}
+	return domain.LoginResult{AccessToken: &token}, nil
+}
+
+// challenge hands out a single-use token proving the password of user
+// matched, for LoginMFA.
+func (as AuthService) challenge(ctx context.Context, user domain.User) (domain.MFAChallenge, error) {
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return domain.MFAChallenge{}, err
+	}
+
+	createdAt := time.Now().UTC()
+	err = as.tokenRepository.CreateToken(ctx, domain.UserToken{
+		TokenHash: hash,
+		UserUUID:  user.UUID,
+		Purpose:   domain.TokenMFAChallenge,
+		Email:     user.Email,
+		CreatedAt: createdAt,
+		ExpiresAt: createdAt.Add(as.mfaChallengeTTL),
+	})
+	if err != nil {
+		return domain.MFAChallenge{}, err
+	}
+
+	return domain.MFAChallenge{
+		MFARequired: true,
+		MFAToken:    token,
+		ExpiresIn:   int(as.mfaChallengeTTL.Seconds()),
+		ExpiresAt:   createdAt.Add(as.mfaChallengeTTL),
+	}, nil
+}
+
+// LoginMFA completes a login with the challenge from Login and a TOTP or
+// recovery code. Each challenge allows a single attempt, so guessing codes
+// takes the password every time.
+func (as AuthService) LoginMFA(ctx context.Context, input domain.MFALoginInput) (domain.AccessToken, error) {
+	if as.issuer == nil {
+		return domain.AccessToken{}, ErrLoginDisabled
+	}
+
+	// Consumed outside the transaction below, so a wrong code spends it.
+	challenge, err := as.tokenRepository.ConsumeToken(ctx, auth.HashOpaqueToken(input.MFAToken), domain.TokenMFAChallenge)
+	if err != nil {
+		return domain.AccessToken{}, err
+	}
+
+	if actor := ActorFromContext(ctx); actor.ID == AnonymousActor {
+		actor.ID = challenge.UserUUID
+		ctx = WithActor(ctx, actor)
+	}
+
+	user, err := as.userRepository.ListUserByUUID(ctx, challenge.UserUUID)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		return domain.AccessToken{}, domain.ErrInvalidCredentials
+	}
+	if err != nil {
+		return domain.AccessToken{}, err
+	}
+	if !user.IsActive {
+		return domain.AccessToken{}, domain.ErrInvalidCredentials
+	}
+
+	err = as.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		return verifyMFACode(ctx, as.mfaRepository, as.auditRepository, as.totp, user.UUID, input.Code)
+	})
+	if errors.Is(err, domain.ErrMFANotEnabled) {
+		return domain.AccessToken{}, domain.ErrInvalidMFACode
+	}
+	if err != nil {
+		return domain.AccessToken{}, err
+	}
+
+	return as.startSession(ctx, user.UUID, auth.AMRPassword, auth.AMROTP, auth.AMRMFA)
+}
+
+// startSession opens a session for the user, authenticated with methods,
+// on the device of the actor, and issues its first tokens.
+func (as AuthService) startSession(ctx context.Context, userUUID string, methods ...string) (domain.AccessToken, error) {
+	actor := ActorFromContext(ctx)
+	var token domain.AccessToken
+	err := as.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		session, err := as.sessionRepository.CreateSession(ctx, domain.Session{
+			UserUUID:  userUUID,
+			UserAgent: actor.UserAgent,
+			IP:        actor.IP,
+			AMR:       strings.Join(methods, " "),
+			ExpiresAt: time.Now().Add(as.sessionTTL),
+		})
+		if err != nil {
+			return err
+		}
+		token, err = as.issueSession(ctx, session)
+		return err
+	})
+	return token, err
+}
+
+// Refresh trades a refresh token for new tokens of its session, rotating
+// it. A rotated token presented again means it leaked, so the whole
+// session is revoked, cutting off whoever holds its newest token too.
+func (as AuthService) Refresh(ctx context.Context, refreshToken string) (domain.AccessToken, error) {
+	if as.issuer == nil {
+		return domain.AccessToken{}, ErrLoginDisabled
+	}
+
+	var token domain.AccessToken
+	var used domain.RefreshToken
+	err := as.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		used, err = as.sessionRepository.UseRefreshToken(ctx, auth.HashOpaqueToken(refreshToken))
+		if err != nil {
+			return err
+		}
+
+		session, err := as.sessionRepository.GetSession(ctx, used.SessionID)
+		if err != nil {
+			return err
+		}
+		if !session.Active(time.Now()) {
+			return domain.ErrInvalidToken
+		}
+		user, err := as.userRepository.ListUserByUUID(ctx, session.UserUUID)
+		if errors.Is(err, domain.ErrUserNotFound) || (err == nil && !user.IsActive) {
+			return domain.ErrInvalidToken
+		}
+		if err != nil {
+			return err
+		}
+
+		actor := ActorFromContext(ctx)
+		if err := as.sessionRepository.TouchSession(ctx, session.ID, actor.IP, actor.UserAgent); err != nil {
+			return err
+		}
+		token, err = as.issueSession(ctx, session)
+		return err
+	})
+	if errors.Is(err, domain.ErrRefreshTokenReused) {
+		// Revoked after the transaction above rolled back, so it sticks.
+		if err := as.revokeReused(ctx, used.SessionID); err != nil {
+			return domain.AccessToken{}, err
+		}
+		return domain.AccessToken{}, domain.ErrInvalidToken
+	}
+	if errors.Is(err, domain.ErrSessionNotFound) {
+		return domain.AccessToken{}, domain.ErrInvalidToken
+	}
+	if err != nil {
+		return domain.AccessToken{}, err
+	}
+	return token, nil
+}
+
+// revokeReused revokes the session of a reused refresh token and audits it
+// once, as a possible token theft.
+func (as AuthService) revokeReused(ctx context.Context, sessionID string) error {
+	session, err := as.sessionRepository.GetSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	log.Printf("service=AuthService func=Refresh sessionID=%s userUUID=%s refresh token reused", session.ID, session.UserUUID)
+
+	if actor := ActorFromContext(ctx); actor.ID == AnonymousActor {
+		actor.ID = session.UserUUID
+		ctx = WithActor(ctx, actor)
+	}
+	err = as.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		if err := as.sessionRepository.RevokeSession(ctx, session.ID, domain.SessionRefreshTokenReused); err != nil {
+			return err
+		}
+		return recordAudit(ctx, as.auditRepository, domain.AuditRefreshTokenReused, session.UserUUID, sessionChange(session))
+	})
+	if errors.Is(err, domain.ErrSessionNotFound) {
+		return nil
+	}
+	return err
+}
+
+// issueSession rotates in a new refresh token for session and issues an
+// access token carrying its ID. The refresh token expires after
+// RefreshTokenTTL, or with the session if that comes first.
+func (as AuthService) issueSession(ctx context.Context, session domain.Session) (domain.AccessToken, error) {
+	refresh, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return domain.AccessToken{}, err
+	}
+
+	createdAt := time.Now().UTC()
+	expiresAt := createdAt.Add(as.refreshTokenTTL)
+	if session.ExpiresAt.Before(expiresAt) {
+		expiresAt = session.ExpiresAt
+	}
+	err = as.sessionRepository.CreateRefreshToken(ctx, domain.RefreshToken{
+		TokenHash: hash,
+		SessionID: session.ID,
+		CreatedAt: createdAt,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return domain.AccessToken{}, err
+	}
+
+	token, err := as.issue(session.UserUUID, session.ID, strings.Fields(session.AMR)...)
+	if err != nil {
+		return domain.AccessToken{}, err
+	}
+	token.RefreshToken = refresh
+	token.RefreshExpiresAt = expiresAt.UTC()
+	token.SessionID = session.ID
+	return token, nil
+}
+
+// findCredential returns the user with email and their credential. Unknown
+// users and users without a password come back with an empty credential
+// rather than an error, so Login treats them like wrong passwords.
+func (as AuthService) findCredential(ctx context.Context, email string) (domain.User, domain.Credential, error) {
+	user, err := as.userRepository.ListUserByEmail(ctx, email)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		return domain.User{}, domain.Credential{}, nil
+	}
+	if err != nil {
+		return domain.User{}, domain.Credential{}, err
+	}
+
+	credential, err := as.credentialRepository.GetCredential(ctx, user.UUID)
+	if errors.Is(err, domain.ErrPasswordNotSet) {
+		return user, domain.Credential{}, nil
+	}
+	if err != nil {
+		return domain.User{}, domain.Credential{}, err
+	}
+	return user, credential, nil
+}
+
+// rehash upgrades the stored hash to the current parameters. Failing to do
+// so does not fail the login; it is retried on the next one.
+func (as AuthService) rehash(ctx context.Context, credential domain.Credential, password string) {
+	hash, err := as.hasher.Hash(password)
+	if err == nil {
+		credential.PasswordHash = hash
+		err = as.credentialRepository.SaveCredential(ctx, credential)
+	}
+	if err != nil {
+		log.Printf("service=AuthService func=rehash userUUID=%s err=%v", credential.UserUUID, err)
+	}
+}
+
+func (as AuthService) issue(subject, sessionID string, methods ...string) (domain.AccessToken, error) {
+	token, expiresAt, err := as.issuer.Issue(subject, sessionID, methods...)
+	if err != nil {
+		return domain.AccessToken{}, err
+	}
+	return domain.AccessToken{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(as.issuer.TTL().Seconds()),
+		ExpiresAt:   expiresAt.UTC(),
+	}, nil
+}
+
+// SetPassword sets or changes the password of a user. Users changing their
+// own password must confirm the current one, if they have one. Setting the
+// password of another user lets the caller log in as them, so like
+// DisableMFA it takes roles:write, which support does not hold.
+func (as AuthService) SetPassword(ctx context.Context, userUUID string, input domain.PasswordInput) error {
+	if err := authorize(ctx, domain.PermUsersWrite, userUUID); err != nil {
+		return err
+	}
+	principal, ok := PrincipalFromContext(ctx)
+	self := ok && principal.Subject == userUUID
+	if ok && !self {
+		if err := authorize(ctx, domain.PermRolesWrite, userUUID); err != nil {
+			return err
+		}
+	}
+	if err := as.policy.Check(input.NewPassword); err != nil {
+		return err
+	}
+
+	if _, err := as.userRepository.ListUserByUUID(ctx, userUUID); err != nil {
+		return err
+	}
+
+	credential, err := as.credentialRepository.GetCredential(ctx, userUUID)
+	if err != nil && !errors.Is(err, domain.ErrPasswordNotSet) {
+		return err
+	}
+
+	if self && credential.PasswordHash != "" {
+		match, _, err := as.hasher.Verify(input.CurrentPassword, credential.PasswordHash)
+		if err != nil {
+			return err
+		}
+		if !match {
+			return domain.ErrInvalidCredentials
+		}
+	}
+
+	hash, err := as.hasher.Hash(input.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	return as.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		return as.savePassword(ctx, userUUID, hash, domain.AuditPasswordChanged)
+	})
+}
+
+// savePassword stores hash as the password of the user and audits it as
+// action. Moving PasswordChangedAt forward revokes every token issued to the
+// user before, see CheckToken, and their sessions are revoked with them.
+func (as AuthService) savePassword(ctx context.Context, userUUID, hash, action string) error {
+	err := as.credentialRepository.SaveCredential(ctx, domain.Credential{
+		UserUUID:          userUUID,
+		PasswordHash:      hash,
+		PasswordChangedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := as.sessionRepository.RevokeUserSessions(ctx, userUUID, domain.SessionPasswordChanged); err != nil {
+		return err
+	}
+
+	// The audit entry records that the password changed, never its value.
+	return recordAudit(ctx, as.auditRepository, action, userUUID, map[string]domain.FieldChange{})
+}
+
+// CheckToken returns domain.ErrTokenRevoked for tokens of a revoked or
+// expired session and for tokens issued to a user before their password
+// last changed. Tokens without iat and subjects that are not users with a
+// password are left alone by the latter.
+func (as AuthService) CheckToken(ctx context.Context, claims *auth.Claims) error {
+	if claims.SessionID != "" {
+		session, err := as.sessionRepository.GetSession(ctx, claims.SessionID)
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			return domain.ErrTokenRevoked
+		}
+		if err != nil {
+			return err
+		}
+		if session.UserUUID != claims.Subject || !session.Active(time.Now()) {
+			return domain.ErrTokenRevoked
+		}
+	}
+
+	if claims.IssuedAt == nil {
+		return nil
+	}
+	if _, err := uuid.Parse(claims.Subject); err != nil {
+		return nil
+	}
+
+	credential, err := as.credentialRepository.GetCredential(ctx, claims.Subject)
+	if errors.Is(err, domain.ErrPasswordNotSet) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// iat has a one second resolution, so tokens issued within the second
+	// of the change survive it.
+	if claims.IssuedAt.Time.Before(credential.PasswordChangedAt.Truncate(time.Second)) {
+		return domain.ErrTokenRevoked
+	}
+	return nil
+}
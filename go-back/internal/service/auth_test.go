@@ -0,0 +1,315 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-back/internal/auth"
+	"go-back/internal/domain"
+	"go-back/internal/storage/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var testArgon2Params = auth.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+type MockCredentialRepository struct {
+	Credentials map[string]domain.Credential
+}
+
+func (m *MockCredentialRepository) GetCredential(ctx context.Context, userUUID string) (domain.Credential, error) {
+	credential, ok := m.Credentials[userUUID]
+	if !ok {
+		return domain.Credential{}, domain.ErrPasswordNotSet
+	}
+	return credential, nil
+}
+
+func (m *MockCredentialRepository) SaveCredential(ctx context.Context, credential domain.Credential) error {
+	m.Credentials[credential.UserUUID] = credential
+	return nil
+}
+
+// MockMFARepository keeps enrollments and recovery code hashes, with
+// whether each code was used, in maps.
+type MockMFARepository struct {
+	Enrollments   map[string]domain.MFA
+	RecoveryCodes map[string]map[string]bool
+}
+
+func NewMockMFARepository() *MockMFARepository {
+	return &MockMFARepository{Enrollments: map[string]domain.MFA{}, RecoveryCodes: map[string]map[string]bool{}}
+}
+
+func (m *MockMFARepository) GetMFA(ctx context.Context, userUUID string) (domain.MFA, error) {
+	mfa, ok := m.Enrollments[userUUID]
+	if !ok {
+		return domain.MFA{}, domain.ErrMFANotEnabled
+	}
+	return mfa, nil
+}
+
+func (m *MockMFARepository) SaveMFA(ctx context.Context, mfa domain.MFA) error {
+	m.Enrollments[mfa.UserUUID] = mfa
+	return nil
+}
+
+func (m *MockMFARepository) UseTOTPStep(ctx context.Context, userUUID string, step int64) error {
+	mfa, ok := m.Enrollments[userUUID]
+	if !ok || mfa.LastUsedStep >= step {
+		return domain.ErrInvalidMFACode
+	}
+	mfa.LastUsedStep = step
+	m.Enrollments[userUUID] = mfa
+	return nil
+}
+
+func (m *MockMFARepository) DeleteMFA(ctx context.Context, userUUID string) error {
+	delete(m.Enrollments, userUUID)
+	delete(m.RecoveryCodes, userUUID)
+	return nil
+}
+
+func (m *MockMFARepository) ReplaceRecoveryCodes(ctx context.Context, userUUID string, hashes []string) error {
+	m.RecoveryCodes[userUUID] = map[string]bool{}
+	for _, hash := range hashes {
+		m.RecoveryCodes[userUUID][hash] = false
+	}
+	return nil
+}
+
+func (m *MockMFARepository) UseRecoveryCode(ctx context.Context, userUUID, hash string) error {
+	used, ok := m.RecoveryCodes[userUUID][hash]
+	if !ok || used {
+		return domain.ErrInvalidMFACode
+	}
+	m.RecoveryCodes[userUUID][hash] = true
+	return nil
+}
+
+func (m *MockMFARepository) CountRecoveryCodes(ctx context.Context, userUUID string) (int, error) {
+	count := 0
+	for _, used := range m.RecoveryCodes[userUUID] {
+		if !used {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func newTestAuthService(t *testing.T, users UserRepository, credentials CredentialRepository, params auth.Argon2Params) AuthService {
+	t.Helper()
+	issuer, _ := auth.NewIssuer("test-secret", auth.IssuerConfig{TTL: time.Minute})
+	service, err := NewAuthService(users, credentials, NewMockMFARepository(), nil, NewMockSessionRepository(), &MockAuditRepository{}, noTransactor{}, AuthConfig{
+		Hasher: auth.NewPasswordHasher(params),
+		Policy: auth.NewPasswordPolicy(12, 0, nil),
+		Issuer: issuer,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return service
+}
+
+func TestAuthService_Login(t *testing.T) {
+	users := &MockUserRepository{
+		ListUserByEmailFunc: func(ctx context.Context, email string) (domain.User, error) {
+			if email != mockUser.Email {
+				return domain.User{}, domain.ErrUserNotFound
+			}
+			return mockUser, nil
+		},
+	}
+
+	changedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	oldHash, _ := auth.NewPasswordHasher(testArgon2Params).Hash("correct horse battery")
+	credentials := &MockCredentialRepository{Credentials: map[string]domain.Credential{
+		mockUser.UUID: {UserUUID: mockUser.UUID, PasswordHash: oldHash, PasswordChangedAt: changedAt},
+	}}
+
+	stronger := testArgon2Params
+	stronger.Iterations = 2
+	service := newTestAuthService(t, users, credentials, stronger)
+	ctx := context.Background()
+
+	for _, input := range []domain.LoginInput{
+		{Email: mockUser.Email, Password: "wrong horse battery"},
+		{Email: "nobody@example.com", Password: "correct horse battery"},
+	} {
+		if _, err := service.Login(ctx, input); !errors.Is(err, domain.ErrInvalidCredentials) {
+			t.Errorf("expected ErrInvalidCredentials for %s, got %v", input.Email, err)
+		}
+	}
+	if credentials.Credentials[mockUser.UUID].PasswordHash != oldHash {
+		t.Fatal("expected failed logins not to rehash")
+	}
+
+	result, err := service.Login(ctx, domain.LoginInput{Email: mockUser.Email, Password: "correct horse battery"})
+	if err != nil || result.AccessToken == nil || result.MFAChallenge != nil {
+		t.Fatalf("expected a token, got %+v, %v", result, err)
+	}
+
+	t.Run("rehashes with the current parameters", func(t *testing.T) {
+		credential := credentials.Credentials[mockUser.UUID]
+		if !strings.Contains(credential.PasswordHash, "m=64,t=2,p=1") {
+			t.Errorf("expected the hash to use t=2, got %q", credential.PasswordHash)
+		}
+		if !credential.PasswordChangedAt.Equal(changedAt) {
+			t.Errorf("expected a rehash to keep password_changed_at, got %v", credential.PasswordChangedAt)
+		}
+		if _, err := service.Login(ctx, domain.LoginInput{Email: mockUser.Email, Password: "correct horse battery"}); err != nil {
+			t.Errorf("expected the rehashed password to work, got %v", err)
+		}
+	})
+
+	t.Run("is disabled without an issuer", func(t *testing.T) {
+		service.issuer = nil
+		if _, err := service.Login(ctx, domain.LoginInput{Email: mockUser.Email, Password: "correct horse battery"}); !errors.Is(err, ErrLoginDisabled) {
+			t.Errorf("expected ErrLoginDisabled, got %v", err)
+		}
+	})
+}
+
+func TestAuthService_SetPassword(t *testing.T) {
+	users := &MockUserRepository{
+		ListUserByUUIDFunc: func(ctx context.Context, uuid string) (domain.User, error) {
+			return mockUser, nil
+		},
+	}
+	hash, _ := auth.NewPasswordHasher(testArgon2Params).Hash("correct horse battery")
+	credentials := &MockCredentialRepository{Credentials: map[string]domain.Credential{
+		mockUser.UUID: {UserUUID: mockUser.UUID, PasswordHash: hash},
+	}}
+	service := newTestAuthService(t, users, credentials, testArgon2Params)
+	input := domain.PasswordInput{NewPassword: "a brand new phrase"}
+
+	support := WithPrincipal(context.Background(), domain.Principal{Subject: "support", Roles: []domain.Role{domain.RoleSelf, domain.RoleSupport}})
+	if err := service.SetPassword(support, mockUser.UUID, input); !errors.Is(err, domain.ErrForbidden) {
+		t.Errorf("expected support not to set the password of others, got %v", err)
+	}
+	apiKey := WithPrincipal(context.Background(), domain.Principal{Subject: "apikey:1", Roles: []domain.Role{}, Scopes: []domain.Permission{domain.PermUsersWrite}})
+	if err := service.SetPassword(apiKey, mockUser.UUID, input); !errors.Is(err, domain.ErrForbidden) {
+		t.Errorf("expected a users:write key not to set the password of others, got %v", err)
+	}
+	if credentials.Credentials[mockUser.UUID].PasswordHash != hash {
+		t.Fatal("expected the password to be unchanged")
+	}
+
+	self := WithPrincipal(context.Background(), domain.Principal{Subject: mockUser.UUID, Roles: []domain.Role{domain.RoleSelf}})
+	if err := service.SetPassword(self, mockUser.UUID, input); !errors.Is(err, domain.ErrInvalidCredentials) {
+		t.Errorf("expected users to confirm their current password, got %v", err)
+	}
+
+	admin := WithPrincipal(context.Background(), domain.Principal{Subject: "admin", Roles: []domain.Role{domain.RoleAdmin}})
+	if err := service.SetPassword(admin, mockUser.UUID, input); err != nil {
+		t.Fatalf("expected admins to set the password, got %v", err)
+	}
+	if credentials.Credentials[mockUser.UUID].PasswordHash == hash {
+		t.Error("expected the password to change")
+	}
+}
+
+func TestPasswordResetService_ForgotPassword(t *testing.T) {
+	lookups := 0
+	users := &MockUserRepository{
+		ListUserByEmailFunc: func(ctx context.Context, email string) (domain.User, error) {
+			lookups++
+			return mockUser, nil
+		},
+	}
+	jobs := &MockJobQueue{}
+	service := NewPasswordResetService(newTestUserService(users), AuthService{}, nil, noTransactor{}, jobs, PasswordResetConfig{})
+
+	for _, email := range []string{mockUser.Email, "nobody@example.com"} {
+		if err := service.ForgotPassword(context.Background(), email); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	// Known and unknown addresses cost the request the same: one job, and
+	// the lookup is left to it.
+	if lookups != 0 || len(jobs.Jobs) != 2 {
+		t.Fatalf("expected one job per request and no lookup, got %d lookups and %+v", lookups, jobs.Jobs)
+	}
+	for i, email := range []string{mockUser.Email, "nobody@example.com"} {
+		if jobs.Jobs[i].kind != JobPasswordReset || jobs.Jobs[i].payload != (PasswordResetJob{Email: email}) {
+			t.Errorf("expected a reset job for %s, got %+v", email, jobs.Jobs[i])
+		}
+	}
+}
+
+func TestPasswordResetService_SendPasswordReset(t *testing.T) {
+	t.Run("sends one email to concurrent jobs", func(t *testing.T) {
+		ctx := context.Background()
+		users := repository.NewMemoryUserRepository()
+		user, _ := users.CreateUser(ctx, domain.UserInput{Name: "John", Email: "john@example.com"})
+		tx := repository.NewMemoryTransactor()
+		jobs := &MockJobQueue{}
+		userService := NewUserService(users, repository.NewMemoryAuditRepository(), tx, UserConfig{})
+		service := NewPasswordResetService(userService, AuthService{}, slowTokenRepository{repository.NewMemoryTokenRepository()}, tx, jobs,
+			PasswordResetConfig{TTL: time.Hour, Interval: time.Minute})
+
+		var wg sync.WaitGroup
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := service.SendPasswordReset(ctx, PasswordResetJob{Email: user.Email}); err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if len(jobs.Jobs) != 1 || jobs.Jobs[0].kind != JobSendEmail {
+			t.Errorf("expected a single reset email, got %+v", jobs.Jobs)
+		}
+	})
+}
+
+func TestAuthService_CheckToken(t *testing.T) {
+	const userUUID = "0b0e6a54-5b1f-4a5e-9d8c-2d4f3c1a7e90"
+	changedAt := time.Date(2024, 1, 2, 3, 4, 5, 600_000_000, time.UTC)
+	credentials := &MockCredentialRepository{Credentials: map[string]domain.Credential{
+		userUUID: {UserUUID: userUUID, PasswordChangedAt: changedAt},
+	}}
+	service := newTestAuthService(t, &MockUserRepository{}, credentials, testArgon2Params)
+
+	sessions := service.sessionRepository.(*MockSessionRepository)
+	active, _ := sessions.CreateSession(context.Background(), domain.Session{UserUUID: userUUID, ExpiresAt: time.Now().Add(time.Hour)})
+	expired, _ := sessions.CreateSession(context.Background(), domain.Session{UserUUID: userUUID, ExpiresAt: time.Now().Add(-time.Second)})
+	revoked, _ := sessions.CreateSession(context.Background(), domain.Session{UserUUID: userUUID, ExpiresAt: time.Now().Add(time.Hour)})
+	sessions.RevokeSession(context.Background(), revoked.ID, domain.SessionLogout)
+
+	claims := func(subject string, issuedAt time.Time) *auth.Claims {
+		return &auth.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: subject, IssuedAt: jwt.NewNumericDate(issuedAt)}}
+	}
+	inSession := func(subject, sessionID string) *auth.Claims {
+		claims := claims(subject, changedAt.Add(time.Minute))
+		claims.SessionID = sessionID
+		return claims
+	}
+	for name, test := range map[string]struct {
+		claims   *auth.Claims
+		expected error
+	}{
+		"issued before the change":   {claims(userUUID, changedAt.Add(-time.Second)), domain.ErrTokenRevoked},
+		"issued within its second":   {claims(userUUID, changedAt), nil},
+		"issued after the change":    {claims(userUUID, changedAt.Add(time.Minute)), nil},
+		"user without a password":    {claims("6f1c2b1e-0c4d-4c3a-8f0e-3b2a1d0c9e8f", changedAt.Add(-time.Hour)), nil},
+		"subject that is not a user": {claims("service-account", changedAt.Add(-time.Hour)), nil},
+		"token without iat":          {&auth.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: userUUID}}, nil},
+		"active session":             {inSession(userUUID, active.ID), nil},
+		"expired session":            {inSession(userUUID, expired.ID), domain.ErrTokenRevoked},
+		"revoked session":            {inSession(userUUID, revoked.ID), domain.ErrTokenRevoked},
+		"unknown session":            {inSession(userUUID, "a3c1e2d4-1111-4222-8333-944455566677"), domain.ErrTokenRevoked},
+		"session of another user":    {inSession("service-account", active.ID), domain.ErrTokenRevoked},
+	} {
+		if err := service.CheckToken(context.Background(), test.claims); !errors.Is(err, test.expected) {
+			t.Errorf("%s: expected %v, got %v", name, test.expected, err)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"go-back/internal/auth"
+	"go-back/internal/domain"
+	"strings"
+	"time"
+)
+
+type MFARepository interface {
+	GetMFA(context.Context, string) (domain.MFA, error)
+	SaveMFA(context.Context, domain.MFA) error
+	UseTOTPStep(context.Context, string, int64) error
+	DeleteMFA(context.Context, string) error
+	ReplaceRecoveryCodes(context.Context, string, []string) error
+	UseRecoveryCode(context.Context, string, string) error
+	CountRecoveryCodes(context.Context, string) (int, error)
+}
+
+type MFAConfig struct {
+	TOTP auth.TOTP
+	// Issuer names the account in authenticator apps.
+	Issuer string
+}
+
+type MFAService struct {
+	userRepository  UserRepository
+	mfaRepository   MFARepository
+	auditRepository AuditRepository
+	transactor      Transactor
+	config          MFAConfig
+}
+
+func NewMFAService(users UserRepository, mfa MFARepository, audit AuditRepository, tx Transactor, config MFAConfig) MFAService {
+	return MFAService{
+		userRepository:  users,
+		mfaRepository:   mfa,
+		auditRepository: audit,
+		transactor:      tx,
+		config:          config,
+	}
+}
+
+// requireSelf refuses callers acting on the MFA of another user: secrets
+// and recovery codes are only ever shown to their owner.
+func requireSelf(ctx context.Context, userUUID string) error {
+	principal, ok := PrincipalFromContext(ctx)
+	if ok && principal.Subject != userUUID {
+		return fmt.Errorf("%w: only the user can enroll their own mfa", domain.ErrForbidden)
+	}
+	return nil
+}
+
+func (ms MFAService) GetMFA(ctx context.Context, userUUID string) (domain.MFAStatus, error) {
+	if err := authorize(ctx, domain.PermUsersRead, userUUID); err != nil {
+		return domain.MFAStatus{}, err
+	}
+	if _, err := ms.userRepository.ListUserByUUID(ctx, userUUID); err != nil {
+		return domain.MFAStatus{}, err
+	}
+
+	mfa, err := ms.mfaRepository.GetMFA(ctx, userUUID)
+	if errors.Is(err, domain.ErrMFANotEnabled) || (err == nil && mfa.ConfirmedAt == nil) {
+		return domain.MFAStatus{}, nil
+	}
+	if err != nil {
+		return domain.MFAStatus{}, err
+	}
+
+	left, err := ms.mfaRepository.CountRecoveryCodes(ctx, userUUID)
+	if err != nil {
+		return domain.MFAStatus{}, err
+	}
+	return domain.MFAStatus{Enabled: true, EnabledAt: mfa.ConfirmedAt, RecoveryCodesLeft: left}, nil
+}
+
+// EnrollTOTP starts a TOTP enrollment with a new secret, replacing any
+// unconfirmed one. MFA only takes effect once ConfirmTOTP gets a code.
+func (ms MFAService) EnrollTOTP(ctx context.Context, userUUID string) (domain.TOTPEnrollment, error) {
+	if err := authorize(ctx, domain.PermUsersWrite, userUUID); err != nil {
+		return domain.TOTPEnrollment{}, err
+	}
+	if err := requireSelf(ctx, userUUID); err != nil {
+		return domain.TOTPEnrollment{}, err
+	}
+
+	user, err := ms.userRepository.ListUserByUUID(ctx, userUUID)
+	if err != nil {
+		return domain.TOTPEnrollment{}, err
+	}
+
+	current, err := ms.mfaRepository.GetMFA(ctx, userUUID)
+	if err != nil && !errors.Is(err, domain.ErrMFANotEnabled) {
+		return domain.TOTPEnrollment{}, err
+	}
+	if current.ConfirmedAt != nil {
+		return domain.TOTPEnrollment{}, fmt.Errorf("%w: mfa already enabled", domain.ErrConflict)
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		return domain.TOTPEnrollment{}, err
+	}
+	uri := ms.config.TOTP.URI(ms.config.Issuer, user.Email, secret)
+	png, err := auth.QRCodePNG(uri)
+	if err != nil {
+		return domain.TOTPEnrollment{}, err
+	}
+
+	err = ms.mfaRepository.SaveMFA(ctx, domain.MFA{UserUUID: userUUID, Secret: secret, CreatedAt: time.Now().UTC()})
+	if err != nil {
+		return domain.TOTPEnrollment{}, err
+	}
+
+	return domain.TOTPEnrollment{
+		Secret: secret,
+		URI:    uri,
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	}, nil
+}
+
+// ConfirmTOTP enables MFA once code proves the authenticator app holds the
+// secret, and returns the first recovery codes.
+func (ms MFAService) ConfirmTOTP(ctx context.Context, userUUID, code string) (domain.RecoveryCodes, error) {
+	if err := authorize(ctx, domain.PermUsersWrite, userUUID); err != nil {
+		return domain.RecoveryCodes{}, err
+	}
+	if err := requireSelf(ctx, userUUID); err != nil {
+		return domain.RecoveryCodes{}, err
+	}
+
+	mfa, err := ms.mfaRepository.GetMFA(ctx, userUUID)
+	if err != nil {
+		return domain.RecoveryCodes{}, err
+	}
+	if mfa.ConfirmedAt != nil {
+		return domain.RecoveryCodes{}, fmt.Errorf("%w: mfa already enabled", domain.ErrConflict)
+	}
+
+	step, ok := ms.config.TOTP.Validate(mfa.Secret, code, time.Now())
+	if !ok {
+		return domain.RecoveryCodes{}, domain.ErrInvalidMFACode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return domain.RecoveryCodes{}, err
+	}
+
+	confirmedAt := time.Now().UTC()
+	mfa.ConfirmedAt = &confirmedAt
+	mfa.LastUsedStep = step
+	err = ms.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		if err := ms.mfaRepository.SaveMFA(ctx, mfa); err != nil {
+			return err
+		}
+		if err := ms.mfaRepository.ReplaceRecoveryCodes(ctx, userUUID, hashes); err != nil {
+			return err
+		}
+		return recordAudit(ctx, ms.auditRepository, domain.AuditMFAEnabled, userUUID, map[string]domain.FieldChange{})
+	})
+	if err != nil {
+		return domain.RecoveryCodes{}, err
+	}
+	return domain.RecoveryCodes{Codes: codes}, nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user, used or
+// not, after checking code.
+func (ms MFAService) RegenerateRecoveryCodes(ctx context.Context, userUUID, code string) (domain.RecoveryCodes, error) {
+	if err := authorize(ctx, domain.PermUsersWrite, userUUID); err != nil {
+		return domain.RecoveryCodes{}, err
+	}
+	if err := requireSelf(ctx, userUUID); err != nil {
+		return domain.RecoveryCodes{}, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return domain.RecoveryCodes{}, err
+	}
+
+	err = ms.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		if err := verifyMFACode(ctx, ms.mfaRepository, ms.auditRepository, ms.config.TOTP, userUUID, code); err != nil {
+			return err
+		}
+		if err := ms.mfaRepository.ReplaceRecoveryCodes(ctx, userUUID, hashes); err != nil {
+			return err
+		}
+		return recordAudit(ctx, ms.auditRepository, domain.AuditRecoveryCodesRegenerated, userUUID, map[string]domain.FieldChange{})
+	})
+	if err != nil {
+		return domain.RecoveryCodes{}, err
+	}
+	return domain.RecoveryCodes{Codes: codes}, nil
+}
+
+// DisableMFA removes the TOTP secret and recovery codes of the user. Users
+// turning off their own MFA must send a valid code; for another user it
+// takes roles:write, the permission to lift what MFA enforcement protects,
+// and is meant for lost devices.
+func (ms MFAService) DisableMFA(ctx context.Context, userUUID, code string) error {
+	if err := authorize(ctx, domain.PermUsersWrite, userUUID); err != nil {
+		return err
+	}
+	principal, ok := PrincipalFromContext(ctx)
+	self := ok && principal.Subject == userUUID
+	if ok && !self {
+		if err := authorize(ctx, domain.PermRolesWrite, userUUID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := ms.userRepository.ListUserByUUID(ctx, userUUID); err != nil {
+		return err
+	}
+
+	return ms.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		mfa, err := ms.mfaRepository.GetMFA(ctx, userUUID)
+		if err != nil {
+			return err
+		}
+		if mfa.ConfirmedAt == nil {
+			return domain.ErrMFANotEnabled
+		}
+
+		if self {
+			if err := verifyMFACode(ctx, ms.mfaRepository, ms.auditRepository, ms.config.TOTP, userUUID, code); err != nil {
+				return err
+			}
+		}
+		if err := ms.mfaRepository.DeleteMFA(ctx, userUUID); err != nil {
+			return err
+		}
+		return recordAudit(ctx, ms.auditRepository, domain.AuditMFADisabled, userUUID, map[string]domain.FieldChange{})
+	})
+}
+
+func newRecoveryCodes() (codes []string, hashes []string, err error) {
+	for i := 0; i < domain.RecoveryCodeCount; i++ {
+		code, hash, err := auth.NewRecoveryCode()
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, hash)
+	}
+	return codes, hashes, nil
+}
+
+// verifyMFACode checks code, a TOTP code or a recovery code, against the
+// confirmed enrollment of the user and spends it: a TOTP code by moving
+// the last used step forward, a recovery code by marking it used, which is
+// audited.
+func verifyMFACode(ctx context.Context, repo MFARepository, audit AuditRepository, totp auth.TOTP, userUUID, code string) error {
+	mfa, err := repo.GetMFA(ctx, userUUID)
+	if err != nil {
+		return err
+	}
+	if mfa.ConfirmedAt == nil {
+		return domain.ErrMFANotEnabled
+	}
+
+	code = strings.TrimSpace(code)
+	if isTOTPCode(code, totp.Digits) {
+		step, ok := totp.Validate(mfa.Secret, code, time.Now())
+		if !ok {
+			return domain.ErrInvalidMFACode
+		}
+		return repo.UseTOTPStep(ctx, userUUID, step)
+	}
+
+	if err := repo.UseRecoveryCode(ctx, userUUID, auth.HashRecoveryCode(code)); err != nil {
+		return err
+	}
+	return recordAudit(ctx, audit, domain.AuditRecoveryCodeUsed, userUUID, map[string]domain.FieldChange{})
+}
+
+func isTOTPCode(code string, digits int) bool {
+	if len(code) != digits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
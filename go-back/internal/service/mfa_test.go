@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go-back/internal/auth"
+	"go-back/internal/domain"
+)
+
+func TestMFAService(t *testing.T) {
+	const userUUID = "0b0e6a54-5b1f-4a5e-9d8c-2d4f3c1a7e90"
+	users := &MockUserRepository{
+		ListUserByUUIDFunc: func(ctx context.Context, uuid string) (domain.User, error) {
+			return domain.User{UUID: uuid, Email: "john@example.com", IsActive: true}, nil
+		},
+	}
+	repo := NewMockMFARepository()
+	audit := &MockAuditRepository{}
+	service := NewMFAService(users, repo, audit, noTransactor{}, MFAConfig{TOTP: auth.DefaultTOTP, Issuer: "Go Project"})
+
+	self := WithPrincipal(context.Background(), domain.Principal{Subject: userUUID, Roles: []domain.Role{domain.RoleSelf}})
+	admin := WithPrincipal(context.Background(), domain.Principal{Subject: "admin", Roles: []domain.Role{domain.RoleAdmin}})
+	code := func(secret string, offset int64) string {
+		code, _ := auth.DefaultTOTP.Code(secret, auth.DefaultTOTP.Step(time.Now())+offset)
+		return code
+	}
+
+	if _, err := service.EnrollTOTP(admin, userUUID); !errors.Is(err, domain.ErrForbidden) {
+		t.Fatalf("expected only the user to enroll, got %v", err)
+	}
+
+	enrollment, err := service.EnrollTOTP(self, userUUID)
+	if err != nil || !strings.HasPrefix(enrollment.QRCode, "data:image/png;base64,") || !strings.Contains(enrollment.URI, enrollment.Secret) {
+		t.Fatalf("expected an enrollment, got %+v, %v", enrollment, err)
+	}
+	if status, _ := service.GetMFA(self, userUUID); status.Enabled {
+		t.Fatal("expected MFA to wait for a first code")
+	}
+
+	if _, err := service.ConfirmTOTP(self, userUUID, code(enrollment.Secret, 5)); !errors.Is(err, domain.ErrInvalidMFACode) {
+		t.Errorf("expected a code outside the skew to be refused, got %v", err)
+	}
+	confirmation := code(enrollment.Secret, 0)
+	codes, err := service.ConfirmTOTP(self, userUUID, confirmation)
+	if err != nil || len(codes.Codes) != domain.RecoveryCodeCount {
+		t.Fatalf("expected %d recovery codes, got %+v, %v", domain.RecoveryCodeCount, codes, err)
+	}
+	if _, err := service.EnrollTOTP(self, userUUID); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("expected a second enrollment to conflict, got %v", err)
+	}
+
+	t.Run("spends each code once", func(t *testing.T) {
+		if err := verifyMFACode(self, repo, audit, auth.DefaultTOTP, userUUID, confirmation); !errors.Is(err, domain.ErrInvalidMFACode) {
+			t.Errorf("expected the confirmation code to be spent, got %v", err)
+		}
+		if err := verifyMFACode(self, repo, audit, auth.DefaultTOTP, userUUID, code(enrollment.Secret, 1)); err != nil {
+			t.Errorf("expected the next code within the skew to work, got %v", err)
+		}
+
+		recovery := strings.ToUpper(codes.Codes[0])
+		if err := verifyMFACode(self, repo, audit, auth.DefaultTOTP, userUUID, recovery); err != nil {
+			t.Errorf("expected the recovery code to work, got %v", err)
+		}
+		if err := verifyMFACode(self, repo, audit, auth.DefaultTOTP, userUUID, recovery); !errors.Is(err, domain.ErrInvalidMFACode) {
+			t.Errorf("expected a used recovery code to be refused, got %v", err)
+		}
+		if last := audit.Events[len(audit.Events)-1]; last.Action != domain.AuditRecoveryCodeUsed {
+			t.Errorf("expected the recovery code to be audited, got %s", last.Action)
+		}
+		if status, _ := service.GetMFA(self, userUUID); !status.Enabled || status.RecoveryCodesLeft != domain.RecoveryCodeCount-1 {
+			t.Errorf("expected %d codes left, got %+v", domain.RecoveryCodeCount-1, status)
+		}
+	})
+
+	t.Run("regenerates recovery codes", func(t *testing.T) {
+		regenerated, err := service.RegenerateRecoveryCodes(self, userUUID, codes.Codes[1])
+		if err != nil || len(regenerated.Codes) != domain.RecoveryCodeCount {
+			t.Fatalf("expected new codes, got %+v, %v", regenerated, err)
+		}
+		if err := verifyMFACode(self, repo, audit, auth.DefaultTOTP, userUUID, codes.Codes[2]); !errors.Is(err, domain.ErrInvalidMFACode) {
+			t.Errorf("expected the old codes to be gone, got %v", err)
+		}
+		codes = regenerated
+	})
+
+	t.Run("disables with a code or roles:write", func(t *testing.T) {
+		if err := service.DisableMFA(self, userUUID, ""); !errors.Is(err, domain.ErrInvalidMFACode) {
+			t.Errorf("expected the user to need a code, got %v", err)
+		}
+		support := WithPrincipal(context.Background(), domain.Principal{Subject: "support", Roles: []domain.Role{domain.RoleSupport}})
+		if err := service.DisableMFA(support, userUUID, ""); !errors.Is(err, domain.ErrForbidden) {
+			t.Errorf("expected support to be refused, got %v", err)
+		}
+
+		if err := service.DisableMFA(self, userUUID, codes.Codes[0]); err != nil {
+			t.Fatalf("expected MFA to be disabled, got %v", err)
+		}
+		if err := service.DisableMFA(admin, userUUID, ""); !errors.Is(err, domain.ErrMFANotEnabled) {
+			t.Errorf("expected ErrMFANotEnabled, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"go-back/internal/auth"
+	"go-back/internal/domain"
+	"time"
+)
+
+type OIDCConfig struct {
+	// LoginTTL is how long the user has to come back from the provider.
+	LoginTTL time.Duration
+}
+
+type OIDCService struct {
+	userService UserService
+	authService AuthService
+	provider    *auth.OIDCProvider
+	config      OIDCConfig
+}
+
+// NewOIDCService logs users in through provider, which may be nil when no
+// identity provider is configured.
+func NewOIDCService(users UserService, auth AuthService, provider *auth.OIDCProvider, config OIDCConfig) OIDCService {
+	return OIDCService{
+		userService: users,
+		authService: auth,
+		provider:    provider,
+		config:      config,
+	}
+}
+
+// Enabled reports whether logins through the identity provider are
+// available, which takes both a provider and a token issuer.
+func (oc OIDCService) Enabled() bool {
+	return oc.provider != nil && oc.authService.IssuesTokens()
+}
+
+// StartLogin returns where to send the user to log in at the provider,
+// with the values the callback must bring back.
+func (oc OIDCService) StartLogin(ctx context.Context) (domain.OIDCLogin, error) {
+	login := domain.OIDCLogin{ExpiresAt: time.Now().Add(oc.config.LoginTTL)}
+	for _, value := range []*string{&login.State, &login.Nonce, &login.Verifier} {
+		var err error
+		if *value, err = auth.RandomToken(); err != nil {
+			return domain.OIDCLogin{}, err
+		}
+	}
+
+	var err error
+	login.URL, err = oc.provider.AuthCodeURL(ctx, login.State, login.Nonce, login.Verifier)
+	if err != nil {
+		return domain.OIDCLogin{}, providerError(err)
+	}
+	return login, nil
+}
+
+// FinishLogin completes the login started as started with the callback of
+// the provider, and logs in the user the ID token names, linked by email
+// or created on the spot. Users with MFA get a challenge as with a
+// password.
+func (oc OIDCService) FinishLogin(ctx context.Context, callback domain.OIDCCallback, started domain.OIDCLogin) (domain.LoginResult, error) {
+	if started.State == "" || subtle.ConstantTimeCompare([]byte(callback.State), []byte(started.State)) != 1 {
+		return domain.LoginResult{}, fmt.Errorf("%w: state mismatch", domain.ErrOIDCLoginFailed)
+	}
+	if callback.Error != "" {
+		return domain.LoginResult{}, fmt.Errorf("%w: %s: %s", domain.ErrOIDCLoginFailed, callback.Error, callback.ErrorDescription)
+	}
+
+	claims, err := oc.provider.Exchange(ctx, callback.Code, started.Verifier, started.Nonce)
+	if err != nil {
+		return domain.LoginResult{}, providerError(err)
+	}
+	// Linking by an email the provider did not verify would hand the
+	// account to whoever typed it there.
+	if claims.Email == "" || !claims.EmailVerified {
+		return domain.LoginResult{}, fmt.Errorf("%w: at the identity provider", domain.ErrEmailNotVerified)
+	}
+
+	user, err := oc.provision(ctx, claims)
+	if err != nil {
+		return domain.LoginResult{}, err
+	}
+	if !user.IsActive {
+		return domain.LoginResult{}, domain.ErrInvalidCredentials
+	}
+
+	if actor := ActorFromContext(ctx); actor.ID == AnonymousActor {
+		actor.ID = user.UUID
+		ctx = WithActor(ctx, actor)
+	}
+	return oc.authService.loginUser(ctx, user, auth.AMRFederated)
+}
+
+// provision returns the user with the email of the ID token, creating them
+// when there is none. The provider verified the email, so it is marked
+// verified rather than mailed a token. The login of the provider is a
+// trusted caller, so the user service is called without a principal.
+func (oc OIDCService) provision(ctx context.Context, claims *auth.IDTokenClaims) (domain.User, error) {
+	user, err := oc.userService.ListUserByEmail(ctx, claims.Email)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		name := claims.Name
+		if name == "" {
+			name = claims.Email
+		}
+		user, err = oc.userService.CreateVerifiedUser(ctx, domain.UserInput{Name: name, Email: claims.Email})
+		if !errors.Is(err, domain.ErrEmailTaken) {
+			return user, err
+		}
+		// Another login of the same user created them first.
+		user, err = oc.userService.ListUserByEmail(ctx, claims.Email)
+	}
+	if err != nil {
+		return domain.User{}, err
+	}
+	return oc.userService.MarkEmailVerified(ctx, user.UUID, user.Email)
+}
+
+// providerError sorts the errors of the provider into the provider failing
+// and the login of the user failing. Unavailability is checked first, as a
+// JWKS that cannot be fetched also fails the ID token.
+func providerError(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrOIDCUnavailable):
+		return fmt.Errorf("%w: %w", domain.ErrIdentityProviderUnavailable, err)
+	case errors.Is(err, auth.ErrOIDCRejected), errors.Is(err, auth.ErrInvalidToken):
+		return fmt.Errorf("%w: %w", domain.ErrOIDCLoginFailed, err)
+	}
+	return err
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-back/internal/auth"
+	"go-back/internal/domain"
+	"time"
+)
+
+type PasswordResetConfig struct {
+	// TTL is how long a reset token stays valid.
+	TTL time.Duration
+	// Interval is the minimum time between two reset emails to the same
+	// user; requests in between are silently dropped.
+	Interval time.Duration
+	// URL is the page users open to choose a new password; the token is
+	// added as its token query parameter.
+	URL string
+}
+
+type PasswordResetService struct {
+	userService     UserService
+	authService     AuthService
+	tokenRepository TokenRepository
+	transactor      Transactor
+	jobs            JobQueue
+	config          PasswordResetConfig
+}
+
+func NewPasswordResetService(users UserService, auth AuthService, tokens TokenRepository, tx Transactor,
+	jobs JobQueue, config PasswordResetConfig) PasswordResetService {
+	return PasswordResetService{
+		userService:     users,
+		authService:     auth,
+		tokenRepository: tokens,
+		transactor:      tx,
+		jobs:            jobs,
+		config:          config,
+	}
+}
+
+// JobPasswordReset jobs mail a reset token, as a PasswordResetJob.
+const JobPasswordReset = "password.reset"
+
+// PasswordResetJob asks for a reset email to Email, if an active user has
+// it.
+type PasswordResetJob struct {
+	Email string `json:"email"`
+}
+
+// ForgotPassword queues a reset email to email. Whether a user has it is
+// only looked up by the job, so the request takes as long, and answers the
+// same, for every address and never tells whether an account exists.
+func (rs PasswordResetService) ForgotPassword(ctx context.Context, email string) error {
+	_, err := rs.jobs.Enqueue(ctx, JobPasswordReset, PasswordResetJob{Email: email})
+	return err
+}
+
+// SendPasswordReset runs JobPasswordReset jobs: it stores a new reset token
+// for the active user with job.Email and queues the email with it. Nothing
+// is sent to unknown or inactive users, nor when the previous email is too
+// recent.
+func (rs PasswordResetService) SendPasswordReset(ctx context.Context, job PasswordResetJob) error {
+	user, err := rs.userService.ListUserByEmail(ctx, job.Email)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !user.IsActive {
+		return nil
+	}
+
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	// The interval is checked in the transaction that issues the token, so
+	// concurrent jobs cannot both pass it. The email is queued along with
+	// the token, so failing to send it is retried by its own job rather
+	// than dropped as too recent.
+	return rs.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		latest, err := rs.tokenRepository.LatestTokenAt(ctx, user.UUID, domain.TokenPasswordReset)
+		if err != nil {
+			return err
+		}
+		if time.Since(latest) < rs.config.Interval {
+			return nil
+		}
+
+		createdAt := time.Now().UTC()
+		if err := rs.tokenRepository.RevokeTokens(ctx, user.UUID, domain.TokenPasswordReset); err != nil {
+			return err
+		}
+		err = rs.tokenRepository.CreateToken(ctx, domain.UserToken{
+			TokenHash: hash,
+			UserUUID:  user.UUID,
+			Purpose:   domain.TokenPasswordReset,
+			Email:     user.Email,
+			CreatedAt: createdAt,
+			ExpiresAt: createdAt.Add(rs.config.TTL),
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = rs.jobs.Enqueue(ctx, JobSendEmail, domain.Email{
+			To:      user.Email,
+			Subject: "Reset your password",
+			Body: fmt.Sprintf("Hi %s,\n\nChoose a new password by opening the link below:\n\n%s\n\n"+
+				"The link expires in %s. If you did not ask for it, ignore this email.\n",
+				user.Name, tokenLink(rs.config.URL, token), rs.config.TTL),
+		})
+		return err
+	})
+}
+
+// ResetPassword consumes token and sets the new password of its user,
+// which revokes the tokens issued to them before.
+func (rs PasswordResetService) ResetPassword(ctx context.Context, input domain.ResetPasswordInput) error {
+	if err := rs.authService.policy.Check(input.NewPassword); err != nil {
+		return err
+	}
+	hash, err := rs.authService.hasher.Hash(input.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	err = rs.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		userToken, err := rs.tokenRepository.ConsumeToken(ctx, auth.HashOpaqueToken(input.Token), domain.TokenPasswordReset)
+		if err != nil {
+			return err
+		}
+
+		// Whoever holds the token controls the mailbox, so they are the actor.
+		if actor := ActorFromContext(ctx); actor.ID == AnonymousActor {
+			actor.ID = userToken.UserUUID
+			ctx = WithActor(ctx, actor)
+		}
+
+		user, err := rs.userService.ListUserByUUID(ctx, userToken.UserUUID)
+		if err != nil {
+			return err
+		}
+		if !user.IsActive || user.Email != userToken.Email {
+			return domain.ErrInvalidToken
+		}
+
+		return rs.authService.savePassword(ctx, user.UUID, hash, domain.AuditPasswordReset)
+	})
+	if errors.Is(err, domain.ErrUserNotFound) {
+		return domain.ErrInvalidToken
+	}
+	return err
+}
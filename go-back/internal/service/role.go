@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-back/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+type RoleRepository interface {
+	ListRoles(context.Context, string) ([]domain.RoleGrant, error)
+	GrantRole(context.Context, domain.RoleGrant) (bool, error)
+	RevokeRole(context.Context, string, domain.Role) (bool, error)
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, principal domain.Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+func PrincipalFromContext(ctx context.Context) (domain.Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(domain.Principal)
+	return principal, ok
+}
+
+// authorize checks that the principal of ctx may use perm on targetUUID.
+// Contexts without a principal come from inside the process (background
+// jobs, the CLI), never from the HTTP API, which always sets one, and are
+// trusted.
+func authorize(ctx context.Context, perm domain.Permission, targetUUID string) error {
+	principal, ok := PrincipalFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	if !principal.Can(perm, targetUUID) && principal.NeedsMFA(perm) {
+		return fmt.Errorf("%w: %s requires %s, held without mfa", domain.ErrMFARequired, principal.Subject, perm)
+	}
+	if !principal.Can(perm, targetUUID) {
+		return fmt.Errorf("%w: %s requires %s", domain.ErrForbidden, principal.Subject, perm)
+	}
+	return nil
+}
+
+// RoleLister lists the roles stored for a user.
+type RoleLister interface {
+	ListRoles(context.Context, string) ([]domain.RoleGrant, error)
+}
+
+// authorizeOver is authorize for writes to the account of targetUUID. On
+// top of perm, callers writing to someone else must outrank the roles of
+// the target, so rights over users do not reach those who hold more of
+// them: support cannot take over or lock out an admin. roles may be nil
+// where no roles are stored.
+func authorizeOver(ctx context.Context, roles RoleLister, perm domain.Permission, targetUUID string) error {
+	if err := authorize(ctx, perm, targetUUID); err != nil {
+		return err
+	}
+	principal, ok := PrincipalFromContext(ctx)
+	if !ok || roles == nil || principal.Subject == targetUUID {
+		return nil
+	}
+
+	grants, err := roles.ListRoles(ctx, targetUUID)
+	if err != nil {
+		return err
+	}
+	held := make([]domain.Role, len(grants))
+	for i, grant := range grants {
+		held[i] = grant.Role
+	}
+	if !principal.Outranks(held) {
+		return fmt.Errorf("%w: %s does not outrank the roles of %s", domain.ErrForbidden, principal.Subject, targetUUID)
+	}
+	return nil
+}
+
+type RoleService struct {
+	roleRepository  RoleRepository
+	userRepository  UserRepository
+	auditRepository AuditRepository
+	transactor      Transactor
+	adminSubjects   map[string]bool
+	mfaRoles        map[domain.Role]bool
+}
+
+// NewRoleService builds a RoleService. adminSubjects are always admins,
+// whatever is stored, so the first roles can be granted. Grants of
+// mfaRoles, stored or bootstrapped, only apply to callers that passed MFA.
+func NewRoleService(roles RoleRepository, users UserRepository, audit AuditRepository, tx Transactor,
+	adminSubjects []string, mfaRoles []domain.Role) RoleService {
+	admins := map[string]bool{}
+	for _, subject := range adminSubjects {
+		admins[subject] = true
+	}
+	enforced := map[domain.Role]bool{}
+	for _, role := range mfaRoles {
+		enforced[role] = true
+	}
+	return RoleService{
+		roleRepository:  roles,
+		userRepository:  users,
+		auditRepository: audit,
+		transactor:      tx,
+		adminSubjects:   admins,
+		mfaRoles:        enforced,
+	}
+}
+
+// LoadPrincipal resolves the roles of an authenticated subject, who passed
+// MFA if mfa is set. Subjects that are active users hold RoleSelf plus
+// their stored roles; inactive, deleted or unknown ones hold none. Roles
+// requiring MFA, including the admin role of adminSubjects, are withheld
+// when mfa is unset.
+func (rs RoleService) LoadPrincipal(ctx context.Context, subject string, mfa bool) (domain.Principal, error) {
+	principal := domain.Principal{Subject: subject, Roles: []domain.Role{}}
+	if rs.adminSubjects[subject] {
+		if rs.mfaRoles[domain.RoleAdmin] && !mfa {
+			principal.Withheld = append(principal.Withheld, domain.RoleAdmin)
+		} else {
+			principal.Roles = append(principal.Roles, domain.RoleAdmin)
+		}
+	}
+
+	if _, err := uuid.Parse(subject); err != nil {
+		return principal, nil
+	}
+
+	user, err := rs.userRepository.ListUserByUUID(ctx, subject)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		return principal, nil
+	}
+	if err != nil {
+		return domain.Principal{}, err
+	}
+	if !user.IsActive {
+		return principal, nil
+	}
+
+	grants, err := rs.roleRepository.ListRoles(ctx, subject)
+	if err != nil {
+		return domain.Principal{}, err
+	}
+
+	principal.Roles = append(principal.Roles, domain.RoleSelf)
+	for _, grant := range grants {
+		if rs.mfaRoles[grant.Role] && !mfa {
+			principal.Withheld = append(principal.Withheld, grant.Role)
+			continue
+		}
+		principal.Roles = append(principal.Roles, grant.Role)
+	}
+	return principal, nil
+}
+
+func (rs RoleService) ListRoles(ctx context.Context, userUUID string) ([]domain.RoleGrant, error) {
+	if err := authorize(ctx, domain.PermRolesRead, userUUID); err != nil {
+		return nil, err
+	}
+	if _, err := rs.userRepository.ListUserByUUID(ctx, userUUID); err != nil {
+		return nil, err
+	}
+	return rs.roleRepository.ListRoles(ctx, userUUID)
+}
+
+// GrantRole gives role to the user and returns all of their roles.
+func (rs RoleService) GrantRole(ctx context.Context, userUUID string, role domain.Role) ([]domain.RoleGrant, error) {
+	if err := authorize(ctx, domain.PermRolesWrite, userUUID); err != nil {
+		return nil, err
+	}
+	if !domain.AssignableRole(role) {
+		return nil, fmt.Errorf("%w: role %q cannot be granted", domain.ErrInvalidInput, role)
+	}
+
+	var grants []domain.RoleGrant
+	err := rs.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		if _, err := rs.userRepository.ListUserByUUID(ctx, userUUID); err != nil {
+			return err
+		}
+
+		granted, err := rs.roleRepository.GrantRole(ctx, domain.RoleGrant{
+			UserUUID:  userUUID,
+			Role:      role,
+			GrantedBy: ActorFromContext(ctx).ID,
+		})
+		if err != nil {
+			return err
+		}
+		if granted {
+			err := recordAudit(ctx, rs.auditRepository, domain.AuditRoleGranted, userUUID,
+				map[string]domain.FieldChange{"role": {From: nil, To: string(role)}})
+			if err != nil {
+				return err
+			}
+		}
+
+		grants, err = rs.roleRepository.ListRoles(ctx, userUUID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+// RevokeRole takes role away from the user and returns their remaining
+// roles.
+func (rs RoleService) RevokeRole(ctx context.Context, userUUID string, role domain.Role) ([]domain.RoleGrant, error) {
+	if err := authorize(ctx, domain.PermRolesWrite, userUUID); err != nil {
+		return nil, err
+	}
+
+	var grants []domain.RoleGrant
+	err := rs.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		if _, err := rs.userRepository.ListUserByUUID(ctx, userUUID); err != nil {
+			return err
+		}
+
+		revoked, err := rs.roleRepository.RevokeRole(ctx, userUUID, role)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			err := recordAudit(ctx, rs.auditRepository, domain.AuditRoleRevoked, userUUID,
+				map[string]domain.FieldChange{"role": {From: string(role), To: nil}})
+			if err != nil {
+				return err
+			}
+		}
+
+		grants, err = rs.roleRepository.ListRoles(ctx, userUUID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"go-back/internal/domain"
+)
+
+type SessionRepository interface {
+	CreateSession(context.Context, domain.Session) (domain.Session, error)
+	GetSession(context.Context, string) (domain.Session, error)
+	ListSessions(context.Context, string) ([]domain.Session, error)
+	TouchSession(context.Context, string, string, string) error
+	RevokeSession(context.Context, string, string) error
+	RevokeUserSessions(context.Context, string, string) error
+	CreateRefreshToken(context.Context, domain.RefreshToken) error
+	UseRefreshToken(context.Context, string) (domain.RefreshToken, error)
+}
+
+// SessionRevoker ends every session of a user, for UserService to cut off
+// deactivated and deleted users.
+type SessionRevoker interface {
+	RevokeUserSessions(ctx context.Context, userUUID, reason string) error
+}
+
+type SessionService struct {
+	sessionRepository SessionRepository
+	auditRepository   AuditRepository
+	transactor        Transactor
+}
+
+func NewSessionService(sessions SessionRepository, audit AuditRepository, tx Transactor) SessionService {
+	return SessionService{
+		sessionRepository: sessions,
+		auditRepository:   audit,
+		transactor:        tx,
+	}
+}
+
+// ListSessions returns the active sessions of the user, marking the one of
+// the actor as current.
+func (ss SessionService) ListSessions(ctx context.Context, userUUID string) ([]domain.Session, error) {
+	if err := authorize(ctx, domain.PermUsersRead, userUUID); err != nil {
+		return nil, err
+	}
+
+	sessions, err := ss.sessionRepository.ListSessions(ctx, userUUID)
+	if err != nil {
+		return nil, err
+	}
+	current := ActorFromContext(ctx).SessionID
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+	return sessions, nil
+}
+
+// RevokeSession ends the session with id, logging out its device: its
+// refresh token stops working and so do its access tokens, see CheckToken.
+// Sessions the caller may not write look like missing ones.
+func (ss SessionService) RevokeSession(ctx context.Context, id string) error {
+	session, err := ss.sessionRepository.GetSession(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := authorize(ctx, domain.PermUsersWrite, session.UserUUID); errors.Is(err, domain.ErrForbidden) {
+		return domain.ErrSessionNotFound
+	} else if err != nil {
+		return err
+	}
+
+	return ss.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		if err := ss.sessionRepository.RevokeSession(ctx, id, domain.SessionLogout); err != nil {
+			return err
+		}
+		return recordAudit(ctx, ss.auditRepository, domain.AuditSessionRevoked, session.UserUUID, sessionChange(session))
+	})
+}
+
+func sessionChange(session domain.Session) map[string]domain.FieldChange {
+	return map[string]domain.FieldChange{"session": {From: session.ID, To: nil}}
+}
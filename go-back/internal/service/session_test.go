@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-back/internal/auth"
+	"go-back/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+// MockSessionRepository keeps sessions and refresh tokens in maps.
+type MockSessionRepository struct {
+	Sessions      map[string]domain.Session
+	RefreshTokens map[string]domain.RefreshToken
+}
+
+func NewMockSessionRepository() *MockSessionRepository {
+	return &MockSessionRepository{Sessions: map[string]domain.Session{}, RefreshTokens: map[string]domain.RefreshToken{}}
+}
+
+func (m *MockSessionRepository) CreateSession(ctx context.Context, session domain.Session) (domain.Session, error) {
+	session.ID = uuid.NewString()
+	session.CreatedAt = time.Now()
+	session.LastUsedAt = session.CreatedAt
+	m.Sessions[session.ID] = session
+	return session, nil
+}
+
+func (m *MockSessionRepository) GetSession(ctx context.Context, id string) (domain.Session, error) {
+	session, ok := m.Sessions[id]
+	if !ok {
+		return domain.Session{}, domain.ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (m *MockSessionRepository) ListSessions(ctx context.Context, userUUID string) ([]domain.Session, error) {
+	sessions := []domain.Session{}
+	for _, session := range m.Sessions {
+		if session.UserUUID == userUUID && session.Active(time.Now()) {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *MockSessionRepository) TouchSession(ctx context.Context, id, ip, userAgent string) error {
+	session := m.Sessions[id]
+	session.LastUsedAt, session.IP, session.UserAgent = time.Now(), ip, userAgent
+	m.Sessions[id] = session
+	return nil
+}
+
+func (m *MockSessionRepository) RevokeSession(ctx context.Context, id, reason string) error {
+	session, ok := m.Sessions[id]
+	if !ok || session.RevokedAt != nil {
+		return domain.ErrSessionNotFound
+	}
+	revokedAt := time.Now()
+	session.RevokedAt, session.RevokedReason = &revokedAt, reason
+	m.Sessions[id] = session
+	return nil
+}
+
+func (m *MockSessionRepository) RevokeUserSessions(ctx context.Context, userUUID, reason string) error {
+	for id, session := range m.Sessions {
+		if session.UserUUID == userUUID && session.RevokedAt == nil {
+			m.RevokeSession(ctx, id, reason)
+		}
+	}
+	return nil
+}
+
+func (m *MockSessionRepository) CreateRefreshToken(ctx context.Context, token domain.RefreshToken) error {
+	m.RefreshTokens[token.TokenHash] = token
+	return nil
+}
+
+func (m *MockSessionRepository) UseRefreshToken(ctx context.Context, tokenHash string) (domain.RefreshToken, error) {
+	token, ok := m.RefreshTokens[tokenHash]
+	if !ok || time.Now().After(token.ExpiresAt) {
+		return domain.RefreshToken{}, domain.ErrInvalidToken
+	}
+	if token.UsedAt != nil {
+		return token, domain.ErrRefreshTokenReused
+	}
+	usedAt := time.Now()
+	token.UsedAt = &usedAt
+	m.RefreshTokens[tokenHash] = token
+	return token, nil
+}
+
+func TestAuthService_Refresh(t *testing.T) {
+	users := &MockUserRepository{
+		ListUserByUUIDFunc: func(ctx context.Context, uuid string) (domain.User, error) {
+			return mockUser, nil
+		},
+	}
+	sessions := NewMockSessionRepository()
+	audit := &MockAuditRepository{}
+	issuer, _ := auth.NewIssuer("test-secret", auth.IssuerConfig{TTL: time.Minute})
+	service, err := NewAuthService(users, &MockCredentialRepository{}, NewMockMFARepository(), nil, sessions, audit, noTransactor{}, AuthConfig{
+		Hasher:          auth.NewPasswordHasher(testArgon2Params),
+		Issuer:          issuer,
+		SessionTTL:      time.Hour,
+		RefreshTokenTTL: 10 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	ctx := WithActor(context.Background(), Actor{IP: "10.0.0.1", UserAgent: "curl"})
+	token, err := service.startSession(ctx, mockUser.UUID, auth.AMRPassword, auth.AMROTP, auth.AMRMFA)
+	if err != nil || token.RefreshToken == "" {
+		t.Fatalf("expected a session, got %+v, %v", token, err)
+	}
+	if session := sessions.Sessions[token.SessionID]; session.IP != "10.0.0.1" || session.UserAgent != "curl" {
+		t.Errorf("expected the device of the actor, got %+v", session)
+	}
+
+	rotated, err := service.Refresh(WithActor(context.Background(), Actor{IP: "10.0.0.2"}), token.RefreshToken)
+	if err != nil || rotated.SessionID != token.SessionID || rotated.RefreshToken == token.RefreshToken {
+		t.Fatalf("expected a rotated token, got %+v, %v", rotated, err)
+	}
+	if session := sessions.Sessions[token.SessionID]; session.IP != "10.0.0.2" {
+		t.Errorf("expected the session to be touched, got %+v", session)
+	}
+	if expiresIn := time.Until(rotated.RefreshExpiresAt); expiresIn > 10*time.Minute || expiresIn < 9*time.Minute {
+		t.Errorf("expected the refresh token to expire in 10m, got %v", expiresIn)
+	}
+
+	claims, err := auth.NewVerifier(mustKeySet(t), auth.VerifierConfig{}).Verify(rotated.AccessToken)
+	if err != nil || claims.SessionID != token.SessionID || !claims.MFA() {
+		t.Fatalf("expected the session and methods in the claims, got %+v, %v", claims, err)
+	}
+
+	if _, err := service.Refresh(ctx, token.RefreshToken); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Fatalf("expected the reuse to be refused, got %v", err)
+	}
+	if session := sessions.Sessions[token.SessionID]; session.RevokedReason != domain.SessionRefreshTokenReused {
+		t.Errorf("expected the session to be revoked, got %+v", session)
+	}
+	if last := audit.Events[len(audit.Events)-1]; last.Action != domain.AuditRefreshTokenReused || last.Actor != mockUser.UUID {
+		t.Errorf("expected the reuse to be audited, got %+v", last)
+	}
+	if _, err := service.Refresh(ctx, rotated.RefreshToken); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("expected the newest token to be revoked too, got %v", err)
+	}
+}
+
+func TestSessionService(t *testing.T) {
+	const userUUID = "0b0e6a54-5b1f-4a5e-9d8c-2d4f3c1a7e90"
+	repo := NewMockSessionRepository()
+	audit := &MockAuditRepository{}
+	service := NewSessionService(repo, audit, noTransactor{})
+
+	current, _ := repo.CreateSession(context.Background(), domain.Session{UserUUID: userUUID, ExpiresAt: time.Now().Add(time.Hour)})
+	other, _ := repo.CreateSession(context.Background(), domain.Session{UserUUID: userUUID, ExpiresAt: time.Now().Add(time.Hour)})
+	self := WithActor(WithPrincipal(context.Background(), domain.Principal{Subject: userUUID, Roles: []domain.Role{domain.RoleSelf}}),
+		Actor{ID: userUUID, SessionID: current.ID})
+
+	sessions, err := service.ListSessions(self, userUUID)
+	if err != nil || len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %+v, %v", sessions, err)
+	}
+	for _, session := range sessions {
+		if session.Current != (session.ID == current.ID) {
+			t.Errorf("expected only the session of the actor to be current, got %+v", session)
+		}
+	}
+
+	stranger := WithPrincipal(context.Background(), domain.Principal{Subject: "someone else", Roles: []domain.Role{domain.RoleSelf}})
+	if err := service.RevokeSession(stranger, other.ID); !errors.Is(err, domain.ErrSessionNotFound) {
+		t.Errorf("expected the session of another user to be hidden, got %v", err)
+	}
+
+	if err := service.RevokeSession(self, other.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if session := repo.Sessions[other.ID]; session.RevokedReason != domain.SessionLogout {
+		t.Errorf("expected the session to be revoked, got %+v", session)
+	}
+	if len(audit.Events) != 1 || audit.Events[0].Action != domain.AuditSessionRevoked {
+		t.Errorf("expected the revocation to be audited, got %+v", audit.Events)
+	}
+	if err := service.RevokeSession(self, other.ID); !errors.Is(err, domain.ErrSessionNotFound) {
+		t.Errorf("expected a revoked session to be gone, got %v", err)
+	}
+}
+
+func mustKeySet(t *testing.T) *auth.KeySet {
+	t.Helper()
+	keys, err := auth.NewKeySet("test-secret", "", 0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return keys
+}
@@ -1,81 +1,525 @@
 package service
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"go-back/internal/domain"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
 )
 
+const DefaultPageSize = 50
+
+// ErrInvalidCursor wraps domain.ErrInvalidInput.
+var ErrInvalidCursor = fmt.Errorf("%w: invalid cursor", domain.ErrInvalidInput)
+
 type UserRepository interface {
-	ListAllUsers() ([]domain.User, error)
-	ListUserByUUID(string) (domain.User, error)
-	ListUserByEmail(string) (domain.User, error)
-	UpdateUser(domain.User) (domain.User, error)
-	ManageActivateUser(string) (domain.User, error)
-	CreateUser(domain.UserInput) (domain.User, error)
-	DeleteUser(string) error
+	ListAllUsers(context.Context, domain.UserFilter) ([]domain.User, error)
+	ListUserByUUID(context.Context, string) (domain.User, error)
+	ListUserByUUIDWithDeleted(context.Context, string) (domain.User, error)
+	ListUserByEmail(context.Context, string) (domain.User, error)
+	UpdateUser(context.Context, domain.User) (domain.User, error)
+	ManageActivateUser(context.Context, string, int) (domain.User, error)
+	CreateUser(context.Context, domain.UserInput) (domain.User, error)
+	DeleteUser(context.Context, string) error
+	RestoreUser(context.Context, string) (domain.User, error)
+	PurgeDeletedUsers(context.Context, time.Time) ([]domain.User, error)
+	MarkEmailVerified(context.Context, string, string) (domain.User, error)
+}
+
+// Transactor runs fn in a transaction that repositories join through ctx.
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(context.Context) error) error
+	// InTx reports whether ctx carries a transaction started by WithinTx.
+	InTx(ctx context.Context) bool
+}
+
+// JobQueue runs work in the background. Jobs enqueued in a transaction
+// only run once it commits.
+type JobQueue interface {
+	Enqueue(ctx context.Context, kind string, payload any) (domain.Job, error)
+}
+
+// EmailVerifier mails verification tokens for new and changed emails.
+type EmailVerifier interface {
+	RequestVerification(context.Context, domain.User) error
+}
+
+// WebhookNotifier tells subscribers about changes to users. Called in the
+// transaction of the change, they only hear about committed changes.
+type WebhookNotifier interface {
+	NotifyUser(ctx context.Context, event string, user domain.User) error
 }
 
 type UserService struct {
-	userRepository UserRepository
+	userRepository  UserRepository
+	auditRepository AuditRepository
+	transactor      Transactor
+	emailVerifier   EmailVerifier
+	sessionRevoker  SessionRevoker
+	webhooks        WebhookNotifier
+	roles           RoleLister
+	reads           *userReads
+}
+
+// userReads merges concurrent identical reads of a user into one query, so
+// a burst of requests for the same user costs the database a single read.
+type userReads struct {
+	group   singleflight.Group
+	reads   atomic.Int64
+	queries atomic.Int64
+}
+
+// userWrites counts the writes to users. Coalesced reads are keyed on it,
+// so a read that started before a write is never shared with callers that
+// come after the write returned.
+var userWrites atomic.Uint64
+
+// withinUserWrite runs fn, which writes users, in a transaction of tx and
+// then retires the reads in flight.
+func withinUserWrite(ctx context.Context, tx Transactor, fn func(context.Context) error) error {
+	defer userWrites.Add(1)
+	return tx.WithinTx(ctx, fn)
 }
 
-func NewUserService(repo UserRepository) UserService {
+// ReadStats counts the reads of users by UUID and email: Reads were asked
+// for and Queries reached the repository, the others having shared a read
+// already in flight. HitRatio is the share of reads that were shared.
+type ReadStats struct {
+	Reads    int64   `json:"reads"`
+	Queries  int64   `json:"queries"`
+	HitRatio float64 `json:"hit_ratio"`
+}
+
+// UserConfig holds the optional collaborators of a UserService; any of
+// them may be left nil.
+type UserConfig struct {
+	// Verifier mails verification tokens for new and changed emails; nil
+	// sends none.
+	Verifier EmailVerifier
+	// Sessions are revoked when a user is deactivated; nil when there are
+	// no sessions to revoke.
+	Sessions SessionRevoker
+	// Webhooks hear about every recorded change; nil when no one
+	// subscribes.
+	Webhooks WebhookNotifier
+	// Roles keep callers from changing users who hold roles they do not;
+	// nil when no roles are stored.
+	Roles RoleLister
+}
+
+func NewUserService(repo UserRepository, audit AuditRepository, tx Transactor, config UserConfig) UserService {
 	return UserService{
-		userRepository: repo,
+		userRepository:  repo,
+		auditRepository: audit,
+		transactor:      tx,
+		emailVerifier:   config.Verifier,
+		sessionRevoker:  config.Sessions,
+		webhooks:        config.Webhooks,
+		roles:           config.Roles,
+		reads:           &userReads{},
 	}
 }
 
-func (us UserService) ListAllUsers() ([]domain.User, error) {
-	users, err := us.userRepository.ListAllUsers()
+// ReadStats returns the counts of reads since the service was built.
+func (us UserService) ReadStats() ReadStats {
+	stats := ReadStats{Reads: us.reads.reads.Load(), Queries: us.reads.queries.Load()}
+	if stats.Reads > 0 {
+		stats.HitRatio = float64(stats.Reads-stats.Queries) / float64(stats.Reads)
+	}
+	return stats
+}
+
+// coalesce calls read, or waits for the identical read already in flight
+// under key and shares its result. Reads inside a transaction are not
+// shared, since they may see writes no one else can see yet, and neither
+// are reads that started before the last write.
+func (us UserService) coalesce(ctx context.Context, key string, read func(context.Context) (domain.User, error)) (domain.User, error) {
+	us.reads.reads.Add(1)
+	if us.transactor.InTx(ctx) {
+		us.reads.queries.Add(1)
+		return read(ctx)
+	}
+
+	key = fmt.Sprintf("%s@%d", key, userWrites.Load())
+	user, err, _ := us.reads.group.Do(key, func() (any, error) {
+		us.reads.queries.Add(1)
+		// The read is shared by every caller waiting on it, so it must not
+		// fail because the first one gave up. The repository still bounds
+		// it with its read timeout.
+		return read(context.WithoutCancel(ctx))
+	})
+	return user.(domain.User), err
+}
+
+func (us UserService) ListAllUsers(ctx context.Context, filter domain.UserFilter) (domain.UserPage, error) {
+	if err := authorize(ctx, domain.PermUsersRead, ""); err != nil {
+		return domain.UserPage{Users: []domain.User{}}, err
+	}
+	// Deleted users are only shown to those who may delete and restore
+	// them.
+	if filter.IncludeDeleted {
+		if err := authorize(ctx, domain.PermUsersDelete, ""); err != nil {
+			return domain.UserPage{Users: []domain.User{}}, err
+		}
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultPageSize
+	}
+
+	if filter.Cursor != "" {
+		after, err := decodeCursor(filter.Cursor, filter.Sort)
+		if err != nil {
+			return domain.UserPage{Users: []domain.User{}}, err
+		}
+		filter.After = &after
+	}
+
+	// Ask for one extra row to know whether there is a next page.
+	limit := filter.Limit
+	filter.Limit++
+
+	users, err := us.userRepository.ListAllUsers(ctx, filter)
 	if err != nil {
-		return []domain.User{}, err
+		return domain.UserPage{Users: []domain.User{}}, err
 	}
-	return users, nil
+
+	page := domain.UserPage{Users: users}
+	if len(users) > limit {
+		page.Users = users[:limit]
+		column, _ := filter.SortColumn()
+		page.NextCursor = encodeCursor(filter.Sort, page.Users[limit-1], column)
+	}
+	return page, nil
 }
 
-func (us UserService) ListUserByUUID(userUUID string) (domain.User, error) {
-	user, err := us.userRepository.ListUserByUUID(userUUID)
+func (us UserService) ListUserByUUID(ctx context.Context, userUUID string) (domain.User, error) {
+	if err := authorize(ctx, domain.PermUsersRead, userUUID); err != nil {
+		return domain.User{}, err
+	}
+
+	user, err := us.coalesce(ctx, "uuid:"+userUUID, func(ctx context.Context) (domain.User, error) {
+		return us.userRepository.ListUserByUUID(ctx, userUUID)
+	})
 	if err != nil {
 		return domain.User{}, err
 	}
 	return user, nil
 }
 
-func (us UserService) ListUserByEmail(email string) (domain.User, error) {
-	user, err := us.userRepository.ListUserByEmail(email)
+// ListUserByUUIDWithDeleted also finds deleted users, which takes the
+// permission to delete and restore them.
+func (us UserService) ListUserByUUIDWithDeleted(ctx context.Context, userUUID string) (domain.User, error) {
+	if err := authorize(ctx, domain.PermUsersDelete, userUUID); err != nil {
+		return domain.User{}, err
+	}
+
+	user, err := us.userRepository.ListUserByUUIDWithDeleted(ctx, userUUID)
 	if err != nil {
 		return domain.User{}, err
 	}
 	return user, nil
 }
 
-func (us UserService) UpdateUser(user domain.User) (domain.User, error) {
-	user, err := us.userRepository.UpdateUser(user)
+func (us UserService) ListUserByEmail(ctx context.Context, email string) (domain.User, error) {
+	if err := authorize(ctx, domain.PermUsersRead, ""); err != nil {
+		return domain.User{}, err
+	}
+
+	user, err := us.coalesce(ctx, "email:"+email, func(ctx context.Context) (domain.User, error) {
+		return us.userRepository.ListUserByEmail(ctx, email)
+	})
 	if err != nil {
 		return domain.User{}, err
 	}
 	return user, nil
 }
 
-func (us UserService) ManageActivateUser(userUUID string) (domain.User, error) {
-	user, err := us.userRepository.ManageActivateUser(userUUID)
+func (us UserService) UpdateUser(ctx context.Context, user domain.User) (domain.User, error) {
+	if err := authorizeOver(ctx, us.roles, domain.PermUsersWrite, user.UUID); err != nil {
+		return domain.User{}, err
+	}
+
+	var before, updatedUser domain.User
+	err := withinUserWrite(ctx, us.transactor, func(ctx context.Context) error {
+		var err error
+		before, err = us.userRepository.ListUserByUUID(ctx, user.UUID)
+		if err != nil {
+			return err
+		}
+
+		updatedUser, err = us.userRepository.UpdateUser(ctx, user)
+		if err != nil {
+			return err
+		}
+
+		if updatedUser.Email != before.Email {
+			if err := us.requestVerification(ctx, updatedUser); err != nil {
+				return err
+			}
+		}
+		return us.audit(ctx, domain.AuditUserUpdated, &before, &updatedUser)
+	})
+	if err != nil {
+		return domain.User{}, err
+	}
+	return updatedUser, nil
+}
+
+func (us UserService) ManageActivateUser(ctx context.Context, userUUID string, expectedVersion int) (domain.User, error) {
+	if err := authorizeOver(ctx, us.roles, domain.PermUsersToggleActive, userUUID); err != nil {
+		return domain.User{}, err
+	}
+
+	var user domain.User
+	err := withinUserWrite(ctx, us.transactor, func(ctx context.Context) error {
+		before, err := us.userRepository.ListUserByUUID(ctx, userUUID)
+		if err != nil {
+			return err
+		}
+		user, err = us.userRepository.ManageActivateUser(ctx, userUUID, expectedVersion)
+		if err != nil {
+			return err
+		}
+
+		action := domain.AuditUserDeactivated
+		if user.IsActive {
+			action = domain.AuditUserActivated
+		} else if err := us.revokeSessions(ctx, userUUID, domain.SessionUserDeactivated); err != nil {
+			return err
+		}
+		return us.audit(ctx, action, &before, &user)
+	})
 	if err != nil {
 		return domain.User{}, err
 	}
 	return user, nil
 }
 
-func (us UserService) CreateUser(user domain.UserInput) (domain.User, error) {
-	createdUser, err := us.userRepository.CreateUser(user)
+func (us UserService) CreateUser(ctx context.Context, user domain.UserInput) (domain.User, error) {
+	return us.createUser(ctx, user, false)
+}
+
+// CreateVerifiedUser creates a user whose email was proven elsewhere, as at
+// an identity provider: it is marked verified in the same transaction and
+// no verification email is sent.
+func (us UserService) CreateVerifiedUser(ctx context.Context, user domain.UserInput) (domain.User, error) {
+	return us.createUser(ctx, user, true)
+}
+
+func (us UserService) createUser(ctx context.Context, user domain.UserInput, verified bool) (domain.User, error) {
+	if err := authorize(ctx, domain.PermUsersWrite, ""); err != nil {
+		return domain.User{}, err
+	}
+
+	var createdUser domain.User
+	err := withinUserWrite(ctx, us.transactor, func(ctx context.Context) error {
+		var err error
+		createdUser, err = us.userRepository.CreateUser(ctx, user)
+		if err != nil {
+			return err
+		}
+
+		if verified {
+			createdUser, err = us.userRepository.MarkEmailVerified(ctx, createdUser.UUID, createdUser.Email)
+		} else {
+			err = us.requestVerification(ctx, createdUser)
+		}
+		if err != nil {
+			return err
+		}
+		return us.audit(ctx, domain.AuditUserCreated, nil, &createdUser)
+	})
 	if err != nil {
 		return domain.User{}, err
 	}
 	return createdUser, nil
 }
 
-func (us UserService) DeleteUser(userUUID string) error {
-	err := us.userRepository.DeleteUser(userUUID)
+// MarkEmailVerified records that the user proved, elsewhere, that they own
+// email, which must still be their email. Users already verified are
+// returned as they are.
+func (us UserService) MarkEmailVerified(ctx context.Context, userUUID, email string) (domain.User, error) {
+	if err := authorizeOver(ctx, us.roles, domain.PermUsersWrite, userUUID); err != nil {
+		return domain.User{}, err
+	}
+
+	var user domain.User
+	err := withinUserWrite(ctx, us.transactor, func(ctx context.Context) error {
+		before, err := us.userRepository.ListUserByUUID(ctx, userUUID)
+		if err != nil {
+			return err
+		}
+		if before.Email == email && before.EmailVerifiedAt != nil {
+			user = before
+			return nil
+		}
+
+		user, err = us.userRepository.MarkEmailVerified(ctx, userUUID, email)
+		if err != nil {
+			return err
+		}
+		return recordAudit(ctx, us.auditRepository, domain.AuditEmailVerified, userUUID, domain.DiffUsers(&before, &user))
+	})
 	if err != nil {
+		return domain.User{}, err
+	}
+	return user, nil
+}
+
+// requestVerification queues a verification email in the transaction of
+// the change, so it is sent once the user is committed and never for a
+// change that was rolled back.
+func (us UserService) requestVerification(ctx context.Context, user domain.User) error {
+	if us.emailVerifier == nil {
+		return nil
+	}
+	return us.emailVerifier.RequestVerification(ctx, user)
+}
+
+func (us UserService) DeleteUser(ctx context.Context, userUUID string) error {
+	if err := authorizeOver(ctx, us.roles, domain.PermUsersDelete, userUUID); err != nil {
 		return err
 	}
-	return nil
+
+	return withinUserWrite(ctx, us.transactor, func(ctx context.Context) error {
+		before, err := us.userRepository.ListUserByUUID(ctx, userUUID)
+		if err != nil {
+			return err
+		}
+
+		if err := us.userRepository.DeleteUser(ctx, userUUID); err != nil {
+			return err
+		}
+		if err := us.revokeSessions(ctx, userUUID, domain.SessionUserDeleted); err != nil {
+			return err
+		}
+
+		after, err := us.userRepository.ListUserByUUIDWithDeleted(ctx, userUUID)
+		if err != nil {
+			return err
+		}
+
+		return us.audit(ctx, domain.AuditUserDeleted, &before, &after)
+	})
+}
+
+// revokeSessions logs the user out everywhere, so deactivated and deleted
+// users lose access right away rather than when their tokens expire.
+func (us UserService) revokeSessions(ctx context.Context, userUUID, reason string) error {
+	if us.sessionRevoker == nil {
+		return nil
+	}
+	return us.sessionRevoker.RevokeUserSessions(ctx, userUUID, reason)
+}
+
+func (us UserService) RestoreUser(ctx context.Context, userUUID string) (domain.User, error) {
+	if err := authorizeOver(ctx, us.roles, domain.PermUsersDelete, userUUID); err != nil {
+		return domain.User{}, err
+	}
+
+	var user domain.User
+	err := withinUserWrite(ctx, us.transactor, func(ctx context.Context) error {
+		before, err := us.userRepository.ListUserByUUIDWithDeleted(ctx, userUUID)
+		if err != nil {
+			return err
+		}
+
+		user, err = us.userRepository.RestoreUser(ctx, userUUID)
+		if err != nil {
+			return err
+		}
+
+		return us.audit(ctx, domain.AuditUserRestored, &before, &user)
+	})
+	if err != nil {
+		return domain.User{}, err
+	}
+	return user, nil
+}
+
+// PurgeDeletedUsers hard deletes users soft deleted longer than retention ago.
+func (us UserService) PurgeDeletedUsers(ctx context.Context, retention time.Duration) (int, error) {
+	ctx = WithActor(ctx, Actor{ID: SystemActor})
+
+	var purged []domain.User
+	err := withinUserWrite(ctx, us.transactor, func(ctx context.Context) error {
+		var err error
+		purged, err = us.userRepository.PurgeDeletedUsers(ctx, time.Now().Add(-retention))
+		if err != nil {
+			return err
+		}
+
+		for i := range purged {
+			if err := us.audit(ctx, domain.AuditUserPurged, &purged[i], nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(purged), nil
+}
+
+// RunPurger calls PurgeDeletedUsers every interval until ctx is done.
+func (us UserService) RunPurger(ctx context.Context, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := us.PurgeDeletedUsers(ctx, retention)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("service=UserService func=RunPurger err=%v", err)
+		} else if purged > 0 {
+			log.Printf("service=UserService func=RunPurger purged=%d", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type cursorPayload struct {
+	Sort string `json:"s"`
+	domain.UserCursor
+}
+
+func encodeCursor(sort string, last domain.User, column string) string {
+	payload, _ := json.Marshal(cursorPayload{
+		Sort:       sort,
+		UserCursor: domain.UserCursor{Value: last.SortValue(column), UUID: last.UUID},
+	})
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+// decodeCursor rejects cursors built for a different sort order, since their
+// value would be compared against the wrong column.
+func decodeCursor(cursor string, sort string) (domain.UserCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return domain.UserCursor{}, ErrInvalidCursor
+	}
+
+	var payload cursorPayload
+	if err := json.Unmarshal(raw, &payload); err != nil || payload.UUID == "" || payload.Sort != sort {
+		return domain.UserCursor{}, ErrInvalidCursor
+	}
+
+	filter := domain.UserFilter{Sort: sort, After: &payload.UserCursor}
+	if _, err := filter.AfterValue(); err != nil {
+		return domain.UserCursor{}, ErrInvalidCursor
+	}
+
+	return payload.UserCursor, nil
 }
@@ -1,8 +1,11 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -12,62 +15,137 @@ import (
 var mockUser = domain.User{UUID: "1", Name: "John", Email: "john@example.com", CreatedAt: time.Now(), UpdatedAt: time.Now(), IsActive: true}
 
 type MockUserRepository struct {
-	ListAllUsersFunc       func() ([]domain.User, error)
-	ListUserByUUIDFunc     func(string) (domain.User, error)
-	ListUserByEmailFunc    func(string) (domain.User, error)
-	UpdateUserFunc         func(domain.User) (domain.User, error)
-	ManageActivateUserFunc func(string) (domain.User, error)
-	CreateUserFunc         func(domain.UserInput) (domain.User, error)
-	DeleteUserFunc         func(string) error
+	ListAllUsersFunc       func(context.Context, domain.UserFilter) ([]domain.User, error)
+	ListUserByUUIDFunc     func(context.Context, string) (domain.User, error)
+	ListUserByEmailFunc    func(context.Context, string) (domain.User, error)
+	UpdateUserFunc         func(context.Context, domain.User) (domain.User, error)
+	ManageActivateUserFunc func(context.Context, string, int) (domain.User, error)
+	CreateUserFunc         func(context.Context, domain.UserInput) (domain.User, error)
+	DeleteUserFunc         func(context.Context, string) error
+	RestoreUserFunc        func(context.Context, string) (domain.User, error)
+	PurgeDeletedUsersFunc  func(context.Context, time.Time) ([]domain.User, error)
+	MarkEmailVerifiedFunc  func(context.Context, string, string) (domain.User, error)
 }
 
-func (m *MockUserRepository) ListAllUsers() ([]domain.User, error) {
-	return m.ListAllUsersFunc()
+func (m *MockUserRepository) ListAllUsers(ctx context.Context, filter domain.UserFilter) ([]domain.User, error) {
+	return m.ListAllUsersFunc(ctx, filter)
 }
 
-func (m *MockUserRepository) ListUserByUUID(userUUID string) (domain.User, error) {
+func (m *MockUserRepository) ListUserByUUID(ctx context.Context, userUUID string) (domain.User, error) {
 	if m.ListUserByUUIDFunc != nil {
-		return m.ListUserByUUIDFunc(userUUID)
+		return m.ListUserByUUIDFunc(ctx, userUUID)
 	}
 	return domain.User{}, nil
 }
 
-func (m *MockUserRepository) ListUserByEmail(email string) (domain.User, error) {
+func (m *MockUserRepository) ListUserByUUIDWithDeleted(ctx context.Context, userUUID string) (domain.User, error) {
+	if m.ListUserByUUIDFunc != nil {
+		return m.ListUserByUUIDFunc(ctx, userUUID)
+	}
+	return domain.User{}, nil
+}
+
+func (m *MockUserRepository) ListUserByEmail(ctx context.Context, email string) (domain.User, error) {
 	if m.ListUserByEmailFunc != nil {
-		return m.ListUserByEmailFunc(email)
+		return m.ListUserByEmailFunc(ctx, email)
 	}
 	return domain.User{}, nil
 }
-func (m *MockUserRepository) UpdateUser(u domain.User) (domain.User, error) {
+func (m *MockUserRepository) UpdateUser(ctx context.Context, u domain.User) (domain.User, error) {
 	if m.UpdateUserFunc != nil {
-		return m.UpdateUserFunc(u)
+		return m.UpdateUserFunc(ctx, u)
 	}
 	return domain.User{}, nil
 }
 
-func (m *MockUserRepository) ManageActivateUser(u string) (domain.User, error) {
+func (m *MockUserRepository) ManageActivateUser(ctx context.Context, u string, version int) (domain.User, error) {
 	if m.ManageActivateUserFunc != nil {
-		return m.ManageActivateUserFunc(u)
+		return m.ManageActivateUserFunc(ctx, u, version)
 	}
 	return domain.User{}, nil
 }
-func (m *MockUserRepository) CreateUser(input domain.UserInput) (domain.User, error) {
+func (m *MockUserRepository) CreateUser(ctx context.Context, input domain.UserInput) (domain.User, error) {
 	if m.CreateUserFunc != nil {
-		return m.CreateUserFunc(input)
+		return m.CreateUserFunc(ctx, input)
 	}
 	return domain.User{}, nil
 }
 
-func (m *MockUserRepository) DeleteUser(uuid string) error {
+func (m *MockUserRepository) DeleteUser(ctx context.Context, uuid string) error {
 	if m.DeleteUserFunc != nil {
-		return m.DeleteUserFunc(uuid)
+		return m.DeleteUserFunc(ctx, uuid)
 	}
 	return nil
 }
 
+func (m *MockUserRepository) RestoreUser(ctx context.Context, uuid string) (domain.User, error) {
+	if m.RestoreUserFunc != nil {
+		return m.RestoreUserFunc(ctx, uuid)
+	}
+	return domain.User{}, nil
+}
+
+func (m *MockUserRepository) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) ([]domain.User, error) {
+	if m.PurgeDeletedUsersFunc != nil {
+		return m.PurgeDeletedUsersFunc(ctx, deletedBefore)
+	}
+	return nil, nil
+}
+
+func (m *MockUserRepository) MarkEmailVerified(ctx context.Context, userUUID, email string) (domain.User, error) {
+	if m.MarkEmailVerifiedFunc != nil {
+		return m.MarkEmailVerifiedFunc(ctx, userUUID, email)
+	}
+	return domain.User{}, nil
+}
+
+type MockAuditRepository struct {
+	Events []domain.AuditEvent
+}
+
+func (m *MockAuditRepository) CreateAuditEvent(ctx context.Context, event domain.AuditEvent) (domain.AuditEvent, error) {
+	m.Events = append(m.Events, event)
+	return event, nil
+}
+
+func (m *MockAuditRepository) ListAuditEvents(ctx context.Context, filter domain.AuditFilter) ([]domain.AuditEvent, error) {
+	return m.Events, nil
+}
+
+type queuedJob struct {
+	kind    string
+	payload any
+}
+
+type MockJobQueue struct {
+	mu   sync.Mutex
+	Jobs []queuedJob
+}
+
+func (m *MockJobQueue) Enqueue(ctx context.Context, kind string, payload any) (domain.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Jobs = append(m.Jobs, queuedJob{kind: kind, payload: payload})
+	return domain.Job{Kind: kind}, nil
+}
+
+type noTransactor struct{}
+
+func (noTransactor) WithinTx(ctx context.Context, fn func(context.Context) error) error {
+	return fn(ctx)
+}
+
+func (noTransactor) InTx(context.Context) bool {
+	return false
+}
+
+func newTestUserService(repo UserRepository) UserService {
+	return NewUserService(repo, &MockAuditRepository{}, noTransactor{}, UserConfig{})
+}
+
 func TestNewUserService(t *testing.T) {
 	repo := &MockUserRepository{}
-	service := NewUserService(repo)
+	service := newTestUserService(repo)
 	if service.userRepository != repo {
 		t.Errorf("expected repository to be set correctly")
 	}
@@ -76,33 +154,86 @@ func TestNewUserService(t *testing.T) {
 func TestUserService_ListAllUsers(t *testing.T) {
 	t.Run("returns users when repository succeeds", func(t *testing.T) {
 		repo := &MockUserRepository{
-			ListAllUsersFunc: func() ([]domain.User, error) {
+			ListAllUsersFunc: func(ctx context.Context, filter domain.UserFilter) ([]domain.User, error) {
 				return []domain.User{mockUser}, nil
 			},
 		}
-		service := UserService{userRepository: repo}
-		users, err := service.ListAllUsers()
+		service := newTestUserService(repo)
+		page, err := service.ListAllUsers(context.Background(), domain.UserFilter{})
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
-		if !reflect.DeepEqual(users, []domain.User{mockUser}) {
-			t.Errorf("expected %v, got %v", []domain.User{mockUser}, users)
+		if !reflect.DeepEqual(page.Users, []domain.User{mockUser}) {
+			t.Errorf("expected %v, got %v", []domain.User{mockUser}, page.Users)
+		}
+		if page.NextCursor != "" {
+			t.Errorf("expected no next cursor, got %q", page.NextCursor)
 		}
 	})
 
 	t.Run("returns error when repository fails", func(t *testing.T) {
 		repo := &MockUserRepository{
-			ListAllUsersFunc: func() ([]domain.User, error) {
+			ListAllUsersFunc: func(ctx context.Context, filter domain.UserFilter) ([]domain.User, error) {
 				return nil, errors.New("db error")
 			},
 		}
-		service := UserService{userRepository: repo}
-		users, err := service.ListAllUsers()
+		service := newTestUserService(repo)
+		page, err := service.ListAllUsers(context.Background(), domain.UserFilter{})
 		if err == nil {
 			t.Fatal("expected error, got nil")
 		}
-		if users == nil || len(users) != 0 {
-			t.Errorf("expected empty users slice, got %v", users)
+		if page.Users == nil || len(page.Users) != 0 {
+			t.Errorf("expected empty users slice, got %v", page.Users)
+		}
+	})
+
+	t.Run("applies default limit and builds next cursor", func(t *testing.T) {
+		var requested domain.UserFilter
+		repo := &MockUserRepository{
+			ListAllUsersFunc: func(ctx context.Context, filter domain.UserFilter) ([]domain.User, error) {
+				requested = filter
+				users := make([]domain.User, filter.Limit)
+				for i := range users {
+					users[i] = mockUser
+				}
+				return users, nil
+			},
+		}
+		service := newTestUserService(repo)
+		page, err := service.ListAllUsers(context.Background(), domain.UserFilter{})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if requested.Limit != DefaultPageSize+1 {
+			t.Errorf("expected repository to be asked for %d users, got %d", DefaultPageSize+1, requested.Limit)
+		}
+		if len(page.Users) != DefaultPageSize || page.NextCursor == "" {
+			t.Fatalf("expected a full page with next cursor, got %d users and cursor %q", len(page.Users), page.NextCursor)
+		}
+
+		if _, err := service.ListAllUsers(context.Background(), domain.UserFilter{Cursor: page.NextCursor}); err != nil {
+			t.Fatalf("expected next cursor to be accepted, got %v", err)
+		}
+		if requested.After == nil || requested.After.UUID != mockUser.UUID {
+			t.Errorf("expected cursor to be decoded, got %v", requested.After)
+		}
+	})
+
+	t.Run("rejects malformed or mismatched cursor", func(t *testing.T) {
+		repo := &MockUserRepository{
+			ListAllUsersFunc: func(ctx context.Context, filter domain.UserFilter) ([]domain.User, error) {
+				return []domain.User{mockUser, mockUser}, nil
+			},
+		}
+		service := newTestUserService(repo)
+		if _, err := service.ListAllUsers(context.Background(), domain.UserFilter{Cursor: "not a cursor"}); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("expected ErrInvalidCursor, got %v", err)
+		}
+
+		page, _ := service.ListAllUsers(context.Background(), domain.UserFilter{Limit: 1, Sort: "name"})
+		_, err := service.ListAllUsers(context.Background(), domain.UserFilter{Cursor: page.NextCursor, Sort: "-created_at"})
+		if !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("expected ErrInvalidCursor, got %v", err)
 		}
 	})
 }
@@ -110,15 +241,15 @@ func TestUserService_ListAllUsers(t *testing.T) {
 func TestUserService_ListUserByUUID(t *testing.T) {
 	t.Run("returns user when repository succeeds", func(t *testing.T) {
 		repo := &MockUserRepository{
-			ListUserByUUIDFunc: func(userUUID string) (domain.User, error) {
+			ListUserByUUIDFunc: func(ctx context.Context, userUUID string) (domain.User, error) {
 				if userUUID == mockUser.UUID {
 					return mockUser, nil
 				}
 				return domain.User{}, errors.New("user not found")
 			},
 		}
-		service := UserService{userRepository: repo}
-		user, err := service.ListUserByUUID(mockUser.UUID)
+		service := newTestUserService(repo)
+		user, err := service.ListUserByUUID(context.Background(), mockUser.UUID)
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
@@ -128,12 +259,12 @@ func TestUserService_ListUserByUUID(t *testing.T) {
 	})
 	t.Run("returns error when repository fails", func(t *testing.T) {
 		repo := &MockUserRepository{
-			ListUserByUUIDFunc: func(userUUID string) (domain.User, error) {
+			ListUserByUUIDFunc: func(ctx context.Context, userUUID string) (domain.User, error) {
 				return domain.User{}, errors.New("db error")
 			},
 		}
-		service := UserService{userRepository: repo}
-		user, err := service.ListUserByUUID("1")
+		service := newTestUserService(repo)
+		user, err := service.ListUserByUUID(context.Background(), "1")
 		if err == nil {
 			t.Fatal("expected error, got nil")
 		}
@@ -146,15 +277,15 @@ func TestUserService_ListUserByUUID(t *testing.T) {
 func TestUserService_ListUserByEmail(t *testing.T) {
 	t.Run("returns user when repository succeeds", func(t *testing.T) {
 		repo := &MockUserRepository{
-			ListUserByEmailFunc: func(email string) (domain.User, error) {
+			ListUserByEmailFunc: func(ctx context.Context, email string) (domain.User, error) {
 				if email == mockUser.Email {
 					return mockUser, nil
 				}
 				return domain.User{}, errors.New("user not found")
 			},
 		}
-		service := UserService{userRepository: repo}
-		user, err := service.ListUserByEmail(mockUser.Email)
+		service := newTestUserService(repo)
+		user, err := service.ListUserByEmail(context.Background(), mockUser.Email)
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
@@ -164,12 +295,12 @@ func TestUserService_ListUserByEmail(t *testing.T) {
 	})
 	t.Run("returns error when repository fails", func(t *testing.T) {
 		repo := &MockUserRepository{
-			ListUserByEmailFunc: func(email string) (domain.User, error) {
+			ListUserByEmailFunc: func(ctx context.Context, email string) (domain.User, error) {
 				return domain.User{}, errors.New("db error")
 			},
 		}
-		service := UserService{userRepository: repo}
-		user, err := service.ListUserByEmail(mockUser.Email)
+		service := newTestUserService(repo)
+		user, err := service.ListUserByEmail(context.Background(), mockUser.Email)
 		if err == nil {
 			t.Fatal("expected error, got nil")
 		}
@@ -179,15 +310,105 @@ func TestUserService_ListUserByEmail(t *testing.T) {
 	})
 }
 
+func TestUserService_CoalescesReads(t *testing.T) {
+	var queries atomic.Int32
+	release := make(chan struct{})
+	repo := &MockUserRepository{
+		ListUserByUUIDFunc: func(ctx context.Context, userUUID string) (domain.User, error) {
+			queries.Add(1)
+			<-release
+			return mockUser, nil
+		},
+	}
+	service := newTestUserService(repo)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if user, err := service.ListUserByUUID(context.Background(), mockUser.UUID); err != nil || user.UUID != mockUser.UUID {
+				t.Errorf("expected %v, got %v, %v", mockUser, user, err)
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if queries.Load() != 1 {
+		t.Errorf("expected concurrent reads to share one query, got %d", queries.Load())
+	}
+	if stats := service.ReadStats(); stats.Reads != 10 || stats.Queries != 1 || stats.HitRatio != 0.9 {
+		t.Errorf("expected 10 reads, 1 query and a hit ratio of 0.9, got %+v", stats)
+	}
+
+	if _, err := service.ListUserByUUID(context.Background(), mockUser.UUID); err != nil || queries.Load() != 2 {
+		t.Errorf("expected a later read to query again, got %d queries, %v", queries.Load(), err)
+	}
+}
+
+func TestUserService_CoalescesReadsUntilWrites(t *testing.T) {
+	var queries atomic.Int32
+	release := make(chan struct{})
+	repo := &MockUserRepository{
+		ListUserByUUIDFunc: func(ctx context.Context, userUUID string) (domain.User, error) {
+			if queries.Add(1) == 1 {
+				<-release
+				return mockUser, nil
+			}
+			updated := mockUser
+			updated.Name = "Jane"
+			return updated, nil
+		},
+		UpdateUserFunc: func(ctx context.Context, user domain.User) (domain.User, error) {
+			return user, nil
+		},
+	}
+	service := newTestUserService(repo)
+
+	stale := make(chan domain.User)
+	go func() {
+		user, _ := service.ListUserByUUID(context.Background(), mockUser.UUID)
+		stale <- user
+	}()
+	for queries.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	updated := mockUser
+	updated.Name = "Jane"
+	if _, err := service.UpdateUser(context.Background(), updated); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	fresh := make(chan domain.User)
+	go func() {
+		user, _ := service.ListUserByUUID(context.Background(), mockUser.UUID)
+		fresh <- user
+	}()
+	select {
+	case user := <-fresh:
+		if user.Name != "Jane" {
+			t.Errorf("expected the read after the write to see it, got %+v", user)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected the read after the write not to wait on the one before it")
+	}
+	close(release)
+	<-stale
+}
+
 func TestUserService_UpdateUser(t *testing.T) {
 	t.Run("returns updated user when repository succeeds", func(t *testing.T) {
 		repo := &MockUserRepository{
-			UpdateUserFunc: func(u domain.User) (domain.User, error) {
+			UpdateUserFunc: func(ctx context.Context, u domain.User) (domain.User, error) {
 				return mockUser, nil
 			},
 		}
-		service := UserService{userRepository: repo}
-		user, err := service.UpdateUser(mockUser)
+		service := newTestUserService(repo)
+		user, err := service.UpdateUser(context.Background(), mockUser)
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
@@ -197,12 +418,12 @@ func TestUserService_UpdateUser(t *testing.T) {
 	})
 	t.Run("returns error when repository fails", func(t *testing.T) {
 		repo := &MockUserRepository{
-			UpdateUserFunc: func(u domain.User) (domain.User, error) {
+			UpdateUserFunc: func(ctx context.Context, u domain.User) (domain.User, error) {
 				return domain.User{}, errors.New("db error")
 			},
 		}
-		service := UserService{userRepository: repo}
-		user, err := service.UpdateUser(mockUser)
+		service := newTestUserService(repo)
+		user, err := service.UpdateUser(context.Background(), mockUser)
 		if err == nil {
 			t.Fatal("expected error, got nil")
 		}
@@ -212,15 +433,81 @@ func TestUserService_UpdateUser(t *testing.T) {
 	})
 }
 
+// MockRoleLister holds the roles of each user.
+type MockRoleLister map[string][]domain.Role
+
+func (m MockRoleLister) ListRoles(ctx context.Context, userUUID string) ([]domain.RoleGrant, error) {
+	grants := []domain.RoleGrant{}
+	for _, role := range m[userUUID] {
+		grants = append(grants, domain.RoleGrant{UserUUID: userUUID, Role: role})
+	}
+	return grants, nil
+}
+
+func TestUserService_TargetRoles(t *testing.T) {
+	repo := &MockUserRepository{
+		UpdateUserFunc: func(ctx context.Context, u domain.User) (domain.User, error) {
+			return u, nil
+		},
+		ManageActivateUserFunc: func(ctx context.Context, uuid string, version int) (domain.User, error) {
+			return mockUser, nil
+		},
+	}
+	roles := MockRoleLister{"admin-uuid": {domain.RoleAdmin}, "viewer-uuid": {domain.RoleViewer}}
+	service := NewUserService(repo, &MockAuditRepository{}, noTransactor{}, UserConfig{Roles: roles})
+
+	as := func(principal domain.Principal) context.Context {
+		return WithPrincipal(context.Background(), principal)
+	}
+	support := as(domain.Principal{Subject: "support-uuid", Roles: []domain.Role{domain.RoleSelf, domain.RoleSupport}})
+	admin := as(domain.Principal{Subject: "other-admin", Roles: []domain.Role{domain.RoleSelf, domain.RoleAdmin}})
+	apiKey := as(domain.Principal{Subject: "apikey:1", Roles: []domain.Role{}, Scopes: []domain.Permission{domain.PermUsersRead, domain.PermUsersWrite}})
+	adminSelf := as(domain.Principal{Subject: "admin-uuid", Roles: []domain.Role{domain.RoleSelf, domain.RoleAdmin}})
+
+	cases := []struct {
+		name   string
+		ctx    context.Context
+		target string
+		err    error
+	}{
+		{"support cannot change admins", support, "admin-uuid", domain.ErrForbidden},
+		{"support changes viewers", support, "viewer-uuid", nil},
+		{"support changes users without roles", support, "member-uuid", nil},
+		{"admins change admins", admin, "admin-uuid", nil},
+		{"api keys cannot change admins", apiKey, "admin-uuid", domain.ErrForbidden},
+		{"api keys change viewers within their scopes", apiKey, "viewer-uuid", nil},
+		{"admins change themselves", adminSelf, "admin-uuid", nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := service.UpdateUser(c.ctx, domain.User{UUID: c.target, Name: "x", Email: "x@example.com"}); !errors.Is(err, c.err) {
+				t.Errorf("expected %v updating, got %v", c.err, err)
+			}
+		})
+	}
+
+	if _, err := service.ManageActivateUser(support, "admin-uuid", 0); !errors.Is(err, domain.ErrForbidden) {
+		t.Errorf("expected support not to deactivate admins, got %v", err)
+	}
+
+	viewer := as(domain.Principal{Subject: "viewer-uuid", Roles: []domain.Role{domain.RoleSelf, domain.RoleViewer}})
+	if _, err := service.ListAllUsers(viewer, domain.UserFilter{IncludeDeleted: true}); !errors.Is(err, domain.ErrForbidden) {
+		t.Errorf("expected viewers not to list deleted users, got %v", err)
+	}
+	if _, err := service.ListUserByUUIDWithDeleted(support, "member-uuid"); !errors.Is(err, domain.ErrForbidden) {
+		t.Errorf("expected support not to read deleted users, got %v", err)
+	}
+}
+
 func TestUserService_ManageActivateUser(t *testing.T) {
 	t.Run("returns updated user when repository succeeds", func(t *testing.T) {
 		repo := &MockUserRepository{
-			ManageActivateUserFunc: func(u string) (domain.User, error) {
+			ManageActivateUserFunc: func(ctx context.Context, u string, version int) (domain.User, error) {
 				return mockUser, nil
 			},
 		}
-		service := UserService{userRepository: repo}
-		user, err := service.ManageActivateUser(mockUser.UUID)
+		service := newTestUserService(repo)
+		user, err := service.ManageActivateUser(context.Background(), mockUser.UUID, 0)
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
@@ -230,12 +517,12 @@ func TestUserService_ManageActivateUser(t *testing.T) {
 	})
 	t.Run("returns error when repository fails", func(t *testing.T) {
 		repo := &MockUserRepository{
-			ManageActivateUserFunc: func(u string) (domain.User, error) {
+			ManageActivateUserFunc: func(ctx context.Context, u string, version int) (domain.User, error) {
 				return domain.User{}, errors.New("db error")
 			},
 		}
-		service := UserService{userRepository: repo}
-		user, err := service.ManageActivateUser(mockUser.UUID)
+		service := newTestUserService(repo)
+		user, err := service.ManageActivateUser(context.Background(), mockUser.UUID, 0)
 		if err == nil {
 			t.Fatal("expected error, got nil")
 		}
@@ -243,16 +530,35 @@ func TestUserService_ManageActivateUser(t *testing.T) {
 			t.Errorf("expected empty user, got %v", user)
 		}
 	})
+	t.Run("does not toggle a user it cannot read", func(t *testing.T) {
+		toggled := false
+		repo := &MockUserRepository{
+			ListUserByUUIDFunc: func(ctx context.Context, u string) (domain.User, error) {
+				return domain.User{}, domain.ErrUserNotFound
+			},
+			ManageActivateUserFunc: func(ctx context.Context, u string, version int) (domain.User, error) {
+				toggled = true
+				return mockUser, nil
+			},
+		}
+		service := newTestUserService(repo)
+		if _, err := service.ManageActivateUser(context.Background(), mockUser.UUID, 0); !errors.Is(err, domain.ErrUserNotFound) {
+			t.Errorf("expected ErrUserNotFound, got %v", err)
+		}
+		if toggled {
+			t.Error("expected the user not to be toggled")
+		}
+	})
 }
 func TestUserService_CreateUser(t *testing.T) {
 	t.Run("returns created user when repository succeeds", func(t *testing.T) {
 		repo := &MockUserRepository{
-			CreateUserFunc: func(input domain.UserInput) (domain.User, error) {
+			CreateUserFunc: func(ctx context.Context, input domain.UserInput) (domain.User, error) {
 				return mockUser, nil
 			},
 		}
-		service := UserService{userRepository: repo}
-		createdUser, err := service.CreateUser(domain.UserInput{
+		service := newTestUserService(repo)
+		createdUser, err := service.CreateUser(context.Background(), domain.UserInput{
 			Name:  "John",
 			Email: "john@example.com",
 		})
@@ -266,12 +572,12 @@ func TestUserService_CreateUser(t *testing.T) {
 
 	t.Run("returns error when repository fails", func(t *testing.T) {
 		repo := &MockUserRepository{
-			CreateUserFunc: func(input domain.UserInput) (domain.User, error) {
+			CreateUserFunc: func(ctx context.Context, input domain.UserInput) (domain.User, error) {
 				return domain.User{}, errors.New("db error")
 			},
 		}
-		service := UserService{userRepository: repo}
-		createdUser, err := service.CreateUser(domain.UserInput{
+		service := newTestUserService(repo)
+		createdUser, err := service.CreateUser(context.Background(), domain.UserInput{
 			Name:  "John",
 			Email: "john@example.com",
 		})
@@ -287,12 +593,12 @@ func TestUserService_CreateUser(t *testing.T) {
 func TestUserService_DeleteUser(t *testing.T) {
 	t.Run("returns nil when repository succeeds", func(t *testing.T) {
 		repo := &MockUserRepository{
-			DeleteUserFunc: func(uuid string) error {
+			DeleteUserFunc: func(ctx context.Context, uuid string) error {
 				return nil
 			},
 		}
-		service := UserService{userRepository: repo}
-		err := service.DeleteUser(mockUser.UUID)
+		service := newTestUserService(repo)
+		err := service.DeleteUser(context.Background(), mockUser.UUID)
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
@@ -300,14 +606,160 @@ func TestUserService_DeleteUser(t *testing.T) {
 
 	t.Run("returns error when repository fails", func(t *testing.T) {
 		repo := &MockUserRepository{
-			DeleteUserFunc: func(uuid string) error {
+			DeleteUserFunc: func(ctx context.Context, uuid string) error {
 				return errors.New("db error")
 			},
 		}
-		service := UserService{userRepository: repo}
-		err := service.DeleteUser(mockUser.UUID)
+		service := newTestUserService(repo)
+		err := service.DeleteUser(context.Background(), mockUser.UUID)
 		if err == nil {
 			t.Fatal("expected error, got nil")
 		}
 	})
 }
+
+func TestUserService_RestoreUser(t *testing.T) {
+	t.Run("returns restored user when repository succeeds", func(t *testing.T) {
+		repo := &MockUserRepository{
+			RestoreUserFunc: func(ctx context.Context, uuid string) (domain.User, error) {
+				return mockUser, nil
+			},
+		}
+		service := newTestUserService(repo)
+		user, err := service.RestoreUser(context.Background(), mockUser.UUID)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !reflect.DeepEqual(user, mockUser) {
+			t.Errorf("expected %v, got %v", mockUser, user)
+		}
+	})
+
+	t.Run("returns error when repository fails", func(t *testing.T) {
+		repo := &MockUserRepository{
+			RestoreUserFunc: func(ctx context.Context, uuid string) (domain.User, error) {
+				return domain.User{}, errors.New("db error")
+			},
+		}
+		service := newTestUserService(repo)
+		if _, err := service.RestoreUser(context.Background(), mockUser.UUID); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+}
+
+func TestUserService_PurgeDeletedUsers(t *testing.T) {
+	var deletedBefore time.Time
+	repo := &MockUserRepository{
+		PurgeDeletedUsersFunc: func(ctx context.Context, before time.Time) ([]domain.User, error) {
+			deletedBefore = before
+			return []domain.User{mockUser, mockUser, mockUser}, nil
+		},
+	}
+	audit := &MockAuditRepository{}
+	service := NewUserService(repo, audit, noTransactor{}, UserConfig{})
+
+	purged, err := service.PurgeDeletedUsers(context.Background(), 24*time.Hour)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if purged != 3 {
+		t.Errorf("expected 3 purged users, got %d", purged)
+	}
+	if len(audit.Events) != 3 || audit.Events[0].Actor != SystemActor || audit.Events[0].Action != domain.AuditUserPurged {
+		t.Errorf("expected 3 user.purged events by %q, got %v", SystemActor, audit.Events)
+	}
+	if cutoff := time.Since(deletedBefore); cutoff < 24*time.Hour || cutoff > 25*time.Hour {
+		t.Errorf("expected cutoff about 24h ago, got %v", cutoff)
+	}
+}
+
+func TestUserService_Audit(t *testing.T) {
+	ctx := WithActor(context.Background(), Actor{ID: "admin", RequestID: "req-1", IP: "10.0.0.1"})
+
+	t.Run("records deactivation and revokes sessions", func(t *testing.T) {
+		repo := &MockUserRepository{
+			ListUserByUUIDFunc: func(ctx context.Context, uuid string) (domain.User, error) {
+				return mockUser, nil
+			},
+			ManageActivateUserFunc: func(ctx context.Context, uuid string, version int) (domain.User, error) {
+				user := mockUser
+				user.IsActive = false
+				return user, nil
+			},
+		}
+		audit := &MockAuditRepository{}
+		sessions := NewMockSessionRepository()
+		session, _ := sessions.CreateSession(ctx, domain.Session{UserUUID: mockUser.UUID, ExpiresAt: time.Now().Add(time.Hour)})
+		service := NewUserService(repo, audit, noTransactor{}, UserConfig{Sessions: sessions})
+
+		if _, err := service.ManageActivateUser(ctx, mockUser.UUID, 0); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if reason := sessions.Sessions[session.ID].RevokedReason; reason != domain.SessionUserDeactivated {
+			t.Errorf("expected the sessions to be revoked, got %q", reason)
+		}
+		if len(audit.Events) != 1 {
+			t.Fatalf("expected 1 event, got %d", len(audit.Events))
+		}
+		event := audit.Events[0]
+		if event.Action != domain.AuditUserDeactivated || event.Actor != "admin" || event.RequestID != "req-1" || event.IP != "10.0.0.1" || event.TargetUUID != mockUser.UUID {
+			t.Errorf("unexpected event %+v", event)
+		}
+		expected := map[string]domain.FieldChange{"is_active": {From: true, To: false}}
+		if !reflect.DeepEqual(event.Changes, expected) {
+			t.Errorf("expected changes %v, got %v", expected, event.Changes)
+		}
+	})
+
+	t.Run("records nothing when the mutation fails", func(t *testing.T) {
+		repo := &MockUserRepository{
+			UpdateUserFunc: func(ctx context.Context, u domain.User) (domain.User, error) {
+				return domain.User{}, errors.New("db error")
+			},
+		}
+		audit := &MockAuditRepository{}
+		service := NewUserService(repo, audit, noTransactor{}, UserConfig{})
+
+		if _, err := service.UpdateUser(ctx, mockUser); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+		if len(audit.Events) != 0 {
+			t.Errorf("expected no events, got %v", audit.Events)
+		}
+	})
+
+	t.Run("notifies every webhook of the change", func(t *testing.T) {
+		repo := &MockUserRepository{
+			CreateUserFunc: func(ctx context.Context, input domain.UserInput) (domain.User, error) {
+				return mockUser, nil
+			},
+		}
+		jobs := &MockJobQueue{}
+		webhooks := NewWebhookService(jobs, nil, []string{"https://a.example.com/hook", "https://b.example.com/hook"})
+		service := NewUserService(repo, &MockAuditRepository{}, noTransactor{}, UserConfig{Webhooks: webhooks})
+
+		if _, err := service.CreateUser(ctx, domain.UserInput{Name: mockUser.Name, Email: mockUser.Email}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(jobs.Jobs) != 2 {
+			t.Fatalf("expected a delivery per webhook, got %+v", jobs.Jobs)
+		}
+		for i, url := range webhooks.urls {
+			job := jobs.Jobs[i]
+			delivery, _ := job.payload.(WebhookJob)
+			if job.kind != JobDeliverWebhook || delivery.URL != url || delivery.Event.Type != domain.AuditUserCreated || delivery.Event.Data.UUID != mockUser.UUID {
+				t.Errorf("expected a user.created delivery to %s, got %+v", url, job)
+			}
+		}
+		if jobs.Jobs[0].payload.(WebhookJob).Event.ID != jobs.Jobs[1].payload.(WebhookJob).Event.ID {
+			t.Errorf("expected every webhook to get the same event")
+		}
+	})
+
+	t.Run("defaults to the anonymous actor", func(t *testing.T) {
+		if actor := ActorFromContext(context.Background()); actor.ID != AnonymousActor {
+			t.Errorf("expected %q, got %q", AnonymousActor, actor.ID)
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-back/internal/auth"
+	"go-back/internal/domain"
+	"net/url"
+	"time"
+)
+
+type TokenRepository interface {
+	CreateToken(context.Context, domain.UserToken) error
+	ConsumeToken(context.Context, string, domain.TokenPurpose) (domain.UserToken, error)
+	LatestTokenAt(context.Context, string, domain.TokenPurpose) (time.Time, error)
+	RevokeTokens(context.Context, string, domain.TokenPurpose) error
+}
+
+type EmailSender interface {
+	Send(context.Context, domain.Email) error
+}
+
+// JobSendEmail jobs deliver their domain.Email payload through an
+// EmailSender. The message, with the token link it may carry, is kept in
+// the job until it is sent.
+const JobSendEmail = "email.send"
+
+type VerificationConfig struct {
+	// TTL is how long a verification token stays valid.
+	TTL time.Duration
+	// ResendInterval is the minimum time between two verification emails
+	// to the same user.
+	ResendInterval time.Duration
+	// URL is the page users open to verify their email; the token is added
+	// as its token query parameter.
+	URL string
+}
+
+type VerificationService struct {
+	userRepository  UserRepository
+	tokenRepository TokenRepository
+	auditRepository AuditRepository
+	transactor      Transactor
+	jobs            JobQueue
+	config          VerificationConfig
+}
+
+func NewVerificationService(users UserRepository, tokens TokenRepository, audit AuditRepository, tx Transactor,
+	jobs JobQueue, config VerificationConfig) VerificationService {
+	return VerificationService{
+		userRepository:  users,
+		tokenRepository: tokens,
+		auditRepository: audit,
+		transactor:      tx,
+		jobs:            jobs,
+		config:          config,
+	}
+}
+
+// RequestVerification stores a new verification token for user.Email and
+// queues the email with it. Tokens sent before stop working. Called in a
+// transaction, nothing is stored nor sent unless it commits.
+func (vs VerificationService) RequestVerification(ctx context.Context, user domain.User) error {
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	createdAt := time.Now().UTC()
+	return vs.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		if err := vs.tokenRepository.RevokeTokens(ctx, user.UUID, domain.TokenEmailVerification); err != nil {
+			return err
+		}
+		err := vs.tokenRepository.CreateToken(ctx, domain.UserToken{
+			TokenHash: hash,
+			UserUUID:  user.UUID,
+			Purpose:   domain.TokenEmailVerification,
+			Email:     user.Email,
+			CreatedAt: createdAt,
+			ExpiresAt: createdAt.Add(vs.config.TTL),
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = vs.jobs.Enqueue(ctx, JobSendEmail, domain.Email{
+			To:      user.Email,
+			Subject: "Confirm your email",
+			Body: fmt.Sprintf("Hi %s,\n\nConfirm your email by opening the link below:\n\n%s\n\nThe link expires in %s.\n",
+				user.Name, tokenLink(vs.config.URL, token), vs.config.TTL),
+		})
+		return err
+	})
+}
+
+// tokenLink adds token to the page at base, or returns the bare token when
+// there is no page to link to.
+func tokenLink(base, token string) string {
+	link, err := url.Parse(base)
+	if err != nil || base == "" {
+		return token
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String()
+}
+
+// ResendVerification mails a new token to a user whose email is not
+// verified yet, at most once per ResendInterval. The interval is checked in
+// the transaction that issues the token, so concurrent resends cannot both
+// pass it.
+func (vs VerificationService) ResendVerification(ctx context.Context, userUUID string) error {
+	if err := authorize(ctx, domain.PermUsersWrite, userUUID); err != nil {
+		return err
+	}
+
+	return vs.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		user, err := vs.userRepository.ListUserByUUID(ctx, userUUID)
+		if err != nil {
+			return err
+		}
+		if user.EmailVerifiedAt != nil {
+			return fmt.Errorf("%w: email already verified", domain.ErrConflict)
+		}
+
+		latest, err := vs.tokenRepository.LatestTokenAt(ctx, userUUID, domain.TokenEmailVerification)
+		if err != nil {
+			return err
+		}
+		if wait := time.Until(latest.Add(vs.config.ResendInterval)); wait > 0 {
+			return domain.RetryAfterError{After: wait}
+		}
+
+		return vs.RequestVerification(ctx, user)
+	})
+}
+
+// VerifyEmail consumes token and marks the email it was sent to as
+// verified. Tokens for an email the user no longer has are invalid.
+func (vs VerificationService) VerifyEmail(ctx context.Context, token string) (domain.User, error) {
+	var user domain.User
+	err := withinUserWrite(ctx, vs.transactor, func(ctx context.Context) error {
+		userToken, err := vs.tokenRepository.ConsumeToken(ctx, auth.HashOpaqueToken(token), domain.TokenEmailVerification)
+		if err != nil {
+			return err
+		}
+
+		// Whoever holds the token owns the email, so they are the actor.
+		if actor := ActorFromContext(ctx); actor.ID == AnonymousActor {
+			actor.ID = userToken.UserUUID
+			ctx = WithActor(ctx, actor)
+		}
+
+		before, err := vs.userRepository.ListUserByUUID(ctx, userToken.UserUUID)
+		if err != nil {
+			return err
+		}
+		user, err = vs.userRepository.MarkEmailVerified(ctx, userToken.UserUUID, userToken.Email)
+		if err != nil {
+			return err
+		}
+
+		changes := domain.DiffUsers(&before, &user)
+		return recordAudit(ctx, vs.auditRepository, domain.AuditEmailVerified, user.UUID, changes)
+	})
+	if errors.Is(err, domain.ErrUserNotFound) {
+		return domain.User{}, domain.ErrInvalidToken
+	}
+	if err != nil {
+		return domain.User{}, err
+	}
+	return user, nil
+}
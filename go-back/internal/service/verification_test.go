@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go-back/internal/domain"
+	"go-back/internal/storage/repository"
+)
+
+// slowTokenRepository widens the window between checking the latest token
+// and issuing the next one, so concurrent callers overlap in it.
+type slowTokenRepository struct {
+	TokenRepository
+}
+
+func (r slowTokenRepository) LatestTokenAt(ctx context.Context, userUUID string, purpose domain.TokenPurpose) (time.Time, error) {
+	latest, err := r.TokenRepository.LatestTokenAt(ctx, userUUID, purpose)
+	time.Sleep(10 * time.Millisecond)
+	return latest, err
+}
+
+func TestVerificationService_ResendVerification(t *testing.T) {
+	t.Run("sends one email to concurrent resends", func(t *testing.T) {
+		ctx := context.Background()
+		users := repository.NewMemoryUserRepository()
+		user, _ := users.CreateUser(ctx, domain.UserInput{Name: "John", Email: "john@example.com"})
+		jobs := &MockJobQueue{}
+		service := NewVerificationService(users, slowTokenRepository{repository.NewMemoryTokenRepository()}, repository.NewMemoryAuditRepository(),
+			repository.NewMemoryTransactor(), jobs, VerificationConfig{TTL: time.Hour, ResendInterval: time.Minute})
+
+		errs := make([]error, 8)
+		var wg sync.WaitGroup
+		for i := range errs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = service.ResendVerification(ctx, user.UUID)
+			}()
+		}
+		wg.Wait()
+
+		sent := 0
+		for _, err := range errs {
+			var retry domain.RetryAfterError
+			switch {
+			case err == nil:
+				sent++
+			case !errors.As(err, &retry):
+				t.Errorf("expected a retry-after error, got %v", err)
+			}
+		}
+		if sent != 1 || len(jobs.Jobs) != 1 {
+			t.Errorf("expected one resend to pass, got %d and jobs %+v", sent, jobs.Jobs)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"go-back/internal/domain"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// JobDeliverWebhook jobs POST an event to one subscriber, as a WebhookJob.
+const JobDeliverWebhook = "webhook.delivery"
+
+type WebhookSender interface {
+	Send(ctx context.Context, url string, event domain.WebhookEvent) error
+}
+
+// WebhookJob delivers Event to URL.
+type WebhookJob struct {
+	URL   string              `json:"url"`
+	Event domain.WebhookEvent `json:"event"`
+}
+
+// WebhookService tells the subscriber URLs about changes to users. Each
+// subscriber gets its own job, so one that is down does not hold back or
+// repeat the deliveries to the others.
+type WebhookService struct {
+	jobs   JobQueue
+	sender WebhookSender
+	urls   []string
+}
+
+func NewWebhookService(jobs JobQueue, sender WebhookSender, urls []string) WebhookService {
+	return WebhookService{jobs: jobs, sender: sender, urls: urls}
+}
+
+// NotifyUser queues the delivery of event about user to every subscriber.
+func (ws WebhookService) NotifyUser(ctx context.Context, event string, user domain.User) error {
+	if len(ws.urls) == 0 {
+		return nil
+	}
+
+	webhookEvent := domain.WebhookEvent{
+		ID:         uuid.NewString(),
+		Type:       event,
+		OccurredAt: time.Now().UTC(),
+		Data:       user,
+	}
+	for _, url := range ws.urls {
+		if _, err := ws.jobs.Enqueue(ctx, JobDeliverWebhook, WebhookJob{URL: url, Event: webhookEvent}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeliverWebhook runs JobDeliverWebhook jobs.
+func (ws WebhookService) DeliverWebhook(ctx context.Context, job WebhookJob) error {
+	return ws.sender.Send(ctx, job.URL, job.Event)
+}
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Store holds values for a while. Values may be dropped at any time, so
+// callers always need a way to rebuild them.
+type Store interface {
+	// Get returns the value of key, or false when there is none.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value for ttl, replacing the value of key if any.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Add stores value for ttl unless key already has a value.
+	Add(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// LRUStore keeps up to size values in process memory, dropping the least
+// recently used first. Each instance has its own, so writes made through
+// one instance are only seen by the others once the values expire.
+type LRUStore struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+func NewLRUStore(size int) *LRUStore {
+	return &LRUStore{
+		size:    max(size, 1),
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+		now:     time.Now,
+	}
+}
+
+func (s *LRUStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.lookup(key)
+	if !ok {
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+func (s *LRUStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.store(key, value, ttl)
+	return nil
+}
+
+func (s *LRUStore) Add(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.lookup(key); !ok {
+		s.store(key, value, ttl)
+	}
+	return nil
+}
+
+// lookup returns the live entry of key, marking it as recently used, and
+// drops it when it has expired.
+func (s *LRUStore) lookup(key string) (*lruEntry, bool) {
+	element, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*lruEntry)
+	if !s.now().Before(entry.expiresAt) {
+		s.order.Remove(element)
+		delete(s.entries, key)
+		return nil, false
+	}
+	s.order.MoveToFront(element)
+	return entry, true
+}
+
+func (s *LRUStore) store(key string, value []byte, ttl time.Duration) {
+	entry := &lruEntry{key: key, value: append([]byte(nil), value...), expiresAt: s.now().Add(ttl)}
+	if element, ok := s.entries[key]; ok {
+		element.Value = entry
+		s.order.MoveToFront(element)
+		return
+	}
+
+	s.entries[key] = s.order.PushFront(entry)
+	for s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*lruEntry).key)
+	}
+}
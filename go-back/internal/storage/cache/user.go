@@ -0,0 +1,228 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"go-back/internal/domain"
+	"go-back/internal/service"
+	"go-back/internal/storage/database"
+)
+
+const (
+	defaultUserTTL  = time.Minute
+	defaultUserHold = 5 * time.Second
+)
+
+// tombstone replaces a user that was just written, so reads that started
+// before the write cannot cache what it replaced. It is never valid JSON.
+var tombstone = []byte("-")
+
+type UserConfig struct {
+	// TTL is how long a user is cached, give or take a tenth so users
+	// cached together do not expire together.
+	TTL time.Duration
+	// Hold is how long a user is not cached after being written. It must
+	// outlast the reads started before the write.
+	Hold time.Duration
+}
+
+// UserRepository caches the active users read by UUID and email in front
+// of another service.UserRepository. Users are cached under their UUID,
+// and emails only point to a UUID, so a user is invalidated in one place
+// whatever it changed. Reads inside a transaction skip the cache, and
+// writes invalidate the user once their transaction commits. Concurrent
+// misses are not merged here: service.UserService already coalesces
+// identical reads in front of the cache.
+type UserRepository struct {
+	next   service.UserRepository
+	store  Store
+	config UserConfig
+}
+
+func NewUserRepository(next service.UserRepository, store Store, config UserConfig) UserRepository {
+	if config.TTL <= 0 {
+		config.TTL = defaultUserTTL
+	}
+	if config.Hold <= 0 {
+		config.Hold = defaultUserHold
+	}
+	return UserRepository{next: next, store: store, config: config}
+}
+
+func userKey(userUUID string) string {
+	return "user:uuid:" + userUUID
+}
+
+func emailKey(email string) string {
+	return "user:email:" + email
+}
+
+func (c UserRepository) ListAllUsers(ctx context.Context, filter domain.UserFilter) ([]domain.User, error) {
+	return c.next.ListAllUsers(ctx, filter)
+}
+
+func (c UserRepository) ListUserByUUID(ctx context.Context, userUUID string) (domain.User, error) {
+	if database.InTx(ctx) {
+		return c.next.ListUserByUUID(ctx, userUUID)
+	}
+	return c.load(ctx, userUUID)
+}
+
+func (c UserRepository) ListUserByUUIDWithDeleted(ctx context.Context, userUUID string) (domain.User, error) {
+	return c.next.ListUserByUUIDWithDeleted(ctx, userUUID)
+}
+
+// ListUserByEmail follows the UUID cached for email, and trusts it only
+// when that user still has email: a stale pointer costs a read, never a
+// wrong user.
+func (c UserRepository) ListUserByEmail(ctx context.Context, email string) (domain.User, error) {
+	if database.InTx(ctx) {
+		return c.next.ListUserByEmail(ctx, email)
+	}
+
+	key := emailKey(email)
+	if userUUID, ok := c.get(ctx, key); ok {
+		user, err := c.load(ctx, string(userUUID))
+		if err == nil && user.Email == email {
+			return user, nil
+		}
+		if err != nil && !errors.Is(err, domain.ErrUserNotFound) {
+			return domain.User{}, err
+		}
+	}
+
+	user, err := c.next.ListUserByEmail(ctx, email)
+	if err != nil {
+		return domain.User{}, err
+	}
+	c.add(ctx, userKey(user.UUID), user)
+	if err := c.store.Set(ctx, key, []byte(user.UUID), c.ttl()); err != nil {
+		log.Printf("cache=UserRepository func=ListUserByEmail err=%v", err)
+	}
+	return user, nil
+}
+
+func (c UserRepository) UpdateUser(ctx context.Context, user domain.User) (domain.User, error) {
+	updatedUser, err := c.next.UpdateUser(ctx, user)
+	if err != nil {
+		return domain.User{}, err
+	}
+	c.invalidate(ctx, updatedUser.UUID)
+	return updatedUser, nil
+}
+
+func (c UserRepository) ManageActivateUser(ctx context.Context, userUUID string, expectedVersion int) (domain.User, error) {
+	user, err := c.next.ManageActivateUser(ctx, userUUID, expectedVersion)
+	if err != nil {
+		return domain.User{}, err
+	}
+	c.invalidate(ctx, userUUID)
+	return user, nil
+}
+
+// CreateUser has nothing to invalidate: missing users are not cached, and
+// an email still pointing to a deleted user is checked before being used.
+func (c UserRepository) CreateUser(ctx context.Context, user domain.UserInput) (domain.User, error) {
+	return c.next.CreateUser(ctx, user)
+}
+
+func (c UserRepository) DeleteUser(ctx context.Context, userUUID string) error {
+	if err := c.next.DeleteUser(ctx, userUUID); err != nil {
+		return err
+	}
+	c.invalidate(ctx, userUUID)
+	return nil
+}
+
+func (c UserRepository) RestoreUser(ctx context.Context, userUUID string) (domain.User, error) {
+	user, err := c.next.RestoreUser(ctx, userUUID)
+	if err != nil {
+		return domain.User{}, err
+	}
+	c.invalidate(ctx, userUUID)
+	return user, nil
+}
+
+// PurgeDeletedUsers has nothing to invalidate either, since deleted users
+// are not cached.
+func (c UserRepository) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) ([]domain.User, error) {
+	return c.next.PurgeDeletedUsers(ctx, deletedBefore)
+}
+
+func (c UserRepository) MarkEmailVerified(ctx context.Context, userUUID, email string) (domain.User, error) {
+	user, err := c.next.MarkEmailVerified(ctx, userUUID, email)
+	if err != nil {
+		return domain.User{}, err
+	}
+	c.invalidate(ctx, userUUID)
+	return user, nil
+}
+
+// load reads the user from the cache, or from the database on a miss.
+func (c UserRepository) load(ctx context.Context, userUUID string) (domain.User, error) {
+	key := userKey(userUUID)
+	if value, ok := c.get(ctx, key); ok {
+		var user domain.User
+		if err := json.Unmarshal(value, &user); err == nil {
+			return user, nil
+		}
+	}
+
+	user, err := c.next.ListUserByUUID(ctx, userUUID)
+	if err != nil {
+		return domain.User{}, err
+	}
+	c.add(ctx, key, user)
+	return user, nil
+}
+
+// get returns the cached value of key, treating a failing store and a
+// tombstone as a miss.
+func (c UserRepository) get(ctx context.Context, key string) ([]byte, bool) {
+	value, ok, err := c.store.Get(ctx, key)
+	if err != nil {
+		log.Printf("cache=UserRepository func=get key=%s err=%v", key, err)
+		return nil, false
+	}
+	if !ok || string(value) == string(tombstone) {
+		return nil, false
+	}
+	return value, true
+}
+
+// add caches user unless key holds a tombstone, or another read got there
+// first.
+func (c UserRepository) add(ctx context.Context, key string, user domain.User) {
+	value, err := json.Marshal(user)
+	if err == nil {
+		err = c.store.Add(ctx, key, value, c.ttl())
+	}
+	if err != nil {
+		log.Printf("cache=UserRepository func=add key=%s err=%v", key, err)
+	}
+}
+
+// invalidate replaces the cached user with a tombstone once the write
+// commits. Were the store to fail, the user could be stale until it
+// expires.
+func (c UserRepository) invalidate(ctx context.Context, userUUID string) {
+	ctx = context.WithoutCancel(ctx)
+	database.AfterCommit(ctx, func() {
+		if err := c.store.Set(ctx, userKey(userUUID), tombstone, c.config.Hold); err != nil {
+			log.Printf("cache=UserRepository func=invalidate userUUID=%s err=%v", userUUID, err)
+		}
+	})
+}
+
+func (c UserRepository) ttl() time.Duration {
+	jitter := int64(c.config.TTL / 10)
+	if jitter <= 0 {
+		return c.config.TTL
+	}
+	return c.config.TTL - time.Duration(rand.Int64N(jitter))
+}
@@ -0,0 +1,227 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	config "go-back/internal/cmd/server"
+	"go-back/internal/domain"
+	"go-back/internal/service"
+	"go-back/internal/storage/database"
+	"go-back/internal/storage/migration"
+	"go-back/internal/storage/repository"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// countingUserRepository counts the reads that reach the repository, and
+// holds them until release is closed when it is set.
+type countingUserRepository struct {
+	service.UserRepository
+	byUUID  atomic.Int32
+	byEmail atomic.Int32
+	release chan struct{}
+}
+
+func (r *countingUserRepository) ListUserByUUID(ctx context.Context, userUUID string) (domain.User, error) {
+	r.byUUID.Add(1)
+	if r.release != nil {
+		<-r.release
+	}
+	return r.UserRepository.ListUserByUUID(ctx, userUUID)
+}
+
+func (r *countingUserRepository) ListUserByEmail(ctx context.Context, email string) (domain.User, error) {
+	r.byEmail.Add(1)
+	return r.UserRepository.ListUserByEmail(ctx, email)
+}
+
+func newSQLiteStorage(t *testing.T) (service.UserRepository, database.Transactor) {
+	t.Helper()
+	ctx := context.Background()
+
+	config.SQLITE_PATH = ":memory:"
+	db, err := database.NewSQLiteDB(ctx)
+	if err != nil {
+		t.Fatalf("expected no error opening sqlite, got %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migration.NewMigrator(db, database.SQLite)
+	if err != nil {
+		t.Fatalf("expected no error loading migrations, got %v", err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("expected no error applying migrations, got %v", err)
+	}
+
+	return repository.NewUserRepository(db, repository.QueryTimeouts{}), database.NewTransactor(db)
+}
+
+func TestUserRepository(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	stores := map[string]Store{
+		"lru":   NewLRUStore(100),
+		"redis": NewRedisStore(client),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			users, tx := newSQLiteStorage(t)
+			counting := &countingUserRepository{UserRepository: users}
+			repo := NewUserRepository(counting, store, UserConfig{TTL: time.Minute, Hold: time.Minute})
+
+			created, err := repo.CreateUser(ctx, domain.UserInput{Name: "John", Email: "john@example.com"})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			for i := 0; i < 2; i++ {
+				if user, err := repo.ListUserByUUID(ctx, created.UUID); err != nil || user.Email != created.Email {
+					t.Fatalf("expected %v, got %v, %v", created, user, err)
+				}
+				if user, err := repo.ListUserByEmail(ctx, created.Email); err != nil || user.UUID != created.UUID {
+					t.Fatalf("expected %v, got %v, %v", created, user, err)
+				}
+			}
+			if counting.byUUID.Load() != 1 || counting.byEmail.Load() != 1 {
+				t.Errorf("expected one read by uuid and one by email, got %d and %d", counting.byUUID.Load(), counting.byEmail.Load())
+			}
+
+			t.Run("keeps the user when the transaction rolls back", func(t *testing.T) {
+				failed := errors.New("rolled back")
+				err := tx.WithinTx(ctx, func(ctx context.Context) error {
+					before, err := repo.ListUserByUUID(ctx, created.UUID)
+					if err != nil {
+						return err
+					}
+					before.Name = "Rolled Back"
+					if _, err := repo.UpdateUser(ctx, before); err != nil {
+						return err
+					}
+					return failed
+				})
+				if !errors.Is(err, failed) {
+					t.Fatalf("expected the transaction to fail, got %v", err)
+				}
+
+				reads := counting.byUUID.Load()
+				if user, err := repo.ListUserByUUID(ctx, created.UUID); err != nil || user.Name != "John" || counting.byUUID.Load() != reads {
+					t.Errorf("expected the cached user, got %v, %v", user, err)
+				}
+			})
+
+			t.Run("invalidates the user once the transaction commits", func(t *testing.T) {
+				var stale domain.User
+				err := tx.WithinTx(ctx, func(ctx context.Context) error {
+					var err error
+					stale, err = repo.ListUserByUUID(ctx, created.UUID)
+					if err != nil {
+						return err
+					}
+					user := stale
+					user.Name = "Jane"
+					user.Email = "jane@example.com"
+					_, err = repo.UpdateUser(ctx, user)
+					return err
+				})
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+
+				// A read that started before the write must not cache what
+				// it read.
+				repo.add(ctx, userKey(created.UUID), stale)
+
+				if user, err := repo.ListUserByUUID(ctx, created.UUID); err != nil || user.Name != "Jane" {
+					t.Errorf("expected the updated user, got %v, %v", user, err)
+				}
+				if _, err := repo.ListUserByEmail(ctx, "john@example.com"); !errors.Is(err, domain.ErrUserNotFound) {
+					t.Errorf("expected the old email to be gone, got %v", err)
+				}
+				if user, err := repo.ListUserByEmail(ctx, "jane@example.com"); err != nil || user.UUID != created.UUID {
+					t.Errorf("expected the user by its new email, got %v, %v", user, err)
+				}
+			})
+
+			t.Run("invalidates deleted users", func(t *testing.T) {
+				if err := repo.DeleteUser(ctx, created.UUID); err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if _, err := repo.ListUserByUUID(ctx, created.UUID); !errors.Is(err, domain.ErrUserNotFound) {
+					t.Errorf("expected %v, got %v", domain.ErrUserNotFound, err)
+				}
+				if _, err := repo.ListUserByEmail(ctx, "jane@example.com"); !errors.Is(err, domain.ErrUserNotFound) {
+					t.Errorf("expected %v, got %v", domain.ErrUserNotFound, err)
+				}
+			})
+		})
+	}
+}
+
+func TestUserRepository_Stampede(t *testing.T) {
+	ctx := context.Background()
+	users := repository.NewMemoryUserRepository()
+	created, err := users.CreateUser(ctx, domain.UserInput{Name: "John", Email: "john@example.com"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Concurrent misses are merged by the user service in front of the
+	// cache, not by the cache itself.
+	counting := &countingUserRepository{UserRepository: users, release: make(chan struct{})}
+	repo := NewUserRepository(counting, NewLRUStore(100), UserConfig{})
+	userService := service.NewUserService(repo, repository.NewMemoryAuditRepository(), repository.NewMemoryTransactor(), service.UserConfig{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if user, err := userService.ListUserByUUID(ctx, created.UUID); err != nil || user.UUID != created.UUID {
+				t.Errorf("expected %v, got %v, %v", created, user, err)
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(counting.release)
+	wg.Wait()
+
+	if reads := counting.byUUID.Load(); reads != 1 {
+		t.Errorf("expected concurrent misses to share one read, got %d", reads)
+	}
+}
+
+func TestLRUStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewLRUStore(2)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	store.Set(ctx, "a", []byte("1"), time.Minute)
+	store.Set(ctx, "b", []byte("2"), time.Minute)
+	store.Add(ctx, "a", []byte("replaced"), time.Minute)
+	store.Set(ctx, "c", []byte("3"), time.Minute)
+
+	if value, ok, _ := store.Get(ctx, "a"); !ok || string(value) != "1" {
+		t.Errorf("expected Add to keep the recently used a, got %q, %v", value, ok)
+	}
+	if _, ok, _ := store.Get(ctx, "b"); ok {
+		t.Error("expected the least recently used b to be dropped")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok, _ := store.Get(ctx, "c"); ok {
+		t.Error("expected c to expire")
+	}
+}
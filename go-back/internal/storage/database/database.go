@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/vingarcia/ksql"
+)
+
+type Dialect string
+
+const (
+	Postgres Dialect = "postgres"
+	SQLite   Dialect = "sqlite"
+)
+
+// sqlAdapter lets ksql run on top of any database/sql driver.
+type sqlAdapter struct {
+	db *sql.DB
+}
+
+func (s sqlAdapter) ExecContext(ctx context.Context, query string, args ...interface{}) (ksql.Result, error) {
+	return s.db.ExecContext(ctx, query, args...)
+}
+
+func (s sqlAdapter) QueryContext(ctx context.Context, query string, args ...interface{}) (ksql.Rows, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (s sqlAdapter) BeginTx(ctx context.Context) (ksql.Tx, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return sqlTx{tx: tx}, nil
+}
+
+func (s sqlAdapter) Close() error {
+	return s.db.Close()
+}
+
+type sqlTx struct {
+	tx *sql.Tx
+}
+
+func (s sqlTx) ExecContext(ctx context.Context, query string, args ...interface{}) (ksql.Result, error) {
+	return s.tx.ExecContext(ctx, query, args...)
+}
+
+func (s sqlTx) QueryContext(ctx context.Context, query string, args ...interface{}) (ksql.Rows, error) {
+	rows, err := s.tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (s sqlTx) Rollback(ctx context.Context) error {
+	return s.tx.Rollback()
+}
+
+func (s sqlTx) Commit(ctx context.Context) error {
+	return s.tx.Commit()
+}
@@ -1,20 +1,39 @@
-package postgres
+package database
 
 import (
 	"context"
 	config "go-back/internal/cmd/server"
-	"log"
 
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/vingarcia/ksql"
 	"github.com/vingarcia/ksql/adapters/kpgx"
 )
 
-func GetDB() *ksql.DB {
-	dbConnect, err := kpgx.New(context.Background(), config.DATABASE_URL, ksql.Config{})
+func NewPostgresDB(ctx context.Context) (ksql.DB, error) {
+	pgxConf, err := pgxpool.ParseConfig(config.DATABASE_URL)
 	if err != nil {
-		log.Panic(err)
+		return ksql.DB{}, err
 	}
-	dbConnect.Exec(context.Background(), "set enable_seqscan = off;")
 
-	return &dbConnect
+	pgxConf.MaxConns = int32(config.DB_MAX_CONNS)
+	pgxConf.MinConns = int32(config.DB_MIN_CONNS)
+	pgxConf.MaxConnIdleTime = config.DB_MAX_CONN_IDLE_TIME
+	pgxConf.MaxConnLifetime = config.DB_MAX_CONN_LIFETIME
+	pgxConf.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		_, err := conn.Exec(ctx, "set enable_seqscan = off;")
+		return err
+	}
+
+	pool, err := pgxpool.ConnectConfig(ctx, pgxConf)
+	if err != nil {
+		return ksql.DB{}, err
+	}
+
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return ksql.DB{}, err
+	}
+
+	return kpgx.NewFromPgxPool(pool)
 }
@@ -0,0 +1,35 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	config "go-back/internal/cmd/server"
+
+	"github.com/vingarcia/ksql"
+	"github.com/vingarcia/ksql/sqldialect"
+	_ "modernc.org/sqlite"
+)
+
+func NewSQLiteDB(ctx context.Context) (ksql.DB, error) {
+	// _txlock=immediate takes the write lock when a transaction starts, so
+	// concurrent writers wait on busy_timeout instead of failing to upgrade.
+	dsn := "file:" + config.SQLITE_PATH +
+		"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)" +
+		"&_time_format=sqlite&_txlock=immediate"
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return ksql.DB{}, err
+	}
+
+	// SQLite serializes writers anyway; a single connection also keeps
+	// ":memory:" databases alive for the lifetime of the pool.
+	db.SetMaxOpenConns(1)
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return ksql.DB{}, err
+	}
+
+	return ksql.NewWithAdapter(sqlAdapter{db: db}, sqldialect.Sqlite3Dialect{})
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"sync"
+
+	"github.com/vingarcia/ksql"
+)
+
+type txKey struct{}
+
+// commitHooksKey carries the functions to call once the outermost
+// transaction commits.
+type commitHooksKey struct{}
+
+type commitHooks struct {
+	mu  sync.Mutex
+	fns []func()
+}
+
+// Transactor runs several repository calls in a single transaction. The
+// transaction travels in the context, and repositories pick it up through
+// Conn, so they don't need to know whether they are part of a larger unit.
+type Transactor struct {
+	db ksql.Provider
+}
+
+func NewTransactor(db ksql.Provider) Transactor {
+	return Transactor{db: db}
+}
+
+// WithinTx calls fn with a context carrying a transaction, committing it
+// when fn succeeds and rolling it back otherwise. Nested calls join the
+// outer transaction.
+func (t Transactor) WithinTx(ctx context.Context, fn func(context.Context) error) error {
+	if InTx(ctx) {
+		return Conn(ctx, t.db).Transaction(ctx, func(tx ksql.Provider) error {
+			return fn(context.WithValue(ctx, txKey{}, tx))
+		})
+	}
+
+	hooks := &commitHooks{}
+	err := t.db.Transaction(ctx, func(tx ksql.Provider) error {
+		ctx := context.WithValue(ctx, txKey{}, tx)
+		return fn(context.WithValue(ctx, commitHooksKey{}, hooks))
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, fn := range hooks.fns {
+		fn()
+	}
+	return nil
+}
+
+// InTx reports whether ctx carries a transaction.
+func (Transactor) InTx(ctx context.Context) bool {
+	return InTx(ctx)
+}
+
+// InTx reports whether ctx carries a transaction.
+func InTx(ctx context.Context) bool {
+	_, ok := ctx.Value(txKey{}).(ksql.Provider)
+	return ok
+}
+
+// AfterCommit calls fn once the transaction carried by ctx commits, and
+// never if it rolls back. Without a transaction fn is called right away.
+func AfterCommit(ctx context.Context, fn func()) {
+	hooks, ok := ctx.Value(commitHooksKey{}).(*commitHooks)
+	if !ok {
+		fn()
+		return
+	}
+	hooks.mu.Lock()
+	hooks.fns = append(hooks.fns, fn)
+	hooks.mu.Unlock()
+}
+
+// Conn returns the transaction carried by ctx, or db when there is none.
+func Conn(ctx context.Context, db ksql.Provider) ksql.Provider {
+	if tx, ok := ctx.Value(txKey{}).(ksql.Provider); ok {
+		return tx
+	}
+	return db
+}
@@ -0,0 +1,285 @@
+package migration
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"go-back/internal/storage/database"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vingarcia/ksql"
+)
+
+//go:embed postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+// lockID is the key used with pg_advisory_xact_lock so that only one
+// migrate runner touches the schema at a time. SQLite needs no explicit
+// lock: its transactions are opened with BEGIN IMMEDIATE.
+const lockID = 4_242_001
+
+var createTableQueries = map[database.Dialect]string{
+	database.Postgres: `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    BIGINT PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+	`,
+	database.SQLite: `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+	`,
+}
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+type appliedMigration struct {
+	Version   int64     `ksql:"version"`
+	Name      string    `ksql:"name"`
+	AppliedAt time.Time `ksql:"applied_at"`
+}
+
+type Migrator struct {
+	db         ksql.Provider
+	dialect    database.Dialect
+	migrations []Migration
+}
+
+func NewMigrator(db ksql.Provider, dialect database.Dialect) (Migrator, error) {
+	if _, ok := createTableQueries[dialect]; !ok {
+		return Migrator{}, fmt.Errorf("unsupported dialect %q", dialect)
+	}
+
+	migrations, err := load(files, string(dialect))
+	if err != nil {
+		return Migrator{}, err
+	}
+
+	return Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+func (m Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.locked(ctx, func(tx ksql.Provider, current map[int64]appliedMigration) error {
+		for _, migration := range m.migrations {
+			if _, ok := current[migration.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, tx, migration); err != nil {
+				return err
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+func (m Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.locked(ctx, func(tx ksql.Provider, current map[int64]appliedMigration) error {
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := current[migration.Version]; !ok {
+				continue
+			}
+			if err := m.revert(ctx, tx, migration); err != nil {
+				return err
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+func (m Migrator) Redo(ctx context.Context) (Migration, error) {
+	var redone Migration
+	err := m.locked(ctx, func(tx ksql.Provider, current map[int64]appliedMigration) error {
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := current[migration.Version]; !ok {
+				continue
+			}
+			if err := m.revert(ctx, tx, migration); err != nil {
+				return err
+			}
+			if err := m.apply(ctx, tx, migration); err != nil {
+				return err
+			}
+			redone = migration
+			return nil
+		}
+		return fmt.Errorf("no applied migration to redo")
+	})
+	return redone, err
+}
+
+func (m Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.ensureTable(ctx, m.db); err != nil {
+		return nil, err
+	}
+
+	current, err := m.applied(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if row, ok := current[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+func (m Migrator) locked(ctx context.Context, fn func(ksql.Provider, map[int64]appliedMigration) error) error {
+	return m.db.Transaction(ctx, func(tx ksql.Provider) error {
+		if m.dialect == database.Postgres {
+			if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", lockID); err != nil {
+				return fmt.Errorf("acquiring migration lock: %w", err)
+			}
+		}
+
+		if err := m.ensureTable(ctx, tx); err != nil {
+			return err
+		}
+
+		current, err := m.applied(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		return fn(tx, current)
+	})
+}
+
+func (Migrator) apply(ctx context.Context, tx ksql.Provider, migration Migration) error {
+	if _, err := tx.Exec(ctx, migration.Up); err != nil {
+		return fmt.Errorf("applying migration %04d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	_, err := tx.Exec(ctx, `
+		INSERT INTO schema_migrations (version, name, applied_at)
+		VALUES ($1, $2, $3);
+	`, migration.Version, migration.Name, time.Now().UTC())
+	return err
+}
+
+func (Migrator) revert(ctx context.Context, tx ksql.Provider, migration Migration) error {
+	if _, err := tx.Exec(ctx, migration.Down); err != nil {
+		return fmt.Errorf("reverting migration %04d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	_, err := tx.Exec(ctx, `
+		DELETE FROM schema_migrations
+		WHERE version = $1;
+	`, migration.Version)
+	return err
+}
+
+func (m Migrator) ensureTable(ctx context.Context, db ksql.Provider) error {
+	_, err := db.Exec(ctx, createTableQueries[m.dialect])
+	return err
+}
+
+func (Migrator) applied(ctx context.Context, db ksql.Provider) (map[int64]appliedMigration, error) {
+	var rows []appliedMigration
+	err := db.Query(ctx, &rows, `
+		SELECT version, name, applied_at
+		FROM schema_migrations
+		ORDER BY version
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[int64]appliedMigration, len(rows))
+	for _, row := range rows {
+		current[row.Version] = row
+	}
+	return current, nil
+}
+
+// load reads every "<version>_<name>.<up|down>.sql" file in dir and pairs
+// them into migrations sorted by version.
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		fileName := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(fileName, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name %q", fileName)
+		}
+
+		rawVersion, name, ok := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(rawVersion, 10, 64)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid migration version in %q", fileName)
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, fileName))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if migration.Name != name {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, migration.Name, name)
+		}
+
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s must have both up and down files", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
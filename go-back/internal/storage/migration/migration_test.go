@@ -0,0 +1,71 @@
+package migration
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("pairs up and down files sorted by version", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"sql/0002_add_column.up.sql":   {Data: []byte("ALTER TABLE t ADD COLUMN c TEXT;")},
+			"sql/0002_add_column.down.sql": {Data: []byte("ALTER TABLE t DROP COLUMN c;")},
+			"sql/0001_create_t.up.sql":     {Data: []byte("CREATE TABLE t (id INT);")},
+			"sql/0001_create_t.down.sql":   {Data: []byte("DROP TABLE t;")},
+		}
+
+		migrations, err := load(fsys, "sql")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(migrations) != 2 {
+			t.Fatalf("expected 2 migrations, got %d", len(migrations))
+		}
+		if migrations[0].Version != 1 || migrations[0].Name != "create_t" {
+			t.Errorf("expected first migration to be 0001_create_t, got %04d_%s", migrations[0].Version, migrations[0].Name)
+		}
+		if migrations[1].Down != "ALTER TABLE t DROP COLUMN c;" {
+			t.Errorf("unexpected down script %q", migrations[1].Down)
+		}
+	})
+
+	t.Run("returns error when a down file is missing", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"sql/0001_create_t.up.sql": {Data: []byte("CREATE TABLE t (id INT);")},
+		}
+
+		if _, err := load(fsys, "sql"); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+
+	t.Run("returns error for malformed file names", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"sql/create_t.sql": {Data: []byte("CREATE TABLE t (id INT);")},
+		}
+
+		if _, err := load(fsys, "sql"); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	postgres, err := load(files, "postgres")
+	if err != nil {
+		t.Fatalf("expected postgres migrations to load, got %v", err)
+	}
+	sqlite, err := load(files, "sqlite")
+	if err != nil {
+		t.Fatalf("expected sqlite migrations to load, got %v", err)
+	}
+	if len(postgres) == 0 || len(postgres) != len(sqlite) {
+		t.Fatalf("expected the same migrations for every dialect, got %d postgres and %d sqlite", len(postgres), len(sqlite))
+	}
+	for i := range postgres {
+		if postgres[i].Version != sqlite[i].Version || postgres[i].Name != sqlite[i].Name {
+			t.Errorf("expected matching migration at %d, got %04d_%s and %04d_%s", i,
+				postgres[i].Version, postgres[i].Name, sqlite[i].Version, sqlite[i].Name)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS users (
+	uuid       UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	name       TEXT NOT NULL,
+	email      TEXT NOT NULL,
+	is_active  BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_key ON users (email);
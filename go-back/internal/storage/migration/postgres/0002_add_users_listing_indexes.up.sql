@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS users_created_at_uuid_idx ON users (created_at, uuid);
+CREATE INDEX IF NOT EXISTS users_updated_at_uuid_idx ON users (updated_at, uuid);
+CREATE INDEX IF NOT EXISTS users_name_uuid_idx ON users (name, uuid);
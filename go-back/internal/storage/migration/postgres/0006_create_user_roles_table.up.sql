@@ -0,0 +1,8 @@
+-- The self role is implicit for every user, so only the others are stored.
+CREATE TABLE IF NOT EXISTS user_roles (
+	user_uuid  UUID NOT NULL REFERENCES users (uuid) ON DELETE CASCADE,
+	role       TEXT NOT NULL CHECK (role IN ('admin', 'support', 'viewer')),
+	granted_by TEXT NOT NULL,
+	granted_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (user_uuid, role)
+);
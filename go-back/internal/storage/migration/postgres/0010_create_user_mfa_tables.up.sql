@@ -0,0 +1,20 @@
+-- TOTP secrets of users with MFA. A row without confirmed_at is an
+-- enrollment waiting for its first code; last_used_step blocks replays.
+CREATE TABLE IF NOT EXISTS user_mfa (
+	user_uuid      UUID PRIMARY KEY REFERENCES users (uuid) ON DELETE CASCADE,
+	secret         TEXT NOT NULL,
+	confirmed_at   TIMESTAMPTZ,
+	last_used_step BIGINT NOT NULL DEFAULT 0,
+	created_at     TIMESTAMPTZ NOT NULL,
+	updated_at     TIMESTAMPTZ NOT NULL
+);
+
+-- One-time recovery codes, stored as SHA-256 like user_tokens.
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+	code_hash  TEXT PRIMARY KEY,
+	user_uuid  UUID NOT NULL REFERENCES users (uuid) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ NOT NULL,
+	used_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS user_recovery_codes_user_idx ON user_recovery_codes (user_uuid);
@@ -0,0 +1,28 @@
+-- Logins of users, one per device. amr lists the authentication methods of
+-- the login, space separated.
+CREATE TABLE IF NOT EXISTS user_sessions (
+	id             UUID PRIMARY KEY,
+	user_uuid      UUID NOT NULL REFERENCES users (uuid) ON DELETE CASCADE,
+	user_agent     TEXT NOT NULL,
+	ip             TEXT NOT NULL,
+	amr            TEXT NOT NULL,
+	created_at     TIMESTAMPTZ NOT NULL,
+	last_used_at   TIMESTAMPTZ NOT NULL,
+	expires_at     TIMESTAMPTZ NOT NULL,
+	revoked_at     TIMESTAMPTZ,
+	revoked_reason TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS user_sessions_user_idx ON user_sessions (user_uuid, revoked_at);
+
+-- Refresh tokens of a session, stored as SHA-256. Rotated tokens are kept
+-- with used_at set so their reuse can be detected.
+CREATE TABLE IF NOT EXISTS session_refresh_tokens (
+	token_hash TEXT PRIMARY KEY,
+	session_id UUID NOT NULL REFERENCES user_sessions (id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	used_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS session_refresh_tokens_session_idx ON session_refresh_tokens (session_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS audit_events_seq_idx;
+ALTER TABLE audit_events DROP COLUMN seq;
+DROP SEQUENCE IF EXISTS audit_events_seq_seq;
@@ -0,0 +1,17 @@
+-- seq orders events by insertion: created_at ties for events written in
+-- the same microsecond, and uuid is random. Existing events are numbered
+-- in their previous order.
+ALTER TABLE audit_events ADD COLUMN seq BIGINT;
+CREATE SEQUENCE IF NOT EXISTS audit_events_seq_seq OWNED BY audit_events.seq;
+
+UPDATE audit_events
+SET seq = ordered.n
+FROM (SELECT uuid, ROW_NUMBER() OVER (ORDER BY created_at, uuid) AS n FROM audit_events) AS ordered
+WHERE audit_events.uuid = ordered.uuid;
+SELECT setval('audit_events_seq_seq', COALESCE(MAX(seq), 0) + 1, false) FROM audit_events;
+
+ALTER TABLE audit_events
+	ALTER COLUMN seq SET DEFAULT nextval('audit_events_seq_seq'),
+	ALTER COLUMN seq SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS audit_events_seq_idx ON audit_events (seq);
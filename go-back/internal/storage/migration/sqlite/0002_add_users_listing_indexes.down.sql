@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS users_name_uuid_idx;
+DROP INDEX IF EXISTS users_updated_at_uuid_idx;
+DROP INDEX IF EXISTS users_created_at_uuid_idx;
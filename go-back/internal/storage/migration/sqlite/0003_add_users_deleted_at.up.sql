@@ -0,0 +1,6 @@
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP;
+
+-- Deleted users keep their email, so uniqueness only applies to live rows.
+DROP INDEX IF EXISTS users_email_key;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_key ON users (email) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS users_deleted_at_idx ON users (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,16 @@
+-- actor and target_uuid are free text: actors are not always users
+-- ("system" for background jobs) and events outlive purged users.
+CREATE TABLE IF NOT EXISTS audit_events (
+	uuid        TEXT PRIMARY KEY,
+	actor       TEXT NOT NULL,
+	action      TEXT NOT NULL,
+	target_uuid TEXT NOT NULL,
+	changes     TEXT NOT NULL,
+	request_id  TEXT NOT NULL DEFAULT '',
+	ip          TEXT NOT NULL DEFAULT '',
+	created_at  TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_created_at_uuid_idx ON audit_events (created_at, uuid);
+CREATE INDEX IF NOT EXISTS audit_events_target_uuid_idx ON audit_events (target_uuid, created_at);
+CREATE INDEX IF NOT EXISTS audit_events_actor_idx ON audit_events (actor, created_at);
@@ -0,0 +1,7 @@
+-- Password hashes are kept apart from users so profile reads never load them.
+CREATE TABLE IF NOT EXISTS user_credentials (
+	user_uuid           TEXT PRIMARY KEY REFERENCES users (uuid) ON DELETE CASCADE,
+	password_hash       TEXT NOT NULL,
+	password_changed_at TIMESTAMP NOT NULL,
+	updated_at          TIMESTAMP NOT NULL
+);
@@ -0,0 +1,13 @@
+-- Single-use tokens mailed to users. Only a SHA-256 of each token is stored;
+-- email is the address a verification token was sent to.
+CREATE TABLE IF NOT EXISTS user_tokens (
+	token_hash TEXT PRIMARY KEY,
+	user_uuid  TEXT NOT NULL REFERENCES users (uuid) ON DELETE CASCADE,
+	purpose    TEXT NOT NULL,
+	email      TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at    TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS user_tokens_user_purpose_idx ON user_tokens (user_uuid, purpose, created_at);
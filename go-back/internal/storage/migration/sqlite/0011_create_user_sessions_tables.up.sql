@@ -0,0 +1,28 @@
+-- Logins of users, one per device. amr lists the authentication methods of
+-- the login, space separated.
+CREATE TABLE IF NOT EXISTS user_sessions (
+	id             TEXT PRIMARY KEY,
+	user_uuid      TEXT NOT NULL REFERENCES users (uuid) ON DELETE CASCADE,
+	user_agent     TEXT NOT NULL,
+	ip             TEXT NOT NULL,
+	amr            TEXT NOT NULL,
+	created_at     TIMESTAMP NOT NULL,
+	last_used_at   TIMESTAMP NOT NULL,
+	expires_at     TIMESTAMP NOT NULL,
+	revoked_at     TIMESTAMP,
+	revoked_reason TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS user_sessions_user_idx ON user_sessions (user_uuid, revoked_at);
+
+-- Refresh tokens of a session, stored as SHA-256. Rotated tokens are kept
+-- with used_at set so their reuse can be detected.
+CREATE TABLE IF NOT EXISTS session_refresh_tokens (
+	token_hash TEXT PRIMARY KEY,
+	session_id TEXT NOT NULL REFERENCES user_sessions (id) ON DELETE CASCADE,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at    TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS session_refresh_tokens_session_idx ON session_refresh_tokens (session_id);
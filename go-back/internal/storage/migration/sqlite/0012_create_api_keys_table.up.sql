@@ -0,0 +1,17 @@
+-- Keys of services calling the API. Only the SHA-256 of the secret part is
+-- stored; scopes is a JSON array of permissions. created_by is free text,
+-- like audit actors.
+CREATE TABLE IF NOT EXISTS api_keys (
+	id           TEXT PRIMARY KEY,
+	name         TEXT NOT NULL,
+	prefix       TEXT NOT NULL UNIQUE,
+	secret_hash  TEXT NOT NULL,
+	scopes       TEXT NOT NULL,
+	rate_limit   INTEGER NOT NULL DEFAULT 0,
+	created_by   TEXT NOT NULL,
+	created_at   TIMESTAMP NOT NULL,
+	updated_at   TIMESTAMP NOT NULL,
+	expires_at   TIMESTAMP,
+	last_used_at TIMESTAMP,
+	revoked_at   TIMESTAMP
+);
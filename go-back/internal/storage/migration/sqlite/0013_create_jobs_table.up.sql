@@ -0,0 +1,18 @@
+-- Background jobs. Workers claim due jobs in a write transaction, which
+-- SQLite serializes, and hold them until locked_until; jobs that succeed
+-- are deleted and jobs out of attempts stay as dead.
+CREATE TABLE IF NOT EXISTS jobs (
+	id           TEXT PRIMARY KEY,
+	kind         TEXT NOT NULL,
+	payload      TEXT NOT NULL,
+	status       TEXT NOT NULL,
+	attempts     INTEGER NOT NULL DEFAULT 0,
+	max_attempts INTEGER NOT NULL,
+	run_at       TIMESTAMP NOT NULL,
+	locked_until TIMESTAMP,
+	last_error   TEXT NOT NULL DEFAULT '',
+	created_at   TIMESTAMP NOT NULL,
+	updated_at   TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS jobs_status_run_at_idx ON jobs (status, run_at);
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS audit_events_seq_trigger;
+DROP INDEX IF EXISTS audit_events_seq_idx;
+ALTER TABLE audit_events DROP COLUMN seq;
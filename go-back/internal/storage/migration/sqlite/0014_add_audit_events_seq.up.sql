@@ -0,0 +1,21 @@
+-- seq orders events by insertion: created_at ties for events written in
+-- the same microsecond, and uuid is random. Existing events are numbered
+-- in their previous order. SQLite has no sequences, so the trigger numbers
+-- new events; writes are serialized, which keeps MAX(seq) + 1 unique.
+ALTER TABLE audit_events ADD COLUMN seq INTEGER;
+
+UPDATE audit_events
+SET seq = (
+	SELECT COUNT(*) FROM audit_events AS earlier
+	WHERE (earlier.created_at, earlier.uuid) <= (audit_events.created_at, audit_events.uuid)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS audit_events_seq_idx ON audit_events (seq);
+
+CREATE TRIGGER IF NOT EXISTS audit_events_seq_trigger AFTER INSERT ON audit_events
+WHEN NEW.seq IS NULL
+BEGIN
+	UPDATE audit_events
+	SET seq = (SELECT COALESCE(MAX(seq), 0) + 1 FROM audit_events)
+	WHERE rowid = NEW.rowid;
+END;
@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-back/internal/domain"
+	"go-back/internal/storage/database"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vingarcia/ksql"
+)
+
+type APIKeyRepository struct {
+	db       ksql.Provider
+	timeouts QueryTimeouts
+}
+
+func NewAPIKeyRepository(db ksql.Provider, timeouts QueryTimeouts) APIKeyRepository {
+	return APIKeyRepository{db: db, timeouts: timeouts}
+}
+
+// CreateAPIKey stores key with a new ID, created now.
+func (r APIKeyRepository) CreateAPIKey(ctx context.Context, key domain.APIKey) (domain.APIKey, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	key.ID = uuid.NewString()
+	key.CreatedAt = now()
+	key.UpdatedAt = key.CreatedAt
+	scopes, err := json.Marshal(key.Scopes)
+	if err != nil {
+		return domain.APIKey{}, err
+	}
+
+	_, err = database.Conn(ctx, r.db).Exec(ctx, r.createAPIKeyQuery(),
+		key.ID, key.Name, key.Prefix, key.SecretHash, string(scopes), key.RateLimit,
+		key.CreatedBy, key.CreatedAt, key.UpdatedAt, nullableUTC(key.ExpiresAt))
+	if err != nil {
+		return domain.APIKey{}, translateError(err)
+	}
+	return key, nil
+}
+
+// GetAPIKey returns the key with id unless it was revoked.
+func (r APIKeyRepository) GetAPIKey(ctx context.Context, id string) (domain.APIKey, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return domain.APIKey{}, domain.ErrAPIKeyNotFound
+	}
+	return r.getAPIKey(ctx, r.getAPIKeyQuery(), id)
+}
+
+// GetAPIKeyByPrefix returns the key with prefix unless it was revoked.
+func (r APIKeyRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (domain.APIKey, error) {
+	return r.getAPIKey(ctx, r.getAPIKeyByPrefixQuery(), prefix)
+}
+
+func (r APIKeyRepository) getAPIKey(ctx context.Context, query string, param string) (domain.APIKey, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	var key domain.APIKey
+	err := database.Conn(ctx, r.db).QueryOne(ctx, &key, query, param)
+	if errors.Is(err, ksql.ErrRecordNotFound) {
+		return domain.APIKey{}, domain.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return domain.APIKey{}, translateError(err)
+	}
+	return key, nil
+}
+
+// ListAPIKeys returns the keys not revoked, expired ones included, newest
+// first.
+func (r APIKeyRepository) ListAPIKeys(ctx context.Context) ([]domain.APIKey, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	keys := []domain.APIKey{}
+	if err := database.Conn(ctx, r.db).Query(ctx, &keys, r.listAPIKeysQuery()); err != nil {
+		return nil, translateError(err)
+	}
+	return keys, nil
+}
+
+// UpdateAPIKey replaces the name, scopes, rate limit and expiry of key.
+func (r APIKeyRepository) UpdateAPIKey(ctx context.Context, key domain.APIKey) (domain.APIKey, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	if _, err := uuid.Parse(key.ID); err != nil {
+		return domain.APIKey{}, domain.ErrAPIKeyNotFound
+	}
+	scopes, err := json.Marshal(key.Scopes)
+	if err != nil {
+		return domain.APIKey{}, err
+	}
+
+	var updated domain.APIKey
+	err = database.Conn(ctx, r.db).Transaction(ctx, func(tx ksql.Provider) error {
+		result, err := tx.Exec(ctx, r.updateAPIKeyQuery(),
+			key.Name, string(scopes), key.RateLimit, nullableUTC(key.ExpiresAt), now(), key.ID)
+		if err != nil {
+			return err
+		}
+		if err := expectAffected(result); err != nil {
+			return err
+		}
+		return tx.QueryOne(ctx, &updated, r.getAPIKeyQuery(), key.ID)
+	})
+	if errors.Is(err, ksql.ErrRecordNotFound) {
+		return domain.APIKey{}, domain.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return domain.APIKey{}, translateError(err)
+	}
+	return updated, nil
+}
+
+func (r APIKeyRepository) RevokeAPIKey(ctx context.Context, id string) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	if _, err := uuid.Parse(id); err != nil {
+		return domain.ErrAPIKeyNotFound
+	}
+
+	result, err := database.Conn(ctx, r.db).Exec(ctx, r.revokeAPIKeyQuery(), now(), id)
+	if err == nil {
+		err = expectAffected(result)
+	}
+	if errors.Is(err, ksql.ErrRecordNotFound) {
+		return domain.ErrAPIKeyNotFound
+	}
+	return translateError(err)
+}
+
+// TouchAPIKey records that the key with id was used at usedAt.
+func (r APIKeyRepository) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	_, err := database.Conn(ctx, r.db).Exec(ctx, r.touchAPIKeyQuery(), usedAt.UTC(), id)
+	return translateError(err)
+}
+
+// nullableUTC passes t in UTC, or NULL when it is nil.
+func nullableUTC(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+func (APIKeyRepository) createAPIKeyQuery() string {
+	return `
+		INSERT INTO api_keys (id, name, prefix, secret_hash, scopes, rate_limit, created_by, created_at, updated_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);
+	`
+}
+
+func (APIKeyRepository) getAPIKeyQuery() string {
+	return `
+		SELECT id, name, prefix, secret_hash, scopes, rate_limit, created_by, created_at, updated_at, expires_at, last_used_at
+		FROM api_keys
+		WHERE id = $1
+		  AND revoked_at IS NULL;
+	`
+}
+
+func (APIKeyRepository) getAPIKeyByPrefixQuery() string {
+	return `
+		SELECT id, name, prefix, secret_hash, scopes, rate_limit, created_by, created_at, updated_at, expires_at, last_used_at
+		FROM api_keys
+		WHERE prefix = $1
+		  AND revoked_at IS NULL;
+	`
+}
+
+func (APIKeyRepository) listAPIKeysQuery() string {
+	return `
+		SELECT id, name, prefix, secret_hash, scopes, rate_limit, created_by, created_at, updated_at, expires_at, last_used_at
+		FROM api_keys
+		WHERE revoked_at IS NULL
+		ORDER BY created_at DESC;
+	`
+}
+
+func (APIKeyRepository) updateAPIKeyQuery() string {
+	return `
+		UPDATE api_keys
+		SET name = $1,
+		    scopes = $2,
+		    rate_limit = $3,
+		    expires_at = $4,
+		    updated_at = $5
+		WHERE id = $6
+		  AND revoked_at IS NULL;
+	`
+}
+
+func (APIKeyRepository) revokeAPIKeyQuery() string {
+	return `
+		UPDATE api_keys
+		SET revoked_at = $1
+		WHERE id = $2
+		  AND revoked_at IS NULL;
+	`
+}
+
+func (APIKeyRepository) touchAPIKeyQuery() string {
+	return `
+		UPDATE api_keys
+		SET last_used_at = $1
+		WHERE id = $2;
+	`
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-back/internal/domain"
+)
+
+type apiKeyStore interface {
+	CreateAPIKey(context.Context, domain.APIKey) (domain.APIKey, error)
+	GetAPIKey(context.Context, string) (domain.APIKey, error)
+	GetAPIKeyByPrefix(context.Context, string) (domain.APIKey, error)
+	ListAPIKeys(context.Context) ([]domain.APIKey, error)
+	UpdateAPIKey(context.Context, domain.APIKey) (domain.APIKey, error)
+	RevokeAPIKey(context.Context, string) error
+	TouchAPIKey(context.Context, string, time.Time) error
+}
+
+func TestAPIKeyRepository(t *testing.T) {
+	backends := map[string]func(*testing.T) apiKeyStore{
+		"memory": func(*testing.T) apiKeyStore { return NewMemoryAPIKeyRepository() },
+		"sqlite": func(t *testing.T) apiKeyStore {
+			return NewAPIKeyRepository(newSQLiteUserRepository(t).db, QueryTimeouts{})
+		},
+	}
+
+	for name, newRepo := range backends {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := newRepo(t)
+
+			expiresAt := now().Add(time.Hour)
+			created, err := repo.CreateAPIKey(ctx, domain.APIKey{
+				Name: "batch", Prefix: "abcd1234", SecretHash: "hash", CreatedBy: "admin",
+				Scopes: []domain.Permission{domain.PermUsersRead, domain.PermUsersWrite}, RateLimit: 60, ExpiresAt: &expiresAt,
+			})
+			if err != nil || created.ID == "" {
+				t.Fatalf("expected a key, got %+v, %v", created, err)
+			}
+			if _, err := repo.CreateAPIKey(ctx, domain.APIKey{Name: "other", Prefix: "abcd1234", Scopes: []domain.Permission{}}); !errors.Is(err, domain.ErrConflict) {
+				t.Errorf("expected a taken prefix to conflict, got %v", err)
+			}
+
+			key, err := repo.GetAPIKeyByPrefix(ctx, "abcd1234")
+			if err != nil || key.ID != created.ID || key.SecretHash != "hash" || len(key.Scopes) != 2 || key.Scopes[1] != domain.PermUsersWrite ||
+				key.ExpiresAt == nil || !key.ExpiresAt.Equal(expiresAt) || key.LastUsedAt != nil {
+				t.Fatalf("expected the key back, got %+v, %v", key, err)
+			}
+
+			usedAt := now()
+			if err := repo.TouchAPIKey(ctx, created.ID, usedAt); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			key.Name = "nightly batch"
+			key.Scopes = []domain.Permission{domain.PermUsersRead}
+			key.ExpiresAt = nil
+			updated, err := repo.UpdateAPIKey(ctx, key)
+			if err != nil || updated.Name != "nightly batch" || len(updated.Scopes) != 1 || updated.ExpiresAt != nil ||
+				updated.LastUsedAt == nil || !updated.LastUsedAt.Equal(usedAt) {
+				t.Fatalf("expected the update and the last use, got %+v, %v", updated, err)
+			}
+
+			if keys, err := repo.ListAPIKeys(ctx); err != nil || len(keys) != 1 {
+				t.Errorf("expected 1 key, got %+v, %v", keys, err)
+			}
+
+			if err := repo.RevokeAPIKey(ctx, created.ID); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if _, err := repo.GetAPIKeyByPrefix(ctx, "abcd1234"); !errors.Is(err, domain.ErrAPIKeyNotFound) {
+				t.Errorf("expected a revoked key to be gone, got %v", err)
+			}
+			if _, err := repo.UpdateAPIKey(ctx, key); !errors.Is(err, domain.ErrAPIKeyNotFound) {
+				t.Errorf("expected ErrAPIKeyNotFound, got %v", err)
+			}
+			if err := repo.RevokeAPIKey(ctx, "not-a-uuid"); !errors.Is(err, domain.ErrAPIKeyNotFound) {
+				t.Errorf("expected ErrAPIKeyNotFound, got %v", err)
+			}
+			if keys, _ := repo.ListAPIKeys(ctx); len(keys) != 0 {
+				t.Errorf("expected no key, got %+v", keys)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"go-back/internal/domain"
+	"go-back/internal/storage/database"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/vingarcia/ksql"
+)
+
+const auditEventColumns = "uuid, actor, action, target_uuid, changes, request_id, ip, created_at, seq"
+
+type AuditRepository struct {
+	db       ksql.Provider
+	timeouts QueryTimeouts
+}
+
+func NewAuditRepository(db ksql.Provider, timeouts QueryTimeouts) AuditRepository {
+	return AuditRepository{db: db, timeouts: timeouts}
+}
+
+// CreateAuditEvent joins the caller's transaction, if any, so the event is
+// only kept when the mutation it describes is committed.
+func (a AuditRepository) CreateAuditEvent(ctx context.Context, event domain.AuditEvent) (domain.AuditEvent, error) {
+	ctx, cancel := withTimeout(ctx, a.timeouts.Write)
+	defer cancel()
+
+	event.UUID = uuid.NewString()
+	event.CreatedAt = now()
+	if event.Changes == nil {
+		event.Changes = map[string]domain.FieldChange{}
+	}
+
+	changes, err := json.Marshal(event.Changes)
+	if err != nil {
+		return domain.AuditEvent{}, err
+	}
+
+	_, err = database.Conn(ctx, a.db).Exec(ctx, a.createAuditEventQuery(),
+		event.UUID, event.Actor, event.Action, event.TargetUUID,
+		string(changes), event.RequestID, event.IP, event.CreatedAt)
+	if err != nil {
+		return domain.AuditEvent{}, translateError(err)
+	}
+
+	return event, nil
+}
+
+func (a AuditRepository) ListAuditEvents(ctx context.Context, filter domain.AuditFilter) ([]domain.AuditEvent, error) {
+	ctx, cancel := withTimeout(ctx, a.timeouts.Read)
+	defer cancel()
+
+	query, params := a.getAuditEventsQuery(filter)
+
+	var events []domain.AuditEvent
+	if err := database.Conn(ctx, a.db).Query(ctx, &events, query, params...); err != nil {
+		return nil, translateError(err)
+	}
+
+	return events, nil
+}
+
+func (AuditRepository) createAuditEventQuery() string {
+	return `
+		INSERT INTO audit_events (uuid, actor, action, target_uuid, changes, request_id, ip, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
+	`
+}
+
+// getAuditEventsQuery lists events newest first, paginated by keyset on
+// seq.
+func (AuditRepository) getAuditEventsQuery(filter domain.AuditFilter) (string, []interface{}) {
+	var conditions []string
+	var params []interface{}
+	param := func(value interface{}) string {
+		params = append(params, value)
+		return "$" + strconv.Itoa(len(params))
+	}
+
+	if filter.Target != "" {
+		conditions = append(conditions, "target_uuid = "+param(filter.Target))
+	}
+	if filter.Actor != "" {
+		conditions = append(conditions, "actor = "+param(filter.Actor))
+	}
+	if filter.Since != nil {
+		conditions = append(conditions, "created_at >= "+param(filter.Since.UTC()))
+	}
+	if filter.After != nil {
+		conditions = append(conditions, "seq < "+param(filter.After.Seq))
+	}
+
+	query := `
+		SELECT ` + auditEventColumns + `
+		FROM audit_events`
+	if len(conditions) > 0 {
+		query += "\n\t\tWHERE " + strings.Join(conditions, "\n\t\t  AND ")
+	}
+	query += "\n\t\tORDER BY seq DESC"
+	if filter.Limit > 0 {
+		query += "\n\t\tLIMIT " + param(filter.Limit)
+	}
+
+	return query, params
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-back/internal/domain"
+	"go-back/internal/storage/database"
+)
+
+type auditStore interface {
+	CreateAuditEvent(context.Context, domain.AuditEvent) (domain.AuditEvent, error)
+	ListAuditEvents(context.Context, domain.AuditFilter) ([]domain.AuditEvent, error)
+}
+
+func TestAuditRepository(t *testing.T) {
+	backends := map[string]func(*testing.T) auditStore{
+		"memory": func(*testing.T) auditStore { return NewMemoryAuditRepository() },
+		"sqlite": func(t *testing.T) auditStore {
+			return NewAuditRepository(newSQLiteUserRepository(t).db, QueryTimeouts{})
+		},
+	}
+
+	for name, newRepo := range backends {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := newRepo(t)
+
+			start := time.Now().UTC().Add(-time.Second)
+			for _, event := range []domain.AuditEvent{
+				{Actor: "admin", Action: domain.AuditUserCreated, TargetUUID: "u1"},
+				{Actor: "admin", Action: domain.AuditUserDeactivated, TargetUUID: "u1",
+					Changes: map[string]domain.FieldChange{"is_active": {From: true, To: false}}},
+				{Actor: "support", Action: domain.AuditUserUpdated, TargetUUID: "u2"},
+			} {
+				if _, err := repo.CreateAuditEvent(ctx, event); err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+			}
+			// Events written in one transaction may share created_at, so
+			// the order must not depend on it.
+			tieCreatedAt(t, repo)
+
+			t.Run("lists newest first with keyset pagination", func(t *testing.T) {
+				events, err := repo.ListAuditEvents(ctx, domain.AuditFilter{Limit: 2})
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if len(events) != 2 || events[0].Action != domain.AuditUserUpdated {
+					t.Fatalf("expected newest 2 events, got %v", events)
+				}
+
+				last := events[1]
+				events, _ = repo.ListAuditEvents(ctx, domain.AuditFilter{
+					Limit: 2,
+					After: &domain.AuditCursor{Seq: last.Seq},
+				})
+				if len(events) != 1 || events[0].Action != domain.AuditUserCreated {
+					t.Errorf("expected the oldest event on the last page, got %v", events)
+				}
+			})
+
+			t.Run("filters by target, actor and since", func(t *testing.T) {
+				events, _ := repo.ListAuditEvents(ctx, domain.AuditFilter{Target: "u1", Actor: "admin"})
+				if len(events) != 2 {
+					t.Fatalf("expected 2 events, got %v", events)
+				}
+				change := events[0].Changes["is_active"]
+				if change.From != true || change.To != false {
+					t.Errorf("expected is_active diff to round trip, got %v", events[0].Changes)
+				}
+
+				later := time.Now().Add(time.Hour)
+				if events, _ := repo.ListAuditEvents(ctx, domain.AuditFilter{Since: &start}); len(events) != 3 {
+					t.Errorf("expected 3 events since %v, got %v", start, events)
+				}
+				if events, _ := repo.ListAuditEvents(ctx, domain.AuditFilter{Since: &later}); len(events) != 0 {
+					t.Errorf("expected no events since %v, got %v", later, events)
+				}
+			})
+		})
+	}
+}
+
+// tieCreatedAt gives every event of repo the created_at of the oldest.
+func tieCreatedAt(t *testing.T, repo auditStore) {
+	t.Helper()
+	switch repo := repo.(type) {
+	case *MemoryAuditRepository:
+		for i := range repo.events {
+			repo.events[i].CreatedAt = repo.events[0].CreatedAt
+		}
+	case AuditRepository:
+		_, err := repo.db.Exec(context.Background(), "UPDATE audit_events SET created_at = (SELECT MIN(created_at) FROM audit_events)")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+}
+
+func TestTransactor_SQLite(t *testing.T) {
+	ctx := context.Background()
+	users := newSQLiteUserRepository(t)
+	audit := NewAuditRepository(users.db, QueryTimeouts{})
+	transactor := database.NewTransactor(users.db)
+
+	errAbort := errors.New("abort")
+	err := transactor.WithinTx(ctx, func(ctx context.Context) error {
+		user, err := users.CreateUser(ctx, domain.UserInput{Name: "John", Email: "john@example.com"})
+		if err != nil {
+			return err
+		}
+		if _, err := audit.CreateAuditEvent(ctx, domain.AuditEvent{Actor: "admin", Action: domain.AuditUserCreated, TargetUUID: user.UUID}); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("expected errAbort, got %v", err)
+	}
+
+	if list, _ := users.ListAllUsers(ctx, domain.UserFilter{}); len(list) != 0 {
+		t.Errorf("expected user insert to be rolled back, got %v", list)
+	}
+	if events, _ := audit.ListAuditEvents(ctx, domain.AuditFilter{}); len(events) != 0 {
+		t.Errorf("expected audit event to be rolled back, got %v", events)
+	}
+}
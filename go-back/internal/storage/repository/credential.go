@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-back/internal/domain"
+	"go-back/internal/storage/database"
+
+	"github.com/vingarcia/ksql"
+)
+
+type CredentialRepository struct {
+	db       ksql.Provider
+	timeouts QueryTimeouts
+}
+
+func NewCredentialRepository(db ksql.Provider, timeouts QueryTimeouts) CredentialRepository {
+	return CredentialRepository{db: db, timeouts: timeouts}
+}
+
+// GetCredential returns domain.ErrPasswordNotSet for users without a
+// password.
+func (r CredentialRepository) GetCredential(ctx context.Context, userUUID string) (domain.Credential, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	var credential domain.Credential
+	err := database.Conn(ctx, r.db).QueryOne(ctx, &credential, r.getCredentialQuery(), userUUID)
+	if errors.Is(err, ksql.ErrRecordNotFound) {
+		return domain.Credential{}, domain.ErrPasswordNotSet
+	}
+	if err != nil {
+		return domain.Credential{}, translateError(err)
+	}
+	return credential, nil
+}
+
+// SaveCredential creates or replaces the password of credential.UserUUID.
+func (r CredentialRepository) SaveCredential(ctx context.Context, credential domain.Credential) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	_, err := database.Conn(ctx, r.db).Exec(ctx, r.saveCredentialQuery(),
+		credential.UserUUID, credential.PasswordHash, credential.PasswordChangedAt.UTC(), now())
+	return translateError(err)
+}
+
+func (CredentialRepository) getCredentialQuery() string {
+	return `
+		SELECT user_uuid, password_hash, password_changed_at, updated_at
+		FROM user_credentials
+		WHERE user_uuid = $1;
+	`
+}
+
+func (CredentialRepository) saveCredentialQuery() string {
+	return `
+		INSERT INTO user_credentials (user_uuid, password_hash, password_changed_at, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_uuid) DO UPDATE
+		SET password_hash = excluded.password_hash,
+		    password_changed_at = excluded.password_changed_at,
+		    updated_at = excluded.updated_at;
+	`
+}
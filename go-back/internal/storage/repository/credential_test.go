@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-back/internal/domain"
+)
+
+func TestCredentialRepository_SQLite(t *testing.T) {
+	ctx := context.Background()
+	users := newSQLiteUserRepository(t)
+	repo := NewCredentialRepository(users.db, QueryTimeouts{})
+
+	user, err := users.CreateUser(ctx, domain.UserInput{Name: "John", Email: "john@example.com"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := repo.GetCredential(ctx, user.UUID); !errors.Is(err, domain.ErrPasswordNotSet) {
+		t.Fatalf("expected ErrPasswordNotSet, got %v", err)
+	}
+
+	changedAt := now().Add(-time.Hour)
+	for _, hash := range []string{"first-hash", "second-hash"} {
+		err := repo.SaveCredential(ctx, domain.Credential{UserUUID: user.UUID, PasswordHash: hash, PasswordChangedAt: changedAt})
+		if err != nil {
+			t.Fatalf("expected no error saving %s, got %v", hash, err)
+		}
+	}
+
+	credential, err := repo.GetCredential(ctx, user.UUID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if credential.PasswordHash != "second-hash" || !credential.PasswordChangedAt.Equal(changedAt) {
+		t.Errorf("expected the second save to replace the first, got %+v", credential)
+	}
+
+	t.Run("rejects unknown users", func(t *testing.T) {
+		err := repo.SaveCredential(ctx, domain.Credential{UserUUID: "missing", PasswordHash: "hash", PasswordChangedAt: changedAt})
+		if !errors.Is(err, domain.ErrInvalidInput) {
+			t.Errorf("expected ErrInvalidInput, got %v", err)
+		}
+	})
+
+	t.Run("drops the password of purged users", func(t *testing.T) {
+		users.DeleteUser(ctx, user.UUID)
+		if _, err := users.PurgeDeletedUsers(ctx, time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := repo.GetCredential(ctx, user.UUID); !errors.Is(err, domain.ErrPasswordNotSet) {
+			t.Errorf("expected ErrPasswordNotSet, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"go-back/internal/domain"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/vingarcia/ksql"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// PostgreSQL error codes, see
+// https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pgUniqueViolation           = "23505"
+	pgForeignKeyViolation       = "23503"
+	pgCheckViolation            = "23514"
+	pgNotNullViolation          = "23502"
+	pgInvalidTextRepresentation = "22P02"
+	pgSerializationFailure      = "40001"
+	pgDeadlockDetected          = "40P01"
+)
+
+// translateError maps driver and ksql errors to the domain error set. The
+// original error stays in the chain for logging. Errors that already are
+// domain errors, or that have no domain meaning, are returned unchanged.
+func translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, ksql.ErrRecordNotFound) {
+		return fmt.Errorf("%w: %w", domain.ErrUserNotFound, err)
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case pgUniqueViolation:
+			if pgErr.ConstraintName == "users_email_key" {
+				return fmt.Errorf("%w: %w", domain.ErrEmailTaken, err)
+			}
+			return fmt.Errorf("%w: %w", domain.ErrConflict, err)
+		case pgForeignKeyViolation, pgCheckViolation, pgNotNullViolation, pgInvalidTextRepresentation:
+			return fmt.Errorf("%w: %w", domain.ErrInvalidInput, err)
+		case pgSerializationFailure, pgDeadlockDetected:
+			return fmt.Errorf("%w: %w", domain.ErrConflict, err)
+		}
+		return err
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+			if strings.Contains(sqliteErr.Error(), "users.email") {
+				return fmt.Errorf("%w: %w", domain.ErrEmailTaken, err)
+			}
+			return fmt.Errorf("%w: %w", domain.ErrConflict, err)
+		case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY, sqlite3.SQLITE_CONSTRAINT_CHECK, sqlite3.SQLITE_CONSTRAINT_NOTNULL:
+			return fmt.Errorf("%w: %w", domain.ErrInvalidInput, err)
+		case sqlite3.SQLITE_BUSY:
+			return fmt.Errorf("%w: %w", domain.ErrConflict, err)
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,225 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-back/internal/domain"
+	"go-back/internal/storage/database"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vingarcia/ksql"
+)
+
+const jobColumns = "id, kind, payload, status, attempts, max_attempts, run_at, locked_until, last_error, created_at, updated_at"
+
+// JobRepository keeps the background jobs of queue.Queue. It needs the
+// dialect since only PostgreSQL can skip the jobs other workers are
+// claiming; SQLite runs one claim at a time anyway.
+type JobRepository struct {
+	db       ksql.Provider
+	dialect  database.Dialect
+	timeouts QueryTimeouts
+}
+
+func NewJobRepository(db ksql.Provider, dialect database.Dialect, timeouts QueryTimeouts) JobRepository {
+	return JobRepository{db: db, dialect: dialect, timeouts: timeouts}
+}
+
+// CreateJob stores job with a new ID as queued, due now unless it has a
+// RunAt.
+func (r JobRepository) CreateJob(ctx context.Context, job domain.Job) (domain.Job, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	job.ID = uuid.NewString()
+	job.Status = domain.JobQueued
+	job.CreatedAt = now()
+	job.UpdatedAt = job.CreatedAt
+	if job.RunAt.IsZero() {
+		job.RunAt = job.CreatedAt
+	}
+	job.RunAt = job.RunAt.UTC().Truncate(time.Microsecond)
+
+	_, err := database.Conn(ctx, r.db).Exec(ctx, r.createJobQuery(),
+		job.ID, job.Kind, job.Payload, job.Status, job.MaxAttempts, job.RunAt, job.CreatedAt, job.UpdatedAt)
+	if err != nil {
+		return domain.Job{}, translateError(err)
+	}
+	return job, nil
+}
+
+func (r JobRepository) GetJob(ctx context.Context, id string) (domain.Job, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	if _, err := uuid.Parse(id); err != nil {
+		return domain.Job{}, domain.ErrJobNotFound
+	}
+
+	var job domain.Job
+	err := database.Conn(ctx, r.db).QueryOne(ctx, &job, r.getJobQuery(), id)
+	if errors.Is(err, ksql.ErrRecordNotFound) {
+		return domain.Job{}, domain.ErrJobNotFound
+	}
+	if err != nil {
+		return domain.Job{}, translateError(err)
+	}
+	return job, nil
+}
+
+// ClaimJobs marks up to limit due jobs of kinds as running for lease, and
+// returns them with their attempt counted. Running jobs whose lease passed
+// are due again.
+func (r JobRepository) ClaimJobs(ctx context.Context, kinds []string, limit int, lease time.Duration) ([]domain.Job, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	if len(kinds) == 0 || limit <= 0 {
+		return nil, nil
+	}
+
+	claimedAt := now()
+	lockedUntil := claimedAt.Add(lease)
+	query, params := r.dueJobsQuery(kinds, limit, claimedAt)
+
+	var jobs []domain.Job
+	err := database.Conn(ctx, r.db).Transaction(ctx, func(tx ksql.Provider) error {
+		if err := tx.Query(ctx, &jobs, query, params...); err != nil {
+			return err
+		}
+		for i := range jobs {
+			if _, err := tx.Exec(ctx, r.claimJobQuery(), domain.JobRunning, lockedUntil, claimedAt, jobs[i].ID); err != nil {
+				return err
+			}
+			jobs[i].Status = domain.JobRunning
+			jobs[i].Attempts++
+			jobs[i].LockedUntil = &lockedUntil
+			jobs[i].UpdatedAt = claimedAt
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return jobs, nil
+}
+
+// The writes below finish a claimed job. They only apply while the job is
+// still running the attempt it was claimed for: once its lease passed
+// another worker may have claimed it again, and the job is theirs.
+
+// CompleteJob deletes job.
+func (r JobRepository) CompleteJob(ctx context.Context, job domain.Job) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	return r.expectJob(database.Conn(ctx, r.db).Exec(ctx, r.deleteJobQuery(), job.ID, job.Attempts, domain.JobRunning))
+}
+
+// RetryJob queues job again for runAt, after it failed with lastError.
+func (r JobRepository) RetryJob(ctx context.Context, job domain.Job, runAt time.Time, lastError string) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	return r.expectJob(database.Conn(ctx, r.db).Exec(ctx, r.retryJobQuery(),
+		domain.JobQueued, runAt.UTC().Truncate(time.Microsecond), lastError, now(), job.ID, job.Attempts, domain.JobRunning))
+}
+
+// KillJob leaves job dead after it failed with lastError.
+func (r JobRepository) KillJob(ctx context.Context, job domain.Job, lastError string) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	return r.expectJob(database.Conn(ctx, r.db).Exec(ctx, r.killJobQuery(),
+		domain.JobDead, lastError, now(), job.ID, job.Attempts, domain.JobRunning))
+}
+
+func (r JobRepository) expectJob(result ksql.Result, err error) error {
+	if err == nil {
+		err = expectAffected(result)
+	}
+	if errors.Is(err, ksql.ErrRecordNotFound) {
+		return domain.ErrJobNotFound
+	}
+	return translateError(err)
+}
+
+func (JobRepository) createJobQuery() string {
+	return `
+		INSERT INTO jobs (id, kind, payload, status, max_attempts, run_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
+	`
+}
+
+func (JobRepository) getJobQuery() string {
+	return `SELECT ` + jobColumns + ` FROM jobs WHERE id = $1;`
+}
+
+// dueJobsQuery selects the oldest due jobs, locking them on PostgreSQL and
+// skipping those locked by other workers.
+func (r JobRepository) dueJobsQuery(kinds []string, limit int, at time.Time) (string, []interface{}) {
+	params := []interface{}{domain.JobQueued, domain.JobRunning, at, limit}
+	placeholders := make([]string, len(kinds))
+	for i, kind := range kinds {
+		params = append(params, kind)
+		placeholders[i] = "$" + strconv.Itoa(len(params))
+	}
+
+	query := `
+		SELECT ` + jobColumns + `
+		FROM jobs
+		WHERE kind IN (` + strings.Join(placeholders, ", ") + `)
+		  AND ((status = $1 AND run_at <= $3) OR (status = $2 AND locked_until <= $3))
+		ORDER BY run_at
+		LIMIT $4`
+	if r.dialect == database.Postgres {
+		query += `
+		FOR UPDATE SKIP LOCKED`
+	}
+	return query + ";", params
+}
+
+func (JobRepository) claimJobQuery() string {
+	return `
+		UPDATE jobs
+		SET status = $1,
+		    attempts = attempts + 1,
+		    locked_until = $2,
+		    updated_at = $3
+		WHERE id = $4;
+	`
+}
+
+func (JobRepository) retryJobQuery() string {
+	return `
+		UPDATE jobs
+		SET status = $1,
+		    run_at = $2,
+		    locked_until = NULL,
+		    last_error = $3,
+		    updated_at = $4
+		WHERE id = $5
+		  AND attempts = $6
+		  AND status = $7;
+	`
+}
+
+func (JobRepository) killJobQuery() string {
+	return `
+		UPDATE jobs
+		SET status = $1,
+		    locked_until = NULL,
+		    last_error = $2,
+		    updated_at = $3
+		WHERE id = $4
+		  AND attempts = $5
+		  AND status = $6;
+	`
+}
+
+func (JobRepository) deleteJobQuery() string {
+	return `DELETE FROM jobs WHERE id = $1 AND attempts = $2 AND status = $3;`
+}
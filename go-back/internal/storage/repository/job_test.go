@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-back/internal/domain"
+	"go-back/internal/storage/database"
+)
+
+type jobStore interface {
+	CreateJob(context.Context, domain.Job) (domain.Job, error)
+	GetJob(context.Context, string) (domain.Job, error)
+	ClaimJobs(ctx context.Context, kinds []string, limit int, lease time.Duration) ([]domain.Job, error)
+	CompleteJob(context.Context, domain.Job) error
+	RetryJob(ctx context.Context, job domain.Job, runAt time.Time, lastError string) error
+	KillJob(ctx context.Context, job domain.Job, lastError string) error
+}
+
+func TestJobRepository(t *testing.T) {
+	backends := map[string]func(*testing.T) jobStore{
+		"memory": func(*testing.T) jobStore { return NewMemoryJobRepository() },
+		"sqlite": func(t *testing.T) jobStore {
+			return NewJobRepository(newSQLiteUserRepository(t).db, database.SQLite, QueryTimeouts{})
+		},
+	}
+
+	for name, newRepo := range backends {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := newRepo(t)
+			kinds := []string{"email", "webhook"}
+
+			first, err := repo.CreateJob(ctx, domain.Job{Kind: "email", Payload: `{"n":1}`, MaxAttempts: 3})
+			if err != nil || first.ID == "" || first.Status != domain.JobQueued || first.RunAt.IsZero() {
+				t.Fatalf("expected a queued job due now, got %+v, %v", first, err)
+			}
+			if _, err := repo.CreateJob(ctx, domain.Job{Kind: "webhook", Payload: `{"n":2}`, MaxAttempts: 3}); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			later, err := repo.CreateJob(ctx, domain.Job{Kind: "email", Payload: `{"n":3}`, MaxAttempts: 3, RunAt: time.Now().Add(time.Hour)})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if _, err := repo.CreateJob(ctx, domain.Job{Kind: "other", Payload: `{}`, MaxAttempts: 3}); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			claimed, err := repo.ClaimJobs(ctx, kinds, 1, time.Minute)
+			if err != nil || len(claimed) != 1 || claimed[0].ID != first.ID {
+				t.Fatalf("expected the oldest job to be claimed, got %+v, %v", claimed, err)
+			}
+			job := claimed[0]
+			if job.Status != domain.JobRunning || job.Attempts != 1 || job.LockedUntil == nil || job.Payload != `{"n":1}` {
+				t.Fatalf("expected the job to run its first attempt, got %+v", job)
+			}
+
+			claimed, err = repo.ClaimJobs(ctx, kinds, 10, time.Minute)
+			if err != nil || len(claimed) != 1 || claimed[0].Kind != "webhook" {
+				t.Fatalf("expected only the other due job of the kinds, got %+v, %v", claimed, err)
+			}
+
+			t.Run("retries and kills only the current attempt", func(t *testing.T) {
+				if err := repo.RetryJob(ctx, job, time.Now().Add(-time.Second), "boom"); err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if err := repo.CompleteJob(ctx, job); err == nil {
+					t.Fatalf("expected a stale attempt not to complete the job")
+				}
+
+				claimed, err := repo.ClaimJobs(ctx, kinds, 10, time.Minute)
+				if err != nil || len(claimed) != 1 || claimed[0].ID != job.ID || claimed[0].Attempts != 2 || claimed[0].LastError != "boom" {
+					t.Fatalf("expected the retried job to be claimed again, got %+v, %v", claimed, err)
+				}
+				if err := repo.KillJob(ctx, job, "stale"); !errors.Is(err, domain.ErrJobNotFound) {
+					t.Errorf("expected ErrJobNotFound for the first attempt, got %v", err)
+				}
+				if err := repo.KillJob(ctx, claimed[0], "gave up"); err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+
+				dead, err := repo.GetJob(ctx, job.ID)
+				if err != nil || dead.Status != domain.JobDead || dead.LastError != "gave up" || dead.LockedUntil != nil {
+					t.Errorf("expected the job to be dead, got %+v, %v", dead, err)
+				}
+				if claimed, _ := repo.ClaimJobs(ctx, kinds, 10, time.Minute); len(claimed) != 0 {
+					t.Errorf("expected dead and delayed jobs not to be claimed, got %+v", claimed)
+				}
+			})
+
+			t.Run("claims jobs again once their lease passed", func(t *testing.T) {
+				if err := repo.RetryJob(ctx, domain.Job{ID: later.ID}, time.Now().Add(-time.Second), ""); !errors.Is(err, domain.ErrJobNotFound) {
+					t.Fatalf("expected an unclaimed job not to be retried, got %v", err)
+				}
+				expired, err := repo.CreateJob(ctx, domain.Job{Kind: "webhook", Payload: `{}`, MaxAttempts: 3})
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if claimed, err := repo.ClaimJobs(ctx, kinds, 10, -time.Second); err != nil || len(claimed) != 1 {
+					t.Fatalf("expected the job to be claimed, got %+v, %v", claimed, err)
+				}
+
+				claimed, err := repo.ClaimJobs(ctx, kinds, 10, time.Minute)
+				if err != nil || len(claimed) != 1 || claimed[0].ID != expired.ID || claimed[0].Attempts != 2 {
+					t.Fatalf("expected the expired job to be claimed again, got %+v, %v", claimed, err)
+				}
+				if err := repo.CompleteJob(ctx, claimed[0]); err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if _, err := repo.GetJob(ctx, expired.ID); !errors.Is(err, domain.ErrJobNotFound) {
+					t.Errorf("expected completed jobs to be deleted, got %v", err)
+				}
+			})
+		})
+	}
+}
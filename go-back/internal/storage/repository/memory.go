@@ -0,0 +1,372 @@
+package repository
+
+import (
+	"context"
+	"go-back/internal/domain"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryUserRepository keeps users in process memory. It mirrors the
+// behaviour of UserRepository so the server and tests can run without
+// a database.
+type MemoryUserRepository struct {
+	mu    sync.RWMutex
+	users map[string]domain.User
+}
+
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{users: map[string]domain.User{}}
+}
+
+func (m *MemoryUserRepository) ListAllUsers(ctx context.Context, filter domain.UserFilter) ([]domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	column, desc := filter.SortColumn()
+	var after *domain.User
+	if filter.After != nil {
+		value, err := filter.AfterValue()
+		if err != nil {
+			return nil, err
+		}
+		after = cursorUser(column, value, filter.After.UUID)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	users := make([]domain.User, 0, len(m.users))
+	for _, user := range m.users {
+		if !matchesFilter(user, filter) {
+			continue
+		}
+		if after != nil {
+			cmp := compareUsers(user, *after, column)
+			if (!desc && cmp <= 0) || (desc && cmp >= 0) {
+				continue
+			}
+		}
+		users = append(users, user)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		cmp := compareUsers(users[i], users[j], column)
+		if desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+
+	if filter.Limit > 0 && len(users) > filter.Limit {
+		users = users[:filter.Limit]
+	}
+
+	return users, nil
+}
+
+func (m *MemoryUserRepository) ListUserByUUID(ctx context.Context, userUUID string) (domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.User{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.findActive(userUUID)
+	if !ok {
+		return domain.User{}, domain.ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+func (m *MemoryUserRepository) ListUserByUUIDWithDeleted(ctx context.Context, userUUID string) (domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.User{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[userUUID]
+	if !ok {
+		return domain.User{}, domain.ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+func (m *MemoryUserRepository) ListUserByEmail(ctx context.Context, email string) (domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.User{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.findByEmail(email)
+	if !ok {
+		return domain.User{}, domain.ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+func (m *MemoryUserRepository) UpdateUser(ctx context.Context, user domain.User) (domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.User{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.findActive(user.UUID)
+	if !ok {
+		return domain.User{}, domain.ErrUserNotFound
+	}
+	if current.Version != user.Version {
+		return domain.User{}, domain.ErrVersionMismatch
+	}
+
+	if other, ok := m.findByEmail(user.Email); ok && other.UUID != user.UUID {
+		return domain.User{}, domain.ErrEmailTaken
+	}
+
+	if current.Email != user.Email {
+		current.EmailVerifiedAt = nil
+	}
+	current.Name = user.Name
+	current.Email = user.Email
+	current.UpdatedAt = now()
+	current.Version++
+	m.users[current.UUID] = current
+
+	return current, nil
+}
+
+func (m *MemoryUserRepository) ManageActivateUser(ctx context.Context, userUUID string, expectedVersion int) (domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.User{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.findActive(userUUID)
+	if !ok {
+		return domain.User{}, domain.ErrUserNotFound
+	}
+
+	if expectedVersion != 0 && user.Version != expectedVersion {
+		return domain.User{}, domain.ErrVersionMismatch
+	}
+
+	user.IsActive = !user.IsActive
+	user.UpdatedAt = now()
+	user.Version++
+	m.users[userUUID] = user
+
+	return user, nil
+}
+
+func (m *MemoryUserRepository) MarkEmailVerified(ctx context.Context, userUUID, email string) (domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.User{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.findActive(userUUID)
+	if !ok || user.Email != email || user.EmailVerifiedAt != nil {
+		return domain.User{}, domain.ErrUserNotFound
+	}
+
+	verifiedAt := now()
+	user.EmailVerifiedAt = &verifiedAt
+	user.UpdatedAt = verifiedAt
+	user.Version++
+	m.users[userUUID] = user
+
+	return user, nil
+}
+
+func (m *MemoryUserRepository) CreateUser(ctx context.Context, input domain.UserInput) (domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.User{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.findByEmail(input.Email); ok {
+		return domain.User{}, domain.ErrEmailTaken
+	}
+
+	createdAt := now()
+	user := domain.User{
+		UUID:      uuid.NewString(),
+		Name:      input.Name,
+		Email:     input.Email,
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+		IsActive:  true,
+		Version:   1,
+	}
+	m.users[user.UUID] = user
+
+	return user, nil
+}
+
+func (m *MemoryUserRepository) DeleteUser(ctx context.Context, userUUID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.findActive(userUUID)
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+
+	deletedAt := now()
+	user.DeletedAt = &deletedAt
+	user.UpdatedAt = deletedAt
+	user.Version++
+	m.users[userUUID] = user
+
+	return nil
+}
+
+func (m *MemoryUserRepository) RestoreUser(ctx context.Context, userUUID string) (domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.User{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userUUID]
+	if !ok {
+		return domain.User{}, domain.ErrUserNotFound
+	}
+	if user.DeletedAt == nil {
+		return user, nil
+	}
+
+	if _, ok := m.findByEmail(user.Email); ok {
+		return domain.User{}, domain.ErrEmailTaken
+	}
+
+	user.DeletedAt = nil
+	user.UpdatedAt = now()
+	user.Version++
+	m.users[userUUID] = user
+
+	return user, nil
+}
+
+func (m *MemoryUserRepository) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) ([]domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var purged []domain.User
+	for userUUID, user := range m.users {
+		if user.DeletedAt != nil && user.DeletedAt.Before(deletedBefore) {
+			delete(m.users, userUUID)
+			purged = append(purged, user)
+		}
+	}
+
+	return purged, nil
+}
+
+func matchesFilter(user domain.User, filter domain.UserFilter) bool {
+	if !filter.IncludeDeleted && user.DeletedAt != nil {
+		return false
+	}
+	if filter.IsActive != nil && user.IsActive != *filter.IsActive {
+		return false
+	}
+	if filter.EmailDomain != "" && !strings.HasSuffix(strings.ToLower(user.Email), "@"+strings.ToLower(filter.EmailDomain)) {
+		return false
+	}
+	if filter.CreatedAfter != nil && !user.CreatedAt.After(*filter.CreatedAfter) {
+		return false
+	}
+	if filter.CreatedBefore != nil && !user.CreatedAt.Before(*filter.CreatedBefore) {
+		return false
+	}
+	if filter.Query != "" && !strings.Contains(strings.ToLower(user.Name), strings.ToLower(filter.Query)) {
+		return false
+	}
+	return true
+}
+
+// compareUsers orders a and b by column and then uuid, the same way the SQL
+// repository sorts and compares "(column, uuid)" rows.
+func compareUsers(a, b domain.User, column string) int {
+	var cmp int
+	switch column {
+	case "name":
+		cmp = strings.Compare(a.Name, b.Name)
+	case "email":
+		cmp = strings.Compare(a.Email, b.Email)
+	case "updated_at":
+		cmp = a.UpdatedAt.Compare(b.UpdatedAt)
+	default:
+		cmp = a.CreatedAt.Compare(b.CreatedAt)
+	}
+	if cmp != 0 {
+		return cmp
+	}
+	return strings.Compare(a.UUID, b.UUID)
+}
+
+// cursorUser builds a placeholder user holding the cursor position so it can
+// be compared with compareUsers.
+func cursorUser(column string, value interface{}, userUUID string) *domain.User {
+	user := &domain.User{UUID: userUUID}
+	switch column {
+	case "name":
+		user.Name = value.(string)
+	case "email":
+		user.Email = value.(string)
+	case "updated_at":
+		user.UpdatedAt = value.(time.Time)
+	default:
+		user.CreatedAt = value.(time.Time)
+	}
+	return user
+}
+
+func (m *MemoryUserRepository) findActive(userUUID string) (domain.User, bool) {
+	user, ok := m.users[userUUID]
+	if !ok || user.DeletedAt != nil {
+		return domain.User{}, false
+	}
+	return user, true
+}
+
+// findByEmail only looks at users that are not deleted, matching the partial
+// unique index on users.email.
+func (m *MemoryUserRepository) findByEmail(email string) (domain.User, bool) {
+	for _, user := range m.users {
+		if user.Email == email && user.DeletedAt == nil {
+			return user, true
+		}
+	}
+	return domain.User{}, false
+}
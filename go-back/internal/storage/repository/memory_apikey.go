@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"go-back/internal/domain"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryAPIKeyRepository keeps API keys in process memory. Revoked keys are
+// dropped.
+type MemoryAPIKeyRepository struct {
+	mu   sync.Mutex
+	keys map[string]domain.APIKey
+}
+
+func NewMemoryAPIKeyRepository() *MemoryAPIKeyRepository {
+	return &MemoryAPIKeyRepository{keys: map[string]domain.APIKey{}}
+}
+
+func (m *MemoryAPIKeyRepository) CreateAPIKey(ctx context.Context, key domain.APIKey) (domain.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.APIKey{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.keys {
+		if existing.Prefix == key.Prefix {
+			return domain.APIKey{}, domain.ErrConflict
+		}
+	}
+	key.ID = uuid.NewString()
+	key.CreatedAt = now()
+	key.UpdatedAt = key.CreatedAt
+	m.keys[key.ID] = copyAPIKey(key)
+	return key, nil
+}
+
+func (m *MemoryAPIKeyRepository) GetAPIKey(ctx context.Context, id string) (domain.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.APIKey{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, ok := m.keys[id]
+	if !ok {
+		return domain.APIKey{}, domain.ErrAPIKeyNotFound
+	}
+	return copyAPIKey(key), nil
+}
+
+func (m *MemoryAPIKeyRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (domain.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.APIKey{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range m.keys {
+		if key.Prefix == prefix {
+			return copyAPIKey(key), nil
+		}
+	}
+	return domain.APIKey{}, domain.ErrAPIKeyNotFound
+}
+
+func (m *MemoryAPIKeyRepository) ListAPIKeys(ctx context.Context) ([]domain.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]domain.APIKey, 0, len(m.keys))
+	for _, key := range m.keys {
+		keys = append(keys, copyAPIKey(key))
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+func (m *MemoryAPIKeyRepository) UpdateAPIKey(ctx context.Context, key domain.APIKey) (domain.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.APIKey{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.keys[key.ID]
+	if !ok {
+		return domain.APIKey{}, domain.ErrAPIKeyNotFound
+	}
+	stored.Name = key.Name
+	stored.Scopes = key.Scopes
+	stored.RateLimit = key.RateLimit
+	stored.ExpiresAt = key.ExpiresAt
+	stored.UpdatedAt = now()
+	m.keys[key.ID] = copyAPIKey(stored)
+	return copyAPIKey(stored), nil
+}
+
+func (m *MemoryAPIKeyRepository) RevokeAPIKey(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.keys[id]; !ok {
+		return domain.ErrAPIKeyNotFound
+	}
+	delete(m.keys, id)
+	return nil
+}
+
+func (m *MemoryAPIKeyRepository) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, ok := m.keys[id]
+	if !ok {
+		return nil
+	}
+	usedAt = usedAt.UTC()
+	key.LastUsedAt = &usedAt
+	m.keys[id] = key
+	return nil
+}
+
+// copyAPIKey keeps callers from sharing the scopes slice with the store.
+func copyAPIKey(key domain.APIKey) domain.APIKey {
+	key.Scopes = append([]domain.Permission(nil), key.Scopes...)
+	return key
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"go-back/internal/domain"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// MemoryAuditRepository keeps audit events in process memory, newest last.
+type MemoryAuditRepository struct {
+	mu     sync.RWMutex
+	events []domain.AuditEvent
+	seq    int64
+}
+
+func NewMemoryAuditRepository() *MemoryAuditRepository {
+	return &MemoryAuditRepository{}
+}
+
+func (m *MemoryAuditRepository) CreateAuditEvent(ctx context.Context, event domain.AuditEvent) (domain.AuditEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.AuditEvent{}, err
+	}
+
+	event.UUID = uuid.NewString()
+	event.CreatedAt = now()
+	if event.Changes == nil {
+		event.Changes = map[string]domain.FieldChange{}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.seq++
+	event.Seq = m.seq
+	m.events = append(m.events, event)
+
+	return event, nil
+}
+
+func (m *MemoryAuditRepository) ListAuditEvents(ctx context.Context, filter domain.AuditFilter) ([]domain.AuditEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := []domain.AuditEvent{}
+	for _, event := range m.events {
+		if filter.Target != "" && event.TargetUUID != filter.Target {
+			continue
+		}
+		if filter.Actor != "" && event.Actor != filter.Actor {
+			continue
+		}
+		if filter.Since != nil && event.CreatedAt.Before(*filter.Since) {
+			continue
+		}
+		if filter.After != nil && event.Seq >= filter.After.Seq {
+			continue
+		}
+		events = append(events, event)
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Seq > events[j].Seq
+	})
+
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		events = events[:filter.Limit]
+	}
+
+	return events, nil
+}
+
+// MemoryTransactor satisfies service.Transactor for the memory storage,
+// which has nothing to roll back. Like SQLite, it runs one transaction at a
+// time, so what a transaction checks holds until it ends; nested calls join
+// the outer one.
+type MemoryTransactor struct {
+	mu sync.Mutex
+}
+
+type memoryTxKey struct{}
+
+func NewMemoryTransactor() *MemoryTransactor {
+	return &MemoryTransactor{}
+}
+
+func (m *MemoryTransactor) WithinTx(ctx context.Context, fn func(context.Context) error) error {
+	if ctx.Value(memoryTxKey{}) != nil {
+		return fn(ctx)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return fn(context.WithValue(ctx, memoryTxKey{}, true))
+}
+
+// InTx is always false: without isolation, reads inside WithinTx see the
+// same users as any other.
+func (*MemoryTransactor) InTx(context.Context) bool {
+	return false
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"go-back/internal/domain"
+	"sync"
+)
+
+// MemoryCredentialRepository keeps passwords in process memory. Like
+// MemoryRoleRepository it does not drop the passwords of purged users.
+type MemoryCredentialRepository struct {
+	mu          sync.RWMutex
+	credentials map[string]domain.Credential
+}
+
+func NewMemoryCredentialRepository() *MemoryCredentialRepository {
+	return &MemoryCredentialRepository{credentials: map[string]domain.Credential{}}
+}
+
+func (m *MemoryCredentialRepository) GetCredential(ctx context.Context, userUUID string) (domain.Credential, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Credential{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	credential, ok := m.credentials[userUUID]
+	if !ok {
+		return domain.Credential{}, domain.ErrPasswordNotSet
+	}
+	return credential, nil
+}
+
+func (m *MemoryCredentialRepository) SaveCredential(ctx context.Context, credential domain.Credential) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	credential.PasswordChangedAt = credential.PasswordChangedAt.UTC()
+	credential.UpdatedAt = now()
+	m.credentials[credential.UserUUID] = credential
+	return nil
+}
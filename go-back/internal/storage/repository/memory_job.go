@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"go-back/internal/domain"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryJobRepository keeps background jobs in process memory, so jobs not
+// run yet are lost when the process exits.
+type MemoryJobRepository struct {
+	mu   sync.Mutex
+	jobs map[string]domain.Job
+}
+
+func NewMemoryJobRepository() *MemoryJobRepository {
+	return &MemoryJobRepository{jobs: map[string]domain.Job{}}
+}
+
+func (m *MemoryJobRepository) CreateJob(ctx context.Context, job domain.Job) (domain.Job, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Job{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job.ID = uuid.NewString()
+	job.Status = domain.JobQueued
+	job.CreatedAt = now()
+	job.UpdatedAt = job.CreatedAt
+	if job.RunAt.IsZero() {
+		job.RunAt = job.CreatedAt
+	}
+	job.RunAt = job.RunAt.UTC().Truncate(time.Microsecond)
+	m.jobs[job.ID] = job
+	return job, nil
+}
+
+func (m *MemoryJobRepository) GetJob(ctx context.Context, id string) (domain.Job, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Job{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return domain.Job{}, domain.ErrJobNotFound
+	}
+	return job, nil
+}
+
+func (m *MemoryJobRepository) ClaimJobs(ctx context.Context, kinds []string, limit int, lease time.Duration) ([]domain.Job, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	claimedAt := now()
+	var due []domain.Job
+	for _, job := range m.jobs {
+		if !slices.Contains(kinds, job.Kind) {
+			continue
+		}
+		queued := job.Status == domain.JobQueued && !job.RunAt.After(claimedAt)
+		expired := job.Status == domain.JobRunning && job.LockedUntil != nil && !job.LockedUntil.After(claimedAt)
+		if queued || expired {
+			due = append(due, job)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].RunAt.Before(due[j].RunAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	lockedUntil := claimedAt.Add(lease)
+	for i := range due {
+		due[i].Status = domain.JobRunning
+		due[i].Attempts++
+		due[i].LockedUntil = &lockedUntil
+		due[i].UpdatedAt = claimedAt
+		m.jobs[due[i].ID] = due[i]
+	}
+	return due, nil
+}
+
+func (m *MemoryJobRepository) CompleteJob(ctx context.Context, job domain.Job) error {
+	return m.finish(ctx, job, func(stored *domain.Job) bool { return false })
+}
+
+func (m *MemoryJobRepository) RetryJob(ctx context.Context, job domain.Job, runAt time.Time, lastError string) error {
+	return m.finish(ctx, job, func(stored *domain.Job) bool {
+		stored.Status = domain.JobQueued
+		stored.RunAt = runAt.UTC().Truncate(time.Microsecond)
+		stored.LastError = lastError
+		return true
+	})
+}
+
+func (m *MemoryJobRepository) KillJob(ctx context.Context, job domain.Job, lastError string) error {
+	return m.finish(ctx, job, func(stored *domain.Job) bool {
+		stored.Status = domain.JobDead
+		stored.LastError = lastError
+		return true
+	})
+}
+
+// finish applies update to job while it is still running the attempt it
+// was claimed for, deleting it unless update says to keep it.
+func (m *MemoryJobRepository) finish(ctx context.Context, job domain.Job, update func(*domain.Job) bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.jobs[job.ID]
+	if !ok || stored.Status != domain.JobRunning || stored.Attempts != job.Attempts {
+		return domain.ErrJobNotFound
+	}
+	if !update(&stored) {
+		delete(m.jobs, job.ID)
+		return nil
+	}
+	stored.LockedUntil = nil
+	stored.UpdatedAt = now()
+	m.jobs[job.ID] = stored
+	return nil
+}
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"go-back/internal/domain"
+	"sync"
+	"time"
+)
+
+// MemoryMFARepository keeps MFA enrollments and recovery codes in process
+// memory.
+type MemoryMFARepository struct {
+	mu            sync.Mutex
+	enrollments   map[string]domain.MFA
+	recoveryCodes map[string]map[string]*time.Time
+}
+
+func NewMemoryMFARepository() *MemoryMFARepository {
+	return &MemoryMFARepository{
+		enrollments:   map[string]domain.MFA{},
+		recoveryCodes: map[string]map[string]*time.Time{},
+	}
+}
+
+func (m *MemoryMFARepository) GetMFA(ctx context.Context, userUUID string) (domain.MFA, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.MFA{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mfa, ok := m.enrollments[userUUID]
+	if !ok {
+		return domain.MFA{}, domain.ErrMFANotEnabled
+	}
+	return mfa, nil
+}
+
+func (m *MemoryMFARepository) SaveMFA(ctx context.Context, mfa domain.MFA) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mfa.CreatedAt = mfa.CreatedAt.UTC()
+	mfa.UpdatedAt = now()
+	m.enrollments[mfa.UserUUID] = mfa
+	return nil
+}
+
+func (m *MemoryMFARepository) UseTOTPStep(ctx context.Context, userUUID string, step int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mfa, ok := m.enrollments[userUUID]
+	if !ok || mfa.LastUsedStep >= step {
+		return domain.ErrInvalidMFACode
+	}
+	mfa.LastUsedStep = step
+	mfa.UpdatedAt = now()
+	m.enrollments[userUUID] = mfa
+	return nil
+}
+
+func (m *MemoryMFARepository) DeleteMFA(ctx context.Context, userUUID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.enrollments, userUUID)
+	delete(m.recoveryCodes, userUUID)
+	return nil
+}
+
+func (m *MemoryMFARepository) ReplaceRecoveryCodes(ctx context.Context, userUUID string, hashes []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	codes := map[string]*time.Time{}
+	for _, hash := range hashes {
+		codes[hash] = nil
+	}
+	m.recoveryCodes[userUUID] = codes
+	return nil
+}
+
+func (m *MemoryMFARepository) UseRecoveryCode(ctx context.Context, userUUID, hash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usedAt, ok := m.recoveryCodes[userUUID][hash]
+	if !ok || usedAt != nil {
+		return domain.ErrInvalidMFACode
+	}
+	used := now()
+	m.recoveryCodes[userUUID][hash] = &used
+	return nil
+}
+
+func (m *MemoryMFARepository) CountRecoveryCodes(ctx context.Context, userUUID string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, usedAt := range m.recoveryCodes[userUUID] {
+		if usedAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"go-back/internal/domain"
+	"sort"
+	"sync"
+)
+
+// MemoryRoleRepository keeps role grants in process memory. Unlike the SQL
+// table it does not drop the grants of purged users.
+type MemoryRoleRepository struct {
+	mu     sync.RWMutex
+	grants map[string]map[domain.Role]domain.RoleGrant
+}
+
+func NewMemoryRoleRepository() *MemoryRoleRepository {
+	return &MemoryRoleRepository{grants: map[string]map[domain.Role]domain.RoleGrant{}}
+}
+
+func (m *MemoryRoleRepository) ListRoles(ctx context.Context, userUUID string) ([]domain.RoleGrant, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	grants := []domain.RoleGrant{}
+	for _, grant := range m.grants[userUUID] {
+		grants = append(grants, grant)
+	}
+	sort.Slice(grants, func(i, j int) bool { return grants[i].Role < grants[j].Role })
+	return grants, nil
+}
+
+func (m *MemoryRoleRepository) GrantRole(ctx context.Context, grant domain.RoleGrant) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.grants[grant.UserUUID][grant.Role]; ok {
+		return false, nil
+	}
+	if m.grants[grant.UserUUID] == nil {
+		m.grants[grant.UserUUID] = map[domain.Role]domain.RoleGrant{}
+	}
+	grant.GrantedAt = now()
+	m.grants[grant.UserUUID][grant.Role] = grant
+	return true, nil
+}
+
+func (m *MemoryRoleRepository) RevokeRole(ctx context.Context, userUUID string, role domain.Role) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.grants[userUUID][role]; !ok {
+		return false, nil
+	}
+	delete(m.grants[userUUID], role)
+	return true, nil
+}
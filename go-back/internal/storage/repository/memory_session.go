@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"context"
+	"go-back/internal/domain"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// MemorySessionRepository keeps sessions and their refresh tokens in
+// process memory.
+type MemorySessionRepository struct {
+	mu            sync.Mutex
+	sessions      map[string]domain.Session
+	refreshTokens map[string]domain.RefreshToken
+}
+
+func NewMemorySessionRepository() *MemorySessionRepository {
+	return &MemorySessionRepository{
+		sessions:      map[string]domain.Session{},
+		refreshTokens: map[string]domain.RefreshToken{},
+	}
+}
+
+func (m *MemorySessionRepository) CreateSession(ctx context.Context, session domain.Session) (domain.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Session{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session.ID = uuid.NewString()
+	session.CreatedAt = now()
+	session.LastUsedAt = session.CreatedAt
+	session.ExpiresAt = session.ExpiresAt.UTC()
+	m.sessions[session.ID] = session
+	return session, nil
+}
+
+func (m *MemorySessionRepository) GetSession(ctx context.Context, id string) (domain.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Session{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok {
+		return domain.Session{}, domain.ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (m *MemorySessionRepository) ListSessions(ctx context.Context, userUUID string) ([]domain.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	at := now()
+	sessions := []domain.Session{}
+	for _, session := range m.sessions {
+		if session.UserUUID == userUUID && session.Active(at) {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions, nil
+}
+
+func (m *MemorySessionRepository) TouchSession(ctx context.Context, id, ip, userAgent string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil
+	}
+	session.LastUsedAt = now()
+	session.IP = ip
+	session.UserAgent = userAgent
+	m.sessions[id] = session
+	return nil
+}
+
+func (m *MemorySessionRepository) RevokeSession(ctx context.Context, id, reason string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok || session.RevokedAt != nil {
+		return domain.ErrSessionNotFound
+	}
+	m.revoke(session, reason)
+	return nil
+}
+
+func (m *MemorySessionRepository) RevokeUserSessions(ctx context.Context, userUUID, reason string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, session := range m.sessions {
+		if session.UserUUID == userUUID && session.RevokedAt == nil {
+			m.revoke(session, reason)
+		}
+	}
+	return nil
+}
+
+func (m *MemorySessionRepository) revoke(session domain.Session, reason string) {
+	revokedAt := now()
+	session.RevokedAt = &revokedAt
+	session.RevokedReason = reason
+	m.sessions[session.ID] = session
+}
+
+func (m *MemorySessionRepository) CreateRefreshToken(ctx context.Context, token domain.RefreshToken) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.refreshTokens[token.TokenHash]; ok {
+		return domain.ErrConflict
+	}
+	token.CreatedAt = token.CreatedAt.UTC()
+	token.ExpiresAt = token.ExpiresAt.UTC()
+	m.refreshTokens[token.TokenHash] = token
+	return nil
+}
+
+func (m *MemorySessionRepository) UseRefreshToken(ctx context.Context, tokenHash string) (domain.RefreshToken, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.RefreshToken{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.refreshTokens[tokenHash]
+	if !ok {
+		return domain.RefreshToken{}, domain.ErrInvalidToken
+	}
+	if token.UsedAt != nil {
+		return token, domain.ErrRefreshTokenReused
+	}
+	usedAt := now()
+	if !usedAt.Before(token.ExpiresAt) {
+		return domain.RefreshToken{}, domain.ErrInvalidToken
+	}
+	token.UsedAt = &usedAt
+	m.refreshTokens[tokenHash] = token
+	return token, nil
+}
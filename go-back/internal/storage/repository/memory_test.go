@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"go-back/internal/domain"
+)
+
+func TestMemoryUserRepository_CreateUser(t *testing.T) {
+	t.Run("generates uuid and defaults", func(t *testing.T) {
+		repo := NewMemoryUserRepository()
+		user, err := repo.CreateUser(context.Background(), domain.UserInput{Name: "John", Email: "john@example.com"})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if user.UUID == "" {
+			t.Error("expected uuid to be generated")
+		}
+		if !user.IsActive {
+			t.Error("expected user to be active by default")
+		}
+		if user.CreatedAt.IsZero() || !user.CreatedAt.Equal(user.UpdatedAt) {
+			t.Errorf("expected created_at and updated_at to be set, got %v and %v", user.CreatedAt, user.UpdatedAt)
+		}
+	})
+
+	t.Run("rejects duplicated email", func(t *testing.T) {
+		repo := NewMemoryUserRepository()
+		input := domain.UserInput{Name: "John", Email: "john@example.com"}
+		if _, err := repo.CreateUser(context.Background(), input); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		_, err := repo.CreateUser(context.Background(), input)
+		if !errors.Is(err, domain.ErrEmailTaken) {
+			t.Errorf("expected ErrEmailTaken, got %v", err)
+		}
+	})
+
+	t.Run("is safe for concurrent use", func(t *testing.T) {
+		repo := NewMemoryUserRepository()
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				repo.CreateUser(context.Background(), domain.UserInput{Name: "John", Email: "john@example.com"})
+			}()
+		}
+		wg.Wait()
+
+		users, _ := repo.ListAllUsers(context.Background(), domain.UserFilter{})
+		if len(users) != 1 {
+			t.Errorf("expected exactly 1 user, got %d", len(users))
+		}
+	})
+}
+
+func TestMemoryUserRepository_Lookups(t *testing.T) {
+	repo := NewMemoryUserRepository()
+	created, _ := repo.CreateUser(context.Background(), domain.UserInput{Name: "John", Email: "john@example.com"})
+
+	t.Run("finds user by uuid and email", func(t *testing.T) {
+		byUUID, err := repo.ListUserByUUID(context.Background(), created.UUID)
+		if err != nil || byUUID != created {
+			t.Errorf("expected %v, got %v (err %v)", created, byUUID, err)
+		}
+		byEmail, err := repo.ListUserByEmail(context.Background(), created.Email)
+		if err != nil || byEmail != created {
+			t.Errorf("expected %v, got %v (err %v)", created, byEmail, err)
+		}
+	})
+
+	t.Run("returns not found like the database repository", func(t *testing.T) {
+		_, err := repo.ListUserByUUID(context.Background(), "missing")
+		if !errors.Is(err, domain.ErrUserNotFound) {
+			t.Errorf("expected domain.ErrUserNotFound, got %v", err)
+		}
+		_, err = repo.ListUserByEmail(context.Background(), "missing@example.com")
+		if !errors.Is(err, domain.ErrUserNotFound) {
+			t.Errorf("expected domain.ErrUserNotFound, got %v", err)
+		}
+	})
+
+	t.Run("honours context cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := repo.ListUserByUUID(ctx, created.UUID); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	})
+}
+
+func TestMemoryUserRepository_Mutations(t *testing.T) {
+	t.Run("update bumps updated_at and keeps email unique", func(t *testing.T) {
+		repo := NewMemoryUserRepository()
+		john, _ := repo.CreateUser(context.Background(), domain.UserInput{Name: "John", Email: "john@example.com"})
+		jane, _ := repo.CreateUser(context.Background(), domain.UserInput{Name: "Jane", Email: "jane@example.com"})
+
+		john.Name = "Johnny"
+		updated, err := repo.UpdateUser(context.Background(), john)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if updated.Name != "Johnny" || updated.UpdatedAt.Before(john.UpdatedAt) {
+			t.Errorf("expected name and updated_at to change, got %v", updated)
+		}
+
+		jane.Email = john.Email
+		if _, err := repo.UpdateUser(context.Background(), jane); !errors.Is(err, domain.ErrEmailTaken) {
+			t.Errorf("expected ErrEmailTaken, got %v", err)
+		}
+	})
+
+	t.Run("toggles is_active", func(t *testing.T) {
+		repo := NewMemoryUserRepository()
+		user, _ := repo.CreateUser(context.Background(), domain.UserInput{Name: "John", Email: "john@example.com"})
+
+		toggled, err := repo.ManageActivateUser(context.Background(), user.UUID, 0)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if toggled.IsActive {
+			t.Error("expected user to be deactivated")
+		}
+
+		if _, err := repo.ManageActivateUser(context.Background(), "missing", 0); !errors.Is(err, domain.ErrUserNotFound) {
+			t.Errorf("expected domain.ErrUserNotFound, got %v", err)
+		}
+	})
+
+	t.Run("soft deletes user", func(t *testing.T) {
+		repo := NewMemoryUserRepository()
+		user, _ := repo.CreateUser(context.Background(), domain.UserInput{Name: "John", Email: "john@example.com"})
+
+		if err := repo.DeleteUser(context.Background(), user.UUID); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := repo.ListUserByUUID(context.Background(), user.UUID); !errors.Is(err, domain.ErrUserNotFound) {
+			t.Errorf("expected domain.ErrUserNotFound, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"go-back/internal/domain"
+	"sync"
+	"time"
+)
+
+// MemoryTokenRepository keeps user tokens in process memory.
+type MemoryTokenRepository struct {
+	mu     sync.Mutex
+	tokens map[string]domain.UserToken
+}
+
+func NewMemoryTokenRepository() *MemoryTokenRepository {
+	return &MemoryTokenRepository{tokens: map[string]domain.UserToken{}}
+}
+
+func (m *MemoryTokenRepository) CreateToken(ctx context.Context, token domain.UserToken) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.tokens[token.TokenHash]; ok {
+		return domain.ErrConflict
+	}
+	token.CreatedAt = token.CreatedAt.UTC()
+	token.ExpiresAt = token.ExpiresAt.UTC()
+	m.tokens[token.TokenHash] = token
+	return nil
+}
+
+func (m *MemoryTokenRepository) ConsumeToken(ctx context.Context, tokenHash string, purpose domain.TokenPurpose) (domain.UserToken, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.UserToken{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usedAt := now()
+	token, ok := m.tokens[tokenHash]
+	if !ok || token.Purpose != purpose || token.UsedAt != nil || !token.ExpiresAt.After(usedAt) {
+		return domain.UserToken{}, domain.ErrInvalidToken
+	}
+	token.UsedAt = &usedAt
+	m.tokens[tokenHash] = token
+	return token, nil
+}
+
+func (m *MemoryTokenRepository) LatestTokenAt(ctx context.Context, userUUID string, purpose domain.TokenPurpose) (time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var latest time.Time
+	for _, token := range m.tokens {
+		if token.UserUUID == userUUID && token.Purpose == purpose && token.CreatedAt.After(latest) {
+			latest = token.CreatedAt
+		}
+	}
+	return latest, nil
+}
+
+func (m *MemoryTokenRepository) RevokeTokens(ctx context.Context, userUUID string, purpose domain.TokenPurpose) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usedAt := now()
+	for hash, token := range m.tokens {
+		if token.UserUUID == userUUID && token.Purpose == purpose && token.UsedAt == nil {
+			token.UsedAt = &usedAt
+			m.tokens[hash] = token
+		}
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-back/internal/domain"
+	"go-back/internal/storage/database"
+
+	"github.com/vingarcia/ksql"
+)
+
+type MFARepository struct {
+	db       ksql.Provider
+	timeouts QueryTimeouts
+}
+
+func NewMFARepository(db ksql.Provider, timeouts QueryTimeouts) MFARepository {
+	return MFARepository{db: db, timeouts: timeouts}
+}
+
+// GetMFA returns domain.ErrMFANotEnabled for users that never started an
+// enrollment.
+func (r MFARepository) GetMFA(ctx context.Context, userUUID string) (domain.MFA, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	var mfa domain.MFA
+	err := database.Conn(ctx, r.db).QueryOne(ctx, &mfa, r.getMFAQuery(), userUUID)
+	if errors.Is(err, ksql.ErrRecordNotFound) {
+		return domain.MFA{}, domain.ErrMFANotEnabled
+	}
+	if err != nil {
+		return domain.MFA{}, translateError(err)
+	}
+	return mfa, nil
+}
+
+// SaveMFA creates or replaces the enrollment of mfa.UserUUID.
+func (r MFARepository) SaveMFA(ctx context.Context, mfa domain.MFA) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	var confirmedAt interface{}
+	if mfa.ConfirmedAt != nil {
+		confirmedAt = mfa.ConfirmedAt.UTC()
+	}
+	_, err := database.Conn(ctx, r.db).Exec(ctx, r.saveMFAQuery(),
+		mfa.UserUUID, mfa.Secret, confirmedAt, mfa.LastUsedStep, mfa.CreatedAt.UTC(), now())
+	return translateError(err)
+}
+
+// UseTOTPStep records that a code of step was accepted. It returns
+// domain.ErrInvalidMFACode when a code of that step or a later one was
+// accepted before, so each code works once even under concurrent logins.
+func (r MFARepository) UseTOTPStep(ctx context.Context, userUUID string, step int64) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	result, err := database.Conn(ctx, r.db).Exec(ctx, r.useTOTPStepQuery(), step, now(), userUUID)
+	if err == nil {
+		err = expectAffected(result)
+	}
+	if errors.Is(err, ksql.ErrRecordNotFound) {
+		return domain.ErrInvalidMFACode
+	}
+	return translateError(err)
+}
+
+// DeleteMFA removes the enrollment and the recovery codes of the user.
+func (r MFARepository) DeleteMFA(ctx context.Context, userUUID string) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	err := database.Conn(ctx, r.db).Transaction(ctx, func(tx ksql.Provider) error {
+		if _, err := tx.Exec(ctx, r.deleteRecoveryCodesQuery(), userUUID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, r.deleteMFAQuery(), userUUID)
+		return err
+	})
+	return translateError(err)
+}
+
+// ReplaceRecoveryCodes drops the recovery codes of the user, used or not,
+// and stores hashes as the new ones.
+func (r MFARepository) ReplaceRecoveryCodes(ctx context.Context, userUUID string, hashes []string) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	err := database.Conn(ctx, r.db).Transaction(ctx, func(tx ksql.Provider) error {
+		if _, err := tx.Exec(ctx, r.deleteRecoveryCodesQuery(), userUUID); err != nil {
+			return err
+		}
+		createdAt := now()
+		for _, hash := range hashes {
+			if _, err := tx.Exec(ctx, r.createRecoveryCodeQuery(), hash, userUUID, createdAt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return translateError(err)
+}
+
+// UseRecoveryCode marks the unused recovery code with hash as used. Unknown
+// and used codes get domain.ErrInvalidMFACode.
+func (r MFARepository) UseRecoveryCode(ctx context.Context, userUUID, hash string) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	result, err := database.Conn(ctx, r.db).Exec(ctx, r.useRecoveryCodeQuery(), now(), hash, userUUID)
+	if err == nil {
+		err = expectAffected(result)
+	}
+	if errors.Is(err, ksql.ErrRecordNotFound) {
+		return domain.ErrInvalidMFACode
+	}
+	return translateError(err)
+}
+
+// CountRecoveryCodes returns how many recovery codes of the user are left.
+func (r MFARepository) CountRecoveryCodes(ctx context.Context, userUUID string) (int, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	var row struct {
+		Count int `ksql:"count"`
+	}
+	err := database.Conn(ctx, r.db).QueryOne(ctx, &row, r.countRecoveryCodesQuery(), userUUID)
+	if err != nil {
+		return 0, translateError(err)
+	}
+	return row.Count, nil
+}
+
+func (MFARepository) getMFAQuery() string {
+	return `
+		SELECT user_uuid, secret, confirmed_at, last_used_step, created_at, updated_at
+		FROM user_mfa
+		WHERE user_uuid = $1;
+	`
+}
+
+func (MFARepository) saveMFAQuery() string {
+	return `
+		INSERT INTO user_mfa (user_uuid, secret, confirmed_at, last_used_step, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_uuid) DO UPDATE
+		SET secret = excluded.secret,
+		    confirmed_at = excluded.confirmed_at,
+		    last_used_step = excluded.last_used_step,
+		    created_at = excluded.created_at,
+		    updated_at = excluded.updated_at;
+	`
+}
+
+func (MFARepository) useTOTPStepQuery() string {
+	return `
+		UPDATE user_mfa
+		SET last_used_step = $1,
+		    updated_at = $2
+		WHERE user_uuid = $3
+		  AND last_used_step < $1;
+	`
+}
+
+func (MFARepository) deleteMFAQuery() string {
+	return `
+		DELETE FROM user_mfa
+		WHERE user_uuid = $1;
+	`
+}
+
+func (MFARepository) deleteRecoveryCodesQuery() string {
+	return `
+		DELETE FROM user_recovery_codes
+		WHERE user_uuid = $1;
+	`
+}
+
+func (MFARepository) createRecoveryCodeQuery() string {
+	return `
+		INSERT INTO user_recovery_codes (code_hash, user_uuid, created_at)
+		VALUES ($1, $2, $3);
+	`
+}
+
+func (MFARepository) useRecoveryCodeQuery() string {
+	return `
+		UPDATE user_recovery_codes
+		SET used_at = $1
+		WHERE code_hash = $2
+		  AND user_uuid = $3
+		  AND used_at IS NULL;
+	`
+}
+
+func (MFARepository) countRecoveryCodesQuery() string {
+	return `
+		SELECT COUNT(*) AS count
+		FROM user_recovery_codes
+		WHERE user_uuid = $1
+		  AND used_at IS NULL;
+	`
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go-back/internal/domain"
+)
+
+type mfaStore interface {
+	GetMFA(context.Context, string) (domain.MFA, error)
+	SaveMFA(context.Context, domain.MFA) error
+	UseTOTPStep(context.Context, string, int64) error
+	DeleteMFA(context.Context, string) error
+	ReplaceRecoveryCodes(context.Context, string, []string) error
+	UseRecoveryCode(context.Context, string, string) error
+	CountRecoveryCodes(context.Context, string) (int, error)
+}
+
+func TestMFARepository(t *testing.T) {
+	backends := map[string]func(*testing.T) (mfaStore, string){
+		"memory": func(*testing.T) (mfaStore, string) { return NewMemoryMFARepository(), "u1" },
+		"sqlite": func(t *testing.T) (mfaStore, string) {
+			users := newSQLiteUserRepository(t)
+			user, err := users.CreateUser(context.Background(), domain.UserInput{Name: "John", Email: "john@example.com"})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			return NewMFARepository(users.db, QueryTimeouts{}), user.UUID
+		},
+	}
+
+	for name, newRepo := range backends {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo, userUUID := newRepo(t)
+
+			if _, err := repo.GetMFA(ctx, userUUID); !errors.Is(err, domain.ErrMFANotEnabled) {
+				t.Fatalf("expected ErrMFANotEnabled, got %v", err)
+			}
+
+			confirmedAt := now()
+			err := repo.SaveMFA(ctx, domain.MFA{UserUUID: userUUID, Secret: "SECRET", ConfirmedAt: &confirmedAt, LastUsedStep: 10, CreatedAt: confirmedAt})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			mfa, err := repo.GetMFA(ctx, userUUID)
+			if err != nil || mfa.Secret != "SECRET" || mfa.ConfirmedAt == nil || !mfa.ConfirmedAt.Equal(confirmedAt) || mfa.LastUsedStep != 10 {
+				t.Fatalf("expected the enrollment back, got %+v, %v", mfa, err)
+			}
+
+			if err := repo.UseTOTPStep(ctx, userUUID, 10); !errors.Is(err, domain.ErrInvalidMFACode) {
+				t.Errorf("expected the last used step to be refused, got %v", err)
+			}
+			if err := repo.UseTOTPStep(ctx, userUUID, 11); err != nil {
+				t.Errorf("expected a newer step to be accepted, got %v", err)
+			}
+			if err := repo.UseTOTPStep(ctx, userUUID, 11); !errors.Is(err, domain.ErrInvalidMFACode) {
+				t.Errorf("expected a replayed step to be refused, got %v", err)
+			}
+
+			if err := repo.ReplaceRecoveryCodes(ctx, userUUID, []string{"a", "b", "c"}); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if err := repo.UseRecoveryCode(ctx, userUUID, "b"); err != nil {
+				t.Errorf("expected the code to be accepted, got %v", err)
+			}
+			if err := repo.UseRecoveryCode(ctx, userUUID, "b"); !errors.Is(err, domain.ErrInvalidMFACode) {
+				t.Errorf("expected a used code to be refused, got %v", err)
+			}
+			if err := repo.UseRecoveryCode(ctx, "someone else", "a"); !errors.Is(err, domain.ErrInvalidMFACode) {
+				t.Errorf("expected the code of another user to be refused, got %v", err)
+			}
+			if count, err := repo.CountRecoveryCodes(ctx, userUUID); err != nil || count != 2 {
+				t.Errorf("expected 2 codes left, got %d, %v", count, err)
+			}
+
+			if err := repo.ReplaceRecoveryCodes(ctx, userUUID, []string{"d"}); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if err := repo.UseRecoveryCode(ctx, userUUID, "a"); !errors.Is(err, domain.ErrInvalidMFACode) {
+				t.Errorf("expected replaced codes to be refused, got %v", err)
+			}
+
+			if err := repo.DeleteMFA(ctx, userUUID); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if _, err := repo.GetMFA(ctx, userUUID); !errors.Is(err, domain.ErrMFANotEnabled) {
+				t.Errorf("expected the enrollment to be gone, got %v", err)
+			}
+			if count, _ := repo.CountRecoveryCodes(ctx, userUUID); count != 0 {
+				t.Errorf("expected the recovery codes to be gone, got %d", count)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"go-back/internal/domain"
+	"go-back/internal/storage/database"
+
+	"github.com/vingarcia/ksql"
+)
+
+type RoleRepository struct {
+	db       ksql.Provider
+	timeouts QueryTimeouts
+}
+
+func NewRoleRepository(db ksql.Provider, timeouts QueryTimeouts) RoleRepository {
+	return RoleRepository{db: db, timeouts: timeouts}
+}
+
+func (r RoleRepository) ListRoles(ctx context.Context, userUUID string) ([]domain.RoleGrant, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	grants := []domain.RoleGrant{}
+	if err := database.Conn(ctx, r.db).Query(ctx, &grants, r.listRolesQuery(), userUUID); err != nil {
+		return nil, translateError(err)
+	}
+	return grants, nil
+}
+
+// GrantRole stores grant and reports whether it was new; granting a role
+// the user already holds is a no-op.
+func (r RoleRepository) GrantRole(ctx context.Context, grant domain.RoleGrant) (bool, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	result, err := database.Conn(ctx, r.db).Exec(ctx, r.grantRoleQuery(),
+		grant.UserUUID, string(grant.Role), grant.GrantedBy, now())
+	if err != nil {
+		return false, translateError(err)
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// RevokeRole removes the role and reports whether the user held it.
+func (r RoleRepository) RevokeRole(ctx context.Context, userUUID string, role domain.Role) (bool, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	result, err := database.Conn(ctx, r.db).Exec(ctx, r.revokeRoleQuery(), userUUID, string(role))
+	if err != nil {
+		return false, translateError(err)
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (RoleRepository) listRolesQuery() string {
+	return `
+		SELECT user_uuid, role, granted_by, granted_at
+		FROM user_roles
+		WHERE user_uuid = $1
+		ORDER BY role;
+	`
+}
+
+func (RoleRepository) grantRoleQuery() string {
+	return `
+		INSERT INTO user_roles (user_uuid, role, granted_by, granted_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_uuid, role) DO NOTHING;
+	`
+}
+
+func (RoleRepository) revokeRoleQuery() string {
+	return `
+		DELETE FROM user_roles
+		WHERE user_uuid = $1
+		  AND role = $2;
+	`
+}
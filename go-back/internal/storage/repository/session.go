@@ -0,0 +1,242 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-back/internal/domain"
+	"go-back/internal/storage/database"
+
+	"github.com/google/uuid"
+	"github.com/vingarcia/ksql"
+)
+
+type SessionRepository struct {
+	db       ksql.Provider
+	timeouts QueryTimeouts
+}
+
+func NewSessionRepository(db ksql.Provider, timeouts QueryTimeouts) SessionRepository {
+	return SessionRepository{db: db, timeouts: timeouts}
+}
+
+// CreateSession stores session with a new ID, created and last used now.
+func (r SessionRepository) CreateSession(ctx context.Context, session domain.Session) (domain.Session, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	session.ID = uuid.NewString()
+	session.CreatedAt = now()
+	session.LastUsedAt = session.CreatedAt
+	session.ExpiresAt = session.ExpiresAt.UTC()
+	_, err := database.Conn(ctx, r.db).Exec(ctx, r.createSessionQuery(),
+		session.ID, session.UserUUID, session.UserAgent, session.IP, session.AMR,
+		session.CreatedAt, session.LastUsedAt, session.ExpiresAt)
+	if err != nil {
+		return domain.Session{}, translateError(err)
+	}
+	return session, nil
+}
+
+// GetSession returns the session with id, revoked or not.
+func (r SessionRepository) GetSession(ctx context.Context, id string) (domain.Session, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	if _, err := uuid.Parse(id); err != nil {
+		return domain.Session{}, domain.ErrSessionNotFound
+	}
+
+	var session domain.Session
+	err := database.Conn(ctx, r.db).QueryOne(ctx, &session, r.getSessionQuery(), id)
+	if errors.Is(err, ksql.ErrRecordNotFound) {
+		return domain.Session{}, domain.ErrSessionNotFound
+	}
+	if err != nil {
+		return domain.Session{}, translateError(err)
+	}
+	return session, nil
+}
+
+// ListSessions returns the active sessions of the user, most recently used
+// first.
+func (r SessionRepository) ListSessions(ctx context.Context, userUUID string) ([]domain.Session, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	sessions := []domain.Session{}
+	if err := database.Conn(ctx, r.db).Query(ctx, &sessions, r.listSessionsQuery(), userUUID, now()); err != nil {
+		return nil, translateError(err)
+	}
+	return sessions, nil
+}
+
+// TouchSession records a use of the session from ip and userAgent.
+func (r SessionRepository) TouchSession(ctx context.Context, id, ip, userAgent string) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	_, err := database.Conn(ctx, r.db).Exec(ctx, r.touchSessionQuery(), now(), ip, userAgent, id)
+	return translateError(err)
+}
+
+// RevokeSession revokes the session with id for reason. Sessions already
+// revoked get domain.ErrSessionNotFound.
+func (r SessionRepository) RevokeSession(ctx context.Context, id, reason string) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	if _, err := uuid.Parse(id); err != nil {
+		return domain.ErrSessionNotFound
+	}
+
+	result, err := database.Conn(ctx, r.db).Exec(ctx, r.revokeSessionQuery(), now(), reason, id)
+	if err == nil {
+		err = expectAffected(result)
+	}
+	if errors.Is(err, ksql.ErrRecordNotFound) {
+		return domain.ErrSessionNotFound
+	}
+	return translateError(err)
+}
+
+// RevokeUserSessions revokes every session of the user still active.
+func (r SessionRepository) RevokeUserSessions(ctx context.Context, userUUID, reason string) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	_, err := database.Conn(ctx, r.db).Exec(ctx, r.revokeUserSessionsQuery(), now(), reason, userUUID)
+	return translateError(err)
+}
+
+func (r SessionRepository) CreateRefreshToken(ctx context.Context, token domain.RefreshToken) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	_, err := database.Conn(ctx, r.db).Exec(ctx, r.createRefreshTokenQuery(),
+		token.TokenHash, token.SessionID, token.CreatedAt.UTC(), token.ExpiresAt.UTC())
+	return translateError(err)
+}
+
+// UseRefreshToken marks the unexpired refresh token with tokenHash as used
+// and returns it. A token used before, or by a concurrent call, is returned
+// with domain.ErrRefreshTokenReused; unknown and expired tokens get
+// domain.ErrInvalidToken.
+func (r SessionRepository) UseRefreshToken(ctx context.Context, tokenHash string) (domain.RefreshToken, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	var token domain.RefreshToken
+	err := database.Conn(ctx, r.db).Transaction(ctx, func(tx ksql.Provider) error {
+		if err := tx.QueryOne(ctx, &token, r.getRefreshTokenQuery(), tokenHash); err != nil {
+			return err
+		}
+		if token.UsedAt != nil {
+			return domain.ErrRefreshTokenReused
+		}
+
+		usedAt := now()
+		if !usedAt.Before(token.ExpiresAt) {
+			return domain.ErrInvalidToken
+		}
+		result, err := tx.Exec(ctx, r.useRefreshTokenQuery(), usedAt, tokenHash)
+		if err != nil {
+			return err
+		}
+		if err := expectAffected(result); err != nil {
+			return domain.ErrRefreshTokenReused
+		}
+		token.UsedAt = &usedAt
+		return nil
+	})
+	switch {
+	case errors.Is(err, ksql.ErrRecordNotFound):
+		return domain.RefreshToken{}, domain.ErrInvalidToken
+	case errors.Is(err, domain.ErrRefreshTokenReused):
+		return token, err
+	case errors.Is(err, domain.ErrInvalidToken):
+		return domain.RefreshToken{}, err
+	case err != nil:
+		return domain.RefreshToken{}, translateError(err)
+	}
+	return token, nil
+}
+
+func (SessionRepository) createSessionQuery() string {
+	return `
+		INSERT INTO user_sessions (id, user_uuid, user_agent, ip, amr, created_at, last_used_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
+	`
+}
+
+func (SessionRepository) getSessionQuery() string {
+	return `
+		SELECT id, user_uuid, user_agent, ip, amr, created_at, last_used_at, expires_at, revoked_at, revoked_reason
+		FROM user_sessions
+		WHERE id = $1;
+	`
+}
+
+func (SessionRepository) listSessionsQuery() string {
+	return `
+		SELECT id, user_uuid, user_agent, ip, amr, created_at, last_used_at, expires_at, revoked_at, revoked_reason
+		FROM user_sessions
+		WHERE user_uuid = $1
+		  AND revoked_at IS NULL
+		  AND expires_at > $2
+		ORDER BY last_used_at DESC;
+	`
+}
+
+func (SessionRepository) touchSessionQuery() string {
+	return `
+		UPDATE user_sessions
+		SET last_used_at = $1,
+		    ip = $2,
+		    user_agent = $3
+		WHERE id = $4;
+	`
+}
+
+func (SessionRepository) revokeSessionQuery() string {
+	return `
+		UPDATE user_sessions
+		SET revoked_at = $1,
+		    revoked_reason = $2
+		WHERE id = $3
+		  AND revoked_at IS NULL;
+	`
+}
+
+func (SessionRepository) revokeUserSessionsQuery() string {
+	return `
+		UPDATE user_sessions
+		SET revoked_at = $1,
+		    revoked_reason = $2
+		WHERE user_uuid = $3
+		  AND revoked_at IS NULL;
+	`
+}
+
+func (SessionRepository) createRefreshTokenQuery() string {
+	return `
+		INSERT INTO session_refresh_tokens (token_hash, session_id, created_at, expires_at)
+		VALUES ($1, $2, $3, $4);
+	`
+}
+
+func (SessionRepository) getRefreshTokenQuery() string {
+	return `
+		SELECT token_hash, session_id, created_at, expires_at, used_at
+		FROM session_refresh_tokens
+		WHERE token_hash = $1;
+	`
+}
+
+func (SessionRepository) useRefreshTokenQuery() string {
+	return `
+		UPDATE session_refresh_tokens
+		SET used_at = $1
+		WHERE token_hash = $2
+		  AND used_at IS NULL;
+	`
+}
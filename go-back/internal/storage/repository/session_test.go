@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-back/internal/domain"
+)
+
+type sessionStore interface {
+	CreateSession(context.Context, domain.Session) (domain.Session, error)
+	GetSession(context.Context, string) (domain.Session, error)
+	ListSessions(context.Context, string) ([]domain.Session, error)
+	TouchSession(context.Context, string, string, string) error
+	RevokeSession(context.Context, string, string) error
+	RevokeUserSessions(context.Context, string, string) error
+	CreateRefreshToken(context.Context, domain.RefreshToken) error
+	UseRefreshToken(context.Context, string) (domain.RefreshToken, error)
+}
+
+func TestSessionRepository(t *testing.T) {
+	backends := map[string]func(*testing.T) (sessionStore, string){
+		"memory": func(*testing.T) (sessionStore, string) { return NewMemorySessionRepository(), "u1" },
+		"sqlite": func(t *testing.T) (sessionStore, string) {
+			users := newSQLiteUserRepository(t)
+			user, err := users.CreateUser(context.Background(), domain.UserInput{Name: "John", Email: "john@example.com"})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			return NewSessionRepository(users.db, QueryTimeouts{}), user.UUID
+		},
+	}
+
+	for name, newRepo := range backends {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo, userUUID := newRepo(t)
+
+			expiresAt := now().Add(time.Hour)
+			first, err := repo.CreateSession(ctx, domain.Session{UserUUID: userUUID, UserAgent: "curl", IP: "10.0.0.1", AMR: "pwd", ExpiresAt: expiresAt})
+			if err != nil || first.ID == "" {
+				t.Fatalf("expected a session, got %+v, %v", first, err)
+			}
+			second, err := repo.CreateSession(ctx, domain.Session{UserUUID: userUUID, UserAgent: "firefox", IP: "10.0.0.2", AMR: "pwd otp mfa", ExpiresAt: expiresAt})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if _, err := repo.CreateSession(ctx, domain.Session{UserUUID: userUUID, AMR: "pwd", ExpiresAt: now().Add(-time.Minute)}); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if err := repo.TouchSession(ctx, first.ID, "10.0.0.3", "curl/8"); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			sessions, err := repo.ListSessions(ctx, userUUID)
+			if err != nil || len(sessions) != 2 || sessions[0].ID != first.ID || sessions[0].IP != "10.0.0.3" || sessions[1].AMR != "pwd otp mfa" {
+				t.Fatalf("expected both active sessions, the touched one first, got %+v, %v", sessions, err)
+			}
+
+			t.Run("rotates refresh tokens once", func(t *testing.T) {
+				err := repo.CreateRefreshToken(ctx, domain.RefreshToken{TokenHash: "h1", SessionID: first.ID, CreatedAt: now(), ExpiresAt: expiresAt})
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				token, err := repo.UseRefreshToken(ctx, "h1")
+				if err != nil || token.SessionID != first.ID || token.UsedAt == nil {
+					t.Fatalf("expected the token to be used, got %+v, %v", token, err)
+				}
+				if token, err := repo.UseRefreshToken(ctx, "h1"); !errors.Is(err, domain.ErrRefreshTokenReused) || token.SessionID != first.ID {
+					t.Errorf("expected the reuse to name the session, got %+v, %v", token, err)
+				}
+				if _, err := repo.UseRefreshToken(ctx, "unknown"); !errors.Is(err, domain.ErrInvalidToken) {
+					t.Errorf("expected ErrInvalidToken, got %v", err)
+				}
+
+				err = repo.CreateRefreshToken(ctx, domain.RefreshToken{TokenHash: "h2", SessionID: first.ID, CreatedAt: now(), ExpiresAt: now().Add(-time.Second)})
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if _, err := repo.UseRefreshToken(ctx, "h2"); !errors.Is(err, domain.ErrInvalidToken) {
+					t.Errorf("expected an expired token to be refused, got %v", err)
+				}
+			})
+
+			t.Run("revokes sessions", func(t *testing.T) {
+				if err := repo.RevokeSession(ctx, first.ID, domain.SessionLogout); err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if err := repo.RevokeSession(ctx, first.ID, domain.SessionLogout); !errors.Is(err, domain.ErrSessionNotFound) {
+					t.Errorf("expected a revoked session to be gone, got %v", err)
+				}
+				if err := repo.RevokeSession(ctx, "not-a-uuid", domain.SessionLogout); !errors.Is(err, domain.ErrSessionNotFound) {
+					t.Errorf("expected ErrSessionNotFound, got %v", err)
+				}
+				session, err := repo.GetSession(ctx, first.ID)
+				if err != nil || session.RevokedAt == nil || session.RevokedReason != domain.SessionLogout {
+					t.Errorf("expected the revocation to be kept, got %+v, %v", session, err)
+				}
+
+				if err := repo.RevokeUserSessions(ctx, userUUID, domain.SessionUserDeactivated); err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if sessions, _ := repo.ListSessions(ctx, userUUID); len(sessions) != 0 {
+					t.Errorf("expected no active session, got %+v", sessions)
+				}
+				if session, _ := repo.GetSession(ctx, second.ID); session.RevokedReason != domain.SessionUserDeactivated {
+					t.Errorf("expected the second session to be revoked, got %+v", session)
+				}
+				if session, _ := repo.GetSession(ctx, first.ID); session.RevokedReason != domain.SessionLogout {
+					t.Errorf("expected the first revocation to be kept, got %+v", session)
+				}
+			})
+		})
+	}
+}
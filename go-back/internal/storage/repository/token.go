@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-back/internal/domain"
+	"go-back/internal/storage/database"
+	"time"
+
+	"github.com/vingarcia/ksql"
+)
+
+// TokenRepository keeps single-use user tokens. It needs the dialect to
+// lock users in LatestTokenAt, which only PostgreSQL has to: SQLite runs
+// one write transaction at a time anyway.
+type TokenRepository struct {
+	db       ksql.Provider
+	dialect  database.Dialect
+	timeouts QueryTimeouts
+}
+
+func NewTokenRepository(db ksql.Provider, dialect database.Dialect, timeouts QueryTimeouts) TokenRepository {
+	return TokenRepository{db: db, dialect: dialect, timeouts: timeouts}
+}
+
+func (r TokenRepository) CreateToken(ctx context.Context, token domain.UserToken) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	_, err := database.Conn(ctx, r.db).Exec(ctx, r.createTokenQuery(),
+		token.TokenHash, token.UserUUID, string(token.Purpose), token.Email,
+		token.CreatedAt.UTC(), token.ExpiresAt.UTC())
+	return translateError(err)
+}
+
+// ConsumeToken marks the unused, unexpired token with tokenHash and purpose
+// as used and returns it. Only one of several concurrent calls succeeds;
+// the others, like unknown or expired tokens, get domain.ErrInvalidToken.
+func (r TokenRepository) ConsumeToken(ctx context.Context, tokenHash string, purpose domain.TokenPurpose) (domain.UserToken, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	var token domain.UserToken
+	err := database.Conn(ctx, r.db).Transaction(ctx, func(tx ksql.Provider) error {
+		usedAt := now()
+		result, err := tx.Exec(ctx, r.consumeTokenQuery(), usedAt, tokenHash, string(purpose), usedAt)
+		if err != nil {
+			return err
+		}
+		if err := expectAffected(result); err != nil {
+			return err
+		}
+
+		return tx.QueryOne(ctx, &token, r.getTokenQuery(), tokenHash)
+	})
+	if errors.Is(err, ksql.ErrRecordNotFound) {
+		return domain.UserToken{}, domain.ErrInvalidToken
+	}
+	if err != nil {
+		return domain.UserToken{}, translateError(err)
+	}
+	return token, nil
+}
+
+// LatestTokenAt returns when the newest token of purpose was issued to the
+// user, or the zero time if none was. In a transaction it locks the user
+// until the transaction ends, so callers that check it before issuing a
+// token take turns and cannot both issue one.
+func (r TokenRepository) LatestTokenAt(ctx context.Context, userUUID string, purpose domain.TokenPurpose) (time.Time, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	var token domain.UserToken
+	err := database.Conn(ctx, r.db).Transaction(ctx, func(tx ksql.Provider) error {
+		if r.dialect == database.Postgres {
+			if _, err := tx.Exec(ctx, r.lockUserQuery(), userUUID); err != nil {
+				return err
+			}
+		}
+		return tx.QueryOne(ctx, &token, r.latestTokenQuery(), userUUID, string(purpose))
+	})
+	if errors.Is(err, ksql.ErrRecordNotFound) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, translateError(err)
+	}
+	return token.CreatedAt, nil
+}
+
+// RevokeTokens marks every unused token of purpose issued to the user as
+// used.
+func (r TokenRepository) RevokeTokens(ctx context.Context, userUUID string, purpose domain.TokenPurpose) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	_, err := database.Conn(ctx, r.db).Exec(ctx, r.revokeTokensQuery(), now(), userUUID, string(purpose))
+	return translateError(err)
+}
+
+func (TokenRepository) createTokenQuery() string {
+	return `
+		INSERT INTO user_tokens (token_hash, user_uuid, purpose, email, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6);
+	`
+}
+
+func (TokenRepository) consumeTokenQuery() string {
+	return `
+		UPDATE user_tokens
+		SET used_at = $1
+		WHERE token_hash = $2
+		  AND purpose = $3
+		  AND used_at IS NULL
+		  AND expires_at > $4;
+	`
+}
+
+func (TokenRepository) getTokenQuery() string {
+	return `
+		SELECT token_hash, user_uuid, purpose, email, created_at, expires_at, used_at
+		FROM user_tokens
+		WHERE token_hash = $1;
+	`
+}
+
+func (TokenRepository) lockUserQuery() string {
+	return `
+		SELECT uuid
+		FROM users
+		WHERE uuid = $1
+		FOR UPDATE;
+	`
+}
+
+func (TokenRepository) latestTokenQuery() string {
+	return `
+		SELECT token_hash, user_uuid, purpose, email, created_at, expires_at, used_at
+		FROM user_tokens
+		WHERE user_uuid = $1
+		  AND purpose = $2
+		ORDER BY created_at DESC
+		LIMIT 1;
+	`
+}
+
+func (TokenRepository) revokeTokensQuery() string {
+	return `
+		UPDATE user_tokens
+		SET used_at = $1
+		WHERE user_uuid = $2
+		  AND purpose = $3
+		  AND used_at IS NULL;
+	`
+}
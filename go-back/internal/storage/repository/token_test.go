@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-back/internal/domain"
+	"go-back/internal/storage/database"
+)
+
+type tokenStore interface {
+	CreateToken(context.Context, domain.UserToken) error
+	ConsumeToken(context.Context, string, domain.TokenPurpose) (domain.UserToken, error)
+	LatestTokenAt(context.Context, string, domain.TokenPurpose) (time.Time, error)
+	RevokeTokens(context.Context, string, domain.TokenPurpose) error
+}
+
+func TestTokenRepository(t *testing.T) {
+	backends := map[string]func(*testing.T) (tokenStore, string){
+		"memory": func(*testing.T) (tokenStore, string) { return NewMemoryTokenRepository(), "u1" },
+		"sqlite": func(t *testing.T) (tokenStore, string) {
+			users := newSQLiteUserRepository(t)
+			user, err := users.CreateUser(context.Background(), domain.UserInput{Name: "John", Email: "john@example.com"})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			return NewTokenRepository(users.db, database.SQLite, QueryTimeouts{}), user.UUID
+		},
+	}
+
+	for name, newRepo := range backends {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo, userUUID := newRepo(t)
+
+			if latest, err := repo.LatestTokenAt(ctx, userUUID, domain.TokenEmailVerification); err != nil || !latest.IsZero() {
+				t.Fatalf("expected no token yet, got %v, %v", latest, err)
+			}
+
+			issuedAt := now()
+			for hash, expiresAt := range map[string]time.Time{
+				"valid":   issuedAt.Add(time.Hour),
+				"expired": issuedAt.Add(-time.Minute),
+				"revoked": issuedAt.Add(time.Hour),
+			} {
+				err := repo.CreateToken(ctx, domain.UserToken{
+					TokenHash: hash,
+					UserUUID:  userUUID,
+					Purpose:   domain.TokenEmailVerification,
+					Email:     "john@example.com",
+					CreatedAt: issuedAt.Add(-2 * time.Minute),
+					ExpiresAt: expiresAt,
+				})
+				if err != nil {
+					t.Fatalf("expected no error creating %s, got %v", hash, err)
+				}
+			}
+
+			latest, err := repo.LatestTokenAt(ctx, userUUID, domain.TokenEmailVerification)
+			if err != nil || !latest.Equal(issuedAt.Add(-2*time.Minute)) {
+				t.Errorf("expected the creation time of the newest token, got %v, %v", latest, err)
+			}
+
+			if _, err := repo.ConsumeToken(ctx, "valid", "password_reset"); !errors.Is(err, domain.ErrInvalidToken) {
+				t.Errorf("expected a token of another purpose to be invalid, got %v", err)
+			}
+			if _, err := repo.ConsumeToken(ctx, "expired", domain.TokenEmailVerification); !errors.Is(err, domain.ErrInvalidToken) {
+				t.Errorf("expected an expired token to be invalid, got %v", err)
+			}
+
+			token, err := repo.ConsumeToken(ctx, "valid", domain.TokenEmailVerification)
+			if err != nil || token.UserUUID != userUUID || token.Email != "john@example.com" || token.UsedAt == nil {
+				t.Fatalf("expected the token to be consumed, got %+v, %v", token, err)
+			}
+			if _, err := repo.ConsumeToken(ctx, "valid", domain.TokenEmailVerification); !errors.Is(err, domain.ErrInvalidToken) {
+				t.Errorf("expected a used token to be invalid, got %v", err)
+			}
+
+			if err := repo.RevokeTokens(ctx, userUUID, domain.TokenEmailVerification); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if _, err := repo.ConsumeToken(ctx, "revoked", domain.TokenEmailVerification); !errors.Is(err, domain.ErrInvalidToken) {
+				t.Errorf("expected a revoked token to be invalid, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMarkEmailVerified_SQLite(t *testing.T) {
+	ctx := context.Background()
+	repo := newSQLiteUserRepository(t)
+
+	user, _ := repo.CreateUser(ctx, domain.UserInput{Name: "John", Email: "john@example.com"})
+	if user.EmailVerifiedAt != nil {
+		t.Fatalf("expected a new user to be unverified, got %v", user.EmailVerifiedAt)
+	}
+
+	if _, err := repo.MarkEmailVerified(ctx, user.UUID, "old@example.com"); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Errorf("expected another email not to match, got %v", err)
+	}
+
+	verified, err := repo.MarkEmailVerified(ctx, user.UUID, "john@example.com")
+	if err != nil || verified.EmailVerifiedAt == nil || verified.Version != user.Version+1 {
+		t.Fatalf("expected the email to be verified, got %+v, %v", verified, err)
+	}
+
+	renamed := verified
+	renamed.Name = "Johnny"
+	renamed, err = repo.UpdateUser(ctx, renamed)
+	if err != nil || renamed.EmailVerifiedAt == nil {
+		t.Errorf("expected a name change to keep the verification, got %+v, %v", renamed, err)
+	}
+
+	renamed.Email = "johnny@example.com"
+	moved, err := repo.UpdateUser(ctx, renamed)
+	if err != nil || moved.EmailVerifiedAt != nil {
+		t.Errorf("expected an email change to reset the verification, got %+v, %v", moved, err)
+	}
+}
@@ -2,49 +2,91 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"go-back/internal/domain"
-	postgres "go-back/internal/storage/database"
+	"go-back/internal/storage/database"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vingarcia/ksql"
 )
 
-type UserRepository struct{}
+const userColumns = "uuid, name, email, created_at, updated_at, is_active, deleted_at, version, email_verified_at"
+
+type QueryTimeouts struct {
+	Read  time.Duration
+	Write time.Duration
+}
+
+type UserRepository struct {
+	db       ksql.Provider
+	timeouts QueryTimeouts
+}
+
+func NewUserRepository(db ksql.Provider, timeouts QueryTimeouts) UserRepository {
+	return UserRepository{db: db, timeouts: timeouts}
+}
+
+// conn joins the transaction started by a database.Transactor, if any.
+func (u UserRepository) conn(ctx context.Context) ksql.Provider {
+	return database.Conn(ctx, u.db)
+}
 
-func (u UserRepository) ListAllUsers() ([]domain.User, error) {
-	ctx := context.Background()
-	db := postgres.GetDB()
-	defer db.Close()
+func (u UserRepository) ListAllUsers(ctx context.Context, filter domain.UserFilter) ([]domain.User, error) {
+	ctx, cancel := withTimeout(ctx, u.timeouts.Read)
+	defer cancel()
+
+	query, params, err := u.getAllUsersQuery(filter)
+	if err != nil {
+		return nil, translateError(err)
+	}
 
 	var users []domain.User
-	err := db.Query(ctx, &users, u.getAllUsersQuery())
+	err = u.conn(ctx).Query(ctx, &users, query, params...)
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 
 	return users, nil
 }
 
-func (u UserRepository) ListUserByUUID(userUUID string) (domain.User, error) {
-	ctx := context.Background()
-	db := postgres.GetDB()
-	defer db.Close()
+func (u UserRepository) ListUserByUUID(ctx context.Context, userUUID string) (domain.User, error) {
+	ctx, cancel := withTimeout(ctx, u.timeouts.Read)
+	defer cancel()
+
+	var user domain.User
+	err := u.conn(ctx).QueryOne(ctx, &user, u.getUserByUUIDQuery(), userUUID)
+	if err != nil {
+		return domain.User{}, translateError(err)
+	}
+
+	return user, nil
+}
+
+func (u UserRepository) ListUserByUUIDWithDeleted(ctx context.Context, userUUID string) (domain.User, error) {
+	ctx, cancel := withTimeout(ctx, u.timeouts.Read)
+	defer cancel()
 
 	var user domain.User
-	err := db.QueryOne(ctx, &user, u.getUserByUUIDQuery(), userUUID)
+	err := u.conn(ctx).QueryOne(ctx, &user, u.getUserByUUIDWithDeletedQuery(), userUUID)
 	if err != nil {
-		return user, err
+		return domain.User{}, translateError(err)
 	}
 
 	return user, nil
 }
 
-func (u UserRepository) ListUserByEmail(email string) (domain.User, error) {
-	ctx := context.Background()
-	db := postgres.GetDB()
-	defer db.Close()
+func (u UserRepository) ListUserByEmail(ctx context.Context, email string) (domain.User, error) {
+	ctx, cancel := withTimeout(ctx, u.timeouts.Read)
+	defer cancel()
 
 	var user domain.User
-	err := db.QueryOne(ctx, &user, u.getUserByEmailQuery(), email)
+	err := u.conn(ctx).QueryOne(ctx, &user, u.getUserByEmailQuery(), email)
 	if err != nil {
-		return user, err
+		return domain.User{}, translateError(err)
 	}
 
 	return user, nil
@@ -52,90 +94,258 @@ func (u UserRepository) ListUserByEmail(email string) (domain.User, error) {
 
 func (UserRepository) getUserByEmailQuery() string {
 	return `
-		SELECT uuid, name, email, created_at, updated_at
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE email = $1
+		  AND deleted_at IS NULL
 		LIMIT 1;
 	`
 }
 
-func (u UserRepository) ManageActivateUser(userUUID string) (domain.User, error) {
-	ctx := context.Background()
-	db := postgres.GetDB()
-	defer db.Close()
+// ManageActivateUser toggles is_active. A non zero expectedVersion makes the
+// update conditional on the user still being at that version.
+func (u UserRepository) ManageActivateUser(ctx context.Context, userUUID string, expectedVersion int) (domain.User, error) {
+	ctx, cancel := withTimeout(ctx, u.timeouts.Write)
+	defer cancel()
 
 	var updatedUser domain.User
-	err := db.QueryOne(ctx, &updatedUser, u.manageActivateUserQuery(), userUUID)
+	err := u.conn(ctx).Transaction(ctx, func(tx ksql.Provider) error {
+		result, err := tx.Exec(ctx, u.manageActivateUserQuery(), now(), userUUID, expectedVersion)
+		if err != nil {
+			return err
+		}
+		if err := u.expectUpdated(ctx, tx, result, userUUID); err != nil {
+			return err
+		}
+
+		return tx.QueryOne(ctx, &updatedUser, u.getUserByUUIDQuery(), userUUID)
+	})
 	if err != nil {
-		return domain.User{}, err
+		return domain.User{}, translateError(err)
 	}
 
 	return updatedUser, nil
 }
 
-func (u UserRepository) UpdateUser(user domain.User) (domain.User, error) {
-	ctx := context.Background()
-	db := postgres.GetDB()
-	defer db.Close()
+// UpdateUser writes name and email only if the stored version still equals
+// user.Version, so concurrent edits cannot silently overwrite each other.
+func (u UserRepository) UpdateUser(ctx context.Context, user domain.User) (domain.User, error) {
+	ctx, cancel := withTimeout(ctx, u.timeouts.Write)
+	defer cancel()
 
 	var updatedUser domain.User
-	err := db.QueryOne(ctx, &updatedUser, u.updateUserQuery(),
-		user.Name, user.Email, user.UUID)
+	err := u.conn(ctx).Transaction(ctx, func(tx ksql.Provider) error {
+		result, err := tx.Exec(ctx, u.updateUserQuery(),
+			user.Name, user.Email, now(), user.UUID, user.Version)
+		if err != nil {
+			return err
+		}
+		if err := u.expectUpdated(ctx, tx, result, user.UUID); err != nil {
+			return err
+		}
+
+		return tx.QueryOne(ctx, &updatedUser, u.getUserByUUIDQuery(), user.UUID)
+	})
 	if err != nil {
-		return domain.User{}, err
+		return domain.User{}, translateError(err)
 	}
 
 	return updatedUser, nil
 }
 
-func (u UserRepository) CreateUser(user domain.UserInput) (domain.User, error) {
-	ctx := context.Background()
-	db := postgres.GetDB()
-	defer db.Close()
+// MarkEmailVerified records that the user proved they own email. It
+// matches nothing, reporting domain.ErrUserNotFound, once the user changed
+// their email, so a token mailed to an old address cannot verify a new one.
+func (u UserRepository) MarkEmailVerified(ctx context.Context, userUUID, email string) (domain.User, error) {
+	ctx, cancel := withTimeout(ctx, u.timeouts.Write)
+	defer cancel()
+
+	var verifiedUser domain.User
+	err := u.conn(ctx).Transaction(ctx, func(tx ksql.Provider) error {
+		verifiedAt := now()
+		result, err := tx.Exec(ctx, u.markEmailVerifiedQuery(), verifiedAt, verifiedAt, userUUID, email)
+		if err != nil {
+			return err
+		}
+		if err := expectAffected(result); err != nil {
+			return err
+		}
 
-	var createdUser domain.User
-	err := db.QueryOne(ctx, &createdUser, u.createUserQuery(), user.Name, user.Email)
+		return tx.QueryOne(ctx, &verifiedUser, u.getUserByUUIDQuery(), userUUID)
+	})
 	if err != nil {
-		return domain.User{}, err
+		return domain.User{}, translateError(err)
+	}
+
+	return verifiedUser, nil
+}
+
+func (u UserRepository) CreateUser(ctx context.Context, user domain.UserInput) (domain.User, error) {
+	ctx, cancel := withTimeout(ctx, u.timeouts.Write)
+	defer cancel()
+
+	createdAt := now()
+	createdUser := domain.User{
+		UUID:      uuid.NewString(),
+		Name:      user.Name,
+		Email:     user.Email,
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+		IsActive:  true,
+		Version:   1,
+	}
+
+	_, err := u.conn(ctx).Exec(ctx, u.createUserQuery(),
+		createdUser.UUID, createdUser.Name, createdUser.Email,
+		createdUser.IsActive, createdUser.CreatedAt, createdUser.UpdatedAt, createdUser.Version)
+	if err != nil {
+		return domain.User{}, translateError(err)
 	}
 
 	return createdUser, nil
 }
 
-func (u UserRepository) DeleteUser(userUUID string) error {
-	ctx := context.Background()
-	db := postgres.GetDB()
-	defer db.Close()
+func (u UserRepository) DeleteUser(ctx context.Context, userUUID string) error {
+	ctx, cancel := withTimeout(ctx, u.timeouts.Write)
+	defer cancel()
+
+	deletedAt := now()
+	result, err := u.conn(ctx).Exec(ctx, u.deleteUserQuery(), deletedAt, deletedAt, userUUID)
+	if err != nil {
+		return translateError(err)
+	}
+
+	return translateError(expectAffected(result))
+}
+
+func (u UserRepository) RestoreUser(ctx context.Context, userUUID string) (domain.User, error) {
+	ctx, cancel := withTimeout(ctx, u.timeouts.Write)
+	defer cancel()
 
-	_, err := db.Exec(ctx, u.deleteUserQuery(), userUUID)
+	var restoredUser domain.User
+	err := u.conn(ctx).Transaction(ctx, func(tx ksql.Provider) error {
+		if _, err := tx.Exec(ctx, u.restoreUserQuery(), now(), userUUID); err != nil {
+			return err
+		}
+
+		// Restoring a user that is not deleted is a no-op; only a uuid that
+		// never existed (or was already purged) is reported as not found.
+		return tx.QueryOne(ctx, &restoredUser, u.getUserByUUIDQuery(), userUUID)
+	})
 	if err != nil {
+		return domain.User{}, translateError(err)
+	}
+
+	return restoredUser, nil
+}
+
+// PurgeDeletedUsers hard deletes users soft deleted before deletedBefore and
+// returns them as they were right before removal.
+func (u UserRepository) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) ([]domain.User, error) {
+	ctx, cancel := withTimeout(ctx, u.timeouts.Write)
+	defer cancel()
+
+	var purgedUsers []domain.User
+	err := u.conn(ctx).Transaction(ctx, func(tx ksql.Provider) error {
+		if err := tx.Query(ctx, &purgedUsers, u.getPurgeableUsersQuery(), deletedBefore.UTC()); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, u.purgeDeletedUsersQuery(), deletedBefore.UTC())
 		return err
+	})
+	if err != nil {
+		return nil, translateError(err)
 	}
 
-	return nil
+	return purgedUsers, nil
+}
+
+// getAllUsersQuery builds a keyset paginated query. The sort column always
+// comes from the whitelist validated in domain.UserFilter, never from raw
+// user input, so it is safe to interpolate.
+func (UserRepository) getAllUsersQuery(filter domain.UserFilter) (string, []interface{}, error) {
+	var conditions []string
+	var params []interface{}
+	param := func(value interface{}) string {
+		params = append(params, value)
+		return "$" + strconv.Itoa(len(params))
+	}
+
+	if !filter.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+	if filter.IsActive != nil {
+		conditions = append(conditions, "is_active = "+param(*filter.IsActive))
+	}
+	if filter.EmailDomain != "" {
+		conditions = append(conditions, "LOWER(email) LIKE "+param("%@"+escapeLike(strings.ToLower(filter.EmailDomain)))+` ESCAPE '\'`)
+	}
+	if filter.CreatedAfter != nil {
+		conditions = append(conditions, "created_at > "+param(filter.CreatedAfter.UTC()))
+	}
+	if filter.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < "+param(filter.CreatedBefore.UTC()))
+	}
+	if filter.Query != "" {
+		conditions = append(conditions, "LOWER(name) LIKE "+param("%"+escapeLike(strings.ToLower(filter.Query))+"%")+` ESCAPE '\'`)
+	}
+
+	column, desc := filter.SortColumn()
+	direction, comparison := "ASC", ">"
+	if desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	if filter.After != nil {
+		value, err := filter.AfterValue()
+		if err != nil {
+			return "", nil, err
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s, uuid) %s (%s, %s)",
+			column, comparison, param(value), param(filter.After.UUID)))
+	}
+
+	query := `
+		SELECT ` + userColumns + `
+		FROM users`
+	if len(conditions) > 0 {
+		query += "\n\t\tWHERE " + strings.Join(conditions, "\n\t\t  AND ")
+	}
+	query += fmt.Sprintf("\n\t\tORDER BY %s %s, uuid %s", column, direction, direction)
+	if filter.Limit > 0 {
+		query += "\n\t\tLIMIT " + param(filter.Limit)
+	}
+
+	return query, params, nil
 }
 
-func (UserRepository) getAllUsersQuery() string {
+func (UserRepository) getUserByUUIDQuery() string {
 	return `
-		SELECT uuid, name, email, created_at, updated_at, is_active
+		SELECT ` + userColumns + `
 		FROM users
+		WHERE uuid = $1
+		  AND deleted_at IS NULL
+		LIMIT 1;
 	`
 }
 
-func (UserRepository) getUserByUUIDQuery() string {
+func (UserRepository) getUserByUUIDWithDeletedQuery() string {
 	return `
-		SELECT uuid, name, email, created_at, updated_at, is_active
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE uuid = $1
 		LIMIT 1;
 	`
 }
 
+// The write queries below avoid RETURNING, NOW() and NOT on booleans so they
+// run unchanged on both PostgreSQL and SQLite; UUIDs and timestamps are
+// generated in Go and the affected row is read back inside the transaction.
+
 func (UserRepository) createUserQuery() string {
 	return `
-		INSERT INTO users (name, email)
-		VALUES ($1, $2)
-		RETURNING uuid, name, email, created_at, updated_at, is_active;
+		INSERT INTO users (uuid, name, email, is_active, created_at, updated_at, version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7);
 	`
 }
 
@@ -144,25 +354,118 @@ func (UserRepository) updateUserQuery() string {
 		UPDATE users
 		SET name = $1,
 			email = $2,
-			updated_at = NOW()
+			email_verified_at = CASE WHEN email = $2 THEN email_verified_at ELSE NULL END,
+			updated_at = $3,
+			version = version + 1
+		WHERE uuid = $4
+		  AND version = $5
+		  AND deleted_at IS NULL;
+	`
+}
+
+func (UserRepository) markEmailVerifiedQuery() string {
+	return `
+		UPDATE users
+		SET email_verified_at = $1,
+		    updated_at = $2,
+		    version = version + 1
 		WHERE uuid = $3
-		RETURNING uuid, name, email, created_at, updated_at, is_active;
+		  AND email = $4
+		  AND email_verified_at IS NULL
+		  AND deleted_at IS NULL;
 	`
 }
 
 func (UserRepository) manageActivateUserQuery() string {
 	return `
 		UPDATE users
-		SET is_active = NOT is_active,
-		    updated_at = NOW()
-		WHERE uuid = $1
-		RETURNING uuid, name, email, created_at, updated_at, is_active;
+		SET is_active = CASE WHEN is_active THEN FALSE ELSE TRUE END,
+		    updated_at = $1,
+		    version = version + 1
+		WHERE uuid = $2
+		  AND ($3 = 0 OR version = $3)
+		  AND deleted_at IS NULL;
 	`
 }
 
 func (UserRepository) deleteUserQuery() string {
+	return `
+		UPDATE users
+		SET deleted_at = $1,
+		    updated_at = $2,
+		    version = version + 1
+		WHERE uuid = $3
+		  AND deleted_at IS NULL;
+	`
+}
+
+func (UserRepository) restoreUserQuery() string {
+	return `
+		UPDATE users
+		SET deleted_at = NULL,
+		    updated_at = $1,
+		    version = version + 1
+		WHERE uuid = $2
+		  AND deleted_at IS NOT NULL;
+	`
+}
+
+func (UserRepository) getPurgeableUsersQuery() string {
+	return `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE deleted_at IS NOT NULL
+		  AND deleted_at < $1;
+	`
+}
+
+func (UserRepository) purgeDeletedUsersQuery() string {
 	return `
 		DELETE FROM users
-		WHERE uuid = $1;
+		WHERE deleted_at IS NOT NULL
+		  AND deleted_at < $1;
 	`
 }
+
+// expectAffected reports ksql.ErrRecordNotFound when a write matched no rows.
+func expectAffected(result ksql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ksql.ErrRecordNotFound
+	}
+	return nil
+}
+
+// expectUpdated tells a conditional update that lost the race apart from one
+// aimed at a user that does not exist.
+func (u UserRepository) expectUpdated(ctx context.Context, tx ksql.Provider, result ksql.Result, userUUID string) error {
+	err := expectAffected(result)
+	if !errors.Is(err, ksql.ErrRecordNotFound) {
+		return err
+	}
+
+	var current domain.User
+	if lookupErr := tx.QueryOne(ctx, &current, u.getUserByUUIDQuery(), userUUID); lookupErr != nil {
+		return lookupErr
+	}
+	return domain.ErrVersionMismatch
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// now matches the microsecond precision PostgreSQL stores timestamps with.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
@@ -0,0 +1,327 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	config "go-back/internal/cmd/server"
+	"go-back/internal/domain"
+	"go-back/internal/storage/database"
+	"go-back/internal/storage/migration"
+
+	"github.com/jackc/pgconn"
+	"github.com/vingarcia/ksql"
+)
+
+func newSQLiteUserRepository(t *testing.T) UserRepository {
+	t.Helper()
+	ctx := context.Background()
+
+	config.SQLITE_PATH = ":memory:"
+	db, err := database.NewSQLiteDB(ctx)
+	if err != nil {
+		t.Fatalf("expected no error opening sqlite, got %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migration.NewMigrator(db, database.SQLite)
+	if err != nil {
+		t.Fatalf("expected no error loading migrations, got %v", err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("expected no error applying migrations, got %v", err)
+	}
+
+	return NewUserRepository(db, QueryTimeouts{})
+}
+
+func TestUserRepository_SQLite(t *testing.T) {
+	ctx := context.Background()
+	repo := newSQLiteUserRepository(t)
+
+	created, err := repo.CreateUser(ctx, domain.UserInput{Name: "John", Email: "john@example.com"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if created.UUID == "" || !created.IsActive {
+		t.Fatalf("expected generated uuid and active user, got %v", created)
+	}
+
+	t.Run("reads user back by uuid and email", func(t *testing.T) {
+		byUUID, err := repo.ListUserByUUID(ctx, created.UUID)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if byUUID.Email != created.Email || !byUUID.CreatedAt.Equal(created.CreatedAt) {
+			t.Errorf("expected %v, got %v", created, byUUID)
+		}
+		if _, err := repo.ListUserByEmail(ctx, created.Email); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("rejects duplicated email", func(t *testing.T) {
+		_, err := repo.CreateUser(ctx, domain.UserInput{Name: "Other", Email: "john@example.com"})
+		if !errors.Is(err, domain.ErrEmailTaken) {
+			t.Errorf("expected domain.ErrEmailTaken, got %v", err)
+		}
+	})
+
+	t.Run("updates user", func(t *testing.T) {
+		created.Name = "Johnny"
+		updated, err := repo.UpdateUser(ctx, created)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if updated.Name != "Johnny" || updated.UpdatedAt.Before(created.UpdatedAt) {
+			t.Errorf("expected name and updated_at to change, got %v", updated)
+		}
+	})
+
+	t.Run("toggles is_active", func(t *testing.T) {
+		toggled, err := repo.ManageActivateUser(ctx, created.UUID, 0)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if toggled.IsActive {
+			t.Error("expected user to be deactivated")
+		}
+	})
+
+	t.Run("returns not found for unknown uuid", func(t *testing.T) {
+		if _, err := repo.ManageActivateUser(ctx, "missing", 0); !errors.Is(err, domain.ErrUserNotFound) {
+			t.Errorf("expected domain.ErrUserNotFound, got %v", err)
+		}
+		if _, err := repo.UpdateUser(ctx, domain.User{UUID: "missing"}); !errors.Is(err, domain.ErrUserNotFound) {
+			t.Errorf("expected domain.ErrUserNotFound, got %v", err)
+		}
+	})
+
+}
+
+type softDeleter interface {
+	CreateUser(context.Context, domain.UserInput) (domain.User, error)
+	ListUserByUUID(context.Context, string) (domain.User, error)
+	ListUserByUUIDWithDeleted(context.Context, string) (domain.User, error)
+	ListAllUsers(context.Context, domain.UserFilter) ([]domain.User, error)
+	DeleteUser(context.Context, string) error
+	RestoreUser(context.Context, string) (domain.User, error)
+	PurgeDeletedUsers(context.Context, time.Time) ([]domain.User, error)
+}
+
+func TestSoftDelete(t *testing.T) {
+	backends := map[string]func(*testing.T) softDeleter{
+		"memory": func(*testing.T) softDeleter { return NewMemoryUserRepository() },
+		"sqlite": func(t *testing.T) softDeleter { return newSQLiteUserRepository(t) },
+	}
+
+	for name, newRepo := range backends {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := newRepo(t)
+			user, _ := repo.CreateUser(ctx, domain.UserInput{Name: "John", Email: "john@example.com"})
+
+			if err := repo.DeleteUser(ctx, user.UUID); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if err := repo.DeleteUser(ctx, user.UUID); !errors.Is(err, domain.ErrUserNotFound) {
+				t.Errorf("expected deleting twice to be not found, got %v", err)
+			}
+			if err := repo.DeleteUser(ctx, "missing"); !errors.Is(err, domain.ErrUserNotFound) {
+				t.Errorf("expected domain.ErrUserNotFound, got %v", err)
+			}
+
+			if _, err := repo.ListUserByUUID(ctx, user.UUID); !errors.Is(err, domain.ErrUserNotFound) {
+				t.Errorf("expected deleted user to be hidden, got %v", err)
+			}
+			deleted, err := repo.ListUserByUUIDWithDeleted(ctx, user.UUID)
+			if err != nil || deleted.DeletedAt == nil {
+				t.Errorf("expected deleted user with deleted_at, got %v (err %v)", deleted, err)
+			}
+			if users, _ := repo.ListAllUsers(ctx, domain.UserFilter{}); len(users) != 0 {
+				t.Errorf("expected deleted user to be hidden from list, got %v", users)
+			}
+			if users, _ := repo.ListAllUsers(ctx, domain.UserFilter{IncludeDeleted: true}); len(users) != 1 {
+				t.Errorf("expected deleted user with include_deleted, got %v", users)
+			}
+
+			restored, err := repo.RestoreUser(ctx, user.UUID)
+			if err != nil || restored.DeletedAt != nil {
+				t.Fatalf("expected restored user, got %v (err %v)", restored, err)
+			}
+			if _, err := repo.RestoreUser(ctx, "missing"); !errors.Is(err, domain.ErrUserNotFound) {
+				t.Errorf("expected domain.ErrUserNotFound, got %v", err)
+			}
+
+			repo.DeleteUser(ctx, user.UUID)
+			if purged, _ := repo.PurgeDeletedUsers(ctx, time.Now().Add(-time.Hour)); len(purged) != 0 {
+				t.Errorf("expected recently deleted user to be kept, purged %v", purged)
+			}
+			if purged, _ := repo.PurgeDeletedUsers(ctx, time.Now().Add(time.Hour)); len(purged) != 1 || purged[0].UUID != user.UUID {
+				t.Errorf("expected the deleted user to be purged, got %v", purged)
+			}
+			if _, err := repo.ListUserByUUIDWithDeleted(ctx, user.UUID); !errors.Is(err, domain.ErrUserNotFound) {
+				t.Errorf("expected purged user to be gone, got %v", err)
+			}
+		})
+	}
+}
+
+type userLister interface {
+	CreateUser(context.Context, domain.UserInput) (domain.User, error)
+	ManageActivateUser(context.Context, string, int) (domain.User, error)
+	ListAllUsers(context.Context, domain.UserFilter) ([]domain.User, error)
+}
+
+func TestListAllUsers_Filters(t *testing.T) {
+	backends := map[string]func(*testing.T) userLister{
+		"memory": func(*testing.T) userLister { return NewMemoryUserRepository() },
+		"sqlite": func(t *testing.T) userLister { return newSQLiteUserRepository(t) },
+	}
+
+	for name, newRepo := range backends {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := newRepo(t)
+
+			start := time.Now().UTC()
+			var created []domain.User
+			for i, email := range []string{"ana@acme.com", "bob@acme.com", "carl@other.org", "dana@acme.com", "eve@other.org"} {
+				user, err := repo.CreateUser(ctx, domain.UserInput{Name: fmt.Sprintf("User %d %s", i, email[:3]), Email: email})
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				created = append(created, user)
+			}
+			repo.ManageActivateUser(ctx, created[1].UUID, 0)
+
+			t.Run("walks pages in order using the last row as cursor", func(t *testing.T) {
+				var seen []string
+				filter := domain.UserFilter{Limit: 2, Sort: "-email"}
+				for {
+					users, err := repo.ListAllUsers(ctx, filter)
+					if err != nil {
+						t.Fatalf("expected no error, got %v", err)
+					}
+					for _, u := range users {
+						seen = append(seen, u.Email)
+					}
+					if len(users) < filter.Limit {
+						break
+					}
+					last := users[len(users)-1]
+					filter.After = &domain.UserCursor{Value: last.SortValue("email"), UUID: last.UUID}
+				}
+
+				expected := []string{"eve@other.org", "dana@acme.com", "carl@other.org", "bob@acme.com", "ana@acme.com"}
+				if fmt.Sprint(seen) != fmt.Sprint(expected) {
+					t.Errorf("expected %v, got %v", expected, seen)
+				}
+			})
+
+			t.Run("filters by domain, status, name and creation time", func(t *testing.T) {
+				active := true
+				users, err := repo.ListAllUsers(ctx, domain.UserFilter{EmailDomain: "ACME.com", IsActive: &active})
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if len(users) != 2 || users[0].Email != "ana@acme.com" || users[1].Email != "dana@acme.com" {
+					t.Errorf("expected active acme users, got %v", users)
+				}
+
+				users, _ = repo.ListAllUsers(ctx, domain.UserFilter{Query: "CAR"})
+				if len(users) != 1 || users[0].Email != "carl@other.org" {
+					t.Errorf("expected name search to match carl, got %v", users)
+				}
+
+				users, _ = repo.ListAllUsers(ctx, domain.UserFilter{Query: "%"})
+				if len(users) != 0 {
+					t.Errorf("expected wildcard characters to be matched literally, got %v", users)
+				}
+
+				before := start.Add(-time.Minute)
+				users, _ = repo.ListAllUsers(ctx, domain.UserFilter{CreatedBefore: &before})
+				if len(users) != 0 {
+					t.Errorf("expected no users created before %v, got %v", before, users)
+				}
+			})
+		})
+	}
+}
+
+type versionedUpdater interface {
+	CreateUser(context.Context, domain.UserInput) (domain.User, error)
+	UpdateUser(context.Context, domain.User) (domain.User, error)
+	ManageActivateUser(context.Context, string, int) (domain.User, error)
+}
+
+func TestOptimisticConcurrency(t *testing.T) {
+	backends := map[string]func(*testing.T) versionedUpdater{
+		"memory": func(*testing.T) versionedUpdater { return NewMemoryUserRepository() },
+		"sqlite": func(t *testing.T) versionedUpdater { return newSQLiteUserRepository(t) },
+	}
+
+	for name, newRepo := range backends {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := newRepo(t)
+			user, _ := repo.CreateUser(ctx, domain.UserInput{Name: "John", Email: "john@example.com"})
+			if user.Version != 1 {
+				t.Fatalf("expected version 1, got %d", user.Version)
+			}
+
+			stale := user
+			user.Name = "Johnny"
+			updated, err := repo.UpdateUser(ctx, user)
+			if err != nil || updated.Version != 2 {
+				t.Fatalf("expected version 2, got %v (err %v)", updated, err)
+			}
+
+			stale.Name = "Jonathan"
+			if _, err := repo.UpdateUser(ctx, stale); !errors.Is(err, domain.ErrVersionMismatch) {
+				t.Errorf("expected domain.ErrVersionMismatch, got %v", err)
+			}
+			if _, err := repo.ManageActivateUser(ctx, user.UUID, 1); !errors.Is(err, domain.ErrVersionMismatch) {
+				t.Errorf("expected domain.ErrVersionMismatch, got %v", err)
+			}
+
+			toggled, err := repo.ManageActivateUser(ctx, user.UUID, 2)
+			if err != nil || toggled.Version != 3 || toggled.IsActive {
+				t.Errorf("expected inactive user at version 3, got %v (err %v)", toggled, err)
+			}
+		})
+	}
+}
+
+func TestTranslateError(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		expected error
+	}{
+		{"record not found", ksql.ErrRecordNotFound, domain.ErrUserNotFound},
+		{"email unique violation", &pgconn.PgError{Code: "23505", ConstraintName: "users_email_key"}, domain.ErrEmailTaken},
+		{"other unique violation", &pgconn.PgError{Code: "23505", ConstraintName: "users_pkey"}, domain.ErrConflict},
+		{"invalid uuid", &pgconn.PgError{Code: "22P02"}, domain.ErrInvalidInput},
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, domain.ErrConflict},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := translateError(fmt.Errorf("query failed: %w", c.err))
+			if !errors.Is(err, c.expected) {
+				t.Errorf("expected %v, got %v", c.expected, err)
+			}
+			if !errors.Is(err, c.err) {
+				t.Errorf("expected original error to be kept, got %v", err)
+			}
+		})
+	}
+
+	if err := translateError(nil); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+}
@@ -1,13 +1,519 @@
 package main
 
 import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"go-back/external/email"
+	"go-back/external/webhook"
+	"go-back/internal/auth"
+	config "go-back/internal/cmd/server"
+	"go-back/internal/domain"
 	"go-back/internal/http/handler"
+	"go-back/internal/http/middleware"
 	"go-back/internal/http/router"
+	"go-back/internal/queue"
+	"go-back/internal/service"
+	"go-back/internal/storage/cache"
+	"go-back/internal/storage/database"
+	"go-back/internal/storage/migration"
+	"go-back/internal/storage/repository"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/vingarcia/ksql"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate(os.Args[2:]); err != nil {
+			log.Fatalf("func=migrate err=%v", err)
+		}
+		return
+	}
+
+	slog.SetDefault(newLogger())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	store, closeStorage, err := newStorage(ctx)
+	if err != nil {
+		log.Fatalf("func=main err=%v", err)
+	}
+	defer closeStorage()
+
+	var redisClient *redis.Client
+	if config.RATE_LIMIT_STORE == "redis" || config.USER_CACHE == "redis" {
+		redisClient, err = newRedisClient()
+		if err != nil {
+			log.Fatalf("func=main err=%v", err)
+		}
+		defer redisClient.Close()
+	}
+
+	store.users, err = newUserCache(store.users, redisClient)
+	if err != nil {
+		log.Fatalf("func=main err=%v", err)
+	}
+
+	sender, err := newEmailSender()
+	if err != nil {
+		log.Fatalf("func=main err=%v", err)
+	}
+
+	if len(config.WEBHOOK_URLS) > 0 && config.WEBHOOK_SECRET == "" {
+		log.Fatal("func=main err=set WEBHOOK_SECRET to sign the webhooks")
+	}
+
+	jobs := queue.NewQueue(store.jobs, config.QUEUE_MAX_ATTEMPTS)
+	worker := queue.NewWorker(store.jobs, queue.WorkerConfig{
+		Concurrency:   config.QUEUE_CONCURRENCY,
+		PollInterval:  config.QUEUE_POLL_INTERVAL,
+		Lease:         config.QUEUE_LEASE,
+		RetryDelay:    config.QUEUE_RETRY_DELAY,
+		MaxRetryDelay: config.QUEUE_MAX_RETRY_DELAY,
+		DrainTimeout:  config.QUEUE_DRAIN_TIMEOUT,
+	})
+
+	verificationService := service.NewVerificationService(store.users, store.tokens, store.audit, store.transactor, jobs,
+		service.VerificationConfig{
+			TTL:            config.EMAIL_VERIFICATION_TTL,
+			ResendInterval: config.EMAIL_VERIFICATION_RESEND_INTERVAL,
+			URL:            config.EMAIL_VERIFICATION_URL,
+		})
+	webhookService := service.NewWebhookService(jobs, webhook.NewSender(config.WEBHOOK_SECRET, config.WEBHOOK_TIMEOUT), config.WEBHOOK_URLS)
+	queue.Handle(worker, service.JobSendEmail, sender.Send)
+	queue.Handle(worker, service.JobDeliverWebhook, webhookService.DeliverWebhook)
+
+	userService := service.NewUserService(store.users, store.audit, store.transactor, service.UserConfig{
+		Verifier: verificationService,
+		Sessions: store.sessions,
+		Webhooks: webhookService,
+		Roles:    store.roles,
+	})
+	expvar.Publish("user_reads", expvar.Func(func() any { return userService.ReadStats() }))
+	auditService := service.NewAuditService(store.audit)
+	mfaRoles, err := parseRoles(config.MFA_REQUIRED_ROLES)
+	if err != nil {
+		log.Fatalf("func=main err=%v", err)
+	}
+	roleService := service.NewRoleService(store.roles, store.users, store.audit, store.transactor, config.ADMIN_SUBJECTS, mfaRoles)
+	mfaService := service.NewMFAService(store.users, store.mfa, store.audit, store.transactor, service.MFAConfig{
+		TOTP:   newTOTP(),
+		Issuer: config.MFA_ISSUER,
+	})
+	sessionService := service.NewSessionService(store.sessions, store.audit, store.transactor)
+	apiKeyService := service.NewAPIKeyService(store.apiKeys, store.audit, store.transactor, service.APIKeyConfig{
+		TouchInterval: config.API_KEY_TOUCH_INTERVAL,
+	})
+	if config.USER_RETENTION > 0 {
+		if config.USER_PURGE_INTERVAL <= 0 {
+			log.Fatalf("func=main err=invalid USER_PURGE_INTERVAL %s: it must be positive", config.USER_PURGE_INTERVAL)
+		}
+		go userService.RunPurger(ctx, config.USER_RETENTION, config.USER_PURGE_INTERVAL)
+	}
+
+	verifier, err := newVerifier()
+	if err != nil {
+		log.Fatalf("func=main err=%v", err)
+	}
+
+	authService, err := newAuthService(store)
+	if err != nil {
+		log.Fatalf("func=main err=%v", err)
+	}
+
+	resetService := service.NewPasswordResetService(userService, authService, store.tokens, store.transactor, jobs,
+		service.PasswordResetConfig{
+			TTL:      config.PASSWORD_RESET_TTL,
+			Interval: config.PASSWORD_RESET_INTERVAL,
+			URL:      config.PASSWORD_RESET_URL,
+		})
+	queue.Handle(worker, service.JobPasswordReset, resetService.SendPasswordReset)
+
+	oidcService := service.NewOIDCService(userService, authService, newOIDCProvider(), service.OIDCConfig{
+		LoginTTL: config.OIDC_LOGIN_TTL,
+	})
+
+	rateLimits, err := newRateLimits(redisClient)
+	if err != nil {
+		log.Fatalf("func=main err=%v", err)
+	}
 
 	r := router.NewRouter()
-	handler.HandleRequests(r)
-	r.Run(":1111")
+	handler.HandleRequests(r, handler.Dependencies{
+		UserService:         userService,
+		AuditService:        auditService,
+		RoleService:         roleService,
+		AuthService:         authService,
+		MFAService:          mfaService,
+		SessionService:      sessionService,
+		APIKeyService:       apiKeyService,
+		OIDCService:         oidcService,
+		VerificationService: verificationService,
+		ResetService:        resetService,
+		Verifier:            verifier,
+		RateLimits:          rateLimits,
+	})
+
+	workerDone := make(chan struct{})
+	go func() {
+		defer close(workerDone)
+		worker.Run(ctx)
+	}()
+
+	server := &http.Server{Addr: ":1111", Handler: r}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("func=main err=%v", err)
+		}
+	}()
+
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("func=main err=%v", err)
+	}
+	// The worker stopped claiming jobs along with ctx; wait for the running
+	// ones before the storage closes.
+	<-workerDone
+}
+
+// newLogger writes JSON logs to stdout. Once it is the default logger, the
+// log package writes through it too.
+func newLogger() *slog.Logger {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(config.LOG_LEVEL)); err != nil {
+		level = slog.LevelInfo
+	}
+	return slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+}
+
+func newVerifier() (*auth.Verifier, error) {
+	keys, err := auth.NewKeySet(config.JWT_SECRET, config.JWT_JWKS_FILE, config.JWT_JWKS_REFRESH)
+	if err != nil {
+		return nil, fmt.Errorf("%w: set JWT_SECRET or JWT_JWKS_FILE", err)
+	}
+	return auth.NewVerifier(keys, auth.VerifierConfig{
+		Issuer:    config.JWT_ISSUER,
+		Audience:  config.JWT_AUDIENCE,
+		ClockSkew: config.JWT_CLOCK_SKEW,
+	}), nil
+}
+
+func newAuthService(store storage) (service.AuthService, error) {
+	var banned []string
+	if config.PASSWORD_BANNED_FILE != "" {
+		var err error
+		banned, err = auth.LoadBannedPasswords(config.PASSWORD_BANNED_FILE)
+		if err != nil {
+			return service.AuthService{}, err
+		}
+	}
+
+	hasher := auth.NewPasswordHasher(auth.Argon2Params{
+		Memory:      uint32(config.ARGON2_MEMORY),
+		Iterations:  uint32(config.ARGON2_ITERATIONS),
+		Parallelism: uint8(config.ARGON2_PARALLELISM),
+		SaltLength:  auth.DefaultArgon2Params.SaltLength,
+		KeyLength:   auth.DefaultArgon2Params.KeyLength,
+	})
+	policy := auth.NewPasswordPolicy(config.PASSWORD_MIN_LENGTH, config.PASSWORD_MAX_LENGTH, banned)
+
+	// Tokens are only issued with the HS256 secret; deployments verifying
+	// tokens of an external provider through JWKS have no login endpoint.
+	var issuer *auth.Issuer
+	if config.JWT_SECRET != "" {
+		var err error
+		issuer, err = auth.NewIssuer(config.JWT_SECRET, auth.IssuerConfig{
+			Issuer:   config.JWT_ISSUER,
+			Audience: config.JWT_AUDIENCE,
+			TTL:      config.JWT_TTL,
+		})
+		if err != nil {
+			return service.AuthService{}, err
+		}
+	}
+
+	return service.NewAuthService(store.users, store.credentials, store.mfa, store.tokens, store.sessions, store.audit, store.transactor, service.AuthConfig{
+		Hasher:               hasher,
+		Policy:               policy,
+		Issuer:               issuer,
+		RequireVerifiedEmail: config.REQUIRE_VERIFIED_EMAIL,
+		TOTP:                 newTOTP(),
+		MFAChallengeTTL:      config.MFA_CHALLENGE_TTL,
+		SessionTTL:           config.SESSION_TTL,
+		RefreshTokenTTL:      config.REFRESH_TOKEN_TTL,
+	})
+}
+
+// newRateLimits reads the limits of each policy and picks the store they
+// are counted in.
+func newRateLimits(redisClient *redis.Client) (handler.RateLimits, error) {
+	limits := handler.RateLimits{
+		APIKey: middleware.Limit{Requests: config.API_KEY_RATE_LIMIT, Period: time.Minute},
+	}
+	for _, setting := range []struct {
+		limit *middleware.Limit
+		value string
+	}{
+		{&limits.IP, config.RATE_LIMIT_IP},
+		{&limits.Login, config.RATE_LIMIT_LOGIN},
+		{&limits.Subject, config.RATE_LIMIT_USER},
+		{&limits.CreateUser, config.RATE_LIMIT_CREATE_USER},
+		{&limits.LookupUser, config.RATE_LIMIT_LOOKUP_USER},
+	} {
+		var err error
+		if *setting.limit, err = middleware.ParseLimit(setting.value); err != nil {
+			return handler.RateLimits{}, err
+		}
+	}
+
+	switch config.RATE_LIMIT_STORE {
+	case "memory":
+		limits.Store = middleware.NewMemoryRateLimitStore()
+		return limits, nil
+
+	case "redis":
+		limits.Store = middleware.NewRedisRateLimitStore(redisClient)
+		return limits, nil
+	}
+	return handler.RateLimits{}, fmt.Errorf("unknown RATE_LIMIT_STORE %q", config.RATE_LIMIT_STORE)
+}
+
+// newUserCache puts the cache selected by USER_CACHE in front of users.
+func newUserCache(users service.UserRepository, redisClient *redis.Client) (service.UserRepository, error) {
+	var store cache.Store
+	switch config.USER_CACHE {
+	case "":
+		return users, nil
+	case "memory":
+		store = cache.NewLRUStore(config.USER_CACHE_SIZE)
+	case "redis":
+		store = cache.NewRedisStore(redisClient)
+	default:
+		return nil, fmt.Errorf("unknown USER_CACHE %q", config.USER_CACHE)
+	}
+
+	// Reads that started before a write are done within their timeout, so
+	// holding the user back for twice as long keeps them from caching it.
+	return cache.NewUserRepository(users, store, cache.UserConfig{
+		TTL:  config.USER_CACHE_TTL,
+		Hold: 2 * config.DB_READ_TIMEOUT,
+	}), nil
+}
+
+func newRedisClient() (*redis.Client, error) {
+	options, err := redis.ParseURL(config.REDIS_URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	return redis.NewClient(options), nil
+}
+
+// newOIDCProvider returns nil unless an identity provider is configured.
+func newOIDCProvider() *auth.OIDCProvider {
+	if config.OIDC_ISSUER_URL == "" {
+		return nil
+	}
+	return auth.NewOIDCProvider(auth.OIDCConfig{
+		IssuerURL:    config.OIDC_ISSUER_URL,
+		ClientID:     config.OIDC_CLIENT_ID,
+		ClientSecret: config.OIDC_CLIENT_SECRET,
+		RedirectURL:  config.OIDC_REDIRECT_URL,
+		Scopes:       config.OIDC_SCOPES,
+		ClockSkew:    config.JWT_CLOCK_SKEW,
+	})
+}
+
+func newTOTP() auth.TOTP {
+	totp := auth.DefaultTOTP
+	totp.Skew = config.MFA_TOTP_SKEW
+	return totp
+}
+
+func parseRoles(names []string) ([]domain.Role, error) {
+	roles := make([]domain.Role, 0, len(names))
+	for _, name := range names {
+		role := domain.Role(name)
+		if !domain.AssignableRole(role) {
+			return nil, fmt.Errorf("unknown role %q", name)
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+func newEmailSender() (service.EmailSender, error) {
+	switch config.EMAIL_SENDER {
+	case "log":
+		return email.NewLogSender(slog.Default()), nil
+	case "file":
+		return email.NewFileSender(config.EMAIL_FILE, config.EMAIL_FROM), nil
+	case "smtp":
+		return email.NewSMTPSender(email.SMTPConfig{
+			Host:     config.SMTP_HOST,
+			Port:     config.SMTP_PORT,
+			Username: config.SMTP_USERNAME,
+			Password: config.SMTP_PASSWORD,
+			From:     config.EMAIL_FROM,
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown EMAIL_SENDER %q", config.EMAIL_SENDER)
+}
+
+func openDatabase(ctx context.Context) (ksql.DB, database.Dialect, error) {
+	switch config.STORAGE {
+	case "postgres":
+		db, err := database.NewPostgresDB(ctx)
+		return db, database.Postgres, err
+
+	case "sqlite":
+		db, err := database.NewSQLiteDB(ctx)
+		return db, database.SQLite, err
+
+	case "memory":
+		return ksql.DB{}, "", fmt.Errorf("the memory storage has no database")
+	}
+
+	return ksql.DB{}, "", fmt.Errorf("unknown STORAGE %q", config.STORAGE)
+}
+
+type storage struct {
+	users       service.UserRepository
+	audit       service.AuditRepository
+	roles       service.RoleRepository
+	credentials service.CredentialRepository
+	tokens      service.TokenRepository
+	mfa         service.MFARepository
+	sessions    service.SessionRepository
+	apiKeys     service.APIKeyRepository
+	jobs        queue.Store
+	transactor  service.Transactor
+}
+
+func newStorage(ctx context.Context) (storage, func(), error) {
+	if config.STORAGE == "memory" {
+		return storage{
+			users:       repository.NewMemoryUserRepository(),
+			audit:       repository.NewMemoryAuditRepository(),
+			roles:       repository.NewMemoryRoleRepository(),
+			credentials: repository.NewMemoryCredentialRepository(),
+			tokens:      repository.NewMemoryTokenRepository(),
+			mfa:         repository.NewMemoryMFARepository(),
+			sessions:    repository.NewMemorySessionRepository(),
+			apiKeys:     repository.NewMemoryAPIKeyRepository(),
+			jobs:        repository.NewMemoryJobRepository(),
+			transactor:  repository.NewMemoryTransactor(),
+		}, func() {}, nil
+	}
+
+	db, dialect, err := openDatabase(ctx)
+	if err != nil {
+		return storage{}, nil, err
+	}
+
+	timeouts := repository.QueryTimeouts{
+		Read:  config.DB_READ_TIMEOUT,
+		Write: config.DB_WRITE_TIMEOUT,
+	}
+	return storage{
+		users:       repository.NewUserRepository(db, timeouts),
+		audit:       repository.NewAuditRepository(db, timeouts),
+		roles:       repository.NewRoleRepository(db, timeouts),
+		credentials: repository.NewCredentialRepository(db, timeouts),
+		tokens:      repository.NewTokenRepository(db, dialect, timeouts),
+		mfa:         repository.NewMFARepository(db, timeouts),
+		sessions:    repository.NewSessionRepository(db, timeouts),
+		apiKeys:     repository.NewAPIKeyRepository(db, timeouts),
+		jobs:        repository.NewJobRepository(db, dialect, timeouts),
+		transactor:  database.NewTransactor(db),
+	}, func() { db.Close() }, nil
+}
+
+func migrate(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up|down [steps]|status|redo")
+	}
+
+	ctx := context.Background()
+	db, dialect, err := openDatabase(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migration.NewMigrator(db, dialect)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		// Migrations run in a single transaction, so when one fails none
+		// of them was applied.
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		for _, m := range applied {
+			fmt.Printf("applied  %04d_%s\n", m.Version, m.Name)
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+		return nil
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		return nil
+
+	case "redo":
+		m, err := migrator.Redo(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("redone   %04d_%s\n", m.Version, m.Name)
+		return nil
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, appliedAt)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown migrate command %q", args[0])
 }